@@ -0,0 +1,477 @@
+// lmdb-inspect reads a strfry LMDB directly, read-only, without running or
+// exec'ing into strfry. It works on the main relay's database as well as
+// the quarantine's, live or copied, since every command runs in a single
+// LMDB read transaction: a consistent snapshot that never blocks the
+// relay's writer.
+//
+//	lmdb-inspect count  --db DIR [--by kind|pubkey|day] [filter flags]
+//	lmdb-inspect dump   --db DIR [filter flags] > events.jsonl
+//	lmdb-inspect dicts  --db DIR
+//	lmdb-inspect verify --db DIR
+//
+// Filter flags (--id, --author, --kind, --since, --until, --limit) are
+// answered from strfry's indexes; see lmdbreader.StreamFilter.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"quarantine-rescuer/internal/lmdbreader"
+	"quarantine-rescuer/internal/verify"
+)
+
+// Build metadata, populated via -ldflags. See Makefile.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Built   = "unknown"
+)
+
+const usage = `usage: lmdb-inspect <command> --db DIR [flags]
+
+commands:
+  count    count events by kind, pubkey or UTC day
+  dump     write events as JSONL to stdout
+  dicts    show zstd compression dictionary usage
+  verify   check every payload decodes, parses and carries a valid id and signature
+  version  print build info
+
+Run lmdb-inspect <command> -h for the command's flags.
+`
+
+// errProblems is returned by verify when it found bad payloads; main maps
+// it to exit status 1 without logging it as a failure of the tool.
+var errProblems = errors.New("integrity problems found")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "count":
+		err = runCount(ctx, args, os.Stdout)
+	case "dump":
+		err = runDump(ctx, args, os.Stdout)
+	case "dicts":
+		err = runDicts(ctx, args, os.Stdout)
+	case "verify":
+		err = runVerify(ctx, args, os.Stdout)
+	case "version", "-version", "--version":
+		fmt.Printf("lmdb-inspect version=%s commit=%s built=%s\n", Version, Commit, Built)
+		return
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errProblems):
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stderr, "lmdb-inspect %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+// common holds the flags every command takes.
+type common struct {
+	db       string
+	mapSize  int64
+	logLevel string
+}
+
+func (c *common) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.db, "db", "", "strfry LMDB directory (the one holding data.mdb). Required.")
+	fs.Int64Var(&c.mapSize, "mapsize", lmdbreader.DefaultMapSize, "LMDB map size; must be at least strfry's dbParams.mapsize.")
+	fs.StringVar(&c.logLevel, "log-level", "warn", "Log level: debug, info, warn, error.")
+}
+
+// parse parses args into fs and checks the common flags.
+func (c *common) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if c.db == "" {
+		return errors.New("--db is required")
+	}
+	return nil
+}
+
+func (c *common) logger() *slog.Logger {
+	var lvl slog.Level
+	switch c.logLevel {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "info":
+		lvl = slog.LevelInfo
+	case "error":
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelWarn
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl}))
+}
+
+// filterFlags are the NIP-01 filter fields, as flags.
+type filterFlags struct {
+	ids, authors, kinds string
+	since, until        string
+	limit               int
+}
+
+func (ff *filterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&ff.ids, "id", "", "Comma-separated event ids (hex).")
+	fs.StringVar(&ff.authors, "author", "", "Comma-separated author pubkeys (hex).")
+	fs.StringVar(&ff.kinds, "kind", "", "Comma-separated kinds.")
+	fs.StringVar(&ff.since, "since", "", "Only events created at or after: unix seconds, YYYY-MM-DD (UTC) or RFC 3339.")
+	fs.StringVar(&ff.until, "until", "", "Only events created at or before; same formats as --since.")
+	fs.IntVar(&ff.limit, "limit", 0, "Only the newest N matching events. 0 = all, in index order.")
+}
+
+func (ff *filterFlags) filter() (lmdbreader.Filter, error) {
+	f := lmdbreader.Filter{IDs: splitList(ff.ids), Authors: splitList(ff.authors), Limit: ff.limit}
+	for _, s := range splitList(ff.kinds) {
+		k, err := strconv.Atoi(s)
+		if err != nil {
+			return f, fmt.Errorf("--kind: %q is not a number", s)
+		}
+		f.Kinds = append(f.Kinds, k)
+	}
+	var err error
+	if f.Since, err = parseTime(ff.since); err != nil {
+		return f, fmt.Errorf("--since: %w", err)
+	}
+	if f.Until, err = parseTime(ff.until); err != nil {
+		return f, fmt.Errorf("--until: %w", err)
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// parseTime parses a --since/--until value to unix seconds; "" is 0.
+func parseTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not unix seconds, YYYY-MM-DD or RFC 3339", s)
+}
+
+// stream opens a filtered event stream for a command's flags.
+func stream(ctx context.Context, c *common, ff *filterFlags) (<-chan lmdbreader.RawEvent, <-chan error, error) {
+	f, err := ff.filter()
+	if err != nil {
+		return nil, nil, err
+	}
+	events, errs := lmdbreader.StreamFilter(ctx, c.db, c.mapSize, f, c.logger())
+	return events, errs, nil
+}
+
+func runCount(ctx context.Context, args []string, w io.Writer) error {
+	var c common
+	var ff filterFlags
+	fs := flag.NewFlagSet("count", flag.ContinueOnError)
+	c.register(fs)
+	ff.register(fs)
+	by := fs.String("by", "kind", "Group by kind, pubkey or day (UTC).")
+	top := fs.Int("top", 0, "Print only the first N groups (with --by pubkey: the N most frequent). 0 = all.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	t, err := newTally(*by)
+	if err != nil {
+		return err
+	}
+
+	events, errs, err := stream(ctx, &c, &ff)
+	if err != nil {
+		return err
+	}
+	for ev := range events {
+		t.add(ev)
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+	return t.write(w, *top)
+}
+
+// tally counts events per group.
+type tally struct {
+	key    func(lmdbreader.RawEvent) string
+	less   func(a, b string) int // order of the printed groups
+	counts map[string]int
+	total  int
+}
+
+func newTally(by string) (*tally, error) {
+	t := &tally{counts: make(map[string]int)}
+	switch by {
+	case "kind":
+		t.key = func(ev lmdbreader.RawEvent) string { return strconv.Itoa(ev.Kind) }
+		t.less = func(a, b string) int {
+			x, _ := strconv.Atoi(a)
+			y, _ := strconv.Atoi(b)
+			return x - y
+		}
+	case "day":
+		t.key = func(ev lmdbreader.RawEvent) string { return time.Unix(ev.CreatedAt, 0).UTC().Format(time.DateOnly) }
+		t.less = strings.Compare
+	case "pubkey":
+		t.key = func(ev lmdbreader.RawEvent) string { return ev.PubKey }
+		t.less = func(a, b string) int {
+			if d := t.counts[b] - t.counts[a]; d != 0 {
+				return d
+			}
+			return strings.Compare(a, b)
+		}
+	default:
+		return nil, fmt.Errorf("--by: %q is not kind, pubkey or day", by)
+	}
+	return t, nil
+}
+
+func (t *tally) add(ev lmdbreader.RawEvent) {
+	t.counts[t.key(ev)]++
+	t.total++
+}
+
+// write prints one "group<TAB>count" line per group, then the total.
+func (t *tally) write(w io.Writer, top int) error {
+	keys := slices.SortedFunc(maps.Keys(t.counts), t.less)
+	if top > 0 && len(keys) > top {
+		keys = keys[:top]
+	}
+	bw := bufio.NewWriter(w)
+	for _, k := range keys {
+		fmt.Fprintf(bw, "%s\t%d\n", k, t.counts[k])
+	}
+	fmt.Fprintf(bw, "total\t%d\n", t.total)
+	return bw.Flush()
+}
+
+func runDump(ctx context.Context, args []string, w io.Writer) error {
+	var c common
+	var ff filterFlags
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	c.register(fs)
+	ff.register(fs)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	events, errs, err := stream(ctx, &c, &ff)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(w, 1<<20)
+	for ev := range events {
+		bw.Write(ev.Raw)
+		bw.WriteByte('\n')
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// dictStats is the payload usage of one dictionary, or of raw payloads.
+type dictStats struct {
+	dictSize int // -1: referenced but missing from CompressionDictionary
+	events   int
+	stored   int64
+	decoded  int64
+	errors   int
+}
+
+func runDicts(ctx context.Context, args []string, w io.Writer) error {
+	var c common
+	fs := flag.NewFlagSet("dicts", flag.ContinueOnError)
+	c.register(fs)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	logger := c.logger()
+
+	dicts, err := lmdbreader.Dictionaries(c.db, c.mapSize, logger)
+	if err != nil {
+		return err
+	}
+	byDict := make(map[uint32]*dictStats, len(dicts))
+	for _, d := range dicts {
+		byDict[d.ID] = &dictStats{dictSize: d.Size}
+	}
+	var raw dictStats
+	err = lmdbreader.WalkPayloads(ctx, c.db, c.mapSize, logger, func(p lmdbreader.Payload) error {
+		s := &raw
+		if p.Compressed {
+			if s = byDict[p.DictID]; s == nil {
+				s = &dictStats{dictSize: -1}
+				byDict[p.DictID] = s
+			}
+		}
+		s.events++
+		s.stored += int64(p.Size)
+		js, err := p.Decode()
+		if err != nil {
+			s.errors++
+			return nil
+		}
+		s.decoded += int64(len(js))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "dict\tdict_bytes\tevents\tstored_bytes\tdecoded_bytes\tratio\terrors\t")
+	row := func(name, size string, s *dictStats) {
+		ratio := "-"
+		if s.stored > 0 {
+			ratio = fmt.Sprintf("%.2f", float64(s.decoded)/float64(s.stored))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%d\t\n", name, size, s.events, s.stored, s.decoded, ratio, s.errors)
+	}
+	row("raw", "-", &raw)
+	for _, id := range slices.Sorted(maps.Keys(byDict)) {
+		s := byDict[id]
+		size := strconv.Itoa(s.dictSize)
+		if s.dictSize < 0 {
+			size = "missing"
+		}
+		row(strconv.FormatUint(uint64(id), 10), size, s)
+	}
+	return tw.Flush()
+}
+
+// verifyBatch is how many events are signature-checked at once, across
+// all CPUs.
+const verifyBatch = 4096
+
+// Integrity problem reasons, alongside verify.ReasonInvalidID and
+// verify.ReasonInvalidSignature.
+const (
+	reasonUndecodable = "undecodable"
+	reasonUnparseable = "unparseable"
+)
+
+func runVerify(ctx context.Context, args []string, w io.Writer) error {
+	var c common
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	c.register(fs)
+	maxProblems := fs.Int("max-problems", 100, "Print at most N problem lines; all are counted. 0 = none.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	counts := make(map[string]int)
+	payloads, printed := 0, 0
+	problem := func(levID uint64, id, reason string, err error) {
+		counts[reason]++
+		if printed < *maxProblems {
+			printed++
+			fmt.Fprintf(bw, "%d\t%s\t%s\t%v\n", levID, id, reason, err)
+		}
+	}
+
+	var evts []*nostr.Event
+	var levIDs []uint64
+	flush := func() {
+		for i, err := range verify.Batch(evts) {
+			if err != nil {
+				problem(levIDs[i], evts[i].ID, verify.Reason(err), err)
+			}
+		}
+		evts, levIDs = evts[:0], levIDs[:0]
+	}
+
+	err := lmdbreader.WalkPayloads(ctx, c.db, c.mapSize, c.logger(), func(p lmdbreader.Payload) error {
+		payloads++
+		js, err := p.Decode()
+		if err != nil {
+			problem(p.LevID, "", reasonUndecodable, err)
+			return nil
+		}
+		var evt nostr.Event
+		if err := json.Unmarshal(js, &evt); err != nil {
+			problem(p.LevID, "", reasonUnparseable, err)
+			return nil
+		}
+		evts = append(evts, &evt)
+		levIDs = append(levIDs, p.LevID)
+		if len(evts) == verifyBatch {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	flush()
+
+	bad := 0
+	for _, n := range counts {
+		bad += n
+	}
+	fmt.Fprintf(bw, "payloads\t%d\nok\t%d\n", payloads, payloads-bad)
+	for _, reason := range []string{reasonUndecodable, reasonUnparseable, verify.ReasonInvalidID, verify.ReasonInvalidSignature} {
+		fmt.Fprintf(bw, "%s\t%d\n", reason, counts[reason])
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if bad > 0 {
+		return errProblems
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+	"github.com/nbd-wtf/go-nostr"
+
+	"quarantine-rescuer/internal/lmdbreader"
+)
+
+// buildPayloads writes an EventPayload table holding payloads, keyed by
+// levId from 1, the way strfry names it.
+func buildPayloads(t *testing.T, payloads ...[]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	if err := env.SetMaxDBs(lmdbreader.MaxDBs); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetMapSize(64 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Open(dir, 0, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = env.Update(func(txn *lmdb.Txn) error {
+		dbi, err := txn.OpenDBI("rasgueadb_defaultDb__EventPayload", lmdb.Create|lmdb.IntegerKey)
+		if err != nil {
+			return err
+		}
+		for i, p := range payloads {
+			if err := txn.Put(dbi, binary.NativeEndian.AppendUint64(nil, uint64(i+1)), p, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func signedPayload(t *testing.T, content string) ([]byte, *nostr.Event) {
+	t.Helper()
+	evt := &nostr.Event{Kind: 1, Content: content, CreatedAt: 1700000000, Tags: nostr.Tags{}}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{0x00}, evt.String()...), evt
+}
+
+func TestVerify(t *testing.T) {
+	good, _ := signedPayload(t, "hello")
+	_, evt := signedPayload(t, "original")
+	evt.Content = "tampered"
+	forged := append([]byte{0x00}, evt.String()...)
+
+	dir := buildPayloads(t, good, forged, []byte{0x00, '{'}, []byte{0x07})
+
+	var out bytes.Buffer
+	err := runVerify(context.Background(), []string{"--db", dir}, &out)
+	if !errors.Is(err, errProblems) {
+		t.Fatalf("err = %v, want errProblems", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"payloads\t4\n", "ok\t1\n", "undecodable\t1\n", "unparseable\t1\n", "invalid_id\t1\n", "invalid_signature\t0\n",
+		"2\t" + evt.ID + "\tinvalid_id\t",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+
+	out.Reset()
+	if err := runVerify(context.Background(), []string{"--db", buildPayloads(t, good)}, &out); err != nil {
+		t.Fatalf("clean database: %v\n%s", err, out.String())
+	}
+}
+
+func TestDicts(t *testing.T) {
+	good, _ := signedPayload(t, "hello")
+	zstd := append([]byte{0x01}, binary.NativeEndian.AppendUint32(nil, 9)...)
+	dir := buildPayloads(t, good, append(zstd, "garbage"...))
+
+	var out bytes.Buffer
+	if err := runDicts(context.Background(), []string{"--db", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want a header, raw and dict 9 rows:\n%s", out.String())
+	}
+	if f := strings.Fields(lines[1]); f[0] != "raw" || f[2] != "1" || f[5] != "1.00" || f[6] != "0" {
+		t.Errorf("raw row = %q", lines[1])
+	}
+	if f := strings.Fields(lines[2]); f[0] != "9" || f[1] != "missing" || f[2] != "1" || f[6] != "1" {
+		t.Errorf("dict row = %q", lines[2])
+	}
+}
+
+func TestTally(t *testing.T) {
+	evs := []lmdbreader.RawEvent{
+		{PubKey: "b", Kind: 10, CreatedAt: 86400},
+		{PubKey: "a", Kind: 2, CreatedAt: 0},
+		{PubKey: "b", Kind: 2, CreatedAt: 100},
+	}
+	for _, tt := range []struct {
+		by   string
+		top  int
+		want string
+	}{
+		{"kind", 0, "2\t2\n10\t1\ntotal\t3\n"},
+		{"day", 0, "1970-01-01\t2\n1970-01-02\t1\ntotal\t3\n"},
+		{"pubkey", 1, "b\t2\ntotal\t3\n"},
+	} {
+		tl, err := newTally(tt.by)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range evs {
+			tl.add(ev)
+		}
+		var out bytes.Buffer
+		if err := tl.write(&out, tt.top); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("--by %s: got %q, want %q", tt.by, out.String(), tt.want)
+		}
+	}
+	if _, err := newTally("relay"); err == nil {
+		t.Error("unknown --by accepted")
+	}
+}
+
+func TestFilterFlags(t *testing.T) {
+	ff := filterFlags{authors: "aa, bb", kinds: "1,3", since: "2024-01-02", until: "1700000000", limit: 5}
+	f, err := ff.filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix()
+	if len(f.Authors) != 2 || f.Authors[1] != "bb" || len(f.Kinds) != 2 || f.Since != since || f.Until != 1700000000 || f.Limit != 5 {
+		t.Fatalf("filter = %+v", f)
+	}
+	for _, bad := range []filterFlags{{kinds: "one"}, {since: "yesterday"}} {
+		if _, err := bad.filter(); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
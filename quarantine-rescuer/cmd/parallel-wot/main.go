@@ -0,0 +1,184 @@
+// parallel-wot looks for parallel webs of trust in the quarantine: follow
+// clusters among quarantined pubkeys that the crawler's seed never
+// reached. It reads every kind 3 in the quarantine LMDB (read-only, like
+// lmdb-inspect), builds their follow graph, and measures each dense
+// cluster's edges into the trusted graph in Dgraph; see internal/pwot.
+//
+// The JSON report goes to stdout or --out. Communities in it list seed
+// candidates; sybil clusters are leads for quarantine-review's reject.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"quarantine-rescuer/internal/envfile"
+	"quarantine-rescuer/internal/lmdbreader"
+	"quarantine-rescuer/internal/pwot"
+	"quarantine-rescuer/internal/wot"
+)
+
+// Build metadata, populated via -ldflags. See Makefile.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Built   = "unknown"
+)
+
+type flags struct {
+	db           string
+	envFile      string
+	mapSize      int64
+	dgraph       string
+	core         int
+	minSize      int
+	minReached   int
+	sybilDensity float64
+	members      bool
+	out          string
+	logLevel     string
+	showVersion  bool
+}
+
+func parseFlags() *flags {
+	f := &flags{}
+	flag.StringVar(&f.db, "db", "", "Quarantine LMDB directory. Empty = "+envfile.EnvVar+" from the environment or --env-file, else "+envfile.DefaultPath+".")
+	flag.StringVar(&f.envFile, "env-file", ".env", "The deepfry .env file to read "+envfile.EnvVar+" from.")
+	flag.Int64Var(&f.mapSize, "mapsize", lmdbreader.DefaultMapSize, "LMDB map size; must be at least strfry's dbParams.mapsize.")
+	flag.StringVar(&f.dgraph, "dgraph", "http://localhost:8080", "Dgraph alpha URL holding the trusted graph (trust_distance from clusterscan --write-scores).")
+	flag.IntVar(&f.core, "core", pwot.DefaultCore, "Keep only pubkeys linked to at least this many others in the quarantine (the k-core) before clustering.")
+	flag.IntVar(&f.minSize, "min-size", pwot.DefaultMinSize, "Smallest cluster to report.")
+	flag.IntVar(&f.minReached, "min-reached", pwot.DefaultMinReached, "Members followed by a trusted account for a cluster to count as a community.")
+	flag.Float64Var(&f.sybilDensity, "sybil-density", pwot.DefaultSybilDensity, "Follow density from which a cluster no trusted account follows counts as a sybil farm.")
+	flag.BoolVar(&f.members, "members", false, "List every cluster member in the report.")
+	flag.StringVar(&f.out, "out", "", "Write the JSON report here. Empty = stdout.")
+	flag.StringVar(&f.logLevel, "log-level", "info", "Log level: debug, info, warn, error.")
+	flag.BoolVar(&f.showVersion, "version", false, "Print version and exit.")
+	flag.Parse()
+	return f
+}
+
+func newLogger(level string) *slog.Logger {
+	var lvl slog.Level
+	switch level {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "warn":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl}))
+}
+
+func main() {
+	f := parseFlags()
+	if f.showVersion {
+		fmt.Printf("parallel-wot version=%s commit=%s built=%s\n", Version, Commit, Built)
+		return
+	}
+
+	logger := newLogger(f.logLevel)
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, f, logger); err != nil {
+		logger.Error("parallel-wot failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, f *flags, logger *slog.Logger) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	db, src, err := envfile.Resolve(f.db, f.envFile, wd)
+	if err != nil {
+		return err
+	}
+	logger.Info("quarantine LMDB", "path", db, "source", src)
+
+	start := time.Now()
+	g, err := readGraph(ctx, db, f.mapSize, logger)
+	if err != nil {
+		return err
+	}
+
+	opts := pwot.Options{
+		Core:         f.core,
+		MinSize:      f.minSize,
+		MinReached:   f.minReached,
+		SybilDensity: f.sybilDensity,
+		Members:      f.members,
+	}
+	rep, err := pwot.Analyze(ctx, g, wot.NewClient(f.dgraph, 30*time.Second, logger), opts, logger)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if f.out != "" {
+		file, err := os.Create(f.out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	verdicts := make(map[string]int)
+	for _, c := range rep.Clusters {
+		verdicts[c.Verdict]++
+	}
+	logger.Info("parallel-wot summary",
+		"authors", rep.Authors,
+		"trusted_authors", rep.TrustedAuthors,
+		"edges", rep.Edges,
+		"clusters", len(rep.Clusters),
+		"communities", verdicts[pwot.VerdictCommunity],
+		"sybil", verdicts[pwot.VerdictSybil],
+		"unclear", verdicts[pwot.VerdictUnclear],
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+// readGraph loads every kind 3 in the LMDB into a follow graph.
+func readGraph(ctx context.Context, db string, mapSize int64, logger *slog.Logger) (*pwot.Graph, error) {
+	g := pwot.NewGraph()
+	events, errs := lmdbreader.StreamFilter(ctx, db, mapSize, lmdbreader.Filter{Kinds: []int{3}}, logger)
+	lists, bad := 0, 0
+	for ev := range events {
+		follows, err := pwot.ParseFollows(ev.Raw)
+		if err != nil {
+			bad++
+			logger.Debug("unparseable follow list", "id", ev.ID, "err", err)
+			continue
+		}
+		g.Add(ev.PubKey, ev.CreatedAt, follows)
+		lists++
+	}
+	if err := <-errs; err != nil {
+		return nil, fmt.Errorf("read follow lists: %w", err)
+	}
+	logger.Info("follow lists read", "lists", lists, "unparseable", bad, "authors", len(g.Authors()), "edges", g.Edges())
+	return g, nil
+}
@@ -0,0 +1,216 @@
+// quarantine-gc enforces a retention policy on the quarantine relay: by
+// age, by event count per pubkey and by a total payload byte budget (see
+// internal/gc for how the rules combine). It picks victims from the
+// quarantine LMDB's indexes, read-only, and deletes them oldest first
+// through `docker exec … strfry delete`, like quarantine-rescue. Run it
+// with --dry-run to see what a policy would remove.
+//
+// LMDB never gives pages back to the filesystem: deleted events free space
+// for new ones, but data.mdb only shrinks with an offline `strfry compact`.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"quarantine-rescuer/internal/deleter"
+	"quarantine-rescuer/internal/envfile"
+	"quarantine-rescuer/internal/gc"
+	"quarantine-rescuer/internal/lmdbreader"
+	"quarantine-rescuer/internal/runner"
+)
+
+// Build metadata, populated via -ldflags. See Makefile.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Built   = "unknown"
+)
+
+type flags struct {
+	db                   string
+	envFile              string
+	mapSize              int64
+	maxAge               time.Duration
+	maxPerPubkey         int
+	maxBytes             string
+	dryRun               bool
+	batchSize            int
+	quarantineContainer  string
+	quarantineConfigPath string
+	logLevel             string
+	showVersion          bool
+}
+
+func parseFlags() *flags {
+	f := &flags{}
+	flag.StringVar(&f.db, "db", "", "Quarantine LMDB directory. Empty = "+envfile.EnvVar+" from the environment or --env-file, else "+envfile.DefaultPath+".")
+	flag.StringVar(&f.envFile, "env-file", ".env", "The deepfry .env file to read "+envfile.EnvVar+" from.")
+	flag.Int64Var(&f.mapSize, "mapsize", lmdbreader.DefaultMapSize, "LMDB map size; must be at least strfry's dbParams.mapsize.")
+	flag.DurationVar(&f.maxAge, "max-age", 0, "Delete events whose created_at is older than this, e.g. 720h. 0 = no age limit.")
+	flag.IntVar(&f.maxPerPubkey, "max-per-pubkey", 0, "Keep at most this many events per pubkey, the newest. 0 = no limit.")
+	flag.StringVar(&f.maxBytes, "max-bytes", "", "Byte budget for stored event payloads, e.g. 20GiB; the oldest events go until it is met. Empty = no budget.")
+	flag.BoolVar(&f.dryRun, "dry-run", false, "Report what the policy would delete without deleting.")
+	flag.IntVar(&f.batchSize, "batch-size", deleter.DefaultBatchSize, "Number of event ids per strfry delete invocation.")
+	flag.StringVar(&f.quarantineContainer, "quarantine-container", "strfry-quarantine", "Docker container name running the quarantine StrFry instance.")
+	flag.StringVar(&f.quarantineConfigPath, "quarantine-config", "/etc/strfry.conf", "Path to strfry.conf inside the quarantine container.")
+	flag.StringVar(&f.logLevel, "log-level", "info", "Log level: debug, info, warn, error.")
+	flag.BoolVar(&f.showVersion, "version", false, "Print version and exit.")
+	flag.Parse()
+	return f
+}
+
+func newLogger(level string) *slog.Logger {
+	var lvl slog.Level
+	switch level {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "warn":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl}))
+}
+
+func main() {
+	f := parseFlags()
+	if f.showVersion {
+		fmt.Printf("quarantine-gc version=%s commit=%s built=%s\n", Version, Commit, Built)
+		return
+	}
+
+	logger := newLogger(f.logLevel)
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, f, logger); err != nil {
+		logger.Error("gc failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, f *flags, logger *slog.Logger) error {
+	policy := gc.Policy{MaxAge: f.maxAge, MaxPerPubkey: f.maxPerPubkey}
+	if f.maxBytes != "" {
+		n, err := parseBytes(f.maxBytes)
+		if err != nil {
+			return fmt.Errorf("--max-bytes: %w", err)
+		}
+		policy.MaxBytes = n
+	}
+	if !policy.Enabled() {
+		return errors.New("no retention rule set; use --max-age, --max-per-pubkey or --max-bytes")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	db, src, err := envfile.Resolve(f.db, f.envFile, wd)
+	if err != nil {
+		return err
+	}
+	logger.Info("quarantine LMDB", "path", db, "source", src)
+
+	start := time.Now()
+	planner := gc.NewPlanner(policy, start)
+	if err := lmdbreader.Entries(ctx, db, f.mapSize, logger, func(e lmdbreader.Entry) error {
+		planner.Add(e)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("read entries: %w", err)
+	}
+	plan := planner.Plan()
+
+	attrs := []any{
+		"dry_run", f.dryRun,
+		"events", plan.Total.Events, "payload_bytes", plan.Total.Bytes,
+		"kept_events", plan.Kept.Events, "kept_bytes", plan.Kept.Bytes,
+		"victims", len(plan.Victims),
+	}
+	for _, rule := range []string{gc.RuleAge, gc.RulePubkeyCount, gc.RuleBytes} {
+		if t, ok := plan.ByRule[rule]; ok {
+			attrs = append(attrs, rule+"_events", t.Events, rule+"_bytes", t.Bytes)
+		}
+	}
+	// data.mdb also holds indexes and free pages; the gap to payload_bytes
+	// is what a compaction could win back.
+	if fi, err := os.Stat(filepath.Join(db, "data.mdb")); err == nil {
+		attrs = append(attrs, "data_mdb_bytes", fi.Size())
+	}
+	attrs = append(attrs, "top_pubkeys", plan.TopPubkeys, "duration_ms", time.Since(start).Milliseconds())
+	logger.Info("gc plan", attrs...)
+
+	if f.dryRun || len(plan.Victims) == 0 {
+		return nil
+	}
+
+	idByLev, err := lmdbreader.IDs(ctx, db, f.mapSize, logger, plan.Victims)
+	if err != nil {
+		return fmt.Errorf("resolve ids: %w", err)
+	}
+	ids := make([]string, 0, len(idByLev))
+	for _, lev := range plan.Victims {
+		if id, ok := idByLev[lev]; ok {
+			ids = append(ids, id)
+		}
+	}
+	if missing := len(plan.Victims) - len(ids); missing > 0 {
+		// Deleted since the plan was read, by the rescuer or strfry itself.
+		logger.Info("victims already gone", "count", missing)
+	}
+
+	del := deleter.New(runner.Exec{}, f.quarantineContainer, f.quarantineConfigPath, f.batchSize, logger)
+	res := del.DeleteByIDs(ctx, ids)
+	logger.Info("gc summary",
+		"deleted", len(res.Deleted),
+		"failed", len(res.Failed),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(res.Failed) > 0 {
+		return fmt.Errorf("%d of %d deletes failed", len(res.Failed), len(ids))
+	}
+	return nil
+}
+
+// parseBytes reads a byte count with an optional unit: B, KB/MB/GB/TB
+// (powers of 1000) or KiB/MiB/GiB/TiB (powers of 1024), e.g. "20GiB".
+func parseBytes(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	i := strings.IndexFunc(num, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	unit := ""
+	if i >= 0 {
+		num, unit = strings.TrimSpace(num[:i]), strings.TrimSpace(num[i:])
+	}
+	mult, ok := map[string]float64{
+		"": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+	}[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q in %q", unit, s)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return int64(v * mult), nil
+}
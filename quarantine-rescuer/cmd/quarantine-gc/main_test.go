@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	for in, want := range map[string]int64{
+		"1024":    1024,
+		"512B":    512,
+		"20GiB":   20 << 30,
+		"1.5 MiB": 3 << 19,
+		"2GB":     2e9,
+	} {
+		if got, err := parseBytes(in); err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "GiB", "10 parsecs", "-1GiB"} {
+		if _, err := parseBytes(in); err == nil {
+			t.Errorf("parseBytes(%q) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"quarantine-rescuer/internal/whitelist"
+)
+
+// Daemon mode defaults.
+const (
+	DefaultScanBatch    = 100
+	DefaultFullInterval = 6 * time.Hour
+)
+
+// retryDelay is how long a failed pass waits before it is retried.
+const retryDelay = 30 * time.Second
+
+// changeSource is the whitelist change stream. Implemented by
+// *whitelist.Subscriber.
+type changeSource interface {
+	Run(ctx context.Context, since uint64, fn func(whitelist.Change)) error
+}
+
+// passRunner runs rescue passes. Implemented by *rescuer.
+type passRunner interface {
+	fullPass(ctx context.Context) error
+	pubkeyPass(ctx context.Context, pubkeys []string) error
+}
+
+// pending is the rescue work the change stream has announced and no pass has
+// done yet. The stream callback only records work, so a slow pass never
+// stalls the stream, and changes arriving during a pass are merged into the
+// next one.
+type pending struct {
+	mu      sync.Mutex
+	full    bool
+	pubkeys map[string]struct{}
+	wake    chan struct{}
+}
+
+func newPending() *pending {
+	return &pending{pubkeys: make(map[string]struct{}), wake: make(chan struct{}, 1)}
+}
+
+// onChange records one whitelist change. A resync (always the first message,
+// since the daemon holds no generation) asks for a full pass: the server
+// cannot say which pubkeys were added while the daemon was not listening.
+// A pubkey removed before its pass ran is not rescued.
+func (p *pending) onChange(ch whitelist.Change) {
+	p.mu.Lock()
+	if ch.Resync {
+		p.full = true
+	}
+	for _, pk := range ch.Added {
+		p.pubkeys[pk] = struct{}{}
+	}
+	for _, pk := range ch.Removed {
+		delete(p.pubkeys, pk)
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+// requestFull asks for a full pass.
+func (p *pending) requestFull() {
+	p.mu.Lock()
+	p.full = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+// requeue puts back the work of a failed pass.
+func (p *pending) requeue(full bool, pubkeys []string) {
+	p.mu.Lock()
+	p.full = p.full || full
+	for _, pk := range pubkeys {
+		p.pubkeys[pk] = struct{}{}
+	}
+	p.mu.Unlock()
+}
+
+func (p *pending) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the pending work. A full pass covers every pubkey,
+// so pubkeys is empty when full is set.
+func (p *pending) take() (full bool, pubkeys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	full = p.full
+	if !full {
+		pubkeys = slices.Sorted(maps.Keys(p.pubkeys))
+	}
+	p.full = false
+	clear(p.pubkeys)
+	return full, pubkeys
+}
+
+// runDaemon follows the whitelist change stream and runs a pass whenever it
+// announces work, plus a full pass every --full-interval, until ctx is
+// cancelled. Cancellation is a clean stop. It fails if the whitelist server
+// has no change stream.
+func runDaemon(ctx context.Context, rs *rescuer, changes changeSource) error {
+	return daemonLoop(ctx, rs, changes, rs.f.fullInterval, retryDelay, rs.logger)
+}
+
+func daemonLoop(ctx context.Context, rs passRunner, changes changeSource, fullInterval, retry time.Duration, logger *slog.Logger) error {
+	p := newPending()
+	streamErr := make(chan error, 1)
+	go func() { streamErr <- changes.Run(ctx, 0, p.onChange) }()
+
+	var fullTick <-chan time.Time
+	if fullInterval > 0 {
+		t := time.NewTicker(fullInterval)
+		defer t.Stop()
+		fullTick = t.C
+	}
+	logger.Info("daemon started; following whitelist changes", "full_interval", fullInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("daemon stopping")
+			return nil
+		case err := <-streamErr:
+			if ctx.Err() != nil {
+				logger.Info("daemon stopping")
+				return nil
+			}
+			if errors.Is(err, whitelist.ErrChangesUnsupported) {
+				return fmt.Errorf("daemon mode needs the whitelist server's change stream: %w", err)
+			}
+			return err
+		case <-fullTick:
+			p.requestFull()
+			continue
+		case <-p.wake:
+		}
+
+		full, pubkeys := p.take()
+		var err error
+		switch {
+		case full:
+			logger.Info("daemon: full pass")
+			err = rs.fullPass(ctx)
+		case len(pubkeys) > 0:
+			logger.Info("daemon: rescuing newly whitelisted pubkeys", "pubkeys", len(pubkeys))
+			err = rs.pubkeyPass(ctx, pubkeys)
+		default:
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Error("rescue pass failed; retrying", "err", err, "retry_in", retry)
+			p.requeue(full, pubkeys)
+			time.AfterFunc(retry, p.signal)
+		}
+	}
+}
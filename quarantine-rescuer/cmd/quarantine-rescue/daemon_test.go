@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"quarantine-rescuer/internal/whitelist"
+)
+
+// fakeChanges delivers a fixed list of changes, then blocks until cancelled.
+type fakeChanges struct {
+	changes []whitelist.Change
+	err     error
+}
+
+func (f fakeChanges) Run(ctx context.Context, since uint64, fn func(whitelist.Change)) error {
+	for _, ch := range f.changes {
+		fn(ch)
+	}
+	if f.err != nil {
+		return f.err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// fakePasses records the passes run and fails the first n of them.
+type fakePasses struct {
+	mu    sync.Mutex
+	calls []string
+	fail  int
+	done  chan struct{}
+	want  int
+}
+
+func (f *fakePasses) record(call string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	if len(f.calls) == f.want {
+		close(f.done)
+	}
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("scan failed")
+	}
+	return nil
+}
+
+func (f *fakePasses) fullPass(ctx context.Context) error { return f.record("full") }
+
+func (f *fakePasses) pubkeyPass(ctx context.Context, pubkeys []string) error {
+	return f.record(fmt.Sprint(pubkeys))
+}
+
+func silentLogger() *slog.Logger { return slog.New(slog.NewTextHandler(io.Discard, nil)) }
+
+func runUntil(t *testing.T, passes *fakePasses, changes fakeChanges, fullInterval, retry time.Duration) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- daemonLoop(ctx, passes, changes, fullInterval, retry, silentLogger()) }()
+	select {
+	case <-passes.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out; passes so far: %v", passes.calls)
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("daemon returned %v on cancel", err)
+	}
+	passes.mu.Lock()
+	defer passes.mu.Unlock()
+	return passes.calls
+}
+
+func TestDaemon_ResyncThenAddedPubkeys(t *testing.T) {
+	// The first message is a resync, answered with a full pass. A later delta
+	// gets a pubkey pass over what it added, less what it removed.
+	changes := make(chan whitelist.Change)
+	passes := &fakePasses{done: make(chan struct{}), want: 2}
+	src := funcChanges(func(ctx context.Context, fn func(whitelist.Change)) error {
+		fn(whitelist.Change{Resync: true, Generation: 5})
+		for ch := range changes {
+			fn(ch)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- daemonLoop(ctx, passes, src, 0, time.Hour, silentLogger()) }()
+
+	waitCalls(t, passes, 1)
+	changes <- whitelist.Change{Since: 5, Generation: 6, Added: []string{"bb", "aa", "cc"}, Removed: []string{"cc"}}
+	close(changes)
+	<-passes.done
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("daemon returned %v on cancel", err)
+	}
+	if got := strings.Join(passes.calls, " "); got != "full [aa bb]" {
+		t.Fatalf("passes = %q, want full then [aa bb]", got)
+	}
+}
+
+func TestDaemon_RetriesFailedPass(t *testing.T) {
+	passes := &fakePasses{done: make(chan struct{}), want: 2, fail: 1}
+	calls := runUntil(t, passes, fakeChanges{changes: []whitelist.Change{
+		{Since: 1, Generation: 2, Added: []string{"aa"}},
+	}}, 0, time.Millisecond)
+	if strings.Join(calls, " ") != "[aa] [aa]" {
+		t.Fatalf("passes = %v, want the failed pubkey pass retried", calls)
+	}
+}
+
+func TestDaemon_PeriodicFullPass(t *testing.T) {
+	passes := &fakePasses{done: make(chan struct{}), want: 2}
+	calls := runUntil(t, passes, fakeChanges{}, 10*time.Millisecond, time.Hour)
+	if strings.Join(calls, " ") != "full full" {
+		t.Fatalf("passes = %v", calls)
+	}
+}
+
+func TestDaemon_NeedsChangeStream(t *testing.T) {
+	err := daemonLoop(context.Background(), &fakePasses{}, fakeChanges{err: whitelist.ErrChangesUnsupported}, 0, time.Hour, silentLogger())
+	if !errors.Is(err, whitelist.ErrChangesUnsupported) {
+		t.Fatalf("err = %v, want ErrChangesUnsupported", err)
+	}
+}
+
+type funcChanges func(ctx context.Context, fn func(whitelist.Change)) error
+
+func (f funcChanges) Run(ctx context.Context, since uint64, fn func(whitelist.Change)) error {
+	return f(ctx, fn)
+}
+
+func waitCalls(t *testing.T, f *fakePasses, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		got := len(f.calls)
+		f.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d passes", n)
+}
@@ -5,6 +5,10 @@
 // against the quarantine container and uses the same whitelist
 // endpoint the live plugin uses.
 //
+// By default it makes one pass over the whole quarantine and exits. With
+// --daemon it stays up, follows the whitelist server's change stream and
+// rescues only the events of pubkeys as they are whitelisted.
+//
 // See quarantine/SPEC.md for background on the quarantine subsystem.
 package main
 
@@ -15,6 +19,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
@@ -22,6 +27,7 @@ import (
 	"quarantine-rescuer/internal/deleter"
 	"quarantine-rescuer/internal/exporter"
 	"quarantine-rescuer/internal/forwarder"
+	"quarantine-rescuer/internal/journal"
 	"quarantine-rescuer/internal/runner"
 	"quarantine-rescuer/internal/whitelist"
 )
@@ -45,6 +51,11 @@ type flags struct {
 	logLevel             string
 	publishTimeout       time.Duration
 	showVersion          bool
+	daemon               bool
+	scanBatch            int
+	fullInterval         time.Duration
+	journal              string
+	journalMaxBytes      int64
 }
 
 func parseFlags() *flags {
@@ -60,6 +71,11 @@ func parseFlags() *flags {
 	flag.StringVar(&f.logLevel, "log-level", "info", "Log level: debug, info, warn, error.")
 	flag.DurationVar(&f.publishTimeout, "publish-timeout", forwarder.DefaultPublishTimeout, "Timeout for a single publish to the main relay.")
 	flag.BoolVar(&f.showVersion, "version", false, "Print version and exit.")
+	flag.BoolVar(&f.daemon, "daemon", false, "Run until signalled, rescuing the events of pubkeys as the whitelist server announces them whitelisted.")
+	flag.IntVar(&f.scanBatch, "scan-batch", DefaultScanBatch, "Daemon mode: pubkeys per strfry scan authors filter.")
+	flag.DurationVar(&f.fullInterval, "full-interval", DefaultFullInterval, "Daemon mode: how often to also make a full pass over the quarantine. 0 = only at startup and on resync.")
+	flag.StringVar(&f.journal, "journal", "", "Append-only run journal file. Records every event moved and lets the next run finish deletes an interrupted one left undone. Empty = no journal.")
+	flag.Int64Var(&f.journalMaxBytes, "journal-max-bytes", journal.DefaultMaxSize, "Rotate the journal at the start of a pass once it is this big, keeping the old file as PATH.<time>. 0 = never rotate.")
 	flag.Parse()
 	return f
 }
@@ -105,14 +121,23 @@ type summary struct {
 	eventsToForward      int
 	eventsForwarded      int
 	eventsFailedForward  int
+	eventsInvalid        int
 	eventsDeleted        int
 	eventsFailedDelete   int
 	whitelistCacheMisses int
 }
 
-func run(ctx context.Context, f *flags, logger *slog.Logger) error {
-	start := time.Now()
+// rescuer runs rescue passes: a full pass over the whole quarantine, or a
+// pubkey pass over the events of a few pubkeys. Both share phases 2 to 4.
+type rescuer struct {
+	f      *flags
+	r      runner.Runner
+	wl     *whitelist.Client
+	j      *journal.Journal // nil without --journal, and on dry runs
+	logger *slog.Logger
+}
 
+func run(ctx context.Context, f *flags, logger *slog.Logger) error {
 	cfg, err := whitelist.LoadConfig()
 	if err != nil {
 		return fmt.Errorf("load whitelist config: %w", err)
@@ -127,15 +152,113 @@ func run(ctx context.Context, f *flags, logger *slog.Logger) error {
 	}
 	healthCancel()
 
-	r := runner.Exec{}
+	rs := &rescuer{f: f, r: runner.Exec{}, wl: wlClient, logger: logger}
+	if f.journal != "" && !f.dryRun {
+		j, err := journal.Open(f.journal, logger)
+		if err != nil {
+			return err
+		}
+		j.SetMaxSize(f.journalMaxBytes)
+		defer func() {
+			if err := j.Close(); err != nil {
+				logger.Error("close journal", "err", err)
+			}
+		}()
+		rs.j = j
+	}
+	if f.daemon {
+		return runDaemon(ctx, rs, whitelist.NewSubscriber(cfg.ServerURL, logger))
+	}
+	return rs.fullPass(ctx)
+}
+
+// fullPass exports every quarantined event and rescues those whose author is
+// whitelisted.
+func (rs *rescuer) fullPass(ctx context.Context) error {
+	start := time.Now()
+	f, logger := rs.f, rs.logger
+	rs.beginPass(ctx, "full")
 
 	// Phase 1: export and group by pubkey.
 	logger.Info("phase 1: exporting from quarantine",
 		"container", f.quarantineContainer, "config", f.quarantineConfigPath)
-	eventsByPubkey, totalEvents, err := collect(ctx, r, f.quarantineContainer, f.quarantineConfigPath, f.limit, logger)
+	events, errs := exporter.Stream(ctx, rs.r, f.quarantineContainer, f.quarantineConfigPath, logger)
+	eventsByPubkey := make(map[string][]exporter.RawEvent)
+	totalEvents, err := collect(events, errs, eventsByPubkey, f.limit, logger)
 	if err != nil {
 		return fmt.Errorf("export: %w", err)
 	}
+	return rs.rescue(ctx, eventsByPubkey, totalEvents, start)
+}
+
+// pubkeyPass scans the quarantine for the events of pubkeys only, in batches
+// of --scan-batch authors, and rescues those whose author is whitelisted.
+func (rs *rescuer) pubkeyPass(ctx context.Context, pubkeys []string) error {
+	start := time.Now()
+	f, logger := rs.f, rs.logger
+	rs.beginPass(ctx, "pubkeys")
+
+	logger.Info("phase 1: scanning quarantine", "pubkeys", len(pubkeys),
+		"container", f.quarantineContainer, "config", f.quarantineConfigPath)
+	batch := f.scanBatch
+	if batch <= 0 {
+		batch = DefaultScanBatch
+	}
+	eventsByPubkey := make(map[string][]exporter.RawEvent)
+	totalEvents := 0
+	for i := 0; i < len(pubkeys); i += batch {
+		filter, err := exporter.AuthorsFilter(pubkeys[i:min(i+batch, len(pubkeys))])
+		if err != nil {
+			return err
+		}
+		events, errs := exporter.Scan(ctx, rs.r, f.quarantineContainer, f.quarantineConfigPath, filter, logger)
+		n, err := collect(events, errs, eventsByPubkey, 0, logger)
+		totalEvents += n
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+	}
+	return rs.rescue(ctx, eventsByPubkey, totalEvents, start)
+}
+
+// beginPass journals the start of a pass and the whitelist generation it
+// runs against, then finishes the deletes of any earlier pass: events it
+// forwarded but never deleted, because it was killed or its delete failed.
+// Those would otherwise sit in both relays, and stay there if their author
+// has since left the whitelist.
+func (rs *rescuer) beginPass(ctx context.Context, kind string) {
+	if rs.j == nil {
+		return
+	}
+	logger := rs.logger
+	gen, err := rs.wl.Generation(ctx)
+	if err != nil {
+		logger.Warn("could not read whitelist generation for the journal", "err", err)
+	}
+	if err := rs.j.BeginPass(kind, gen); err != nil {
+		logger.Error("journal write failed", "err", err)
+	}
+
+	var ids []string
+	for _, pending := range rs.j.Pending() {
+		ids = append(ids, pending...)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	logger.Info("phase 0: deleting events forwarded by an earlier pass", "ids", len(ids))
+	del := deleter.New(rs.r, rs.f.quarantineContainer, rs.f.quarantineConfigPath, rs.f.batchSize, logger)
+	res := del.DeleteByIDs(ctx, ids)
+	if err := rs.j.Deleted(res.Deleted, res.Failed); err != nil {
+		logger.Error("journal write failed", "err", err)
+	}
+	logger.Info("phase 0 complete", "deleted", len(res.Deleted), "failed", len(res.Failed))
+}
+
+// rescue runs phases 2 to 4 over the events a pass collected and logs the
+// pass's summary.
+func (rs *rescuer) rescue(ctx context.Context, eventsByPubkey map[string][]exporter.RawEvent, totalEvents int, start time.Time) error {
+	f, logger, r, wlClient := rs.f, rs.logger, rs.r, rs.wl
 	sum := summary{
 		pubkeysSeen:    len(eventsByPubkey),
 		eventsExported: totalEvents,
@@ -170,31 +293,49 @@ func run(ctx context.Context, f *flags, logger *slog.Logger) error {
 	// Phase 3: forward to main relay.
 	logger.Info("phase 3: forwarding to main relay", "relay", f.mainRelay)
 	fwd := forwarder.New(f.mainRelay, f.forwardConcurrency, f.publishTimeout, logger)
+	if rs.j != nil {
+		fwd.SetOnPubkeyDone(func(pubkey string, ok, failed []string) {
+			if err := rs.j.Forwarded(pubkey, ok, failed); err != nil {
+				logger.Error("journal write failed", "pubkey", pubkey, "err", err)
+			}
+		})
+	}
 	fwdRes := fwd.Forward(ctx, whitelisted)
 	sum.eventsForwarded = len(fwdRes.SuccessIDs)
 	sum.eventsFailedForward = len(fwdRes.FailedIDs)
+	sum.eventsInvalid = len(fwdRes.InvalidIDs)
 	logger.Info("phase 3 complete",
-		"forwarded", sum.eventsForwarded, "failed", sum.eventsFailedForward)
-	if sum.eventsForwarded == 0 {
+		"forwarded", sum.eventsForwarded, "failed", sum.eventsFailedForward, "invalid", sum.eventsInvalid)
+	if sum.eventsForwarded == 0 && sum.eventsInvalid == 0 {
 		logSummary(logger, &sum, time.Since(start))
 		return nil
 	}
 
-	// Phase 4: delete only the successfully forwarded events.
-	logger.Info("phase 4: deleting from quarantine", "ids", sum.eventsForwarded)
+	// Phase 4: delete the successfully forwarded events, and only once the
+	// journal holds their forwards, along with the forgeries, which no pass
+	// would ever forward.
+	if err := rs.j.Sync(); err != nil {
+		logSummary(logger, &sum, time.Since(start))
+		return fmt.Errorf("sync journal; not deleting: %w", err)
+	}
+	ids := append(slices.Clone(fwdRes.SuccessIDs), fwdRes.InvalidIDs...)
+	logger.Info("phase 4: deleting from quarantine", "ids", len(ids), "invalid", sum.eventsInvalid)
 	del := deleter.New(r, f.quarantineContainer, f.quarantineConfigPath, f.batchSize, logger)
-	delRes := del.DeleteByIDs(ctx, fwdRes.SuccessIDs)
+	delRes := del.DeleteByIDs(ctx, ids)
 	sum.eventsDeleted = len(delRes.Deleted)
 	sum.eventsFailedDelete = len(delRes.Failed)
+	if err := rs.j.Deleted(delRes.Deleted, delRes.Failed); err != nil {
+		logger.Error("journal write failed", "err", err)
+	}
 	logger.Info("phase 4 complete", "deleted", sum.eventsDeleted, "failed", sum.eventsFailedDelete)
 
 	logSummary(logger, &sum, time.Since(start))
 	return nil
 }
 
-func collect(ctx context.Context, r runner.Runner, container, configPath string, limit int, logger *slog.Logger) (map[string][]exporter.RawEvent, int, error) {
-	events, errs := exporter.Stream(ctx, r, container, configPath, logger)
-	byPubkey := make(map[string][]exporter.RawEvent)
+// collect groups a stream's events into byPubkey and returns how many it
+// read, stopping after limit events if limit > 0.
+func collect(events <-chan exporter.RawEvent, errs <-chan error, byPubkey map[string][]exporter.RawEvent, limit int, logger *slog.Logger) (int, error) {
 	total := 0
 	for ev := range events {
 		byPubkey[ev.PubKey] = append(byPubkey[ev.PubKey], ev)
@@ -205,9 +346,9 @@ func collect(ctx context.Context, r runner.Runner, container, configPath string,
 		}
 	}
 	if err, ok := <-errs; ok {
-		return byPubkey, total, err
+		return total, err
 	}
-	return byPubkey, total, nil
+	return total, nil
 }
 
 func filterWhitelisted(ctx context.Context, c *whitelist.Client, eventsByPubkey map[string][]exporter.RawEvent, concurrency int, logger *slog.Logger) map[string][]exporter.RawEvent {
@@ -257,6 +398,7 @@ func logSummary(logger *slog.Logger, s *summary, elapsed time.Duration) {
 		"events_to_forward", s.eventsToForward,
 		"events_forwarded", s.eventsForwarded,
 		"events_failed_forward", s.eventsFailedForward,
+		"events_invalid", s.eventsInvalid,
 		"events_deleted", s.eventsDeleted,
 		"events_failed_delete", s.eventsFailedDelete,
 		"duration_ms", elapsed.Milliseconds(),
@@ -0,0 +1,192 @@
+// quarantine-review serves a JSON API for moderators to triage the
+// quarantine relay pubkey by pubkey: what each pubkey has in quarantine,
+// why it was quarantined and how it stands in the web of trust, with
+// approve (allow + rescue) and reject (delete, optionally deny) actions.
+// See internal/review for the API.
+//
+// It reads the quarantine LMDB directly (like lmdb-inspect), deletes
+// through `docker exec … strfry delete` and forwards to the main relay
+// (like quarantine-rescue), so it runs on the relay host.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"quarantine-rescuer/internal/decisions"
+	"quarantine-rescuer/internal/deleter"
+	"quarantine-rescuer/internal/envfile"
+	"quarantine-rescuer/internal/forwarder"
+	"quarantine-rescuer/internal/journal"
+	"quarantine-rescuer/internal/lmdbreader"
+	"quarantine-rescuer/internal/review"
+	"quarantine-rescuer/internal/runner"
+	"quarantine-rescuer/internal/whitelist"
+	"quarantine-rescuer/internal/wot"
+)
+
+// Build metadata, populated via -ldflags. See Makefile.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Built   = "unknown"
+)
+
+// tokenEnv holds the whitelist server's admin_token. It authorizes both
+// the whitelist overrides this service sets and the review actions.
+const tokenEnv = "WHITELIST_ADMIN_TOKEN"
+
+type flags struct {
+	addr                 string
+	db                   string
+	envFile              string
+	mapSize              int64
+	refresh              time.Duration
+	dgraph               string
+	decisions            string
+	mainRelay            string
+	quarantineContainer  string
+	quarantineConfigPath string
+	batchSize            int
+	publishTimeout       time.Duration
+	settle               time.Duration
+	journal              string
+	journalMaxBytes      int64
+	logLevel             string
+	showVersion          bool
+}
+
+func parseFlags() *flags {
+	f := &flags{}
+	flag.StringVar(&f.addr, "addr", "127.0.0.1:8091", "Listen address for the review API.")
+	flag.StringVar(&f.db, "db", "", "Quarantine LMDB directory. Empty = "+envfile.EnvVar+" from the environment or --env-file, else "+envfile.DefaultPath+".")
+	flag.StringVar(&f.envFile, "env-file", ".env", "The deepfry .env file to read "+envfile.EnvVar+" from.")
+	flag.Int64Var(&f.mapSize, "mapsize", lmdbreader.DefaultMapSize, "LMDB map size; must be at least strfry's dbParams.mapsize.")
+	flag.DurationVar(&f.refresh, "refresh", 5*time.Minute, "How long the list of quarantined pubkeys is reused before it is rebuilt from the LMDB.")
+	flag.StringVar(&f.dgraph, "dgraph", "http://localhost:8080", "Dgraph alpha URL for web-of-trust context. Empty = none.")
+	flag.StringVar(&f.decisions, "decisions", "", "Router decision listener URL (decisions.addr in router.yaml), e.g. http://127.0.0.1:9104. Empty = no quarantine reasons.")
+	flag.StringVar(&f.mainRelay, "main-relay", "ws://localhost:7777", "WebSocket URL of the main StrFry relay.")
+	flag.StringVar(&f.quarantineContainer, "quarantine-container", "strfry-quarantine", "Docker container name running the quarantine StrFry instance.")
+	flag.StringVar(&f.quarantineConfigPath, "quarantine-config", "/etc/strfry.conf", "Path to strfry.conf inside the quarantine container.")
+	flag.IntVar(&f.batchSize, "batch-size", deleter.DefaultBatchSize, "Number of event ids per strfry delete invocation.")
+	flag.DurationVar(&f.publishTimeout, "publish-timeout", forwarder.DefaultPublishTimeout, "Timeout for a single publish to the main relay.")
+	flag.DurationVar(&f.settle, "settle", review.DefaultSettle, "Wait between an approve's allow override and its forward, for the main relay's plugin to pick the override up.")
+	flag.StringVar(&f.journal, "journal", "", "Append-only run journal file, as for quarantine-rescue; use a file of its own. Records every event approve forwards and every delete, and lets the next start finish deletes an interrupted approve left undone. Empty = no journal.")
+	flag.Int64Var(&f.journalMaxBytes, "journal-max-bytes", journal.DefaultMaxSize, "Rotate the journal at the start of a pass once it is this big, keeping the old file as PATH.<time>. 0 = never rotate.")
+	flag.StringVar(&f.logLevel, "log-level", "info", "Log level: debug, info, warn, error.")
+	flag.BoolVar(&f.showVersion, "version", false, "Print version and exit.")
+	flag.Parse()
+	return f
+}
+
+func newLogger(level string) *slog.Logger {
+	var lvl slog.Level
+	switch level {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "warn":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl}))
+}
+
+func main() {
+	f := parseFlags()
+	if f.showVersion {
+		fmt.Printf("quarantine-review version=%s commit=%s built=%s\n", Version, Commit, Built)
+		return
+	}
+
+	logger := newLogger(f.logLevel)
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, f, logger); err != nil {
+		logger.Error("review service failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, f *flags, logger *slog.Logger) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	db, src, err := envfile.Resolve(f.db, f.envFile, wd)
+	if err != nil {
+		return err
+	}
+	logger.Info("quarantine LMDB", "path", db, "source", src)
+
+	cfg, err := whitelist.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("load whitelist config: %w", err)
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		logger.Warn(tokenEnv + " not set; approve and reject are disabled")
+	}
+
+	svc := &review.Service{
+		Quarantine: review.NewLMDB(db, f.mapSize, f.refresh, logger),
+		Overrides:  whitelist.NewAdminClient(whitelist.NewClient(cfg.ServerURL, cfg.CheckTimeout, logger), token),
+		Forwarder:  forwarder.New(f.mainRelay, 1, f.publishTimeout, logger),
+		Deleter:    deleter.New(runner.Exec{}, f.quarantineContainer, f.quarantineConfigPath, f.batchSize, logger),
+		Token:      token,
+		Settle:     f.settle,
+		Logger:     logger,
+	}
+	if f.dgraph != "" {
+		svc.Graph = wot.NewClient(f.dgraph, 10*time.Second, logger)
+	}
+	if f.decisions != "" {
+		svc.Reasons = decisions.NewClient(f.decisions, 5*time.Second, logger)
+	}
+	if f.journal != "" {
+		j, err := journal.Open(f.journal, logger)
+		if err != nil {
+			return err
+		}
+		j.SetMaxSize(f.journalMaxBytes)
+		defer func() {
+			if err := j.Close(); err != nil {
+				logger.Error("close journal", "err", err)
+			}
+		}()
+		svc.Journal = j
+		svc.FinishPending(ctx)
+	}
+
+	srv := &http.Server{Addr: f.addr, Handler: svc.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("review API listening", "addr", f.addr, "whitelist", cfg.ServerURL, "main_relay", f.mainRelay)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
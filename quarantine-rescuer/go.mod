@@ -3,13 +3,15 @@ module quarantine-rescuer
 go 1.24.2
 
 require (
+	github.com/PowerDNS/lmdb-go v1.9.3
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/klauspost/compress v1.18.0
 	github.com/nbd-wtf/go-nostr v0.52.3
 	github.com/spf13/viper v1.21.0
 )
 
 require (
 	github.com/ImVexed/fasturl v0.0.0-20230304231329-4e41488060f3 // indirect
-	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0 // indirect
 	github.com/bytedance/sonic v1.13.1 // indirect
 	github.com/bytedance/sonic/loader v0.2.4 // indirect
@@ -0,0 +1,82 @@
+// Package decisions reads the quarantine decision records the router
+// plugin keeps: why it quarantined an event, with which heuristics flags
+// and score, and against which whitelist generation.
+//
+// It mirrors the read side of whitelist-plugin/pkg/decisions (this module
+// doesn't import other deepfry modules). Record and the GET
+// /decisions/{id} endpoint are defined there and must stay in sync.
+package decisions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Record is why one event was quarantined.
+type Record struct {
+	ID         string   `json:"id"`
+	Pubkey     string   `json:"pubkey"`
+	Kind       int      `json:"kind"`
+	ReceivedAt int64    `json:"receivedAt"`
+	DecidedAt  int64    `json:"decidedAt"`
+	SourceType string   `json:"sourceType"`
+	SourceInfo string   `json:"sourceInfo,omitempty"`
+	Reason     string   `json:"reason"`
+	Rule       string   `json:"rule,omitempty"`
+	Score      float64  `json:"score"`
+	Flags      []string `json:"flags,omitempty"`
+	Generation uint64   `json:"generation"`
+}
+
+// Client looks records up on the router's decision listener
+// (decisions.addr in router.yaml).
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+// NewClient returns a client for the listener at baseURL, e.g.
+// http://127.0.0.1:9104.
+func NewClient(baseURL string, timeout time.Duration, logger *slog.Logger) *Client {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+// Get returns the record for event id, or nil if none was kept: the event
+// predates the store, its record was pruned, or it was dropped under load.
+func (c *Client) Get(ctx context.Context, id string) (*Record, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/decisions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build decision request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("decision lookup: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("decision lookup %s: unexpected status %d", id, resp.StatusCode)
+	}
+	var rec Record
+	if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("decode decision %s: %w", id, err)
+	}
+	return &rec, nil
+}
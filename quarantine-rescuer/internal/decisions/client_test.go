@@ -0,0 +1,43 @@
+package decisions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Get(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/decisions/known":
+			fmt.Fprint(w, `{"id":"known","pubkey":"pk","kind":1,"reason":"not_in_wot","score":0.7,"flags":["url_density"],"generation":9}`)
+		case "/decisions/broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL+"/", time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	rec, err := c.Get(ctx, "known")
+	if err != nil || rec == nil {
+		t.Fatalf("Get(known) = %v, %v", rec, err)
+	}
+	if rec.Reason != "not_in_wot" || rec.Score != 0.7 || len(rec.Flags) != 1 || rec.Generation != 9 {
+		t.Errorf("record = %+v", rec)
+	}
+
+	if rec, err := c.Get(ctx, "unknown"); rec != nil || err != nil {
+		t.Errorf("Get(unknown) = %v, %v; want nil, nil", rec, err)
+	}
+	if _, err := c.Get(ctx, "broken"); err == nil {
+		t.Error("Get(broken): want an error on 500")
+	}
+}
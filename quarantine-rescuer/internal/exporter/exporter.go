@@ -1,5 +1,6 @@
 // Package exporter streams events out of a quarantine StrFry LMDB by
-// shelling out to `strfry export` inside the quarantine container.
+// shelling out to `strfry export` (everything) or `strfry scan` (one
+// filter's matches) inside the quarantine container.
 //
 // Why exec instead of opening LMDB directly: LMDB has well-defined
 // reader/writer semantics, but strfry maintains its own indices and
@@ -53,17 +54,41 @@ type minEvent struct {
 // or the command's non-zero exit. Callers should drain events first,
 // then read errs.
 func Stream(ctx context.Context, r runner.Runner, container, configPath string, logger *slog.Logger) (<-chan RawEvent, <-chan error) {
+	return stream(ctx, r, container, configPath, logger, "export")
+}
+
+// Scan runs `docker exec <container> /app/strfry --config=<configPath> scan <filter>`
+// and emits the matching events the way Stream does. strfry answers a scan
+// from its indices, so an authors filter costs in proportion to those
+// authors' events rather than the whole LMDB.
+func Scan(ctx context.Context, r runner.Runner, container, configPath, filter string, logger *slog.Logger) (<-chan RawEvent, <-chan error) {
+	return stream(ctx, r, container, configPath, logger, "scan", filter)
+}
+
+// AuthorsFilter returns the NIP-01 filter matching every event by pubkeys.
+func AuthorsFilter(pubkeys []string) (string, error) {
+	filter := struct {
+		Authors []string `json:"authors"`
+	}{pubkeys}
+	encoded, err := json.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("marshal filter: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func stream(ctx context.Context, r runner.Runner, container, configPath string, logger *slog.Logger, cmd ...string) (<-chan RawEvent, <-chan error) {
 	if logger == nil {
 		logger = slog.Default()
 	}
 	events := make(chan RawEvent, 256)
 	errs := make(chan error, 1)
 
-	stdout, wait, err := r.Stream(ctx, "docker", "exec", container,
-		"/app/strfry", fmt.Sprintf("--config=%s", configPath), "export")
+	args := append([]string{"exec", container, "/app/strfry", fmt.Sprintf("--config=%s", configPath)}, cmd...)
+	stdout, wait, err := r.Stream(ctx, "docker", args...)
 	if err != nil {
 		close(events)
-		errs <- fmt.Errorf("start strfry export: %w", err)
+		errs <- fmt.Errorf("start strfry %s: %w", cmd[0], err)
 		close(errs)
 		return events, errs
 	}
@@ -106,7 +131,7 @@ func Stream(ctx context.Context, r runner.Runner, container, configPath string,
 			}
 		}
 		if err := scanner.Err(); err != nil {
-			errs <- fmt.Errorf("scan strfry export: %w", err)
+			errs <- fmt.Errorf("read strfry %s: %w", cmd[0], err)
 			_ = wait()
 			return
 		}
@@ -125,3 +125,35 @@ func TestStream_ContextCancel(t *testing.T) {
 		t.Fatal("errs channel did not close after cancel")
 	}
 }
+
+// argvRunner records the argv of the command it is asked to stream.
+type argvRunner struct {
+	fakeRunner
+	args *[]string
+}
+
+func (a argvRunner) Stream(ctx context.Context, name string, args ...string) (io.ReadCloser, func() error, error) {
+	*a.args = append([]string{name}, args...)
+	return a.fakeRunner.Stream(ctx, name, args...)
+}
+
+func TestScan_RunsStrfryScanWithFilter(t *testing.T) {
+	filter, err := AuthorsFilter([]string{"p1", "p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter != `{"authors":["p1","p2"]}` {
+		t.Fatalf("filter = %s", filter)
+	}
+
+	var argv []string
+	r := argvRunner{fakeRunner{stdout: `{"id":"a","pubkey":"p1","kind":1,"created_at":100}`}, &argv}
+	got, err := Drain(Scan(context.Background(), r, "q", "/etc/strfry.conf", filter, newSilentLogger()))
+	if err != nil || len(got) != 1 || got[0].PubKey != "p1" {
+		t.Fatalf("got %+v, err %v", got, err)
+	}
+	want := `docker exec q /app/strfry --config=/etc/strfry.conf scan {"authors":["p1","p2"]}`
+	if strings.Join(argv, " ") != want {
+		t.Fatalf("argv = %q, want %q", strings.Join(argv, " "), want)
+	}
+}
@@ -6,6 +6,12 @@
 //
 // Across pubkeys we run a small worker pool to keep latency bounded
 // without overwhelming the relay or the host.
+//
+// Before anything is published, every event's id and signature are
+// verified (across all CPUs); an event that fails is never sent, so a
+// forgery in quarantine cannot reach the main relay. It is reported in
+// Result.InvalidIDs, apart from the failed forwards, for the caller to
+// delete.
 package forwarder
 
 import (
@@ -20,6 +26,7 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 
 	"quarantine-rescuer/internal/exporter"
+	"quarantine-rescuer/internal/verify"
 )
 
 // DefaultPublishTimeout caps a single relay.Publish call.
@@ -29,6 +36,7 @@ const DefaultPublishTimeout = 5 * time.Second
 type Result struct {
 	SuccessIDs []string
 	FailedIDs  []string
+	InvalidIDs []string // never sent: their id or signature did not verify
 }
 
 // Forwarder publishes events to a relay through one or more workers.
@@ -37,6 +45,7 @@ type Forwarder struct {
 	workers        int
 	publishTimeout time.Duration
 	logger         *slog.Logger
+	onPubkeyDone   func(pubkey string, ok, failed []string)
 }
 
 func New(relayURL string, workers int, publishTimeout time.Duration, logger *slog.Logger) *Forwarder {
@@ -57,6 +66,14 @@ func New(relayURL string, workers int, publishTimeout time.Duration, logger *slo
 	}
 }
 
+// SetOnPubkeyDone registers fn to be called, from the worker, once each
+// pubkey's events have all been published or failed. The run journal uses
+// it to record forwards as they happen rather than at the end of the pass.
+// Events dropped by verification are not reported through fn.
+func (f *Forwarder) SetOnPubkeyDone(fn func(pubkey string, ok, failed []string)) {
+	f.onPubkeyDone = fn
+}
+
 // Forward publishes every event in eventsByPubkey to the configured
 // relay. Each worker holds its own dedicated relay connection.
 //
@@ -85,6 +102,22 @@ func (f *Forwarder) Forward(ctx context.Context, eventsByPubkey map[string][]exp
 		failed = append(failed, id)
 		mu.Unlock()
 	}
+	// done reports one pubkey's outcome to onPubkeyDone.
+	done := func(pubkey string, ok, bad []string) {
+		if f.onPubkeyDone != nil {
+			f.onPubkeyDone(pubkey, ok, bad)
+		}
+	}
+	failAll := func(w work) {
+		ids := make([]string, len(w.events))
+		for i, ev := range w.events {
+			addFailed(ev.ID)
+			ids[i] = ev.ID
+		}
+		done(w.pubkey, nil, ids)
+	}
+
+	eventsByPubkey, invalid := f.dropInvalid(eventsByPubkey)
 
 	worker := func(workerID int) {
 		relay, err := f.connect(ctx)
@@ -92,19 +125,19 @@ func (f *Forwarder) Forward(ctx context.Context, eventsByPubkey map[string][]exp
 			f.logger.Error("forwarder: worker could not connect; failing assigned events",
 				"worker", workerID, "relay", f.relayURL, "err", err)
 			for w := range jobs {
-				for _, ev := range w.events {
-					addFailed(ev.ID)
-				}
+				failAll(w)
 			}
 			return
 		}
 		defer relay.Close()
 
 		for w := range jobs {
+			var ok, bad []string
 			for _, raw := range w.events {
 				select {
 				case <-ctx.Done():
 					addFailed(raw.ID)
+					bad = append(bad, raw.ID)
 					continue
 				default:
 				}
@@ -113,6 +146,7 @@ func (f *Forwarder) Forward(ctx context.Context, eventsByPubkey map[string][]exp
 					f.logger.Warn("forwarder: cannot decode event; skipping",
 						"event_id", raw.ID, "err", err)
 					addFailed(raw.ID)
+					bad = append(bad, raw.ID)
 					continue
 				}
 				pubCtx, cancel := context.WithTimeout(ctx, f.publishTimeout)
@@ -123,10 +157,13 @@ func (f *Forwarder) Forward(ctx context.Context, eventsByPubkey map[string][]exp
 						"worker", workerID, "event_id", raw.ID,
 						"pubkey", raw.PubKey, "kind", raw.Kind, "err", err)
 					addFailed(raw.ID)
+					bad = append(bad, raw.ID)
 					continue
 				}
 				addSuccess(raw.ID)
+				ok = append(ok, raw.ID)
 			}
+			done(w.pubkey, ok, bad)
 		}
 	}
 
@@ -147,15 +184,58 @@ func (f *Forwarder) Forward(ctx context.Context, eventsByPubkey map[string][]exp
 		select {
 		case jobs <- work{pubkey: pk, events: sortedEvts}:
 		case <-ctx.Done():
-			for _, ev := range sortedEvts {
-				addFailed(ev.ID)
-			}
+			failAll(work{pubkey: pk, events: sortedEvts})
 		}
 	}
 	close(jobs)
 	wg.Wait()
 
-	return Result{SuccessIDs: success, FailedIDs: failed}
+	return Result{SuccessIDs: success, FailedIDs: failed, InvalidIDs: invalid}
+}
+
+// dropInvalid verifies every event in one batch and returns the events that
+// passed, still grouped by pubkey, plus the ids of those that did not.
+// Events that cannot be decoded are left in for the worker to report.
+func (f *Forwarder) dropInvalid(eventsByPubkey map[string][]exporter.RawEvent) (map[string][]exporter.RawEvent, []string) {
+	var (
+		raws    []exporter.RawEvent
+		decoded []*nostr.Event
+	)
+	for _, evts := range eventsByPubkey {
+		for _, raw := range evts {
+			if evt, err := decodeEvent(raw.Raw); err == nil {
+				raws = append(raws, raw)
+				decoded = append(decoded, evt)
+			}
+		}
+	}
+
+	bad := make(map[string]bool)
+	var invalid []string
+	for i, err := range verify.Batch(decoded) {
+		if err == nil {
+			continue
+		}
+		raw := raws[i]
+		f.logger.Warn("forwarder: event failed verification; not forwarding",
+			"event_id", raw.ID, "pubkey", raw.PubKey, "kind", raw.Kind,
+			"reason", verify.Reason(err), "err", err)
+		bad[raw.ID] = true
+		invalid = append(invalid, raw.ID)
+	}
+	if len(invalid) == 0 {
+		return eventsByPubkey, nil
+	}
+
+	valid := make(map[string][]exporter.RawEvent, len(eventsByPubkey))
+	for pk, evts := range eventsByPubkey {
+		for _, raw := range evts {
+			if !bad[raw.ID] {
+				valid[pk] = append(valid[pk], raw)
+			}
+		}
+	}
+	return valid, invalid
 }
 
 func (f *Forwarder) connect(ctx context.Context) (*nostr.Relay, error) {
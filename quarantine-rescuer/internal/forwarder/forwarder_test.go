@@ -2,11 +2,17 @@ package forwarder
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/nbd-wtf/go-nostr"
+
 	"quarantine-rescuer/internal/exporter"
 )
 
@@ -18,16 +24,24 @@ func newSilentLogger() *slog.Logger { return slog.New(slog.NewTextHandler(io.Dis
 func TestForward_AllFailWhenRelayUnreachable(t *testing.T) {
 	f := New("ws://127.0.0.1:1", 2, 200*time.Millisecond, newSilentLogger())
 
+	sk1, sk2 := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	a, b, c := signedEvent(t, sk1, 100), signedEvent(t, sk1, 200), signedEvent(t, sk2, 50)
 	in := map[string][]exporter.RawEvent{
-		"p1": {
-			{ID: "a", PubKey: "p1", CreatedAt: 100, Raw: validEvent("a", "p1", 100)},
-			{ID: "b", PubKey: "p1", CreatedAt: 200, Raw: validEvent("b", "p1", 200)},
-		},
-		"p2": {
-			{ID: "c", PubKey: "p2", CreatedAt: 50, Raw: validEvent("c", "p2", 50)},
-		},
+		a.PubKey: {a, b},
+		c.PubKey: {c},
 	}
 
+	var mu sync.Mutex
+	reported := make(map[string][]string)
+	f.SetOnPubkeyDone(func(pubkey string, ok, failed []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(ok) != 0 {
+			t.Errorf("pubkey %s reported ok %v", pubkey, ok)
+		}
+		reported[pubkey] = failed
+	})
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	res := f.Forward(ctx, in)
@@ -38,6 +52,39 @@ func TestForward_AllFailWhenRelayUnreachable(t *testing.T) {
 	if len(res.FailedIDs) != 3 {
 		t.Errorf("FailedIDs = %v (len %d), want 3", res.FailedIDs, len(res.FailedIDs))
 	}
+	if len(res.InvalidIDs) != 0 {
+		t.Errorf("InvalidIDs = %v, want none", res.InvalidIDs)
+	}
+	if len(reported) != 2 || len(reported[a.PubKey]) != 2 || len(reported[c.PubKey]) != 1 {
+		t.Errorf("per-pubkey reports = %v, want both pubkeys with all their events failed", reported)
+	}
+}
+
+// TestForward_InvalidEventsNeverPublished confirms that events whose id or
+// signature does not verify are dropped up front, without a relay, and
+// reported apart from the failed forwards; the rest of their pubkey's
+// events still go to a worker.
+func TestForward_InvalidEventsNeverPublished(t *testing.T) {
+	f := New("ws://127.0.0.1:1", 1, 200*time.Millisecond, newSilentLogger())
+
+	sk := nostr.GeneratePrivateKey()
+	good := signedEvent(t, sk, 100)
+	forged := signedEvent(t, sk, 200)
+	forged.Raw = []byte(strings.Replace(string(forged.Raw), `"content":"x"`, `"content":"y"`, 1))
+	unsigned := exporter.RawEvent{ID: "c", PubKey: good.PubKey, CreatedAt: 300, Raw: validEvent("c", good.PubKey, 300)}
+
+	res := f.Forward(context.Background(), map[string][]exporter.RawEvent{good.PubKey: {good, forged, unsigned}})
+
+	slices.Sort(res.InvalidIDs)
+	want := []string{forged.ID, "c"}
+	slices.Sort(want)
+	if !slices.Equal(res.InvalidIDs, want) {
+		t.Fatalf("InvalidIDs = %v, want %v", res.InvalidIDs, want)
+	}
+	// good was handed to the worker, which cannot connect.
+	if !slices.Equal(res.FailedIDs, []string{good.ID}) || len(res.SuccessIDs) != 0 {
+		t.Fatalf("FailedIDs = %v, SuccessIDs = %v", res.FailedIDs, res.SuccessIDs)
+	}
 }
 
 func TestForward_EmptyInput(t *testing.T) {
@@ -62,9 +109,22 @@ func TestForward_DefaultsApplied(t *testing.T) {
 	}
 }
 
+// signedEvent builds a properly signed kind-1 event by sk.
+func signedEvent(t *testing.T, sk string, createdAt int64) exporter.RawEvent {
+	t.Helper()
+	evt := nostr.Event{Kind: 1, Content: "x", CreatedAt: nostr.Timestamp(createdAt), Tags: nostr.Tags{}}
+	if err := evt.Sign(sk); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	raw, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return exporter.RawEvent{ID: evt.ID, PubKey: evt.PubKey, Kind: 1, CreatedAt: createdAt, Raw: raw}
+}
+
 // validEvent builds a minimal go-nostr-decodable JSON event. It does not
-// have a real signature, but Forward only round-trips the JSON; signature
-// verification happens on the receiving relay.
+// have a real signature, so Forward fails it verification.
 func validEvent(id, pubkey string, createdAt int64) []byte {
 	return []byte(`{"id":"` + id + `","pubkey":"` + pubkey + `","created_at":` +
 		itoa(createdAt) + `,"kind":1,"tags":[],"content":"x","sig":"00"}`)
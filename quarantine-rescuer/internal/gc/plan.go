@@ -0,0 +1,193 @@
+// Package gc decides which quarantined events a retention policy removes.
+// It works from strfry's indexes (lmdbreader.Entries): each event's levId,
+// pubkey, created_at and stored payload size, never its content, at about
+// 32 bytes of memory per event.
+//
+// Rules apply in order, and an event is counted under the first that
+// claims it:
+//
+//  1. age: created_at older than MaxAge;
+//  2. pubkey_count: beyond the newest MaxPerPubkey events of its pubkey;
+//  3. bytes: while the payload bytes left exceed MaxBytes, the oldest
+//     remaining events, whoever wrote them.
+//
+// Age is by created_at, the only timestamp strfry indexes, so an event
+// backdated by its author ages out early.
+package gc
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"quarantine-rescuer/internal/lmdbreader"
+)
+
+// Rule names, as reported in Plan.ByRule.
+const (
+	RuleAge         = "age"
+	RulePubkeyCount = "pubkey_count"
+	RuleBytes       = "bytes"
+)
+
+// Policy is a retention policy; zero fields are off.
+type Policy struct {
+	MaxAge       time.Duration
+	MaxPerPubkey int
+	MaxBytes     int64 // stored payload bytes, indexes not included
+}
+
+// Enabled reports whether any rule is set.
+func (p Policy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxPerPubkey > 0 || p.MaxBytes > 0
+}
+
+// Tally counts events and their stored payload bytes.
+type Tally struct {
+	Events int   `json:"events"`
+	Bytes  int64 `json:"bytes"`
+}
+
+func (t *Tally) add(size int32) {
+	t.Events++
+	t.Bytes += int64(size)
+}
+
+// PubkeyTally is one pubkey's share of the victims.
+type PubkeyTally struct {
+	Pubkey string `json:"pubkey"`
+	Tally
+}
+
+// Plan is what a policy removes.
+type Plan struct {
+	Total  Tally            `json:"total"`
+	Kept   Tally            `json:"kept"`
+	ByRule map[string]Tally `json:"by_rule"`
+	// TopPubkeys are the pubkeys losing the most events, most first.
+	TopPubkeys []PubkeyTally `json:"top_pubkeys"`
+	// Victims are the levIds to delete, oldest first, so an interrupted
+	// delete has removed the oldest events.
+	Victims []uint64 `json:"-"`
+}
+
+// topPubkeys is how many pubkeys a Plan lists.
+const topPubkeys = 10
+
+// Rules as stored in entry.rule (ruleNone = kept), one byte so an entry
+// stays 32.
+const (
+	ruleNone uint8 = iota
+	ruleAge
+	rulePubkeyCount
+	ruleBytes
+)
+
+var ruleNames = [...]string{ruleAge: RuleAge, rulePubkeyCount: RulePubkeyCount, ruleBytes: RuleBytes}
+
+type entry struct {
+	lev       uint64
+	createdAt int64
+	pubkey    int32 // index into Planner.names
+	size      int32
+	rule      uint8
+}
+
+// Planner collects entries and plans against them.
+type Planner struct {
+	policy  Policy
+	now     time.Time
+	pubkeys map[string]int32
+	names   []string
+	entries []entry
+}
+
+// NewPlanner plans policy as of now.
+func NewPlanner(policy Policy, now time.Time) *Planner {
+	return &Planner{policy: policy, now: now, pubkeys: make(map[string]int32)}
+}
+
+// Add records one event.
+func (p *Planner) Add(e lmdbreader.Entry) {
+	pk, ok := p.pubkeys[e.Pubkey]
+	if !ok {
+		pk = int32(len(p.names))
+		p.pubkeys[e.Pubkey] = pk
+		p.names = append(p.names, e.Pubkey)
+	}
+	p.entries = append(p.entries, entry{lev: e.LevID, createdAt: e.CreatedAt, pubkey: pk, size: int32(e.Size)})
+}
+
+// Plan applies the policy to everything added.
+func (p *Planner) Plan() Plan {
+	es := p.entries
+	// Oldest first; levId breaks ties the way strfry assigned them.
+	slices.SortFunc(es, func(a, b entry) int {
+		return cmp.Or(cmp.Compare(a.createdAt, b.createdAt), cmp.Compare(a.lev, b.lev))
+	})
+
+	if p.policy.MaxAge > 0 {
+		cutoff := p.now.Add(-p.policy.MaxAge).Unix()
+		for i := range es {
+			if es[i].createdAt >= cutoff {
+				break
+			}
+			es[i].rule = ruleAge
+		}
+	}
+
+	if p.policy.MaxPerPubkey > 0 {
+		kept := make([]int, len(p.names))
+		for i := len(es) - 1; i >= 0; i-- {
+			if es[i].rule != ruleNone {
+				continue
+			}
+			if kept[es[i].pubkey]++; kept[es[i].pubkey] > p.policy.MaxPerPubkey {
+				es[i].rule = rulePubkeyCount
+			}
+		}
+	}
+
+	if p.policy.MaxBytes > 0 {
+		var left int64
+		for _, e := range es {
+			if e.rule == ruleNone {
+				left += int64(e.size)
+			}
+		}
+		for i := 0; i < len(es) && left > p.policy.MaxBytes; i++ {
+			if es[i].rule == ruleNone {
+				es[i].rule = ruleBytes
+				left -= int64(es[i].size)
+			}
+		}
+	}
+
+	plan := Plan{ByRule: make(map[string]Tally)}
+	byPubkey := make(map[int32]*Tally)
+	for _, e := range es {
+		plan.Total.add(e.size)
+		if e.rule == ruleNone {
+			plan.Kept.add(e.size)
+			continue
+		}
+		t := plan.ByRule[ruleNames[e.rule]]
+		t.add(e.size)
+		plan.ByRule[ruleNames[e.rule]] = t
+		if byPubkey[e.pubkey] == nil {
+			byPubkey[e.pubkey] = &Tally{}
+		}
+		byPubkey[e.pubkey].add(e.size)
+		plan.Victims = append(plan.Victims, e.lev)
+	}
+	for pk, t := range byPubkey {
+		plan.TopPubkeys = append(plan.TopPubkeys, PubkeyTally{Pubkey: p.names[pk], Tally: *t})
+	}
+	slices.SortFunc(plan.TopPubkeys, func(a, b PubkeyTally) int {
+		return cmp.Or(cmp.Compare(b.Events, a.Events), cmp.Compare(a.Pubkey, b.Pubkey))
+	})
+	if len(plan.TopPubkeys) > topPubkeys {
+		plan.TopPubkeys = plan.TopPubkeys[:topPubkeys]
+	}
+	return plan
+}
@@ -0,0 +1,84 @@
+package gc
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"quarantine-rescuer/internal/lmdbreader"
+)
+
+var now = time.Unix(1_000_000, 0)
+
+// entries: pubkey a has five events a day apart ending now, b has two old
+// ones, c one recent; every payload is 100 bytes.
+func plan(t *testing.T, p Policy) Plan {
+	t.Helper()
+	pl := NewPlanner(p, now)
+	day := int64(86400)
+	lev := uint64(0)
+	add := func(pk string, createdAt int64) {
+		lev++
+		pl.Add(lmdbreader.Entry{LevID: lev, Pubkey: pk, CreatedAt: createdAt, Size: 100})
+	}
+	for i := int64(4); i >= 0; i-- {
+		add("a", now.Unix()-i*day) // levs 1..5, oldest first
+	}
+	add("b", now.Unix()-10*day) // 6
+	add("b", now.Unix()-9*day)  // 7
+	add("c", now.Unix()-day/2)  // 8
+	return pl.Plan()
+}
+
+func TestPlan_Age(t *testing.T) {
+	got := plan(t, Policy{MaxAge: 3 * 24 * time.Hour})
+	// b's two, then a's one older than three days (exactly three days is
+	// kept); oldest first.
+	if !slices.Equal(got.Victims, []uint64{6, 7, 1}) {
+		t.Fatalf("victims = %v", got.Victims)
+	}
+	if got.ByRule[RuleAge] != (Tally{Events: 3, Bytes: 300}) || got.Kept != (Tally{Events: 5, Bytes: 500}) || got.Total.Events != 8 {
+		t.Errorf("plan = %+v", got)
+	}
+}
+
+func TestPlan_PerPubkeyKeepsNewest(t *testing.T) {
+	got := plan(t, Policy{MaxPerPubkey: 2})
+	if !slices.Equal(got.Victims, []uint64{1, 2, 3}) {
+		t.Fatalf("victims = %v, want a's three oldest", got.Victims)
+	}
+	if len(got.TopPubkeys) != 1 || got.TopPubkeys[0].Pubkey != "a" || got.TopPubkeys[0].Events != 3 {
+		t.Errorf("top pubkeys = %+v", got.TopPubkeys)
+	}
+}
+
+func TestPlan_ByteBudgetTakesOldestAcrossPubkeys(t *testing.T) {
+	got := plan(t, Policy{MaxBytes: 450})
+	if !slices.Equal(got.Victims, []uint64{6, 7, 1, 2}) || got.Kept.Bytes != 400 {
+		t.Fatalf("victims = %v, kept %+v", got.Victims, got.Kept)
+	}
+}
+
+func TestPlan_RulesInOrder(t *testing.T) {
+	got := plan(t, Policy{MaxAge: 5 * 24 * time.Hour, MaxPerPubkey: 3, MaxBytes: 250})
+	// age takes b; pubkey_count takes a's two oldest; bytes then cuts the
+	// remaining 400 bytes (a3, a4, c, a5) to 200.
+	if got.ByRule[RuleAge].Events != 2 || got.ByRule[RulePubkeyCount].Events != 2 || got.ByRule[RuleBytes].Events != 2 {
+		t.Fatalf("by rule = %+v", got.ByRule)
+	}
+	if !slices.Equal(got.Victims, []uint64{6, 7, 1, 2, 3, 4}) {
+		t.Errorf("victims = %v", got.Victims)
+	}
+	if got.Kept != (Tally{Events: 2, Bytes: 200}) {
+		t.Errorf("kept = %+v", got.Kept)
+	}
+}
+
+func TestPlan_Disabled(t *testing.T) {
+	if (Policy{}).Enabled() {
+		t.Error("zero policy enabled")
+	}
+	if got := plan(t, Policy{}); len(got.Victims) != 0 || got.Kept.Events != 8 {
+		t.Errorf("zero policy plan = %+v", got)
+	}
+}
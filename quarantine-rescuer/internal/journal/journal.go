@@ -0,0 +1,333 @@
+// Package journal is the rescuer's append-only run journal: one JSON line
+// per pass started, per pubkey forwarded and per delete run. It is the
+// audit history of every event moved from quarantine to the main relay,
+// and it is what lets an interrupted run finish its deletes.
+//
+// A run that dies between forwarding an event and deleting it leaves the
+// event in both relays. Journal entries record each pubkey's forwarded ids
+// as soon as the pubkey is done, and are synced before any delete starts,
+// so on the next start Pending lists exactly the ids forwarded but never
+// deleted, and the rescuer deletes them before doing anything else.
+//
+// Entry shapes:
+//
+//	{"time":…,"pass":"<id>","op":"pass","kind":"full"|"pubkeys"|…,"generation":G}
+//	{"time":…,"pass":"<id>","op":"forward","pubkey":"<hex>","generation":G,"ok":[ids],"failed":[ids]}
+//	{"time":…,"pass":"<id>","op":"delete","ok":[ids],"failed":[ids]}
+//
+// generation is the whitelist generation the pass ran against, if the
+// whitelist server reported one.
+//
+// quarantine-review journals each approve and reject as a pass of kind
+// "approve" or "reject", and its startup cleanup as "pending".
+//
+// With SetMaxSize, a pass that starts with the file past the limit first
+// rotates it: the file is kept as <path>.<time> and the new one opens with a
+// "rotate" pass re-recording every pending forward, so the ids stay pending
+// across the rotation. The swap is a rename, so a crash leaves either file
+// in place, both holding the pending forwards.
+//
+// A failed write or sync is sticky: every later Sync returns it, so the
+// callers' "sync before delete" never deletes an event whose forward may be
+// missing from the journal.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the journal size past which the commands' passes rotate
+// it.
+const DefaultMaxSize = 64 << 20
+
+// Entry ops.
+const (
+	OpPass    = "pass"
+	OpForward = "forward"
+	OpDelete  = "delete"
+)
+
+// Entry is one journal line.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Pass       string    `json:"pass"`
+	Op         string    `json:"op"`
+	Kind       string    `json:"kind,omitempty"`
+	Pubkey     string    `json:"pubkey,omitempty"`
+	Generation uint64    `json:"generation,omitempty"`
+	OK         []string  `json:"ok,omitempty"`
+	Failed     []string  `json:"failed,omitempty"`
+}
+
+// Journal appends entries to one file. A nil *Journal records nothing, so
+// callers need not check whether journaling is enabled. Safe for
+// concurrent use.
+type Journal struct {
+	mu         sync.Mutex
+	path       string
+	f          *os.File
+	size       int64
+	maxSize    int64 // rotate past this many bytes; 0 = never
+	err        error // first write or sync failure; sticky
+	logger     *slog.Logger
+	pass       string
+	generation uint64
+	pending    map[string]string // forwarded, not yet deleted: id → pubkey
+	now        func() time.Time
+}
+
+// Open opens (or creates) the journal at path and replays it to find the
+// ids still pending deletion. A torn last line, left by a crash mid-write,
+// is cut off so new entries start on a line of their own. Entries are
+// appended with O_APPEND, so they always land at the end of the file.
+func Open(path string, logger *slog.Logger) (*Journal, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	j := &Journal{path: path, f: f, logger: logger, pending: make(map[string]string), now: time.Now}
+	if err := j.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// replay reads every entry, rebuilding pending, and cuts the file after the
+// last complete line.
+func (j *Journal) replay() error {
+	r := bufio.NewReader(j.f)
+	var good int64 // offset just past the last complete line
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				j.logger.Warn("journal: dropping torn last line", "line", lineNo, "bytes", len(line))
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+		good += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			j.logger.Warn("journal: skipping unreadable line", "line", lineNo, "err", err)
+			continue
+		}
+		j.apply(e)
+	}
+	if err := j.f.Truncate(good); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	j.size = good
+	return nil
+}
+
+// SetMaxSize makes BeginPass rotate the journal once it holds n bytes or
+// more. n <= 0 never rotates.
+func (j *Journal) SetMaxSize(n int64) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.maxSize = n
+}
+
+func (j *Journal) apply(e Entry) {
+	switch e.Op {
+	case OpForward:
+		for _, id := range e.OK {
+			j.pending[id] = e.Pubkey
+		}
+	case OpDelete:
+		for _, id := range e.OK {
+			delete(j.pending, id)
+		}
+	}
+}
+
+// Pending returns the ids forwarded but not yet deleted, by pubkey.
+func (j *Journal) Pending() map[string][]string {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.byPubkey()
+}
+
+// BeginPass starts a new pass; later entries carry its id and generation.
+// It rotates the journal first if it has outgrown SetMaxSize.
+func (j *Journal) BeginPass(kind string, generation uint64) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.maxSize > 0 && j.size >= j.maxSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	now := j.now()
+	j.pass = now.UTC().Format("20060102T150405.000Z")
+	j.generation = generation
+	return j.write(Entry{Time: now, Op: OpPass, Kind: kind, Generation: generation})
+}
+
+// Forwarded records the outcome of forwarding one pubkey's events.
+func (j *Journal) Forwarded(pubkey string, ok, failed []string) error {
+	if j == nil || len(ok)+len(failed) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.write(Entry{Time: j.now(), Op: OpForward, Pubkey: pubkey, Generation: j.generation, OK: ok, Failed: failed})
+}
+
+// Deleted records the outcome of deleting ids from quarantine.
+func (j *Journal) Deleted(ok, failed []string) error {
+	if j == nil || len(ok)+len(failed) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.write(Entry{Time: j.now(), Op: OpDelete, OK: ok, Failed: failed})
+}
+
+// write appends e as one line (one write call) and applies it. Caller
+// holds mu.
+func (j *Journal) write(e Entry) error {
+	if j.err != nil {
+		return j.err
+	}
+	e.Pass = j.pass
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	n, err := j.f.Write(append(line, '\n'))
+	j.size += int64(n)
+	if err != nil {
+		j.err = fmt.Errorf("write journal: %w", err)
+		return j.err
+	}
+	j.apply(e)
+	return nil
+}
+
+// rotate keeps the current file as <path>.<time> and starts a new one with
+// a "rotate" pass holding every pending forward. The new file is written and
+// synced beside the old one, then renamed over it. Caller holds mu.
+func (j *Journal) rotate() error {
+	if j.err != nil {
+		return j.err
+	}
+	now := j.now()
+	archive := j.path + "." + now.UTC().Format("20060102T150405.000Z")
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("rotate journal: %w", err)
+	}
+	old, oldSize := j.f, j.size
+	j.f, j.size = f, 0
+	j.pass = now.UTC().Format("20060102T150405.000Z") + "-rotate"
+	err = j.write(Entry{Time: now, Op: OpPass, Kind: "rotate", Generation: j.generation})
+	byPubkey := j.byPubkey()
+	pks := make([]string, 0, len(byPubkey))
+	for pk := range byPubkey {
+		pks = append(pks, pk)
+	}
+	slices.Sort(pks)
+	for _, pk := range pks {
+		if err != nil {
+			break
+		}
+		ids := byPubkey[pk]
+		slices.Sort(ids)
+		err = j.write(Entry{Time: now, Op: OpForward, Pubkey: pk, Generation: j.generation, OK: ids})
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	linked := false
+	if err == nil {
+		err = os.Link(j.path, archive)
+		linked = err == nil
+	}
+	if err == nil {
+		err = os.Rename(tmp, j.path)
+	}
+	if err != nil {
+		// Keep journaling to the old file; the next pass tries again.
+		f.Close()
+		os.Remove(tmp)
+		if linked {
+			os.Remove(archive)
+		}
+		j.f, j.size, j.err = old, oldSize, nil
+		return fmt.Errorf("rotate journal: %w", err)
+	}
+	old.Close()
+	j.logger.Info("journal rotated", "archive", archive, "pending", len(j.pending))
+	return nil
+}
+
+// byPubkey returns the pending ids by pubkey. Caller holds mu.
+func (j *Journal) byPubkey() map[string][]string {
+	out := make(map[string][]string)
+	for id, pk := range j.pending {
+		out[pk] = append(out[pk], id)
+	}
+	return out
+}
+
+// Sync flushes the journal to disk. The rescuer syncs before deleting, so
+// no event is deleted unless its forward is on disk. It returns the first
+// write or sync failure since Open, even if this sync succeeds.
+func (j *Journal) Sync() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.err = fmt.Errorf("sync journal: %w", err)
+	}
+	return j.err
+}
+
+// Close syncs and closes the journal.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,264 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func silent() *slog.Logger { return slog.New(slog.NewTextHandler(io.Discard, nil)) }
+
+func open(t *testing.T, path string) *Journal {
+	t.Helper()
+	j, err := Open(path, silent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestJournal_PendingSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	if err := j.BeginPass("full", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Forwarded("pk1", []string{"a", "b"}, []string{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Forwarded("pk2", []string{"c"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Deleted([]string{"a"}, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j = open(t, path)
+	defer j.Close()
+	got := j.Pending()
+	if len(got) != 2 || len(got["pk1"]) != 1 || got["pk1"][0] != "b" || len(got["pk2"]) != 1 || got["pk2"][0] != "c" {
+		t.Fatalf("pending = %v, want pk1:[b] pk2:[c]", got)
+	}
+
+	// Finishing the deletes clears them.
+	if err := j.Deleted([]string{"b", "c"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Pending(); len(got) != 0 {
+		t.Fatalf("pending after delete = %v", got)
+	}
+}
+
+func TestJournal_EntriesCarryPassAndGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	j.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	j.BeginPass("pubkeys", 3)
+	j.Forwarded("pk", []string{"a"}, nil)
+	j.BeginPass("full", 0)
+	j.Deleted([]string{"a"}, nil)
+	j.Forwarded("pk", nil, nil) // nothing to record
+	j.Close()
+
+	es := readEntries(t, path)
+	if len(es) != 4 {
+		t.Fatalf("%d entries, want 4: %+v", len(es), es)
+	}
+	if es[0].Op != OpPass || es[0].Kind != "pubkeys" || es[0].Pass != "20240501T120001.000Z" || es[0].Generation != 3 {
+		t.Errorf("first pass entry = %+v", es[0])
+	}
+	if es[1].Op != OpForward || es[1].Pass != es[0].Pass || es[1].Generation != 3 || es[1].Pubkey != "pk" {
+		t.Errorf("forward entry = %+v", es[1])
+	}
+	if es[3].Op != OpDelete || es[3].Pass != es[2].Pass || es[3].Pass == es[0].Pass {
+		t.Errorf("delete entry = %+v, want second pass %q", es[3], es[2].Pass)
+	}
+}
+
+func TestJournal_TornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	good := `{"time":"2024-05-01T12:00:00Z","pass":"p","op":"forward","pubkey":"pk","ok":["a","b"]}` + "\n"
+	if err := os.WriteFile(path, []byte(good+"not json\n"+`{"op":"delete","ok":["a"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j := open(t, path)
+	if got := j.Pending()["pk"]; len(got) != 2 {
+		t.Fatalf("pending = %v; the torn delete must not count", got)
+	}
+	if err := j.Deleted([]string{"a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// The unreadable but complete line is kept; only the torn tail goes.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || lines[1] != "not json" {
+		t.Fatalf("journal after append:\n%s", data)
+	}
+	var e Entry
+	if err := json.Unmarshal([]byte(lines[2]), &e); err != nil || e.Op != OpDelete {
+		t.Fatalf("appended line %q: %v", lines[2], err)
+	}
+}
+
+func TestJournal_Nil(t *testing.T) {
+	var j *Journal
+	if err := j.BeginPass("full", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Forwarded("pk", []string{"a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Deleted([]string{"a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p := j.Pending(); p != nil {
+		t.Fatalf("pending = %v", p)
+	}
+}
+
+func TestJournal_ConcurrentForwards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			id := string(rune('a' + i))
+			j.Forwarded("pk"+id, []string{id}, nil)
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+	j.Close()
+
+	var ids []string
+	for _, e := range readEntries(t, path) {
+		ids = append(ids, e.OK...)
+	}
+	sort.Strings(ids)
+	if len(ids) != 8 || ids[0] != "a" || ids[7] != "h" {
+		t.Fatalf("ids = %v", ids)
+	}
+}
+
+// TestJournal_AppendsAfterTruncate: if something truncates the file under an
+// open journal, the next entry goes at the new end, not at the old offset
+// behind a run of NUL bytes.
+func TestJournal_AppendsAfterTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	defer j.Close()
+	j.Forwarded("pk", []string{"a", "b", "c"}, nil)
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	j.Deleted([]string{"a"}, nil)
+	j.Sync()
+
+	es := readEntries(t, path)
+	if len(es) != 1 || es[0].Op != OpDelete {
+		t.Fatalf("entries after truncate = %+v, want only the delete", es)
+	}
+}
+
+func TestJournal_WriteErrorIsSticky(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	j.f.Close() // every write now fails
+
+	if err := j.Forwarded("pk", []string{"a"}, nil); err == nil {
+		t.Fatal("Forwarded on a closed file succeeded")
+	}
+	if err := j.Sync(); err == nil {
+		t.Fatal("Sync succeeded after a failed write; the forward is not on disk")
+	}
+	if err := j.Sync(); err == nil {
+		t.Fatal("a second Sync forgot the failed write")
+	}
+}
+
+func TestJournal_RotateKeepsPending(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.jsonl")
+	j := open(t, path)
+	j.SetMaxSize(1)
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	j.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	j.BeginPass("full", 3) // empty file: no rotation
+	j.Forwarded("pk1", []string{"a", "b"}, nil)
+	j.Forwarded("pk2", []string{"c"}, nil)
+	j.Deleted([]string{"a"}, nil)
+	if err := j.BeginPass("full", 4); err != nil {
+		t.Fatal(err)
+	}
+	j.Deleted([]string{"c"}, nil)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, _ := filepath.Glob(path + ".2024*")
+	if len(archives) != 1 {
+		t.Fatalf("archives = %v, want one", archives)
+	}
+	if old := readEntries(t, archives[0]); len(old) != 4 {
+		t.Errorf("archive holds %d entries, want the 4 written before rotating", len(old))
+	}
+	es := readEntries(t, path)
+	if len(es) != 5 || es[0].Kind != "rotate" || es[3].Kind != "full" || es[3].Generation != 4 {
+		t.Fatalf("rotated journal = %+v", es)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("rotation left its temp file behind")
+	}
+
+	j = open(t, path)
+	defer j.Close()
+	if got := j.Pending(); len(got) != 1 || len(got["pk1"]) != 1 || got["pk1"][0] != "b" {
+		t.Fatalf("pending after rotation = %v, want pk1:[b]", got)
+	}
+}
@@ -0,0 +1,515 @@
+package lmdbreader
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+)
+
+// StreamFilter reads strfry's Event indexes instead of walking every
+// payload. Each index is a DUPSORT table whose values are 8-byte levIds
+// (the EventPayload key) and whose keys are, per golpe.yaml:
+//
+//	Event__id          id(32)     ‖ created_at(8)
+//	Event__pubkey      pubkey(32) ‖ created_at(8)
+//	Event__kind        kind(8)    ‖ created_at(8)
+//	Event__pubkeyKind  pubkey(32) ‖ kind(8) ‖ created_at(8)
+//	Event__created_at  created_at(8), MDB_INTEGERKEY
+//
+// Integers are native-endian uint64, ids and pubkeys raw bytes.
+//
+// Comparator caveat: strfry sorts the first four with golpe's custom
+// comparators (byte prefix, then the trailing integers numerically). LMDB
+// comparators are per-process and lmdb-go can't register one, so our
+// cursors compare keys with plain memcmp. Iterating is unaffected, but a
+// seek only lands correctly when memcmp and golpe agree on which keys sort
+// below the seek key. They do for "prefix ‖ all-zero integers", so every
+// seek here is to the start of an id, a pubkey, or the table; kinds and
+// created_at are then filtered from the key as entries are walked.
+// Event__created_at uses LMDB's own integer comparator and seeks freely.
+
+// Event index table names.
+const (
+	idIndex         = "Event__id"
+	pubkeyIndex     = "Event__pubkey"
+	kindIndex       = "Event__kind"
+	pubkeyKindIndex = "Event__pubkeyKind"
+	createdAtIndex  = "Event__created_at"
+)
+
+// Filter is the subset of a NIP-01 filter the indexes can answer: every
+// non-empty field must match. Tag filters are not supported.
+type Filter struct {
+	IDs     []string // lowercase or uppercase 64-char hex
+	Authors []string // lowercase or uppercase 64-char hex
+	Kinds   []int
+	Since   int64 // created_at >= Since; 0 = unbounded
+	Until   int64 // created_at <= Until; 0 = unbounded
+	// Limit, if > 0, returns only the newest Limit events, newest first.
+	// Without it events come in index order.
+	Limit int
+}
+
+// ErrBadFilter is returned through errs when a Filter can't be used.
+var ErrBadFilter = errors.New("lmdbreader: bad filter")
+
+// candidate is one index hit: the levId to look up and the created_at the
+// index key carried, so a Limit can be applied before any payload is read.
+type candidate struct {
+	levID     uint64
+	createdAt int64
+}
+
+// StreamFilter is Stream restricted to the events matching f. It picks one
+// index for f — ids, else authors (with kinds: pubkeyKind), else kinds,
+// else created_at — and decompresses only the payloads of its hits. Every
+// event is checked against the whole filter before it is emitted.
+func StreamFilter(ctx context.Context, lmdbPath string, mapSize int64, f Filter, logger *slog.Logger) (<-chan RawEvent, <-chan error) {
+	m, err := newMatcher(f)
+	if err != nil {
+		events := make(chan RawEvent)
+		errs := make(chan error, 1)
+		close(events)
+		errs <- err
+		close(errs)
+		return events, errs
+	}
+
+	return read(ctx, lmdbPath, mapSize, logger, func(r *eventReader, emit func(RawEvent) error) error {
+		// fetch reads one hit's payload and emits it if the event matches,
+		// reporting whether it did.
+		fetch := func(c candidate) (bool, error) {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			var key [8]byte
+			binary.NativeEndian.PutUint64(key[:], c.levID)
+			val, err := r.txn.Get(r.payloadDB, key[:])
+			if lmdb.IsNotFound(err) {
+				r.logger.Warn("lmdbreader: index points at a missing payload", "lev_id", c.levID)
+				return false, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("get payload %d: %w", c.levID, err)
+			}
+			ev, ok := r.decode(val)
+			if !ok || !m.matches(ev) {
+				return false, nil
+			}
+			return true, emit(ev)
+		}
+
+		if f.Limit <= 0 {
+			return m.scan(r.txn, func(c candidate) error {
+				_, err := fetch(c)
+				return err
+			})
+		}
+		// Newest first: gather the hits, sort by the created_at from their
+		// index keys, and stop reading payloads once Limit events are out.
+		var hits []candidate
+		if err := m.scan(r.txn, func(c candidate) error {
+			hits = append(hits, c)
+			return nil
+		}); err != nil {
+			return err
+		}
+		slices.SortFunc(hits, func(a, b candidate) int {
+			return cmp.Or(cmp.Compare(b.createdAt, a.createdAt), cmp.Compare(b.levID, a.levID))
+		})
+		sent := 0
+		for _, c := range hits {
+			if sent == f.Limit {
+				break
+			}
+			ok, err := fetch(c)
+			if err != nil {
+				return err
+			}
+			if ok {
+				sent++
+			}
+		}
+		return nil
+	})
+}
+
+// matcher is a validated Filter: hex decoded, sets built.
+type matcher struct {
+	ids     [][]byte
+	authors [][]byte
+	kinds   map[int]struct{}
+	maxKind int
+	since   int64
+	until   int64 // math.MaxInt64 when unbounded
+
+	idSet     map[string]struct{}
+	authorSet map[string]struct{}
+}
+
+func newMatcher(f Filter) (*matcher, error) {
+	m := &matcher{since: f.Since, until: f.Until}
+	if m.until == 0 {
+		m.until = math.MaxInt64
+	}
+	var err error
+	if m.ids, m.idSet, err = decodeHex32(f.IDs); err != nil {
+		return nil, fmt.Errorf("%w: ids: %v", ErrBadFilter, err)
+	}
+	if m.authors, m.authorSet, err = decodeHex32(f.Authors); err != nil {
+		return nil, fmt.Errorf("%w: authors: %v", ErrBadFilter, err)
+	}
+	if len(f.Kinds) > 0 {
+		m.kinds = make(map[int]struct{}, len(f.Kinds))
+		for _, k := range f.Kinds {
+			if k < 0 {
+				return nil, fmt.Errorf("%w: negative kind %d", ErrBadFilter, k)
+			}
+			m.kinds[k] = struct{}{}
+			m.maxKind = max(m.maxKind, k)
+		}
+	}
+	return m, nil
+}
+
+// decodeHex32 decodes and dedupes 32-byte hex values, in sorted order so
+// index seeks move forward.
+func decodeHex32(in []string) ([][]byte, map[string]struct{}, error) {
+	if len(in) == 0 {
+		return nil, nil, nil
+	}
+	set := make(map[string]struct{}, len(in))
+	for _, s := range in {
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != 32 {
+			return nil, nil, fmt.Errorf("%q is not 64 hex characters", s)
+		}
+		set[string(b)] = struct{}{}
+	}
+	out := make([][]byte, 0, len(set))
+	for k := range set {
+		out = append(out, []byte(k))
+	}
+	slices.SortFunc(out, bytes.Compare)
+	return out, set, nil
+}
+
+// inTime reports whether createdAt is within [since, until].
+func (m *matcher) inTime(createdAt int64) bool {
+	return createdAt >= m.since && createdAt <= m.until
+}
+
+func (m *matcher) hasKind(kind int) bool {
+	if m.kinds == nil {
+		return true
+	}
+	_, ok := m.kinds[kind]
+	return ok
+}
+
+// matches checks a decoded event against the whole filter. Index keys
+// already narrowed the candidates; this catches the fields the chosen index
+// doesn't cover.
+func (m *matcher) matches(ev RawEvent) bool {
+	if !m.inTime(ev.CreatedAt) || !m.hasKind(ev.Kind) {
+		return false
+	}
+	if m.idSet != nil && !hexIn(m.idSet, ev.ID) {
+		return false
+	}
+	if m.authorSet != nil && !hexIn(m.authorSet, ev.PubKey) {
+		return false
+	}
+	return true
+}
+
+func hexIn(set map[string]struct{}, s string) bool {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return false
+	}
+	_, ok := set[string(b)]
+	return ok
+}
+
+// scan walks the index best suited to the filter and calls fn for each
+// entry whose key matches the filter fields that index covers.
+func (m *matcher) scan(txn *lmdb.Txn, fn func(candidate) error) error {
+	switch {
+	case m.ids != nil:
+		return m.scanPrefixes(txn, idIndex, m.ids, 8, func(suffix []byte) (int64, bool) {
+			ts := int64(binary.NativeEndian.Uint64(suffix))
+			return ts, m.inTime(ts)
+		}, fn)
+	case m.authors != nil && m.kinds != nil:
+		return m.scanPrefixes(txn, pubkeyKindIndex, m.authors, 16, func(suffix []byte) (int64, bool) {
+			kind := binary.NativeEndian.Uint64(suffix[:8])
+			ts := int64(binary.NativeEndian.Uint64(suffix[8:]))
+			return ts, m.hasKind(int(kind)) && m.inTime(ts)
+		}, fn)
+	case m.authors != nil:
+		return m.scanPrefixes(txn, pubkeyIndex, m.authors, 8, func(suffix []byte) (int64, bool) {
+			ts := int64(binary.NativeEndian.Uint64(suffix))
+			return ts, m.inTime(ts)
+		}, fn)
+	case m.kinds != nil:
+		return m.scanKinds(txn, fn)
+	default:
+		return m.scanCreatedAt(txn, fn)
+	}
+}
+
+// scanPrefixes visits, for each prefix, the index entries whose key is
+// prefix followed by suffixLen bytes of integers. check decodes the suffix
+// into created_at and says whether the entry is a hit.
+func (m *matcher) scanPrefixes(txn *lmdb.Txn, table string, prefixes [][]byte, suffixLen int, check func(suffix []byte) (int64, bool), fn func(candidate) error) error {
+	return withCursor(txn, table, func(cur *lmdb.Cursor) error {
+		for _, prefix := range prefixes {
+			seek := make([]byte, len(prefix)+suffixLen)
+			copy(seek, prefix)
+			key, val, err := cur.Get(seek, nil, lmdb.SetRange)
+			for ; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+				if len(key) != len(seek) || !bytes.HasPrefix(key, prefix) {
+					break
+				}
+				ts, ok := check(key[len(prefix):])
+				if !ok {
+					continue
+				}
+				if err := visit(val, ts, fn); err != nil {
+					return err
+				}
+			}
+			if err != nil && !lmdb.IsNotFound(err) {
+				return fmt.Errorf("%s cursor: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// scanKinds walks Event__kind from the start, since it can't seek to a
+// kind (see the comparator caveat), and stops after the largest kind asked
+// for. Cheap for the low kinds that make up most traffic.
+func (m *matcher) scanKinds(txn *lmdb.Txn, fn func(candidate) error) error {
+	return withCursor(txn, kindIndex, func(cur *lmdb.Cursor) error {
+		key, val, err := cur.Get(nil, nil, lmdb.First)
+		for ; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+			if len(key) != 16 {
+				continue
+			}
+			kind := binary.NativeEndian.Uint64(key[:8])
+			if kind > uint64(m.maxKind) {
+				return nil
+			}
+			ts := int64(binary.NativeEndian.Uint64(key[8:]))
+			if !m.hasKind(int(kind)) || !m.inTime(ts) {
+				continue
+			}
+			if err := visit(val, ts, fn); err != nil {
+				return err
+			}
+		}
+		if !lmdb.IsNotFound(err) {
+			return fmt.Errorf("%s cursor: %w", kindIndex, err)
+		}
+		return nil
+	})
+}
+
+// scanCreatedAt walks Event__created_at from Since to Until.
+func (m *matcher) scanCreatedAt(txn *lmdb.Txn, fn func(candidate) error) error {
+	return withCursor(txn, createdAtIndex, func(cur *lmdb.Cursor) error {
+		var seek [8]byte
+		binary.NativeEndian.PutUint64(seek[:], uint64(max(m.since, 0)))
+		key, val, err := cur.Get(seek[:], nil, lmdb.SetRange)
+		for ; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+			if len(key) != 8 {
+				continue
+			}
+			ts := int64(binary.NativeEndian.Uint64(key))
+			if ts > m.until {
+				return nil
+			}
+			if err := visit(val, ts, fn); err != nil {
+				return err
+			}
+		}
+		if !lmdb.IsNotFound(err) {
+			return fmt.Errorf("%s cursor: %w", createdAtIndex, err)
+		}
+		return nil
+	})
+}
+
+// visit reports one index value (a levId) to fn.
+func visit(val []byte, createdAt int64, fn func(candidate) error) error {
+	if len(val) != 8 {
+		return nil
+	}
+	return fn(candidate{levID: binary.NativeEndian.Uint64(val), createdAt: createdAt})
+}
+
+func withCursor(txn *lmdb.Txn, table string, fn func(*lmdb.Cursor) error) error {
+	dbi, err := openTable(txn, table)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", table, err)
+	}
+	cur, err := txn.OpenCursor(dbi)
+	if err != nil {
+		return fmt.Errorf("open %s cursor: %w", table, err)
+	}
+	defer cur.Close()
+	return fn(cur)
+}
+
+// Author tallies one pubkey's events.
+type Author struct {
+	Pubkey string
+	Events int
+	Kinds  map[int]int // events per kind
+	Oldest int64       // lowest created_at
+	Newest int64       // highest created_at
+}
+
+// Authors tallies every pubkey's events from the Event__pubkeyKind index
+// alone. No payload is read, so it costs one index walk however large or
+// compressed the events are. Authors come sorted by pubkey.
+func Authors(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger) ([]Author, error) {
+	byPubkey := make(map[string]*Author)
+	err := view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+		return withCursor(r.txn, pubkeyKindIndex, func(cur *lmdb.Cursor) error {
+			key, _, err := cur.Get(nil, nil, lmdb.First)
+			for n := 0; err == nil; key, _, err = cur.Get(nil, nil, lmdb.Next) {
+				if n++; n%4096 == 0 {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+				}
+				if len(key) != 48 {
+					continue
+				}
+				pk := hex.EncodeToString(key[:32])
+				kind := int(binary.NativeEndian.Uint64(key[32:40]))
+				ts := int64(binary.NativeEndian.Uint64(key[40:]))
+				a := byPubkey[pk]
+				if a == nil {
+					a = &Author{Pubkey: pk, Kinds: make(map[int]int), Oldest: ts, Newest: ts}
+					byPubkey[pk] = a
+				}
+				a.Events++
+				a.Kinds[kind]++
+				a.Oldest = min(a.Oldest, ts)
+				a.Newest = max(a.Newest, ts)
+			}
+			if !lmdb.IsNotFound(err) {
+				return fmt.Errorf("%s cursor: %w", pubkeyKindIndex, err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Author, 0, len(byPubkey))
+	for _, a := range byPubkey {
+		out = append(out, *a)
+	}
+	slices.SortFunc(out, func(a, b Author) int { return cmp.Compare(a.Pubkey, b.Pubkey) })
+	return out, nil
+}
+
+// Entry is one event as strfry's indexes describe it, without its payload.
+type Entry struct {
+	LevID     uint64
+	Pubkey    string
+	CreatedAt int64
+	Size      int // stored payload bytes, compression flag included
+}
+
+// Entries calls fn for every event listed in the Event__pubkey index, with
+// the stored size of its payload. Payloads are looked up but never
+// decoded, so a walk costs index pages and one B-tree lookup per event.
+func Entries(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger, fn func(Entry) error) error {
+	return view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+		return withCursor(r.txn, pubkeyIndex, func(cur *lmdb.Cursor) error {
+			key, val, err := cur.Get(nil, nil, lmdb.First)
+			for n := 0; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+				if n++; n%4096 == 0 {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+				}
+				if len(key) != 40 || len(val) != 8 {
+					continue
+				}
+				e := Entry{
+					LevID:     binary.NativeEndian.Uint64(val),
+					Pubkey:    hex.EncodeToString(key[:32]),
+					CreatedAt: int64(binary.NativeEndian.Uint64(key[32:])),
+				}
+				payload, err := r.txn.Get(r.payloadDB, val)
+				if lmdb.IsNotFound(err) {
+					r.logger.Warn("lmdbreader: index points at a missing payload", "lev_id", e.LevID)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("get payload %d: %w", e.LevID, err)
+				}
+				e.Size = len(payload)
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			if !lmdb.IsNotFound(err) {
+				return fmt.Errorf("%s cursor: %w", pubkeyIndex, err)
+			}
+			return nil
+		})
+	})
+}
+
+// IDs maps levIds to event ids by walking the Event__id index. strfry never
+// reuses a levId, so ids resolved in a later transaction than the one the
+// levIds came from still name the same events; levIds deleted in between
+// are simply absent from the result.
+func IDs(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger, levIDs []uint64) (map[uint64]string, error) {
+	want := make(map[uint64]struct{}, len(levIDs))
+	for _, lev := range levIDs {
+		want[lev] = struct{}{}
+	}
+	out := make(map[uint64]string, len(levIDs))
+	err := view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+		return withCursor(r.txn, idIndex, func(cur *lmdb.Cursor) error {
+			key, val, err := cur.Get(nil, nil, lmdb.First)
+			for n := 0; err == nil && len(out) < len(want); key, val, err = cur.Get(nil, nil, lmdb.Next) {
+				if n++; n%4096 == 0 {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+				}
+				if len(key) != 40 || len(val) != 8 {
+					continue
+				}
+				lev := binary.NativeEndian.Uint64(val)
+				if _, ok := want[lev]; ok {
+					out[lev] = hex.EncodeToString(key[:32])
+				}
+			}
+			if err != nil && !lmdb.IsNotFound(err) {
+				return fmt.Errorf("%s cursor: %w", idIndex, err)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
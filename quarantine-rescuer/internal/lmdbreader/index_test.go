@@ -0,0 +1,299 @@
+package lmdbreader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+)
+
+// testEvent is one event of a synthetic strfry database.
+type testEvent struct {
+	lev       uint64
+	id        string
+	pubkey    string
+	kind      int
+	createdAt int64
+	payload   []byte // nil = the event's JSON, uncompressed
+}
+
+func hex32(n int) string { return fmt.Sprintf("%064x", n) }
+
+func u64(v uint64) []byte { return binary.NativeEndian.AppendUint64(nil, v) }
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// buildIndexedEnv writes evs the way strfry lays them out: prefixed table
+// names, an EventPayload row per event and one entry per Event__* index.
+// Kinds stay below 256 so memcmp order (used here, see index.go) agrees
+// with golpe's numeric order on the kind.
+func buildIndexedEnv(t *testing.T, dir string, evs []testEvent) {
+	t.Helper()
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	if err := env.SetMaxDBs(MaxDBs); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.SetMapSize(64 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Open(dir, 0, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const dup = lmdb.Create | lmdb.DupSort | lmdb.DupFixed | lmdb.IntegerDup
+	err = env.Update(func(txn *lmdb.Txn) error {
+		open := func(name string, flags uint) lmdb.DBI {
+			dbi, err := txn.OpenDBI(tablePrefix+name, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return dbi
+		}
+		payloadDB := open(payloadDBI, lmdb.Create|lmdb.IntegerKey)
+		idDB := open(idIndex, dup)
+		pubkeyDB := open(pubkeyIndex, dup)
+		kindDB := open(kindIndex, dup)
+		pubkeyKindDB := open(pubkeyKindIndex, dup)
+		createdAtDB := open(createdAtIndex, dup|lmdb.IntegerKey)
+
+		for _, ev := range evs {
+			payload := ev.payload
+			if payload == nil {
+				payload = rawPayload(fmt.Sprintf(`{"id":%q,"pubkey":%q,"kind":%d,"created_at":%d}`,
+					ev.id, ev.pubkey, ev.kind, ev.createdAt))
+			}
+			lev := u64(ev.lev)
+			ts := u64(uint64(ev.createdAt))
+			kind := u64(uint64(ev.kind))
+			id, pk := mustHex(t, ev.id), mustHex(t, ev.pubkey)
+			for _, put := range []struct {
+				dbi lmdb.DBI
+				key []byte
+				val []byte
+			}{
+				{payloadDB, lev, payload},
+				{idDB, slices.Concat(id, ts), lev},
+				{pubkeyDB, slices.Concat(pk, ts), lev},
+				{kindDB, slices.Concat(kind, ts), lev},
+				{pubkeyKindDB, slices.Concat(pk, kind, ts), lev},
+				{createdAtDB, ts, lev},
+			} {
+				if err := txn.Put(put.dbi, put.key, put.val, 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixture: two authors, kinds 0/1/3, created_at 100..600.
+var (
+	pk1 = hex32(0xa1)
+	pk2 = hex32(0xb2)
+
+	fixture = []testEvent{
+		{lev: 1, id: hex32(1), pubkey: pk1, kind: 1, createdAt: 100},
+		{lev: 2, id: hex32(2), pubkey: pk2, kind: 1, createdAt: 200},
+		{lev: 3, id: hex32(3), pubkey: pk1, kind: 0, createdAt: 300},
+		{lev: 4, id: hex32(4), pubkey: pk1, kind: 3, createdAt: 400},
+		{lev: 5, id: hex32(5), pubkey: pk2, kind: 3, createdAt: 500},
+		{lev: 6, id: hex32(6), pubkey: pk1, kind: 1, createdAt: 600},
+	}
+)
+
+func queryIDs(t *testing.T, dir string, f Filter, logger *slog.Logger) ([]string, error) {
+	t.Helper()
+	events, errs := StreamFilter(context.Background(), dir, 64*1024*1024, f, logger)
+	var ids []string
+	for ev := range events {
+		if len(ev.Raw) == 0 {
+			t.Errorf("event %s has no raw bytes", ev.ID)
+		}
+		// Short names keep the failures readable: hex32(4) -> "4".
+		ids = append(ids, strings.TrimLeft(ev.ID, "0"))
+	}
+	return ids, <-errs
+}
+
+func TestStreamFilter(t *testing.T) {
+	dir := t.TempDir()
+	buildIndexedEnv(t, dir, fixture)
+
+	for _, tt := range []struct {
+		name   string
+		f      Filter
+		want   string
+		sorted bool // compare as a set; index order isn't part of the contract
+	}{
+		{"authors", Filter{Authors: []string{pk1}}, "1 3 4 6", true},
+		{"authors and time", Filter{Authors: []string{pk1}, Since: 300, Until: 400}, "3 4", true},
+		{"authors and kinds", Filter{Authors: []string{pk1, pk2}, Kinds: []int{3}}, "4 5", true},
+		{"kinds", Filter{Kinds: []int{0, 3}}, "3 4 5", true},
+		{"kinds and time", Filter{Kinds: []int{1}, Since: 150}, "2 6", true},
+		{"time", Filter{Since: 200, Until: 500}, "2 3 4 5", false},
+		{"ids", Filter{IDs: []string{hex32(5), hex32(2), hex32(99)}}, "2 5", true},
+		{"ids and authors", Filter{IDs: []string{hex32(5), hex32(4)}, Authors: []string{pk1}}, "4", true},
+		{"uppercase hex", Filter{Authors: []string{strings.ToUpper(pk2)}}, "2 5", true},
+		{"no match", Filter{Authors: []string{hex32(0xff)}}, "", true},
+		{"all", Filter{}, "1 2 3 4 5 6", false},
+		{"limit is newest first", Filter{Limit: 3}, "6 5 4", false},
+		{"limit with authors", Filter{Authors: []string{pk1}, Kinds: []int{1, 3}, Limit: 2}, "6 4", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := queryIDs(t, dir, tt.f, newSilentLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sorted {
+				slices.Sort(ids)
+			}
+			if got := strings.Join(ids, " "); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamFilter_DecodesOnlyHits(t *testing.T) {
+	// pk2's payload is garbage. A query for pk1 must never read it, which
+	// the absence of a decode warning proves.
+	evs := slices.Clone(fixture)
+	evs[1].payload = []byte{0x99, 0x00}
+
+	dir := t.TempDir()
+	buildIndexedEnv(t, dir, evs)
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	ids, err := queryIDs(t, dir, Filter{Authors: []string{pk1}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 {
+		t.Fatalf("got %v, want pk1's 4 events", ids)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("non-matching payload was decoded: %s", logs.String())
+	}
+
+	// A query that does hit it skips it with a warning.
+	ids, err = queryIDs(t, dir, Filter{Authors: []string{pk2}}, logger)
+	if err != nil || len(ids) != 1 || !strings.Contains(logs.String(), "undecodable") {
+		t.Fatalf("got %v (err %v), logs %q; want the bad payload skipped", ids, err, logs.String())
+	}
+}
+
+func TestStreamFilter_BadFilter(t *testing.T) {
+	for _, f := range []Filter{
+		{Authors: []string{"abc"}},
+		{IDs: []string{strings.Repeat("zz", 32)}},
+		{Kinds: []int{-1}},
+	} {
+		if _, err := queryIDs(t, t.TempDir(), f, newSilentLogger()); !errors.Is(err, ErrBadFilter) {
+			t.Errorf("%+v: err = %v, want ErrBadFilter", f, err)
+		}
+	}
+}
+
+func TestStreamFilter_MissingIndex(t *testing.T) {
+	// A database without the Event indexes (only EventPayload) can still
+	// be streamed in full, but not filtered.
+	dir := t.TempDir()
+	buildSyntheticEnv(t, dir, map[uint64][]byte{1: rawPayload(`{"id":"a","pubkey":"p","kind":1,"created_at":1}`)}, nil)
+
+	_, err := queryIDs(t, dir, Filter{Kinds: []int{1}}, newSilentLogger())
+	if err == nil || !strings.Contains(err.Error(), kindIndex) {
+		t.Fatalf("err = %v, want a missing %s error", err, kindIndex)
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	dir := t.TempDir()
+	// A payload Authors must never need: it doesn't decode.
+	evs := append(slices.Clone(fixture), testEvent{lev: 7, id: hex32(7), pubkey: pk2, kind: 1, createdAt: 50, payload: []byte{0x07}})
+	buildIndexedEnv(t, dir, evs)
+
+	got, err := Authors(context.Background(), dir, 64*1024*1024, newSilentLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Pubkey != pk1 || got[1].Pubkey != pk2 {
+		t.Fatalf("authors = %+v", got)
+	}
+	a := got[0]
+	if a.Events != 4 || a.Kinds[0] != 1 || a.Kinds[1] != 2 || a.Kinds[3] != 1 || a.Oldest != 100 || a.Newest != 600 {
+		t.Errorf("pk1 = %+v", a)
+	}
+	b := got[1]
+	if b.Events != 3 || b.Kinds[1] != 2 || b.Kinds[3] != 1 || b.Oldest != 50 || b.Newest != 500 {
+		t.Errorf("pk2 = %+v", b)
+	}
+}
+
+func TestEntriesAndIDs(t *testing.T) {
+	dir := t.TempDir()
+	buildIndexedEnv(t, dir, fixture)
+
+	var got []Entry
+	err := Entries(context.Background(), dir, 64*1024*1024, newSilentLogger(), func(e Entry) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(fixture) {
+		t.Fatalf("%d entries, want %d", len(got), len(fixture))
+	}
+	for _, e := range got {
+		ev := fixture[e.LevID-1]
+		want := len(rawPayload(fmt.Sprintf(`{"id":%q,"pubkey":%q,"kind":%d,"created_at":%d}`, ev.id, ev.pubkey, ev.kind, ev.createdAt)))
+		if e.Pubkey != ev.pubkey || e.CreatedAt != ev.createdAt || e.Size != want {
+			t.Errorf("entry %+v, want pubkey %s created_at %d size %d", e, ev.pubkey, ev.createdAt, want)
+		}
+	}
+
+	ids, err := IDs(context.Background(), dir, 64*1024*1024, newSilentLogger(), []uint64{2, 5, 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[2] != hex32(2) || ids[5] != hex32(5) {
+		t.Fatalf("ids = %v", ids)
+	}
+}
+
+func TestStream_PrefixedTables(t *testing.T) {
+	// strfry's real table names carry the rasgueadb prefix.
+	dir := t.TempDir()
+	buildIndexedEnv(t, dir, fixture)
+	got, err := collectEvents(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(fixture) {
+		t.Fatalf("got %d events, want %d", len(got), len(fixture))
+	}
+}
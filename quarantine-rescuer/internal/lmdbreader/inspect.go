@@ -0,0 +1,102 @@
+package lmdbreader
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+)
+
+// Payload is one EventPayload row as stored, for tools that inspect the
+// database rather than consume its events. Decode is lazy, so a walk that
+// only looks at the storage fields never decompresses anything.
+type Payload struct {
+	LevID      uint64
+	Compressed bool   // zstd (flag 0x01)
+	DictID     uint32 // set when Compressed
+	Size       int    // stored bytes, flag and dict id included
+
+	val []byte
+	r   *eventReader
+}
+
+// Decode returns the event JSON, decompressing it if needed. The bytes are
+// only valid until the WalkPayloads callback returns.
+func (p Payload) Decode() ([]byte, error) {
+	return decodePayload(p.val, p.r.dec, p.r.dictCache, p.r.txn, p.r.dictDB)
+}
+
+// WalkPayloads calls fn for every EventPayload row, in levId order, inside
+// one read transaction — a consistent snapshot however long the walk
+// takes. Undecodable rows are passed to fn like any other; it is up to fn
+// to call Decode and judge. A non-nil error from fn stops the walk and is
+// returned.
+func WalkPayloads(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger, fn func(Payload) error) error {
+	return view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+		cur, err := r.txn.OpenCursor(r.payloadDB)
+		if err != nil {
+			return fmt.Errorf("open cursor: %w", err)
+		}
+		defer cur.Close()
+
+		key, val, err := cur.Get(nil, nil, lmdb.First)
+		for ; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := Payload{Size: len(val), val: val, r: r}
+			if len(key) == 8 {
+				p.LevID = binary.NativeEndian.Uint64(key)
+			}
+			if len(val) >= 5 && val[0] == 0x01 {
+				p.Compressed = true
+				p.DictID = binary.NativeEndian.Uint32(val[1:5])
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if !lmdb.IsNotFound(err) {
+			return fmt.Errorf("cursor get: %w", err)
+		}
+		return nil
+	})
+}
+
+// Dictionary is one CompressionDictionary entry.
+type Dictionary struct {
+	ID   uint32
+	Size int
+}
+
+// Dictionaries lists the zstd dictionaries strfry has trained, by id. A
+// database that never compressed anything has none.
+func Dictionaries(lmdbPath string, mapSize int64, logger *slog.Logger) ([]Dictionary, error) {
+	var dicts []Dictionary
+	err := view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+		if !r.hasDicts {
+			return nil
+		}
+		cur, err := r.txn.OpenCursor(r.dictDB)
+		if err != nil {
+			return fmt.Errorf("open cursor: %w", err)
+		}
+		defer cur.Close()
+
+		key, val, err := cur.Get(nil, nil, lmdb.First)
+		for ; err == nil; key, val, err = cur.Get(nil, nil, lmdb.Next) {
+			if len(key) != 8 {
+				continue
+			}
+			// Keys are uint64s, ids uint32 (see dictCache.decoderFor).
+			dicts = append(dicts, Dictionary{ID: uint32(binary.LittleEndian.Uint64(key)), Size: len(val)})
+		}
+		if !lmdb.IsNotFound(err) {
+			return fmt.Errorf("cursor get: %w", err)
+		}
+		return nil
+	})
+	return dicts, err
+}
@@ -0,0 +1,74 @@
+package lmdbreader
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWalkPayloads(t *testing.T) {
+	dir := t.TempDir()
+	good := rawPayload(`{"id":"a","pubkey":"p","kind":1,"created_at":1}`)
+	buildSyntheticEnv(t, dir, map[uint64][]byte{
+		1: good,
+		2: zstdPayload(7, []byte("not a zstd frame")),
+		3: {0x99},
+	}, map[uint64][]byte{7: []byte("dict")})
+
+	var got []Payload
+	var decodeErrs []bool
+	err := WalkPayloads(context.Background(), dir, 64*1024*1024, newSilentLogger(), func(p Payload) error {
+		_, err := p.Decode()
+		got = append(got, p)
+		decodeErrs = append(decodeErrs, err != nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("walked %d payloads, want 3", len(got))
+	}
+	if p := got[0]; p.LevID != 1 || p.Compressed || p.Size != len(good) || decodeErrs[0] {
+		t.Errorf("raw payload = %+v, decode failed %v", p, decodeErrs[0])
+	}
+	if p := got[1]; p.LevID != 2 || !p.Compressed || p.DictID != 7 || !decodeErrs[1] {
+		t.Errorf("zstd payload = %+v, decode failed %v; want dict 7 and a decode error", p, decodeErrs[1])
+	}
+	if p := got[2]; p.Compressed || !decodeErrs[2] {
+		t.Errorf("unknown flag payload = %+v, want a decode error", p)
+	}
+}
+
+func TestWalkPayloads_StopsOnCallbackError(t *testing.T) {
+	dir := t.TempDir()
+	buildSyntheticEnv(t, dir, map[uint64][]byte{1: rawPayload(`{}`), 2: rawPayload(`{}`)}, nil)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := WalkPayloads(context.Background(), dir, 64*1024*1024, newSilentLogger(), func(Payload) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("err = %v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func TestDictionaries(t *testing.T) {
+	dir := t.TempDir()
+	buildSyntheticEnv(t, dir, map[uint64][]byte{}, map[uint64][]byte{1: make([]byte, 100), 2: make([]byte, 50)})
+	dicts, err := Dictionaries(dir, 64*1024*1024, newSilentLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dicts) != 2 || dicts[0] != (Dictionary{ID: 1, Size: 100}) || dicts[1] != (Dictionary{ID: 2, Size: 50}) {
+		t.Fatalf("dicts = %+v", dicts)
+	}
+
+	empty := t.TempDir()
+	buildSyntheticEnv(t, empty, map[uint64][]byte{}, nil)
+	if dicts, err := Dictionaries(empty, 64*1024*1024, newSilentLogger()); err != nil || len(dicts) != 0 {
+		t.Fatalf("no dictionary table: dicts = %+v, err = %v", dicts, err)
+	}
+}
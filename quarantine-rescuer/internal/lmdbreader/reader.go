@@ -9,7 +9,8 @@
 // moment it began; strfry's writer continues unaffected.
 //
 // We rely on strfry's documented LMDB schema (see
-// https://github.com/hoytech/strfry/blob/master/golpe.yaml). Two tables:
+// https://github.com/hoytech/strfry/blob/master/golpe.yaml). Every table
+// name carries rasgueadb's "rasgueadb_defaultDb__" prefix. Stream reads two:
 //
 //   - EventPayload (raw, MDB_INTEGERKEY): keys are uint64 levIds. Values
 //     start with a one-byte compression flag:
@@ -17,8 +18,10 @@
 //     0x01 — zstd; followed by 4-byte native-endian dict id, then payload
 //   - CompressionDictionary: maps dict id to the zstd dictionary bytes.
 //
-// We don't touch the indexed Event table — the JSON in EventPayload
+// Stream doesn't touch the indexed Event table — the JSON in EventPayload
 // already contains everything we need (id, pubkey, kind, created_at).
+// StreamFilter (index.go) uses its indexes to read only the events that
+// match a filter.
 package lmdbreader
 
 import (
@@ -50,6 +53,10 @@ const (
 	dictDBI    = "CompressionDictionary"
 )
 
+// tablePrefix is the prefix rasgueadb gives every table name in the
+// strfry environment.
+const tablePrefix = "rasgueadb_defaultDb__"
+
 // RawEvent is re-exported from internal/event for back-compatibility
 // of intra-module call sites; the underlying type lives there.
 type RawEvent = event.RawEvent
@@ -68,106 +75,166 @@ type minEvent struct {
 // event. The events channel closes on EOF or error; errs receives at most
 // one terminal error after the events channel is drained.
 func Stream(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger) (<-chan RawEvent, <-chan error) {
-	if logger == nil {
-		logger = slog.Default()
-	}
-	if mapSize <= 0 {
-		mapSize = DefaultMapSize
-	}
+	return read(ctx, lmdbPath, mapSize, logger, func(r *eventReader, emit func(RawEvent) error) error {
+		cur, err := r.txn.OpenCursor(r.payloadDB)
+		if err != nil {
+			return fmt.Errorf("open cursor: %w", err)
+		}
+		defer cur.Close()
+
+		op := uint(lmdb.First)
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			_, val, err := cur.Get(nil, nil, op)
+			op = lmdb.Next
+			if lmdb.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("cursor get: %w", err)
+			}
+			ev, ok := r.decode(val)
+			if !ok {
+				continue
+			}
+			if err := emit(ev); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// eventReader decodes EventPayload values inside one read transaction.
+type eventReader struct {
+	txn       *lmdb.Txn
+	payloadDB lmdb.DBI
+	dictDB    lmdb.DBI
+	hasDicts  bool // the CompressionDictionary table exists
+	dec       *zstd.Decoder
+	dictCache *dictCache
+	logger    *slog.Logger
+}
+
+// read runs fn in a read transaction over the LMDB at lmdbPath, on its own
+// goroutine, with the event and error channels Stream documents. emit sends
+// one event, failing once ctx is cancelled.
+func read(ctx context.Context, lmdbPath string, mapSize int64, logger *slog.Logger, fn func(r *eventReader, emit func(RawEvent) error) error) (<-chan RawEvent, <-chan error) {
 	events := make(chan RawEvent, 256)
 	errs := make(chan error, 1)
 
+	emit := func(ev RawEvent) error {
+		select {
+		case events <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
 	go func() {
 		defer close(events)
 		defer close(errs)
 
-		env, err := openEnv(lmdbPath, mapSize)
+		err := view(lmdbPath, mapSize, logger, func(r *eventReader) error {
+			return fn(r, emit)
+		})
 		if err != nil {
-			errs <- fmt.Errorf("open lmdb env at %s: %w", lmdbPath, err)
-			return
+			errs <- err
 		}
-		defer env.Close()
+	}()
 
-		dec, err := zstd.NewReader(nil) // no default dict; dicts are loaded lazily per dictID
-		if err != nil {
-			errs <- fmt.Errorf("init zstd decoder: %w", err)
-			return
-		}
-		defer dec.Close()
+	return events, errs
+}
+
+// view opens the LMDB at lmdbPath read-only and runs fn in one read
+// transaction, with the payload and dictionary tables open.
+func view(lmdbPath string, mapSize int64, logger *slog.Logger, fn func(r *eventReader) error) error {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if mapSize <= 0 {
+		mapSize = DefaultMapSize
+	}
 
-		dictCache := newDictCache()
+	env, err := openEnv(lmdbPath, mapSize)
+	if err != nil {
+		return fmt.Errorf("open lmdb env at %s: %w", lmdbPath, err)
+	}
+	defer env.Close()
 
-		err = env.View(func(txn *lmdb.Txn) error {
-			payloadDB, err := txn.OpenDBI(payloadDBI, 0)
-			if err != nil {
-				return fmt.Errorf("open %s: %w", payloadDBI, err)
-			}
-			dictDB, err := txn.OpenDBI(dictDBI, 0)
-			if err != nil && !lmdb.IsNotFound(err) {
-				// Missing CompressionDictionary table is fine — it just
-				// means nothing was ever compressed. Real errors aren't.
-				return fmt.Errorf("open %s: %w", dictDBI, err)
-			}
+	dec, err := zstd.NewReader(nil) // no default dict; dicts are loaded lazily per dictID
+	if err != nil {
+		return fmt.Errorf("init zstd decoder: %w", err)
+	}
+	defer dec.Close()
 
-			cur, err := txn.OpenCursor(payloadDB)
-			if err != nil {
-				return fmt.Errorf("open cursor: %w", err)
-			}
-			defer cur.Close()
-
-			op := uint(lmdb.First)
-			for {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-				}
-				_, val, err := cur.Get(nil, nil, op)
-				op = lmdb.Next
-				if lmdb.IsNotFound(err) {
-					return nil
-				}
-				if err != nil {
-					return fmt.Errorf("cursor get: %w", err)
-				}
-				jsonBytes, err := decodePayload(val, dec, dictCache, txn, dictDB)
-				if err != nil {
-					logger.Warn("lmdbreader: skipping undecodable event", "err", err)
-					continue
-				}
-				ev, err := parseMinEvent(jsonBytes)
-				if err != nil {
-					logger.Warn("lmdbreader: skipping unparseable JSON", "err", err)
-					continue
-				}
-				if ev.ID == "" || ev.PubKey == "" {
-					logger.Warn("lmdbreader: skipping event with empty id/pubkey")
-					continue
-				}
-				// Copy: cursor reuses memory, and we send to a channel
-				// that may outlive this iteration.
-				rawCopy := make([]byte, len(jsonBytes))
-				copy(rawCopy, jsonBytes)
-
-				select {
-				case events <- RawEvent{
-					ID:        ev.ID,
-					PubKey:    ev.PubKey,
-					Kind:      ev.Kind,
-					CreatedAt: ev.CreatedAt,
-					Raw:       rawCopy,
-				}:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
-		})
+	dictCache := newDictCache()
+	defer dictCache.Close()
+
+	return env.View(func(txn *lmdb.Txn) error {
+		payloadDB, err := openTable(txn, payloadDBI)
 		if err != nil {
-			errs <- err
+			return fmt.Errorf("open %s: %w", payloadDBI, err)
 		}
-	}()
+		dictDB, err := openTable(txn, dictDBI)
+		if err != nil && !lmdb.IsNotFound(err) {
+			// Missing CompressionDictionary table is fine — it just
+			// means nothing was ever compressed. Real errors aren't.
+			return fmt.Errorf("open %s: %w", dictDBI, err)
+		}
+		return fn(&eventReader{
+			txn:       txn,
+			payloadDB: payloadDB,
+			dictDB:    dictDB,
+			hasDicts:  err == nil,
+			dec:       dec,
+			dictCache: dictCache,
+			logger:    logger,
+		})
+	})
+}
 
-	return events, errs
+// decode turns one EventPayload value into a RawEvent, logging and
+// reporting false for values that can't be decoded.
+func (r *eventReader) decode(val []byte) (RawEvent, bool) {
+	jsonBytes, err := decodePayload(val, r.dec, r.dictCache, r.txn, r.dictDB)
+	if err != nil {
+		r.logger.Warn("lmdbreader: skipping undecodable event", "err", err)
+		return RawEvent{}, false
+	}
+	ev, err := parseMinEvent(jsonBytes)
+	if err != nil {
+		r.logger.Warn("lmdbreader: skipping unparseable JSON", "err", err)
+		return RawEvent{}, false
+	}
+	if ev.ID == "" || ev.PubKey == "" {
+		r.logger.Warn("lmdbreader: skipping event with empty id/pubkey")
+		return RawEvent{}, false
+	}
+	// Copy: cursor reuses memory, and we send to a channel
+	// that may outlive this iteration.
+	rawCopy := make([]byte, len(jsonBytes))
+	copy(rawCopy, jsonBytes)
+	return RawEvent{
+		ID:        ev.ID,
+		PubKey:    ev.PubKey,
+		Kind:      ev.Kind,
+		CreatedAt: ev.CreatedAt,
+		Raw:       rawCopy,
+	}, true
+}
+
+// openTable opens a strfry table by its golpe name, e.g. "EventPayload".
+// rasgueadb stores every table as rasgueadb_defaultDb__<name>; the bare
+// name is accepted too, for databases laid out without the prefix.
+func openTable(txn *lmdb.Txn, name string) (lmdb.DBI, error) {
+	dbi, err := txn.OpenDBI(tablePrefix+name, 0)
+	if lmdb.IsNotFound(err) {
+		return txn.OpenDBI(name, 0)
+	}
+	return dbi, err
 }
 
 func openEnv(path string, mapSize int64) (*lmdb.Env, error) {
@@ -0,0 +1,263 @@
+package pwot
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"quarantine-rescuer/internal/wot"
+)
+
+// Verdicts a Cluster can get.
+const (
+	// VerdictCommunity: trusted accounts already follow several members.
+	// Its seed candidates would bring it into the web of trust.
+	VerdictCommunity = "community"
+	// VerdictSybil: dense, and no trusted account follows any member.
+	VerdictSybil = "sybil"
+	// VerdictUnclear: neither; look at it by hand.
+	VerdictUnclear = "unclear"
+)
+
+// Defaults for Options.
+const (
+	DefaultCore         = 2
+	DefaultMinSize      = 5
+	DefaultMinReached   = 2
+	DefaultSybilDensity = 0.3
+	DefaultBatchSize    = 500
+)
+
+// seedCandidates is how many seed candidates a community lists.
+const seedCandidates = 5
+
+// Trust is the trusted graph: wot.Client.
+type Trust interface {
+	Profiles(ctx context.Context, pubkeys []string) (map[string]wot.Profile, error)
+	TrustedFollowers(ctx context.Context, pubkeys []string) (map[string]int, error)
+}
+
+// Options tunes Analyze.
+type Options struct {
+	Core         int     // k of the k-core clusters are cut from
+	MinSize      int     // smallest cluster reported
+	MinReached   int     // members with a trusted follower for VerdictCommunity
+	SybilDensity float64 // density from which an unreached cluster is VerdictSybil
+	BatchSize    int     // pubkeys per Dgraph query
+	Members      bool    // list every member in the report
+}
+
+// Cluster is one dense component of the quarantine follow graph.
+type Cluster struct {
+	Verdict       string  `json:"verdict"`
+	Size          int     `json:"size"`
+	InternalEdges int     `json:"internal_edges"` // follows between members
+	Density       float64 `json:"density"`        // internal_edges / size·(size−1)
+	Reciprocity   float64 `json:"reciprocity"`    // share of internal follows that are mutual
+	// TrustedFollowers counts follows from trusted accounts to members, and
+	// ReachedMembers the members with at least one.
+	TrustedFollowers int `json:"trusted_followers"`
+	ReachedMembers   int `json:"reached_members"`
+	// TrustedFollows counts follows from members to trusted accounts, and
+	// TrustedTargets the distinct trusted accounts followed.
+	TrustedFollows int `json:"trusted_follows"`
+	TrustedTargets int `json:"trusted_targets"`
+	// SeedCandidates are a community's most followed members inside it.
+	SeedCandidates []string `json:"seed_candidates,omitempty"`
+	Members        []string `json:"members,omitempty"`
+
+	key string // smallest member pubkey, to order ties
+}
+
+// Report is the result of Analyze.
+type Report struct {
+	Authors        int       `json:"authors"`         // quarantined pubkeys with a follow list
+	TrustedAuthors int       `json:"trusted_authors"` // of those, already trusted in Dgraph and left out
+	Edges          int       `json:"edges"`           // follows in the quarantine's lists
+	Clusters       []Cluster `json:"clusters"`
+}
+
+// Analyze finds g's clusters and measures them against trust. Authors
+// Dgraph already trusts (since rescued, or not yet) are left out of the
+// graph. Clusters come communities first, most reached first, then
+// unclear and sybil ones, largest first.
+func Analyze(ctx context.Context, g *Graph, trust Trust, opts Options, logger *slog.Logger) (*Report, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	authors := g.Authors()
+	rep := &Report{Authors: len(authors), Edges: g.Edges(), Clusters: []Cluster{}}
+
+	authorProfiles, err := profiles(ctx, trust, authors, opts.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("author profiles: %w", err)
+	}
+	excluded := make(map[int32]bool)
+	for pk, p := range authorProfiles {
+		if p.TrustDistance != nil {
+			excluded[g.ids[pk]] = true
+		}
+	}
+	rep.TrustedAuthors = len(excluded)
+
+	comps := g.components(excluded, opts.Core, opts.MinSize)
+	logger.Info("clusters found", "authors", len(authors), "trusted_authors", len(excluded), "clusters", len(comps))
+	if len(comps) == 0 {
+		return rep, nil
+	}
+
+	// Look up everything the clusters follow outside themselves, and who
+	// follows their members.
+	inComp := make(map[int32]int, len(comps))
+	for i, comp := range comps {
+		for _, m := range comp {
+			inComp[m] = i
+		}
+	}
+	targetSet := make(map[int32]bool)
+	var members []string
+	for i, comp := range comps {
+		for _, m := range comp {
+			members = append(members, g.names[m])
+			for _, t := range g.lists[m].follows {
+				if c, ok := inComp[t]; !ok || c != i {
+					targetSet[t] = true
+				}
+			}
+		}
+	}
+	targets := make([]string, 0, len(targetSet))
+	for t := range targetSet {
+		if p, ok := authorProfiles[g.names[t]]; ok && p.TrustDistance != nil {
+			continue // already known
+		}
+		targets = append(targets, g.names[t])
+	}
+	slices.Sort(targets)
+	targetProfiles, err := profiles(ctx, trust, targets, opts.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("target profiles: %w", err)
+	}
+	trusted := make(map[int32]bool)
+	for _, ps := range []map[string]wot.Profile{authorProfiles, targetProfiles} {
+		for pk, p := range ps {
+			if p.TrustDistance != nil {
+				trusted[g.ids[pk]] = true
+			}
+		}
+	}
+	followers := make(map[string]int, len(members))
+	for lo := 0; lo < len(members); lo += opts.BatchSize {
+		got, err := trust.TrustedFollowers(ctx, members[lo:min(lo+opts.BatchSize, len(members))])
+		if err != nil {
+			return nil, fmt.Errorf("trusted followers: %w", err)
+		}
+		for pk, n := range got {
+			followers[pk] = n
+		}
+	}
+
+	for i, comp := range comps {
+		rep.Clusters = append(rep.Clusters, g.measure(i, comp, inComp, trusted, followers, opts))
+	}
+	rank := map[string]int{VerdictCommunity: 0, VerdictUnclear: 1, VerdictSybil: 2}
+	slices.SortFunc(rep.Clusters, func(a, b Cluster) int {
+		return cmp.Or(
+			cmp.Compare(rank[a.Verdict], rank[b.Verdict]),
+			cmp.Compare(b.ReachedMembers, a.ReachedMembers),
+			cmp.Compare(b.Size, a.Size),
+			cmp.Compare(a.key, b.key),
+		)
+	})
+	return rep, nil
+}
+
+func (g *Graph) measure(idx int, comp []int32, inComp map[int32]int, trusted map[int32]bool, followers map[string]int, opts Options) Cluster {
+	// comp is sorted by id, not by pubkey.
+	c := Cluster{Size: len(comp), key: g.names[comp[0]]}
+	for _, m := range comp[1:] {
+		c.key = min(c.key, g.names[m])
+	}
+	edges := make(map[[2]int32]bool)
+	inDegree := make(map[int32]int, len(comp))
+	targets := make(map[int32]bool)
+	for _, m := range comp {
+		for _, t := range g.lists[m].follows {
+			if i, ok := inComp[t]; ok && i == idx {
+				edges[[2]int32{m, t}] = true
+				inDegree[t]++
+			} else if trusted[t] {
+				c.TrustedFollows++
+				targets[t] = true
+			}
+		}
+		if n := followers[g.names[m]]; n > 0 {
+			c.TrustedFollowers += n
+			c.ReachedMembers++
+		}
+	}
+	c.InternalEdges = len(edges)
+	c.TrustedTargets = len(targets)
+	if c.Size > 1 {
+		c.Density = float64(c.InternalEdges) / float64(c.Size*(c.Size-1))
+	}
+	mutual := 0
+	for e := range edges {
+		if edges[[2]int32{e[1], e[0]}] {
+			mutual++
+		}
+	}
+	if c.InternalEdges > 0 {
+		c.Reciprocity = float64(mutual) / float64(c.InternalEdges)
+	}
+
+	switch {
+	case c.ReachedMembers >= opts.MinReached:
+		c.Verdict = VerdictCommunity
+	case c.TrustedFollowers == 0 && c.Density >= opts.SybilDensity:
+		c.Verdict = VerdictSybil
+	default:
+		c.Verdict = VerdictUnclear
+	}
+
+	if c.Verdict == VerdictCommunity {
+		ranked := slices.Clone(comp)
+		slices.SortFunc(ranked, func(a, b int32) int {
+			return cmp.Or(
+				cmp.Compare(inDegree[b], inDegree[a]),
+				cmp.Compare(followers[g.names[b]], followers[g.names[a]]),
+				cmp.Compare(g.names[a], g.names[b]),
+			)
+		})
+		for _, m := range ranked[:min(seedCandidates, len(ranked))] {
+			c.SeedCandidates = append(c.SeedCandidates, g.names[m])
+		}
+	}
+	if opts.Members {
+		for _, m := range comp {
+			c.Members = append(c.Members, g.names[m])
+		}
+		slices.Sort(c.Members)
+	}
+	return c
+}
+
+// profiles looks pubkeys up in batches.
+func profiles(ctx context.Context, trust Trust, pubkeys []string, batch int) (map[string]wot.Profile, error) {
+	out := make(map[string]wot.Profile)
+	for lo := 0; lo < len(pubkeys); lo += batch {
+		got, err := trust.Profiles(ctx, pubkeys[lo:min(lo+batch, len(pubkeys))])
+		if err != nil {
+			return nil, err
+		}
+		for pk, p := range got {
+			out[pk] = p
+		}
+	}
+	return out, nil
+}
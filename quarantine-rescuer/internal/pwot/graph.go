@@ -0,0 +1,183 @@
+// Package pwot looks for parallel webs of trust among quarantined pubkeys:
+// follow clusters the crawler's seed never reached. It builds the follow
+// graph of the quarantine's kind 3 lists, keeps its dense part (the k-core:
+// every member follows or is followed by at least k others), splits that
+// into connected components and measures each component's edges into the
+// trusted graph in Dgraph.
+//
+// A community real people built is usually reached from outside: a few
+// trusted accounts already follow some of its members. A sybil farm is
+// usually a near-clique that follows out to popular trusted accounts but
+// that no trusted account follows back. Analyze labels components on those
+// two signals; the labels are leads for a moderator, not decisions.
+package pwot
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Graph is the follow graph of quarantined authors. Every pubkey, author
+// or followed, is interned once.
+type Graph struct {
+	ids   map[string]int32
+	names []string
+	lists map[int32]followList // by author: its newest kind 3
+}
+
+type followList struct {
+	createdAt int64
+	follows   []int32
+}
+
+// NewGraph returns an empty graph.
+func NewGraph() *Graph {
+	return &Graph{ids: make(map[string]int32), lists: make(map[int32]followList)}
+}
+
+func (g *Graph) intern(pk string) int32 {
+	id, ok := g.ids[pk]
+	if !ok {
+		id = int32(len(g.names))
+		g.ids[pk] = id
+		g.names = append(g.names, pk)
+	}
+	return id
+}
+
+// Add records pubkey's follow list as of createdAt. Like a relay, the graph
+// keeps only each author's newest list.
+func (g *Graph) Add(pubkey string, createdAt int64, follows []string) {
+	a := g.intern(strings.ToLower(pubkey))
+	if cur, ok := g.lists[a]; ok && cur.createdAt >= createdAt {
+		return
+	}
+	ids := make([]int32, 0, len(follows))
+	for _, f := range follows {
+		if t := g.intern(f); t != a {
+			ids = append(ids, t)
+		}
+	}
+	g.lists[a] = followList{createdAt: createdAt, follows: ids}
+}
+
+// Authors returns the pubkeys with a follow list, sorted.
+func (g *Graph) Authors() []string {
+	out := make([]string, 0, len(g.lists))
+	for a := range g.lists {
+		out = append(out, g.names[a])
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Edges returns the number of follows recorded, to any pubkey.
+func (g *Graph) Edges() int {
+	n := 0
+	for _, l := range g.lists {
+		n += len(l.follows)
+	}
+	return n
+}
+
+// components returns the connected components, at least minSize strong,
+// of the k-core of the undirected graph between authors not in excluded.
+// Members are sorted by id.
+func (g *Graph) components(excluded map[int32]bool, k, minSize int) [][]int32 {
+	isNode := func(id int32) bool {
+		_, ok := g.lists[id]
+		return ok && !excluded[id]
+	}
+	adj := make(map[int32][]int32)
+	for a, l := range g.lists {
+		if excluded[a] {
+			continue
+		}
+		for _, t := range l.follows {
+			if isNode(t) {
+				adj[a] = append(adj[a], t)
+				adj[t] = append(adj[t], a)
+			}
+		}
+	}
+	for a, ns := range adj {
+		slices.Sort(ns)
+		adj[a] = slices.Compact(ns)
+	}
+
+	// Peel nodes with fewer than k neighbours until none are left.
+	deg := make(map[int32]int, len(adj))
+	var queue []int32
+	for a, ns := range adj {
+		deg[a] = len(ns)
+		if deg[a] < k {
+			queue = append(queue, a)
+		}
+	}
+	removed := make(map[int32]bool)
+	for len(queue) > 0 {
+		a := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if removed[a] {
+			continue
+		}
+		removed[a] = true
+		for _, n := range adj[a] {
+			if !removed[n] {
+				if deg[n]--; deg[n] < k {
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+
+	seen := make(map[int32]bool)
+	var out [][]int32
+	for a := range adj {
+		if removed[a] || seen[a] {
+			continue
+		}
+		comp := []int32{a}
+		seen[a] = true
+		for i := 0; i < len(comp); i++ {
+			for _, n := range adj[comp[i]] {
+				if !removed[n] && !seen[n] {
+					seen[n] = true
+					comp = append(comp, n)
+				}
+			}
+		}
+		if len(comp) >= minSize {
+			slices.Sort(comp)
+			out = append(out, comp)
+		}
+	}
+	return out
+}
+
+// ParseFollows returns the distinct pubkeys in a kind 3 event's p tags,
+// lowercased. Tags that aren't a 64-char hex pubkey are skipped.
+func ParseFollows(raw []byte) ([]string, error) {
+	var ev struct {
+		Tags [][]string `json:"tags"`
+	}
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(ev.Tags))
+	var out []string
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 || tag[0] != "p" || len(tag[1]) != 64 {
+			continue
+		}
+		pk := strings.ToLower(tag[1])
+		if _, err := hex.DecodeString(pk); err != nil || seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		out = append(out, pk)
+	}
+	return out, nil
+}
@@ -0,0 +1,168 @@
+package pwot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"quarantine-rescuer/internal/wot"
+)
+
+func pk(name string) string { return fmt.Sprintf("%064x", name) }
+
+type fakeTrust struct {
+	trusted   map[string]bool
+	followers map[string]int
+	batches   []int
+}
+
+func (f *fakeTrust) Profiles(_ context.Context, pks []string) (map[string]wot.Profile, error) {
+	f.batches = append(f.batches, len(pks))
+	out := make(map[string]wot.Profile)
+	for _, p := range pks {
+		if f.trusted[p] {
+			one := 1
+			out[p] = wot.Profile{TrustDistance: &one}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeTrust) TrustedFollowers(_ context.Context, pks []string) (map[string]int, error) {
+	out := make(map[string]int)
+	for _, p := range pks {
+		if n := f.followers[p]; n > 0 {
+			out[p] = n
+		}
+	}
+	return out, nil
+}
+
+// graph has three clusters:
+//   - c0..c4, a mutual ring two trusted accounts follow into, plus a
+//     pendant that only follows c0 and a trusted author the ring follows;
+//   - s0..s5, a clique following one trusted account, followed by none;
+//   - u0..u4, a one-way ring, sparse and unreached.
+func graph() (*Graph, *fakeTrust) {
+	g := NewGraph()
+	follows := make(map[string][]string)
+	ring := func(prefix string, n int, mutual bool) {
+		for i := 0; i < n; i++ {
+			a, b := pk(fmt.Sprint(prefix, i)), pk(fmt.Sprint(prefix, (i+1)%n))
+			follows[a] = append(follows[a], b)
+			if mutual {
+				follows[b] = append(follows[b], a)
+			}
+		}
+	}
+	ring("c", 5, true)
+	follows[pk("pendant")] = []string{pk("c0")}
+	follows[pk("c3")] = append(follows[pk("c3")], pk("rescued"))
+	follows[pk("rescued")] = []string{pk("c3")}
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 6; j++ {
+			if i != j {
+				follows[pk(fmt.Sprint("s", i))] = append(follows[pk(fmt.Sprint("s", i))], pk(fmt.Sprint("s", j)))
+			}
+		}
+		follows[pk(fmt.Sprint("s", i))] = append(follows[pk(fmt.Sprint("s", i))], pk("celebrity"))
+	}
+	ring("u", 5, false)
+	for a, fs := range follows {
+		g.Add(a, 100, fs)
+	}
+	return g, &fakeTrust{
+		trusted:   map[string]bool{pk("celebrity"): true, pk("rescued"): true},
+		followers: map[string]int{pk("c0"): 2, pk("c2"): 1},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	g, trust := graph()
+	opts := Options{Core: DefaultCore, MinSize: DefaultMinSize, MinReached: DefaultMinReached, SybilDensity: DefaultSybilDensity, BatchSize: 4, Members: true}
+	rep, err := Analyze(context.Background(), g, trust, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Authors != 18 || rep.TrustedAuthors != 1 {
+		t.Errorf("authors = %d, trusted %d; want 18, 1", rep.Authors, rep.TrustedAuthors)
+	}
+	if len(rep.Clusters) != 3 {
+		t.Fatalf("clusters = %+v", rep.Clusters)
+	}
+	for _, b := range trust.batches {
+		if b > 4 {
+			t.Errorf("profile batch of %d, want <= 4", b)
+		}
+	}
+
+	c := rep.Clusters[0]
+	if c.Verdict != VerdictCommunity || c.Size != 5 || c.InternalEdges != 10 || c.Density != 0.5 || c.Reciprocity != 1 {
+		t.Errorf("community = %+v", c)
+	}
+	if c.ReachedMembers != 2 || c.TrustedFollowers != 3 || c.TrustedFollows != 1 || c.TrustedTargets != 1 {
+		t.Errorf("community trust edges = %+v", c)
+	}
+	if len(c.SeedCandidates) != 5 || c.SeedCandidates[0] != pk("c0") || c.SeedCandidates[1] != pk("c2") {
+		t.Errorf("seed candidates = %q", c.SeedCandidates)
+	}
+	if slices.Contains(c.Members, pk("pendant")) || slices.Contains(c.Members, pk("rescued")) {
+		t.Errorf("members = %q; the pendant is outside the 2-core and rescued is trusted", c.Members)
+	}
+
+	if u := rep.Clusters[1]; u.Verdict != VerdictUnclear || u.Size != 5 || u.Density != 0.25 || u.Reciprocity != 0 {
+		t.Errorf("one-way ring = %+v", u)
+	}
+
+	s := rep.Clusters[2]
+	if s.Verdict != VerdictSybil || s.Size != 6 || s.Density != 1 || s.TrustedFollowers != 0 || s.TrustedFollows != 6 || s.TrustedTargets != 1 || s.SeedCandidates != nil {
+		t.Errorf("clique = %+v", s)
+	}
+}
+
+func TestAnalyze_MinSize(t *testing.T) {
+	g, trust := graph()
+	rep, err := Analyze(context.Background(), g, trust, Options{Core: 2, MinSize: 6, MinReached: 2, SybilDensity: 0.3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Clusters) != 1 || rep.Clusters[0].Verdict != VerdictSybil || rep.Clusters[0].Members != nil {
+		t.Errorf("clusters = %+v, want only the clique, without members", rep.Clusters)
+	}
+}
+
+func TestGraph_KeepsNewestList(t *testing.T) {
+	g := NewGraph()
+	g.Add(strings.ToUpper(pk("a")), 200, []string{pk("b"), pk("c")})
+	g.Add(pk("a"), 100, []string{pk("d")})
+	if got := g.Authors(); len(got) != 1 || got[0] != pk("a") {
+		t.Fatalf("authors = %q", got)
+	}
+	if g.Edges() != 2 {
+		t.Errorf("edges = %d; the older list replaced the newer", g.Edges())
+	}
+	g.Add(pk("a"), 300, []string{pk("a"), pk("d")})
+	if g.Edges() != 1 {
+		t.Errorf("edges = %d; the newer list didn't replace, or a self-follow counted", g.Edges())
+	}
+}
+
+func TestParseFollows(t *testing.T) {
+	a, b := pk("a"), pk("b")
+	raw := fmt.Sprintf(`{"kind":3,"tags":[["p",%q,"wss://r"],["p",%q],["p",%q],["e",%q],["p","npub1x"],["p"],["p",%q]]}`,
+		a, strings.ToUpper(a), b, b, strings.Repeat("z", 64))
+	got, err := ParseFollows([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{a, b}) {
+		t.Errorf("follows = %q", got)
+	}
+	if _, err := ParseFollows([]byte("{")); err == nil {
+		t.Error("bad JSON parsed")
+	}
+}
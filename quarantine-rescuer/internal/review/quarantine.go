@@ -0,0 +1,96 @@
+package review
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"quarantine-rescuer/internal/event"
+	"quarantine-rescuer/internal/lmdbreader"
+)
+
+// Summary is one quarantined pubkey: how many events it has, of which
+// kinds, and the range of their created_at.
+type Summary struct {
+	Pubkey string      `json:"pubkey"`
+	Events int         `json:"events"`
+	Kinds  map[int]int `json:"kinds"`
+	Oldest int64       `json:"oldest"`
+	Newest int64       `json:"newest"`
+}
+
+// Quarantine is the review service's read access to the quarantine relay.
+type Quarantine interface {
+	// Summaries lists every quarantined pubkey, most events first.
+	Summaries(ctx context.Context) ([]Summary, error)
+	// Events returns a pubkey's events: with limit > 0 the newest limit,
+	// newest first, otherwise all of them.
+	Events(ctx context.Context, pubkey string, limit int) ([]event.RawEvent, error)
+	// Forget drops pubkey from the summaries until they are next rebuilt,
+	// once its events have been approved or rejected.
+	Forget(pubkey string)
+}
+
+// LMDB reads the quarantine relay's LMDB directly, read-only. Summaries
+// come from strfry's pubkey index alone and are rebuilt at most once per
+// refresh interval; events are read through the index on every call.
+type LMDB struct {
+	path    string
+	mapSize int64
+	refresh time.Duration
+	logger  *slog.Logger
+
+	mu        sync.Mutex
+	summaries []Summary
+	built     time.Time
+}
+
+// NewLMDB reads the LMDB in dir, rebuilding the pubkey summaries when
+// they are older than refresh.
+func NewLMDB(dir string, mapSize int64, refresh time.Duration, logger *slog.Logger) *LMDB {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LMDB{path: dir, mapSize: mapSize, refresh: refresh, logger: logger}
+}
+
+func (q *LMDB) Summaries(ctx context.Context) ([]Summary, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.summaries != nil && time.Since(q.built) < q.refresh {
+		return q.summaries, nil
+	}
+
+	start := time.Now()
+	authors, err := lmdbreader.Authors(ctx, q.path, q.mapSize, q.logger)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]Summary, len(authors))
+	for i, a := range authors {
+		sums[i] = Summary{Pubkey: a.Pubkey, Events: a.Events, Kinds: a.Kinds, Oldest: a.Oldest, Newest: a.Newest}
+	}
+	slices.SortStableFunc(sums, func(a, b Summary) int { return cmp.Compare(b.Events, a.Events) })
+	q.summaries, q.built = sums, time.Now()
+	q.logger.Info("quarantine summaries rebuilt", "pubkeys", len(sums), "duration_ms", time.Since(start).Milliseconds())
+	return sums, nil
+}
+
+func (q *LMDB) Events(ctx context.Context, pubkey string, limit int) ([]event.RawEvent, error) {
+	events, errs := lmdbreader.StreamFilter(ctx, q.path, q.mapSize, lmdbreader.Filter{Authors: []string{pubkey}, Limit: limit}, q.logger)
+	var out []event.RawEvent
+	for ev := range events {
+		out = append(out, ev)
+	}
+	return out, <-errs
+}
+
+func (q *LMDB) Forget(pubkey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Copy rather than edit in place: callers may still hold the old slice.
+	q.summaries = slices.DeleteFunc(slices.Clone(q.summaries), func(s Summary) bool { return s.Pubkey == pubkey })
+}
@@ -0,0 +1,504 @@
+// Package review is the quarantine review service: a JSON API over the
+// quarantine relay's contents for moderators to triage it pubkey by pubkey.
+//
+// Reads show each quarantined pubkey with its event counts, its
+// web-of-trust standing from Dgraph and, per event, the router's record of
+// why the event was quarantined. Two actions settle a pubkey:
+//
+//   - approve adds an allow override on the whitelist server, then
+//     forwards the pubkey's quarantined events to the main relay and
+//     deletes those that were accepted — a one-pubkey rescue pass;
+//   - reject deletes the pubkey's quarantined events and, if asked, adds a
+//     deny override so it is not quarantined again.
+//
+// With a Journal, each action is a pass of its own in the rescuer's run
+// journal (kind "approve" or "reject"), recording its forwards and deletes
+// the way a rescue pass does.
+package review
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"quarantine-rescuer/internal/decisions"
+	"quarantine-rescuer/internal/deleter"
+	"quarantine-rescuer/internal/event"
+	"quarantine-rescuer/internal/exporter"
+	"quarantine-rescuer/internal/forwarder"
+	"quarantine-rescuer/internal/journal"
+	"quarantine-rescuer/internal/whitelist"
+	"quarantine-rescuer/internal/wot"
+)
+
+// Page sizes.
+const (
+	DefaultPubkeyLimit = 50
+	MaxPubkeyLimit     = 500
+	DefaultEventLimit  = 100
+	MaxEventLimit      = 1000
+)
+
+// DefaultSettle is how long approve waits between adding the allow
+// override and forwarding: long enough for the main relay's plugin to see
+// the override on the whitelist change stream.
+const DefaultSettle = 2 * time.Second
+
+// maxActionBodyBytes bounds an approve or reject body.
+const maxActionBodyBytes = 4 << 10
+
+// Reasons looks up why an event was quarantined; nil when none was kept.
+type Reasons interface {
+	Get(ctx context.Context, id string) (*decisions.Record, error)
+}
+
+// Graph looks up pubkeys' web-of-trust signals.
+type Graph interface {
+	Profiles(ctx context.Context, pubkeys []string) (map[string]wot.Profile, error)
+}
+
+// Overrides records allow and deny overrides on the whitelist server, and
+// reads its generation for the journal.
+type Overrides interface {
+	SetOverride(ctx context.Context, pubkey, action, reason string) error
+	Generation(ctx context.Context) (uint64, error)
+}
+
+// Forwarder publishes events to the main relay.
+type Forwarder interface {
+	Forward(ctx context.Context, eventsByPubkey map[string][]exporter.RawEvent) forwarder.Result
+}
+
+// Deleter deletes events from the quarantine relay.
+type Deleter interface {
+	DeleteByIDs(ctx context.Context, ids []string) deleter.Result
+}
+
+// Service serves the review API. Quarantine, Overrides, Forwarder and
+// Deleter are required; without Reasons or Graph the API leaves that
+// context out.
+type Service struct {
+	Quarantine Quarantine
+	Reasons    Reasons
+	Graph      Graph
+	Overrides  Overrides
+	Forwarder  Forwarder
+	Deleter    Deleter
+	Journal    *journal.Journal // nil = no journal
+
+	// Token authorizes the actions ("Authorization: Bearer <token>").
+	// Empty keeps them disabled (403); reads need no token.
+	Token string
+	// Settle is the wait between approve's override and its forward.
+	Settle time.Duration
+	Logger *slog.Logger
+
+	actionMu sync.Mutex // one action at a time
+}
+
+// Handler returns the API:
+//
+//	GET  /health
+//	GET  /pubkeys                  quarantined pubkeys, most events first;
+//	                               offset, limit (default 50, at most 500)
+//	GET  /pubkeys/{pubkey}         one pubkey and its newest events with
+//	                               their decision records; limit (default
+//	                               100, at most 1000)
+//	POST /pubkeys/{pubkey}/approve {"reason": "..."}
+//	POST /pubkeys/{pubkey}/reject  {"reason": "...", "deny": true|false}
+func (s *Service) Handler() http.Handler {
+	if s.Logger == nil {
+		s.Logger = slog.Default()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	mux.HandleFunc("GET /pubkeys", s.handleList)
+	mux.HandleFunc("GET /pubkeys/{pubkey}", s.handleGet)
+	mux.HandleFunc("POST /pubkeys/{pubkey}/approve", s.handleApprove)
+	mux.HandleFunc("POST /pubkeys/{pubkey}/reject", s.handleReject)
+	return mux
+}
+
+// PubkeyView is a Summary with the pubkey's web-of-trust signals; WoT is
+// nil for a pubkey the crawler never reached.
+type PubkeyView struct {
+	Summary
+	WoT *wot.Profile `json:"wot"`
+}
+
+type listResponse struct {
+	Total    int          `json:"total"`
+	Offset   int          `json:"offset"`
+	Pubkeys  []PubkeyView `json:"pubkeys"`
+	WoTError string       `json:"wot_error,omitempty"`
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	offset, err := intParam(r, "offset", 0, 0, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", DefaultPubkeyLimit, 1, MaxPubkeyLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sums, err := s.Quarantine.Summaries(r.Context())
+	if err != nil {
+		s.Logger.Error("review: read quarantine", "err", err)
+		http.Error(w, "read quarantine: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	offset = min(offset, len(sums)) // before adding limit, which could overflow
+	resp := listResponse{Total: len(sums), Offset: offset, Pubkeys: []PubkeyView{}}
+	page := sums[offset:min(offset+limit, len(sums))]
+	pubkeys := make([]string, len(page))
+	for i, sum := range page {
+		resp.Pubkeys = append(resp.Pubkeys, PubkeyView{Summary: sum})
+		pubkeys[i] = sum.Pubkey
+	}
+	profiles, err := s.profiles(r.Context(), pubkeys)
+	if err != nil {
+		resp.WoTError = err.Error()
+	}
+	for i := range resp.Pubkeys {
+		if p, ok := profiles[resp.Pubkeys[i].Pubkey]; ok {
+			resp.Pubkeys[i].WoT = &p
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// EventView is one quarantined event and why it was quarantined; Decision
+// is nil when the router kept no record of it.
+type EventView struct {
+	Event    json.RawMessage   `json:"event"`
+	Decision *decisions.Record `json:"decision"`
+}
+
+type pubkeyResponse struct {
+	Summary       Summary      `json:"summary"`
+	WoT           *wot.Profile `json:"wot"`
+	Events        []EventView  `json:"events"`
+	WoTError      string       `json:"wot_error,omitempty"`
+	DecisionError string       `json:"decision_error,omitempty"`
+}
+
+func (s *Service) handleGet(w http.ResponseWriter, r *http.Request) {
+	pk, ok := pubkeyParam(w, r)
+	if !ok {
+		return
+	}
+	limit, err := intParam(r, "limit", DefaultEventLimit, 1, MaxEventLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	sums, err := s.Quarantine.Summaries(ctx)
+	if err != nil {
+		http.Error(w, "read quarantine: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events, err := s.Quarantine.Events(ctx, pk, limit)
+	if err != nil {
+		http.Error(w, "read quarantine: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "no quarantined events for this pubkey", http.StatusNotFound)
+		return
+	}
+
+	resp := pubkeyResponse{Summary: Summary{Pubkey: pk}, Events: make([]EventView, len(events))}
+	for _, sum := range sums {
+		if sum.Pubkey == pk {
+			resp.Summary = sum
+			break
+		}
+	}
+	if profiles, err := s.profiles(ctx, []string{pk}); err != nil {
+		resp.WoTError = err.Error()
+	} else if p, ok := profiles[pk]; ok {
+		resp.WoT = &p
+	}
+	for i, ev := range events {
+		resp.Events[i].Event = ev.Raw
+		if s.Reasons == nil || resp.DecisionError != "" {
+			continue
+		}
+		// One failed lookup means the listener is down or misconfigured;
+		// don't wait out a timeout per event.
+		if resp.Events[i].Decision, err = s.Reasons.Get(ctx, ev.ID); err != nil {
+			resp.DecisionError = err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Service) profiles(ctx context.Context, pubkeys []string) (map[string]wot.Profile, error) {
+	if s.Graph == nil || len(pubkeys) == 0 {
+		return nil, nil
+	}
+	profiles, err := s.Graph.Profiles(ctx, pubkeys)
+	if err != nil {
+		s.Logger.Warn("review: web-of-trust lookup failed", "pubkeys", len(pubkeys), "err", err)
+	}
+	return profiles, err
+}
+
+type actionRequest struct {
+	Reason string `json:"reason"`
+	Deny   bool   `json:"deny"`
+}
+
+// ActionResult is the outcome of an approve or reject.
+type ActionResult struct {
+	Pubkey        string   `json:"pubkey"`
+	Action        string   `json:"action"`
+	Override      string   `json:"override,omitempty"` // "allow" or "deny", if one was added
+	Events        int      `json:"events"`
+	Forwarded     int      `json:"forwarded"`
+	Deleted       int      `json:"deleted"`
+	FailedForward []string `json:"failed_forward,omitempty"`
+	Invalid       []string `json:"invalid,omitempty"` // forged; deleted, never forwarded
+	FailedDelete  []string `json:"failed_delete,omitempty"`
+}
+
+// handleApprove allows the pubkey and rescues its quarantined events.
+// - bad pubkey or body → 400; no events → 404
+// - override fails → 502, nothing is forwarded
+// - otherwise → 200 with the ActionResult; events the main relay refused
+// stay in quarantine, for a retry or the rescuer's next pass, and events
+// that fail verification are deleted without being forwarded
+func (s *Service) handleApprove(w http.ResponseWriter, r *http.Request) {
+	pk, req, ok := s.action(w, r)
+	if !ok {
+		return
+	}
+	defer s.actionMu.Unlock()
+	ctx := r.Context()
+
+	events, ok := s.allEvents(w, r, pk)
+	if !ok {
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "no quarantined events for this pubkey", http.StatusNotFound)
+		return
+	}
+	if err := s.Overrides.SetOverride(ctx, pk, whitelist.ActionAllow, orDefault(req.Reason, "approved in quarantine review")); err != nil {
+		s.Logger.Error("review: allow override failed", "pubkey", pk, "err", err)
+		http.Error(w, "allow override failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	select {
+	case <-time.After(s.Settle):
+	case <-ctx.Done():
+		return
+	}
+
+	res := ActionResult{Pubkey: pk, Action: "approve", Override: whitelist.ActionAllow, Events: len(events)}
+	raws := make([]exporter.RawEvent, len(events))
+	for i, ev := range events {
+		raws[i] = exporter.RawEvent(ev)
+	}
+	s.beginPass(ctx, "approve")
+	fwd := s.Forwarder.Forward(ctx, map[string][]exporter.RawEvent{pk: raws})
+	res.Forwarded, res.FailedForward, res.Invalid = len(fwd.SuccessIDs), fwd.FailedIDs, fwd.InvalidIDs
+	if err := s.Journal.Forwarded(pk, fwd.SuccessIDs, fwd.FailedIDs); err != nil {
+		s.Logger.Error("review: journal write failed", "pubkey", pk, "err", err)
+	}
+	// As in a rescue pass, nothing is deleted unless the journal holds its
+	// forward; forgeries go with the forwarded events.
+	ids := append(slices.Clone(fwd.SuccessIDs), fwd.InvalidIDs...)
+	if err := s.Journal.Sync(); err != nil {
+		s.Logger.Error("review: sync journal; not deleting", "pubkey", pk, "err", err)
+		res.FailedDelete = ids
+	} else if len(ids) > 0 {
+		res.Deleted, res.FailedDelete = s.delete(ctx, ids)
+	}
+	s.Quarantine.Forget(pk)
+	s.Logger.Info("review: approved", "pubkey", pk, "reason", req.Reason, "events", res.Events,
+		"forwarded", res.Forwarded, "failed_forward", len(res.FailedForward), "invalid", len(res.Invalid),
+		"deleted", res.Deleted, "failed_delete", len(res.FailedDelete))
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleReject deletes the pubkey's quarantined events, denying it first
+// if asked.
+// - bad pubkey or body → 400; no events and no deny → 404
+// - deny override fails → 502, nothing is deleted
+// - otherwise → 200 with the ActionResult
+func (s *Service) handleReject(w http.ResponseWriter, r *http.Request) {
+	pk, req, ok := s.action(w, r)
+	if !ok {
+		return
+	}
+	defer s.actionMu.Unlock()
+	ctx := r.Context()
+
+	events, ok := s.allEvents(w, r, pk)
+	if !ok {
+		return
+	}
+	if len(events) == 0 && !req.Deny {
+		http.Error(w, "no quarantined events for this pubkey", http.StatusNotFound)
+		return
+	}
+	res := ActionResult{Pubkey: pk, Action: "reject", Events: len(events)}
+	s.beginPass(ctx, "reject")
+	if req.Deny {
+		if err := s.Overrides.SetOverride(ctx, pk, whitelist.ActionDeny, orDefault(req.Reason, "rejected in quarantine review")); err != nil {
+			s.Logger.Error("review: deny override failed", "pubkey", pk, "err", err)
+			http.Error(w, "deny override failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		res.Override = whitelist.ActionDeny
+	}
+	if len(events) > 0 {
+		ids := make([]string, len(events))
+		for i, ev := range events {
+			ids[i] = ev.ID
+		}
+		res.Deleted, res.FailedDelete = s.delete(ctx, ids)
+	}
+	s.Quarantine.Forget(pk)
+	s.Logger.Info("review: rejected", "pubkey", pk, "reason", req.Reason, "deny", req.Deny,
+		"events", res.Events, "deleted", res.Deleted, "failed_delete", len(res.FailedDelete))
+	writeJSON(w, http.StatusOK, res)
+}
+
+// FinishPending deletes the events an earlier approve forwarded but never
+// deleted, because the service was stopped mid-action or the delete
+// failed, as the rescuer's phase 0 does. Call it before serving.
+func (s *Service) FinishPending(ctx context.Context) {
+	var ids []string
+	for _, pending := range s.Journal.Pending() {
+		ids = append(ids, pending...)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	s.beginPass(ctx, "pending")
+	deleted, failed := s.delete(ctx, ids)
+	s.Logger.Info("review: deleted events forwarded by an earlier approve", "deleted", deleted, "failed", len(failed))
+}
+
+// beginPass starts a journal pass for one action, stamped with the
+// whitelist generation it ran against.
+func (s *Service) beginPass(ctx context.Context, kind string) {
+	if s.Journal == nil {
+		return
+	}
+	gen, err := s.Overrides.Generation(ctx)
+	if err != nil {
+		s.Logger.Warn("review: could not read whitelist generation for the journal", "err", err)
+	}
+	if err := s.Journal.BeginPass(kind, gen); err != nil {
+		s.Logger.Error("review: journal write failed", "err", err)
+	}
+}
+
+// delete deletes ids from quarantine and journals the outcome.
+func (s *Service) delete(ctx context.Context, ids []string) (int, []string) {
+	del := s.Deleter.DeleteByIDs(ctx, ids)
+	if err := s.Journal.Deleted(del.Deleted, del.Failed); err != nil {
+		s.Logger.Error("review: journal write failed", "err", err)
+	}
+	return len(del.Deleted), del.Failed
+}
+
+// action authorizes an action request and decodes its body. On success it
+// holds actionMu, which the caller must release.
+// - no token configured → 403
+// - missing or wrong bearer token → 401 with WWW-Authenticate
+func (s *Service) action(w http.ResponseWriter, r *http.Request) (string, actionRequest, bool) {
+	var req actionRequest
+	if s.Token == "" {
+		http.Error(w, "review actions disabled", http.StatusForbidden)
+		return "", req, false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="quarantine-review"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", req, false
+	}
+	pk, ok := pubkeyParam(w, r)
+	if !ok {
+		return "", req, false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxActionBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return "", req, false
+	}
+	s.actionMu.Lock()
+	return pk, req, true
+}
+
+// allEvents reads every quarantined event of pk, answering 500 on failure.
+func (s *Service) allEvents(w http.ResponseWriter, r *http.Request, pk string) ([]event.RawEvent, bool) {
+	events, err := s.Quarantine.Events(r.Context(), pk, 0)
+	if err != nil {
+		s.Logger.Error("review: read quarantine", "pubkey", pk, "err", err)
+		http.Error(w, "read quarantine: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return events, true
+}
+
+// pubkeyParam returns the {pubkey} path value lowercased, answering 400 if
+// it is not 64-char hex.
+func pubkeyParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	pk := strings.ToLower(r.PathValue("pubkey"))
+	if b, err := hex.DecodeString(pk); err != nil || len(b) != 32 {
+		http.Error(w, "pubkey must be 64 hex characters", http.StatusBadRequest)
+		return "", false
+	}
+	return pk, true
+}
+
+// intParam parses an integer query parameter of at least lo, capped at hi
+// when hi > 0.
+func intParam(r *http.Request, name string, def, lo, hi int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo {
+		return 0, fmt.Errorf("%s must be an integer >= %d", name, lo)
+	}
+	if hi > 0 {
+		n = min(n, hi)
+	}
+	return n, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
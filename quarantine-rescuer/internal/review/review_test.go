@@ -0,0 +1,424 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"quarantine-rescuer/internal/decisions"
+	"quarantine-rescuer/internal/deleter"
+	"quarantine-rescuer/internal/event"
+	"quarantine-rescuer/internal/exporter"
+	"quarantine-rescuer/internal/forwarder"
+	"quarantine-rescuer/internal/journal"
+	"quarantine-rescuer/internal/wot"
+)
+
+var (
+	spammer  = strings.Repeat("a", 64)
+	newcomer = strings.Repeat("b", 64)
+)
+
+type fakeQuarantine struct {
+	sums      []Summary
+	events    map[string][]event.RawEvent
+	forgotten []string
+}
+
+func (q *fakeQuarantine) Summaries(context.Context) ([]Summary, error) { return q.sums, nil }
+
+func (q *fakeQuarantine) Events(_ context.Context, pk string, limit int) ([]event.RawEvent, error) {
+	evs := q.events[pk]
+	if limit > 0 && len(evs) > limit {
+		evs = evs[:limit]
+	}
+	return evs, nil
+}
+
+func (q *fakeQuarantine) Forget(pk string) { q.forgotten = append(q.forgotten, pk) }
+
+type fakeReasons map[string]*decisions.Record
+
+func (r fakeReasons) Get(_ context.Context, id string) (*decisions.Record, error) { return r[id], nil }
+
+type fakeGraph struct{ err error }
+
+func (g fakeGraph) Profiles(_ context.Context, pks []string) (map[string]wot.Profile, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	two := 2
+	return map[string]wot.Profile{newcomer: {FollowerCount: 40, TrustDistance: &two}}, nil
+}
+
+type fakeOverrides struct {
+	set []string // "action pubkey reason"
+	err error
+}
+
+func (o *fakeOverrides) SetOverride(_ context.Context, pk, action, reason string) error {
+	if o.err != nil {
+		return o.err
+	}
+	o.set = append(o.set, action+" "+pk+" "+reason)
+	return nil
+}
+
+func (o *fakeOverrides) Generation(context.Context) (uint64, error) { return 7, nil }
+
+// fakeForwarder accepts every event except those in reject, and reports
+// those in forged as failing verification.
+type fakeForwarder struct {
+	reject map[string]bool
+	forged map[string]bool
+	got    map[string][]exporter.RawEvent
+}
+
+func (f *fakeForwarder) Forward(_ context.Context, byPubkey map[string][]exporter.RawEvent) forwarder.Result {
+	f.got = byPubkey
+	var res forwarder.Result
+	for _, evs := range byPubkey {
+		for _, ev := range evs {
+			if f.forged[ev.ID] {
+				res.InvalidIDs = append(res.InvalidIDs, ev.ID)
+			} else if f.reject[ev.ID] {
+				res.FailedIDs = append(res.FailedIDs, ev.ID)
+			} else {
+				res.SuccessIDs = append(res.SuccessIDs, ev.ID)
+			}
+		}
+	}
+	return res
+}
+
+type fakeDeleter struct{ got []string }
+
+func (d *fakeDeleter) DeleteByIDs(_ context.Context, ids []string) deleter.Result {
+	d.got = append(d.got, ids...)
+	return deleter.Result{Deleted: ids}
+}
+
+type fixture struct {
+	q   *fakeQuarantine
+	ov  *fakeOverrides
+	fwd *fakeForwarder
+	del *fakeDeleter
+	svc *Service
+	srv *httptest.Server
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ev := func(id, pk string) event.RawEvent {
+		return event.RawEvent{ID: id, PubKey: pk, Kind: 1, Raw: []byte(fmt.Sprintf(`{"id":%q,"pubkey":%q}`, id, pk))}
+	}
+	fx := &fixture{
+		q: &fakeQuarantine{
+			sums: []Summary{
+				{Pubkey: spammer, Events: 3, Kinds: map[int]int{1: 3}},
+				{Pubkey: newcomer, Events: 2, Kinds: map[int]int{1: 2}},
+			},
+			events: map[string][]event.RawEvent{
+				spammer:  {ev("s1", spammer), ev("s2", spammer), ev("s3", spammer)},
+				newcomer: {ev("n1", newcomer), ev("n2", newcomer)},
+			},
+		},
+		ov:  &fakeOverrides{},
+		fwd: &fakeForwarder{},
+		del: &fakeDeleter{},
+	}
+	fx.svc = &Service{
+		Quarantine: fx.q,
+		Reasons:    fakeReasons{"n1": {ID: "n1", Reason: "not_in_wot", Flags: []string{"url_density"}}},
+		Graph:      fakeGraph{},
+		Overrides:  fx.ov,
+		Forwarder:  fx.fwd,
+		Deleter:    fx.del,
+		Token:      "secret",
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	fx.srv = httptest.NewServer(fx.svc.Handler())
+	t.Cleanup(fx.srv.Close)
+	return fx
+}
+
+func (fx *fixture) do(t *testing.T, method, path, token, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, fx.srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestList(t *testing.T) {
+	fx := newFixture(t)
+	var resp listResponse
+	if code := fx.do(t, "GET", "/pubkeys?offset=1&limit=5", "", "", &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if resp.Total != 2 || len(resp.Pubkeys) != 1 || resp.Pubkeys[0].Pubkey != newcomer {
+		t.Fatalf("page = %+v", resp)
+	}
+	if w := resp.Pubkeys[0].WoT; w == nil || w.FollowerCount != 40 || *w.TrustDistance != 2 {
+		t.Errorf("wot = %+v", w)
+	}
+
+	if code := fx.do(t, "GET", "/pubkeys?offset=9", "", "", &resp); code != http.StatusOK || len(resp.Pubkeys) != 0 {
+		t.Errorf("past the end: status %d, %d pubkeys", code, len(resp.Pubkeys))
+	}
+	if code := fx.do(t, "GET", "/pubkeys?offset="+strconv.Itoa(math.MaxInt), "", "", &resp); code != http.StatusOK || len(resp.Pubkeys) != 0 {
+		t.Errorf("offset+limit overflowing: status %d, %d pubkeys", code, len(resp.Pubkeys))
+	}
+	if code := fx.do(t, "GET", "/pubkeys?limit=0", "", "", nil); code != http.StatusBadRequest {
+		t.Errorf("limit=0: status %d, want 400", code)
+	}
+
+	// A Dgraph failure degrades the page rather than failing it.
+	fx.svc.Graph = fakeGraph{err: errors.New("dgraph down")}
+	resp = listResponse{}
+	if code := fx.do(t, "GET", "/pubkeys", "", "", &resp); code != http.StatusOK || resp.WoTError == "" || len(resp.Pubkeys) != 2 {
+		t.Errorf("dgraph down: status %d, %+v", code, resp)
+	}
+}
+
+func TestGet(t *testing.T) {
+	fx := newFixture(t)
+	var resp pubkeyResponse
+	if code := fx.do(t, "GET", "/pubkeys/"+strings.ToUpper(newcomer)+"?limit=1", "", "", &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if resp.Summary.Pubkey != newcomer || resp.Summary.Events != 2 || resp.WoT == nil || len(resp.Events) != 1 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if d := resp.Events[0].Decision; d == nil || d.Reason != "not_in_wot" || d.Flags[0] != "url_density" {
+		t.Errorf("decision = %+v", d)
+	}
+	if !strings.Contains(string(resp.Events[0].Event), `"id":"n1"`) {
+		t.Errorf("event = %s", resp.Events[0].Event)
+	}
+
+	if code := fx.do(t, "GET", "/pubkeys/"+strings.Repeat("c", 64), "", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown pubkey: status %d, want 404", code)
+	}
+	if code := fx.do(t, "GET", "/pubkeys/npub1xyz", "", "", nil); code != http.StatusBadRequest {
+		t.Errorf("bad pubkey: status %d, want 400", code)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	fx := newFixture(t)
+	fx.fwd.reject = map[string]bool{"n2": true}
+
+	var res ActionResult
+	if code := fx.do(t, "POST", "/pubkeys/"+newcomer+"/approve", "secret", `{"reason":"known artist"}`, &res); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if !slices.Equal(fx.ov.set, []string{"allow " + newcomer + " known artist"}) {
+		t.Errorf("overrides = %q", fx.ov.set)
+	}
+	if len(fx.fwd.got[newcomer]) != 2 {
+		t.Errorf("forwarded %+v, want both of the pubkey's events", fx.fwd.got)
+	}
+	// Only what the main relay accepted leaves quarantine.
+	if !slices.Equal(fx.del.got, []string{"n1"}) {
+		t.Errorf("deleted %q, want [n1]", fx.del.got)
+	}
+	if res.Override != "allow" || res.Events != 2 || res.Forwarded != 1 || res.Deleted != 1 || !slices.Equal(res.FailedForward, []string{"n2"}) {
+		t.Errorf("result = %+v", res)
+	}
+	if !slices.Equal(fx.q.forgotten, []string{newcomer}) {
+		t.Errorf("forgotten = %q", fx.q.forgotten)
+	}
+}
+
+// TestApprove_DeletesForgedEvents: an event that fails verification is
+// never forwarded and, unlike a refused one, leaves quarantine.
+func TestApprove_DeletesForgedEvents(t *testing.T) {
+	fx := newFixture(t)
+	fx.fwd.forged = map[string]bool{"n2": true}
+
+	var res ActionResult
+	if code := fx.do(t, "POST", "/pubkeys/"+newcomer+"/approve", "secret", "", &res); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if !slices.Equal(fx.del.got, []string{"n1", "n2"}) {
+		t.Errorf("deleted %q, want [n1 n2]", fx.del.got)
+	}
+	if res.Forwarded != 1 || res.Deleted != 2 || len(res.FailedForward) != 0 || !slices.Equal(res.Invalid, []string{"n2"}) {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestApprove_Journal(t *testing.T) {
+	fx := newFixture(t)
+	fx.fwd.reject = map[string]bool{"n2": true}
+	path := filepath.Join(t.TempDir(), "review.jsonl")
+	j, err := journal.Open(path, fx.svc.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fx.svc.Journal = j
+
+	if code := fx.do(t, "POST", "/pubkeys/"+newcomer+"/approve", "secret", "", nil); code != http.StatusOK {
+		t.Fatalf("approve: status %d", code)
+	}
+	if code := fx.do(t, "POST", "/pubkeys/"+spammer+"/reject", "secret", "", nil); code != http.StatusOK {
+		t.Fatalf("reject: status %d", code)
+	}
+	j.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e journal.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if e.Op != journal.OpDelete && e.Generation != 7 {
+			t.Errorf("entry %+v: generation %d, want 7", e, e.Generation)
+		}
+		ops = append(ops, e.Op+" "+e.Kind+strings.Join(e.OK, ",")+"/"+strings.Join(e.Failed, ","))
+	}
+	want := []string{
+		"pass approve/",
+		"forward n1/n2",
+		"delete n1/",
+		"pass reject/",
+		"delete s1,s2,s3/",
+	}
+	if !slices.Equal(ops, want) {
+		t.Errorf("journal = %q, want %q", ops, want)
+	}
+}
+
+// TestApprove_JournalWriteFailureDeletesNothing: a forward that never
+// reached the journal must not be deleted from quarantine.
+func TestApprove_JournalWriteFailureDeletesNothing(t *testing.T) {
+	fx := newFixture(t)
+	j, err := journal.Open(filepath.Join(t.TempDir(), "review.jsonl"), fx.svc.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close() // every write now fails
+	fx.svc.Journal = j
+
+	var res ActionResult
+	if code := fx.do(t, "POST", "/pubkeys/"+newcomer+"/approve", "secret", "", &res); code != http.StatusOK {
+		t.Fatalf("approve: status %d", code)
+	}
+	if fx.del.got != nil {
+		t.Errorf("deleted %q with the journal failing", fx.del.got)
+	}
+	if res.Deleted != 0 || len(res.FailedDelete) != res.Forwarded {
+		t.Errorf("result = %+v, want every forwarded id in failed_delete", res)
+	}
+}
+
+func TestFinishPending(t *testing.T) {
+	fx := newFixture(t)
+	path := filepath.Join(t.TempDir(), "review.jsonl")
+	j, err := journal.Open(path, fx.svc.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	// An approve that forwarded n1 and stopped before deleting it.
+	j.BeginPass("approve", 7)
+	j.Forwarded(newcomer, []string{"n1"}, nil)
+	fx.svc.Journal = j
+
+	fx.svc.FinishPending(context.Background())
+	if !slices.Equal(fx.del.got, []string{"n1"}) {
+		t.Errorf("deleted %q, want [n1]", fx.del.got)
+	}
+	if p := j.Pending(); len(p) != 0 {
+		t.Errorf("pending after FinishPending = %v", p)
+	}
+}
+
+func TestApprove_OverrideFailureForwardsNothing(t *testing.T) {
+	fx := newFixture(t)
+	fx.ov.err = errors.New("401")
+	if code := fx.do(t, "POST", "/pubkeys/"+newcomer+"/approve", "secret", "", nil); code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502", code)
+	}
+	if fx.fwd.got != nil || fx.del.got != nil {
+		t.Errorf("forwarded %v, deleted %v after a failed override", fx.fwd.got, fx.del.got)
+	}
+}
+
+func TestReject(t *testing.T) {
+	fx := newFixture(t)
+	var res ActionResult
+	if code := fx.do(t, "POST", "/pubkeys/"+spammer+"/reject", "secret", `{"reason":"spam ring","deny":true}`, &res); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if !slices.Equal(fx.ov.set, []string{"deny " + spammer + " spam ring"}) {
+		t.Errorf("overrides = %q", fx.ov.set)
+	}
+	if !slices.Equal(fx.del.got, []string{"s1", "s2", "s3"}) || res.Deleted != 3 || res.Override != "deny" {
+		t.Errorf("deleted %q, result %+v", fx.del.got, res)
+	}
+	if fx.fwd.got != nil {
+		t.Error("reject forwarded events")
+	}
+
+	// Without deny, reject only deletes.
+	fx, res = newFixture(t), ActionResult{}
+	if code := fx.do(t, "POST", "/pubkeys/"+spammer+"/reject", "secret", "", &res); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if fx.ov.set != nil || res.Override != "" || len(fx.del.got) != 3 {
+		t.Errorf("overrides %q, deleted %q", fx.ov.set, fx.del.got)
+	}
+}
+
+func TestActionAuth(t *testing.T) {
+	fx := newFixture(t)
+	path := "/pubkeys/" + spammer + "/reject"
+	if code := fx.do(t, "POST", path, "", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", code)
+	}
+	if code := fx.do(t, "POST", path, "wrong", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", code)
+	}
+	if code := fx.do(t, "POST", path, "secret", "{", nil); code != http.StatusBadRequest {
+		t.Errorf("bad body: status %d, want 400", code)
+	}
+	fx.svc.Token = ""
+	if code := fx.do(t, "POST", path, "secret", "", nil); code != http.StatusForbidden {
+		t.Errorf("no token configured: status %d, want 403", code)
+	}
+	if fx.del.got != nil {
+		t.Errorf("deleted %q without authorization", fx.del.got)
+	}
+}
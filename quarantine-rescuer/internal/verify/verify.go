@@ -0,0 +1,91 @@
+// Package verify checks that a quarantined event is what it claims to be
+// (NIP-01): its id is the sha256 of its canonical serialisation, and its sig
+// is a valid BIP-340 Schnorr signature of that id by its pubkey. The
+// forwarder runs every event through it, so a forgery that made it into the
+// quarantine LMDB is never replayed into the main relay.
+//
+// This is a copy of whitelist-plugin/pkg/verify without the seen-event cache;
+// deepfry modules do not import each other. Keep the two checks identical.
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Reason codes surfaced in logs and the summary line.
+const (
+	ReasonInvalidID        = "invalid_id"
+	ReasonInvalidSignature = "invalid_signature"
+)
+
+var (
+	// ErrInvalidID means the id is not the hash of the event.
+	ErrInvalidID = errors.New("event id does not match its hash")
+	// ErrInvalidSignature means the pubkey or sig is malformed, or the
+	// signature does not verify.
+	ErrInvalidSignature = errors.New("invalid event signature")
+)
+
+// Event recomputes evt's id and verifies its signature. It returns nil,
+// ErrInvalidID or an error wrapping ErrInvalidSignature.
+func Event(evt *nostr.Event) error {
+	hash := sha256.Sum256(evt.Serialize())
+	if hex.EncodeToString(hash[:]) != evt.ID {
+		return ErrInvalidID
+	}
+	pk, err := hex.DecodeString(evt.PubKey)
+	if err != nil {
+		return fmt.Errorf("%w: pubkey: %v", ErrInvalidSignature, err)
+	}
+	pub, err := schnorr.ParsePubKey(pk)
+	if err != nil {
+		return fmt.Errorf("%w: pubkey: %v", ErrInvalidSignature, err)
+	}
+	sb, err := hex.DecodeString(evt.Sig)
+	if err != nil {
+		return fmt.Errorf("%w: sig: %v", ErrInvalidSignature, err)
+	}
+	sig, err := schnorr.ParseSignature(sb)
+	if err != nil {
+		return fmt.Errorf("%w: sig: %v", ErrInvalidSignature, err)
+	}
+	if !sig.Verify(hash[:], pub) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Reason maps an error from Event to its reason code.
+func Reason(err error) string {
+	if errors.Is(err, ErrInvalidID) {
+		return ReasonInvalidID
+	}
+	return ReasonInvalidSignature
+}
+
+// Batch verifies evts across all CPUs and returns one error per event, nil
+// for the valid ones.
+func Batch(evts []*nostr.Event) []error {
+	errs := make([]error, len(evts))
+	workers := min(runtime.GOMAXPROCS(0), len(evts))
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < len(evts); i += workers {
+				errs[i] = Event(evts[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,53 @@
+package verify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func signed(t *testing.T, content string) *nostr.Event {
+	t.Helper()
+	evt := &nostr.Event{Kind: 1, Content: content, CreatedAt: 1700000000, Tags: nostr.Tags{}}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return evt
+}
+
+func TestEvent(t *testing.T) {
+	good := signed(t, "hello")
+	if err := Event(good); err != nil {
+		t.Fatalf("valid event: %v", err)
+	}
+
+	tampered := *good
+	tampered.Content = "goodbye"
+	if err := Event(&tampered); !errors.Is(err, ErrInvalidID) || Reason(err) != ReasonInvalidID {
+		t.Fatalf("tampered content: %v", err)
+	}
+
+	tampered.ID = tampered.GetID()
+	if err := Event(&tampered); !errors.Is(err, ErrInvalidSignature) || Reason(err) != ReasonInvalidSignature {
+		t.Fatalf("stale signature: %v", err)
+	}
+
+	bad := *good
+	bad.Sig = "00"
+	if err := Event(&bad); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("malformed sig: %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	evts := []*nostr.Event{signed(t, "a"), signed(t, "b"), signed(t, "c")}
+	evts[1].Sig = evts[0].Sig
+	errs := Batch(evts)
+	if errs[0] != nil || errs[2] != nil || !errors.Is(errs[1], ErrInvalidSignature) {
+		t.Fatalf("Batch = %v", errs)
+	}
+	if len(Batch(nil)) != 0 {
+		t.Fatal("empty batch")
+	}
+}
@@ -0,0 +1,60 @@
+package whitelist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Override actions, as whitelist-plugin/pkg/overrides defines them.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// AdminClient calls the whitelist server's /overrides admin API, which
+// needs the server's admin_token as a bearer token.
+type AdminClient struct {
+	*Client
+	token string
+}
+
+// NewAdminClient wraps c with the admin token.
+func NewAdminClient(c *Client, token string) *AdminClient {
+	return &AdminClient{Client: c, token: token}
+}
+
+type overrideRequest struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// SetOverride records an allow or deny override for pubkey via
+// POST /overrides/{pubkey}. The server applies it to the whitelist and
+// announces it on /changes straight away.
+func (c *AdminClient) SetOverride(ctx context.Context, pubkey, action, reason string) error {
+	body, err := json.Marshal(overrideRequest{Action: action, Reason: reason})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.serverURL+"/overrides/"+pubkey, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build override request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("override request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("override %s %s: status %d: %s", action, pubkey, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
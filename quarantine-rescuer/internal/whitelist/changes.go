@@ -0,0 +1,187 @@
+package whitelist
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// This is the subscriber half of whitelist-plugin/pkg/changestream, the
+// server's GET /changes Server-Sent Events feed. One message per whitelist
+// generation the client has not seen:
+//
+//	event: delta
+//	data: {"since":S,"generation":G,"added":["<hex>",...],"removed":[...]}
+//
+//	event: resync
+//	data: {"generation":G}
+//
+// plus a ": ping" comment every 15 seconds. Keep the two in sync.
+
+// changesPath is the server route of the stream.
+const changesPath = "/changes"
+
+// heartbeatInterval mirrors changestream.HeartbeatInterval. Three missed
+// heartbeats mean a dead connection.
+const heartbeatInterval = 15 * time.Second
+
+// ErrChangesUnsupported is returned by Subscriber.Run when the server has
+// no change stream (it predates it).
+var ErrChangesUnsupported = errors.New("whitelist server has no change stream")
+
+// Change is one whitelist generation. A resync carries only Generation:
+// the server could not say what changed since the generation asked for, so
+// the receiver must treat every pubkey as possibly added.
+type Change struct {
+	Resync     bool     `json:"-"`
+	Since      uint64   `json:"since,omitempty"`
+	Generation uint64   `json:"generation"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+}
+
+// Subscriber follows the server's change stream, reconnecting with backoff.
+type Subscriber struct {
+	url        string
+	httpClient *http.Client
+	logger     *slog.Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	idle       time.Duration // no bytes for this long = dead connection
+}
+
+// NewSubscriber returns a Subscriber for the server at serverURL.
+func NewSubscriber(serverURL string, logger *slog.Logger) *Subscriber {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Subscriber{
+		url: strings.TrimRight(serverURL, "/") + changesPath,
+		// No client timeout: the body is read for as long as the connection
+		// lives. Dead connections are caught by the idle watchdog.
+		httpClient: &http.Client{},
+		logger:     logger,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		idle:       3 * heartbeatInterval,
+	}
+}
+
+// Run calls fn for every change until ctx is cancelled, reconnecting after
+// any failure and resuming from the generation of the last change delivered
+// to fn. since is the generation the caller already holds; 0 means none, and
+// the server answers with a resync. fn runs on Run's goroutine and should
+// return quickly; the connection is declared dead if fn blocks for longer
+// than a few heartbeats.
+//
+// Run returns ctx.Err() on cancellation, or ErrChangesUnsupported if the
+// server answers 404.
+func (s *Subscriber) Run(ctx context.Context, since uint64, fn func(Change)) error {
+	backoff := s.minBackoff
+	for {
+		delivered, err := s.stream(ctx, &since, fn)
+		if errors.Is(err, ErrChangesUnsupported) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if delivered {
+			backoff = s.minBackoff
+		}
+		s.logger.Warn("change stream disconnected", "resume_from", since, "retry_in", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+	}
+}
+
+// stream holds one connection open, advancing *since as changes are
+// delivered. It reports whether any change was delivered, to reset the
+// backoff.
+func (s *Subscriber) stream(ctx context.Context, since *uint64, fn func(Change)) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?since=%d", s.url, *since), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, ErrChangesUnsupported
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	watchdog := time.AfterFunc(s.idle, cancel)
+	defer watchdog.Stop()
+
+	delivered := false
+	var name, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20) // a large delta is one data line
+	for scanner.Scan() {
+		watchdog.Reset(s.idle)
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data == "" {
+				continue
+			}
+			ch, err := decodeChange(name, data)
+			name, data = "", ""
+			if err != nil {
+				return delivered, err
+			}
+			fn(ch)
+			*since = ch.Generation
+			delivered = true
+		case strings.HasPrefix(line, ":"):
+			// heartbeat
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return delivered, err
+	}
+	return delivered, io.ErrUnexpectedEOF
+}
+
+func decodeChange(name, data string) (Change, error) {
+	var ch Change
+	if err := json.Unmarshal([]byte(data), &ch); err != nil {
+		return ch, fmt.Errorf("decode %s event: %w", name, err)
+	}
+	switch name {
+	case "delta":
+	case "resync":
+		ch.Resync = true
+	default:
+		return ch, fmt.Errorf("unknown event type %q", name)
+	}
+	return ch, nil
+}
@@ -0,0 +1,83 @@
+package whitelist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscriber_DeliversAndResumes(t *testing.T) {
+	var mu sync.Mutex
+	var sinces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		n := len(sinces)
+		mu.Unlock()
+		if r.URL.Path != "/changes" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		switch n {
+		case 1:
+			fmt.Fprint(w, "event: resync\nid: 5\ndata: {\"generation\":5}\n\n")
+			fmt.Fprint(w, ": ping\n\n")
+			fmt.Fprint(w, "event: delta\nid: 6\ndata: {\"since\":5,\"generation\":6,\"added\":[\"aa\",\"bb\"]}\n\n")
+			// Connection drops; the subscriber resumes from 6.
+		default:
+			fmt.Fprint(w, "event: delta\nid: 7\ndata: {\"since\":6,\"generation\":7,\"removed\":[\"aa\"]}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSubscriber(srv.URL, newSilentLogger())
+	s.minBackoff = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []Change
+	err := s.Run(ctx, 0, func(ch Change) {
+		got = append(got, ch)
+		if len(got) == 3 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run err = %v, want context.Canceled", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d changes, want 3: %+v", len(got), got)
+	}
+	if !got[0].Resync || got[0].Generation != 5 {
+		t.Errorf("first change = %+v, want resync at 5", got[0])
+	}
+	if got[1].Resync || len(got[1].Added) != 2 || got[1].Generation != 6 {
+		t.Errorf("second change = %+v", got[1])
+	}
+	if len(got[2].Removed) != 1 || got[2].Generation != 7 {
+		t.Errorf("third change = %+v", got[2])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sinces[0] != "0" || sinces[1] != "6" {
+		t.Errorf("since params = %v, want [0 6 ...]", sinces)
+	}
+}
+
+func TestSubscriber_Unsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	err := NewSubscriber(srv.URL, newSilentLogger()).Run(context.Background(), 0, func(Change) {
+		t.Error("no change expected")
+	})
+	if !errors.Is(err, ErrChangesUnsupported) {
+		t.Fatalf("err = %v, want ErrChangesUnsupported", err)
+	}
+}
@@ -2,8 +2,9 @@
 //
 // It mirrors whitelist-plugin/pkg/client to keep this module self-contained
 // (existing deepfry subsystems are independent Go modules with no
-// cross-imports). The endpoints — GET /check/{pubkey} and GET /health —
-// are defined by whitelist-plugin/pkg/server and must stay in sync.
+// cross-imports). The endpoints — GET /check/{pubkey}, GET /health,
+// GET /stats and, for AdminClient, POST /overrides/{pubkey} — are defined by
+// whitelist-plugin/pkg/server and must stay in sync.
 package whitelist
 
 import (
@@ -61,6 +62,32 @@ func (c *Client) CheckHealth(ctx context.Context) error {
 	return nil
 }
 
+type statsResponse struct {
+	Generation uint64 `json:"generation"`
+}
+
+// Generation returns the whitelist generation the server is serving, from
+// GET /stats, or 0 if the server does not track generations.
+func (c *Client) Generation(ctx context.Context) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.serverURL+"/stats", nil)
+	if err != nil {
+		return 0, fmt.Errorf("build stats request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("stats request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("stats: unexpected status %d", resp.StatusCode)
+	}
+	var body statsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decode stats: %w", err)
+	}
+	return body.Generation, nil
+}
+
 // IsWhitelisted returns true iff the server says the pubkey is on the whitelist.
 // Returns false on any error (fail-closed) — the caller is expected to have
 // already verified server reachability via CheckHealth, so transient false
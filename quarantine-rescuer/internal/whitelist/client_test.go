@@ -2,6 +2,7 @@ package whitelist
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -93,3 +94,48 @@ func TestClient_IsWhitelisted_FailsClosedOnNetworkError(t *testing.T) {
 		t.Fatal("expected fail-closed (false) on network error")
 	}
 }
+
+func TestClient_Generation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"entries":10,"last_refresh":"2024-01-01T00:00:00Z","generation":42}`)
+	}))
+	defer srv.Close()
+
+	gen, err := NewClient(srv.URL, time.Second, newSilentLogger()).Generation(context.Background())
+	if err != nil || gen != 42 {
+		t.Fatalf("Generation = %d, %v; want 42", gen, err)
+	}
+}
+
+func TestAdminClient_SetOverride(t *testing.T) {
+	var got struct {
+		path, auth string
+		body       overrideRequest
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path, got.auth = r.Method+" "+r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got.body)
+		if got.auth != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"action":"allow"}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, time.Second, newSilentLogger())
+	if err := NewAdminClient(c, "secret").SetOverride(context.Background(), "ab", ActionAllow, "reviewed"); err != nil {
+		t.Fatal(err)
+	}
+	if got.path != "POST /overrides/ab" || got.body != (overrideRequest{Action: "allow", Reason: "reviewed"}) {
+		t.Fatalf("request = %+v", got)
+	}
+
+	err := NewAdminClient(c, "wrong").SetOverride(context.Background(), "ab", ActionDeny, "")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("wrong token: err = %v, want a 401", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package wot looks up the web-of-trust signals Dgraph holds for a set of
+// pubkeys: follower_count, kept by the crawler, and trust_distance and
+// cluster_flagged, written by clusterscan --write-scores, plus how many
+// trusted accounts follow each. They are the same
+// predicates the whitelist server scores from (see
+// whitelist-plugin/pkg/repository), read here for the few pubkeys a
+// reviewer is looking at rather than for the whole graph.
+package wot
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Profile is one pubkey's signals. A pubkey the crawler never reached has
+// no Profile at all.
+type Profile struct {
+	FollowerCount  int  `json:"follower_count"`
+	TrustDistance  *int `json:"trust_distance,omitempty"` // hops from the seed set; nil = not placed by clusterscan
+	ClusterFlagged bool `json:"cluster_flagged"`
+}
+
+// Client queries Dgraph's DQL /query endpoint.
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+// NewClient returns a client for the Dgraph alpha at baseURL, e.g.
+// http://localhost:8080. A GraphQL URL (…/graphql) is accepted too.
+func NewClient(baseURL string, timeout time.Duration, logger *slog.Logger) *Client {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Client{
+		endpoint:   dqlEndpoint(baseURL),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+// dqlEndpoint maps a Dgraph base or GraphQL URL to its DQL /query URL.
+func dqlEndpoint(u string) string {
+	u = strings.TrimRight(u, "/")
+	switch {
+	case strings.HasSuffix(u, "/query"):
+		return u
+	case strings.HasSuffix(u, "/graphql"):
+		return strings.TrimSuffix(u, "/graphql") + "/query"
+	}
+	return u + "/query"
+}
+
+// Profiles returns the profiles Dgraph has for pubkeys, keyed by lowercase
+// hex pubkey. Pubkeys must be 64-char hex; they are inlined in the query.
+func (c *Client) Profiles(ctx context.Context, pubkeys []string) (map[string]Profile, error) {
+	out := make(map[string]Profile, len(pubkeys))
+	if len(pubkeys) == 0 {
+		return out, nil
+	}
+	list, err := pubkeyList(pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Pubkey string `json:"pubkey"`
+		Profile
+	}
+	if err := c.query(ctx, fmt.Sprintf(`{ q(func: eq(pubkey, [%s])) { pubkey follower_count trust_distance cluster_flagged } }`, list), &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[strings.ToLower(row.Pubkey)] = row.Profile
+	}
+	return out, nil
+}
+
+// TrustedFollowers counts, for each of pubkeys, its followers that
+// clusterscan placed in the trusted set (those with a trust_distance).
+// Pubkeys Dgraph doesn't know, or with no trusted followers, are absent.
+func (c *Client) TrustedFollowers(ctx context.Context, pubkeys []string) (map[string]int, error) {
+	out := make(map[string]int, len(pubkeys))
+	if len(pubkeys) == 0 {
+		return out, nil
+	}
+	list, err := pubkeyList(pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Pubkey string `json:"pubkey"`
+		N      int    `json:"n"`
+	}
+	if err := c.query(ctx, fmt.Sprintf(`{ q(func: eq(pubkey, [%s])) { pubkey n: count(~follows @filter(has(trust_distance))) } }`, list), &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.N > 0 {
+			out[strings.ToLower(row.Pubkey)] = row.N
+		}
+	}
+	return out, nil
+}
+
+// pubkeyList validates pubkeys as 64-char hex and renders them as a quoted
+// DQL list body.
+func pubkeyList(pubkeys []string) (string, error) {
+	quoted := make([]string, len(pubkeys))
+	for i, pk := range pubkeys {
+		if b, err := hex.DecodeString(pk); err != nil || len(b) != 32 {
+			return "", fmt.Errorf("invalid pubkey %q", pk)
+		}
+		quoted[i] = `"` + strings.ToLower(pk) + `"`
+	}
+	return strings.Join(quoted, ","), nil
+}
+
+// query runs a DQL query and decodes its "q" block into rows.
+func (c *Client) query(ctx context.Context, query string, rows any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewBufferString(query))
+	if err != nil {
+		return fmt.Errorf("build dgraph request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dql")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("dgraph query: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read dgraph response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dgraph query: unexpected status %d: %s", resp.StatusCode, body)
+	}
+
+	var response struct {
+		Data struct {
+			Q json.RawMessage `json:"q"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("decode dgraph response: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("DQL error: %s", response.Errors[0].Message)
+	}
+	if len(response.Data.Q) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Data.Q, rows); err != nil {
+		return fmt.Errorf("decode dgraph response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package wot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Profiles(t *testing.T) {
+	placed := strings.Repeat("a", 64)
+	unplaced := strings.Repeat("b", 64)
+	unknown := strings.Repeat("c", 64)
+
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query" || r.Header.Get("Content-Type") != "application/dql" {
+			t.Errorf("request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		query = string(b)
+		fmt.Fprintf(w, `{"data":{"q":[
+			{"pubkey":%q,"follower_count":120,"trust_distance":2},
+			{"pubkey":%q,"follower_count":3,"cluster_flagged":true}]}}`, placed, unplaced)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/graphql", time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	got, err := c.Profiles(context.Background(), []string{placed, strings.ToUpper(unplaced), unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `eq(pubkey, ["`+placed+`","`+unplaced+`","`+unknown+`"])`) {
+		t.Errorf("query = %s", query)
+	}
+	if p := got[placed]; p.FollowerCount != 120 || p.TrustDistance == nil || *p.TrustDistance != 2 || p.ClusterFlagged {
+		t.Errorf("placed = %+v", p)
+	}
+	if p := got[unplaced]; p.TrustDistance != nil || !p.ClusterFlagged {
+		t.Errorf("unplaced = %+v", p)
+	}
+	if _, ok := got[unknown]; ok || len(got) != 2 {
+		t.Errorf("profiles = %+v; the unknown pubkey must be absent", got)
+	}
+}
+
+func TestClient_ProfilesErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors":[{"message":"predicate not indexed"}]}`)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, time.Second, nil)
+
+	if _, err := c.Profiles(context.Background(), []string{strings.Repeat("a", 64)}); err == nil || !strings.Contains(err.Error(), "not indexed") {
+		t.Errorf("DQL error: err = %v", err)
+	}
+	if _, err := c.Profiles(context.Background(), []string{`"]) { uid } }`}); err == nil {
+		t.Error("a non-hex pubkey reached the query")
+	}
+}
+
+func TestClient_TrustedFollowers(t *testing.T) {
+	reached := strings.Repeat("a", 64)
+	alone := strings.Repeat("b", 64)
+
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		query = string(b)
+		fmt.Fprintf(w, `{"data":{"q":[{"pubkey":%q,"n":3},{"pubkey":%q,"n":0}]}}`, reached, alone)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, time.Second, nil)
+	got, err := c.TrustedFollowers(context.Background(), []string{reached, alone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, "count(~follows @filter(has(trust_distance)))") {
+		t.Errorf("query = %s", query)
+	}
+	if len(got) != 1 || got[reached] != 3 {
+		t.Errorf("trusted followers = %v, want only %s: 3", got, reached[:8])
+	}
+}
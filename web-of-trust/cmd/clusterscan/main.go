@@ -1,10 +1,13 @@
 // Command clusterscan finds suspected spam clusters in the Web-of-Trust graph
 // by graph shape alone. It computes a trusted set by propagating trust out from
-// seed pubkeys (a node joins once K trusted accounts follow it), then reports
+// seed pubkeys (a node joins once K trusted accounts follow it, each trusted
+// account muting or reporting it cancelling some of those), then reports
 // "weak bridges": non-trusted accounts that touch the trusted set through only a
 // few edges yet have a large cluster of non-trusted accounts hanging beneath
-// them. It is strictly read-only and writes a timestamped CSV + JSON report to
-// the working directory.
+// them. It writes a timestamped CSV + JSON report to the working directory and
+// is read-only unless --write-scores is given, in which case it also persists
+// each node's trust_distance and cluster_flagged for the whitelist server's
+// trust tiers.
 package main
 
 import (
@@ -43,6 +46,8 @@ func main() {
 	}
 
 	k := flag.Int("k", cfg.TrustK, "endorsements from the trusted set required to join it")
+	muteWeight := flag.Int("mute-weight", cfg.MuteWeight, "endorsements cancelled by each trusted account that mutes a node (0 = ignore mutes)")
+	reportWeight := flag.Int("report-weight", cfg.ReportWeight, "endorsements cancelled by each trusted account that reports a node (0 = ignore reports)")
 	depth := flag.Int("depth", cfg.ClusterDepth, "follows-hops to walk when sizing a cluster")
 	maxWeight := flag.Int("max-bridge-weight", cfg.MaxBridgeWeight, "max edges crossing into trusted for a node to count as a weak bridge")
 	minCluster := flag.Int("min-cluster-size", cfg.MinClusterSize, "ignore bridges whose cluster is smaller than this")
@@ -50,6 +55,7 @@ func main() {
 	outDir := flag.String("out", ".", "directory to write the report files into")
 	withMembers := flag.Bool("members", false, "include per-cluster member pubkeys in the JSON report")
 	stats := flag.Bool("stats", false, "after building the trusted set, print its follow-count distribution and exit (calibration)")
+	writeScores := flag.Bool("write-scores", false, "persist trust_distance and cluster_flagged to Dgraph for the whitelist server")
 	flag.Parse()
 
 	ctx := context.Background()
@@ -72,16 +78,20 @@ func main() {
 		log.Printf("WARNING: only %d of %d seed pubkeys found in the graph", len(seedUIDs), len(cfg.SeedPubkeys))
 	}
 
-	// trusted maps UID -> struct{} for fast membership tests.
+	// trusted maps UID -> struct{} for fast membership tests; distance records
+	// the closure round in which each UID joined (seeds = 0).
 	trusted := make(map[string]struct{}, len(seedUIDs))
+	distance := make(map[string]int, len(seedUIDs))
 	for _, uid := range seedUIDs {
 		trusted[uid] = struct{}{}
+		distance[uid] = 0
 	}
-	log.Printf("Seeded trusted set with %d pubkeys (K=%d)", len(trusted), *k)
+	discount := dgraph.Discount{Mute: max(*muteWeight, 0), Report: max(*reportWeight, 0)}
+	log.Printf("Seeded trusted set with %d pubkeys (K=%d, mute weight %d, report weight %d)", len(trusted), *k, discount.Mute, discount.Report)
 
 	// --- Phase 1: trust closure ---
 	for round := 1; ; round++ {
-		newUIDs, err := client.ExpandTrustedSet(ctx, keysOf(trusted), *k)
+		newUIDs, err := client.ExpandTrustedSet(ctx, keysOf(trusted), *k, discount)
 		if err != nil {
 			log.Fatalf("Trust propagation round %d failed: %v", round, err)
 		}
@@ -89,6 +99,7 @@ func main() {
 		for _, uid := range newUIDs {
 			if _, ok := trusted[uid]; !ok {
 				trusted[uid] = struct{}{}
+				distance[uid] = round
 				added++
 			}
 		}
@@ -118,6 +129,7 @@ func main() {
 
 	// --- Phase 3: size the cluster beneath each bridge ---
 	reports := make([]bridgeReport, 0, len(bridges))
+	var flagged []string
 	for _, b := range bridges {
 		members, err := client.ClusterBeneath(ctx, b.UID, *depth)
 		if err != nil {
@@ -150,6 +162,11 @@ func main() {
 			r.Members = cluster
 		}
 		reports = append(reports, r)
+
+		flagged = append(flagged, b.UID)
+		for _, m := range cluster {
+			flagged = append(flagged, m.UID)
+		}
 	}
 
 	// Strongest signal first: a large cluster reached through the thinnest link.
@@ -163,6 +180,16 @@ func main() {
 	if err := writeReports(*outDir, reports); err != nil {
 		log.Fatalf("Failed to write report: %v", err)
 	}
+
+	if *writeScores {
+		if err := client.EnsureSchema(ctx); err != nil {
+			log.Fatalf("Failed to ensure schema: %v", err)
+		}
+		if err := client.WriteTrustScores(ctx, distance, flagged); err != nil {
+			log.Fatalf("Failed to write trust scores: %v", err)
+		}
+		log.Printf("Wrote trust_distance for %d nodes and cluster_flagged for %d nodes", len(distance), len(flagged))
+	}
 	log.Printf("Done: %d suspected spam clusters (>= %d members)", len(reports), *minCluster)
 }
 
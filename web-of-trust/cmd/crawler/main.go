@@ -247,6 +247,8 @@ func main() {
 		RelayEOSEQuorum: cfg.RelayEOSEQuorum,
 		// HARD-01/IN-03: thread MissBackoff so BackfillNextAttempt uses the real cadence.
 		MissBackoff: cfg.MissBackoff,
+		// Mute lists and reports for clusterscan's trust discount.
+		NegativeSignals: cfg.NegativeSignals,
 		OnConnectFail: func(url string) {
 			// markRelayDead already emits the single ejection log line with class/count/threshold (LOG-03/D-15).
 			if err := config.EjectRelayURL(url); err != nil {
@@ -0,0 +1,158 @@
+// Command wot-rank scores every account in the Web-of-Trust graph with
+// personalized PageRank from the seed pubkeys and writes the score to each
+// node's trust_rank predicate, so the whitelist server and search ranking
+// can use a continuous trust score rather than clusterscan's yes/no closure.
+// It reads the whole follows graph once into dense uint32 arrays, iterates
+// in memory until the scores settle, and reports convergence. With
+// --dry-run it writes nothing.
+//
+// trust_rank is the PageRank share scaled by the node count: 1.0 is what
+// every node would get if trust were spread evenly, seeds score far above
+// it, and nodes the seeds can't reach get no trust_rank at all.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sort"
+	"time"
+
+	"web-of-trust/pkg/config"
+	"web-of-trust/pkg/dgraph"
+	"web-of-trust/pkg/rank"
+)
+
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	damping := flag.Float64("damping", rank.DefaultDamping, "probability the walker follows an edge rather than jumping back to a seed")
+	tolerance := flag.Float64("tolerance", rank.DefaultTolerance, "stop once the L1 change between iterations is below this")
+	maxIter := flag.Int("max-iterations", rank.DefaultMaxIterations, "iteration cap; hitting it is reported as not converged")
+	top := flag.Int("top", 20, "log this many of the highest-ranked pubkeys")
+	dryRun := flag.Bool("dry-run", false, "compute and report, but do not write trust_rank")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	client, err := dgraph.NewClient(cfg.DgraphAddr)
+	if err != nil {
+		log.Fatalf("Failed to create Dgraph client: %v", err)
+	}
+	defer client.Close()
+
+	// --- Phase 0: resolve seed pubkeys to UIDs ---
+	seedUIDs, err := client.ResolvePubkeysToUIDs(ctx, cfg.SeedPubkeys)
+	if err != nil {
+		log.Fatalf("Failed to resolve seed pubkeys: %v", err)
+	}
+	if len(seedUIDs) == 0 {
+		log.Fatalf("None of the %d configured seed pubkeys exist in the graph; cannot anchor trust", len(cfg.SeedPubkeys))
+	}
+	if len(seedUIDs) < len(cfg.SeedPubkeys) {
+		log.Printf("WARNING: only %d of %d seed pubkeys found in the graph", len(seedUIDs), len(cfg.SeedPubkeys))
+	}
+
+	// --- Phase 1: read the graph ---
+	start := time.Now()
+	g, err := client.ReadFollowGraph(ctx)
+	if err != nil {
+		log.Fatalf("Failed to read follow graph: %v", err)
+	}
+	log.Printf("Read %d nodes, %d follows in %s", g.NodeCount, g.EdgeCount, time.Since(start).Round(time.Millisecond))
+
+	isSeed := make(map[string]bool, len(seedUIDs))
+	for _, uid := range seedUIDs {
+		isSeed[uid] = true
+	}
+	var seeds []uint32
+	for i, uid := range g.UIDs {
+		if isSeed[uid] {
+			seeds = append(seeds, uint32(i))
+		}
+	}
+	if len(seeds) == 0 {
+		log.Fatalf("None of the seed pubkeys follows or is followed by anyone; nothing to rank")
+	}
+	if len(seeds) < len(seedUIDs) {
+		log.Printf("WARNING: %d seed pubkeys have no follows edges and are left out", len(seedUIDs)-len(seeds))
+	}
+
+	graph := rank.FromEdges(g.NodeCount, g.Edges)
+	g.Edges = nil // the compressed rows are all the iteration needs
+
+	// --- Phase 2: iterate ---
+	start = time.Now()
+	res := rank.Personalized(graph, seeds, rank.Options{
+		Damping:       *damping,
+		Tolerance:     *tolerance,
+		MaxIterations: *maxIter,
+		Progress: func(it int, delta float64) {
+			if it%10 == 0 {
+				log.Printf("Iteration %d: L1 change %.3g", it, delta)
+			}
+		},
+	})
+	if res.Converged {
+		log.Printf("Converged after %d iterations in %s (L1 change %.3g < %g)", res.Iterations, time.Since(start).Round(time.Millisecond), res.Delta, *tolerance)
+	} else {
+		log.Printf("WARNING: not converged after %d iterations (L1 change %.3g >= %g); ranks are approximate", res.Iterations, res.Delta, *tolerance)
+	}
+
+	ranks := make(map[string]float64, len(res.Scores))
+	scale := float64(graph.N())
+	for i, s := range res.Scores {
+		if s > 0 {
+			ranks[g.UIDs[i]] = s * scale
+		}
+	}
+	log.Printf("Ranked %d of %d nodes; %d are unreachable from the seeds", len(ranks), graph.N(), graph.N()-len(ranks))
+
+	if *top > 0 {
+		if err := logTop(ctx, client, g.UIDs, res.Scores, scale, *top); err != nil {
+			log.Printf("WARNING: could not list top pubkeys: %v", err)
+		}
+	}
+
+	// --- Phase 3: write ---
+	if *dryRun {
+		log.Printf("Dry run: trust_rank not written")
+		return
+	}
+	if err := client.EnsureSchema(ctx); err != nil {
+		log.Fatalf("Failed to ensure schema: %v", err)
+	}
+	start = time.Now()
+	if err := client.WriteTrustRanks(ctx, ranks); err != nil {
+		log.Fatalf("Failed to write trust ranks: %v", err)
+	}
+	log.Printf("Wrote trust_rank for %d nodes in %s", len(ranks), time.Since(start).Round(time.Millisecond))
+}
+
+// logTop logs the n highest-scoring nodes with their pubkeys.
+func logTop(ctx context.Context, client *dgraph.Client, uids []string, scores []float64, scale float64, n int) error {
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	if len(idx) > n {
+		idx = idx[:n]
+	}
+	topUIDs := make([]string, len(idx))
+	for i, j := range idx {
+		topUIDs[i] = uids[j]
+	}
+	pubkeys, err := client.PubkeysForUIDs(ctx, topUIDs)
+	if err != nil {
+		return err
+	}
+	log.Printf("Top %d by trust_rank:", len(idx))
+	for i, j := range idx {
+		log.Printf("  %3d  %-64s  %.2f", i+1, pubkeys[uids[j]], scores[j]*scale)
+	}
+	return nil
+}
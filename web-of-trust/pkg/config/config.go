@@ -49,6 +49,7 @@ type Config struct {
 	FrontierBatchSize    int           `mapstructure:"frontier_batch_size"`
 	CountSampleInterval  int           `mapstructure:"count_sample_interval"`
 	ForwardRelayURL      string        `mapstructure:"forward_relay_url"`
+	NegativeSignals      bool          `mapstructure:"crawl_negative_signals"` // also fetch mute lists (kind 10000) and reports (kind 1984)
 
 	// Spam-cluster scan (clusterscan CLI) settings.
 	SeedPubkeys     []string `mapstructure:"seed_pubkeys"`      // trusted roots; trust flows out along follows
@@ -56,6 +57,8 @@ type Config struct {
 	ClusterDepth    int      `mapstructure:"cluster_depth"`     // follows-hops to walk when measuring a cluster
 	MaxBridgeWeight int      `mapstructure:"max_bridge_weight"` // a candidate is a "weak bridge" if 1..N edges cross into trusted
 	MinClusterSize  int      `mapstructure:"min_cluster_size"`  // ignore bridges whose cluster is smaller than this
+	MuteWeight      int      `mapstructure:"mute_weight"`       // endorsements cancelled by each trusted account muting a node
+	ReportWeight    int      `mapstructure:"report_weight"`     // endorsements cancelled by each trusted account reporting a node
 
 	// Relay health management (Phase 7) settings.
 	RelayEjectionThresholds EjectionThresholds `mapstructure:"relay_ejection_thresholds"`
@@ -103,6 +106,7 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("relay_filter_batch_size", 100)
 	viper.SetDefault("frontier_batch_size", 100)
 	viper.SetDefault("count_sample_interval", 100)
+	viper.SetDefault("crawl_negative_signals", true)
 
 	// clusterscan defaults: the admin/forwarder keys used by the whitelist
 	// plugin (whitelist-plugin/pkg/repository getHardcodedPubkeys) form the
@@ -118,6 +122,8 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("cluster_depth", 3)
 	viper.SetDefault("max_bridge_weight", 2)
 	viper.SetDefault("min_cluster_size", 5)
+	viper.SetDefault("mute_weight", 1)
+	viper.SetDefault("report_weight", 2)
 
 	// Relay health management defaults (D-06).
 	viper.SetDefault("relay_ejection_thresholds", map[string]interface{}{
@@ -205,6 +211,14 @@ func LoadConfig() (*Config, error) {
 		cfg.MissBackoff.HitRefreshCadence = 24 * time.Hour
 	}
 
+	// Guard: a negative weight would turn a mute or report into an endorsement.
+	if cfg.MuteWeight < 0 {
+		cfg.MuteWeight = 0
+	}
+	if cfg.ReportWeight < 0 {
+		cfg.ReportWeight = 0
+	}
+
 	// Ensure EjectedRelays is non-nil for safe slice operations.
 	if cfg.EjectedRelays == nil {
 		cfg.EjectedRelays = []string{}
@@ -174,6 +174,45 @@ count_sample_interval: -2
 	}
 }
 
+// TestLoadConfig_NegativeSignals verifies the negative-signal defaults (fetch
+// on, mute weight 1, report weight 2) and that negative weights clamp to 0.
+func TestLoadConfig_NegativeSignals(t *testing.T) {
+	viper.Reset()
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.NegativeSignals || cfg.MuteWeight != 1 || cfg.ReportWeight != 2 {
+		t.Fatalf("defaults: want true/1/2, got %v/%d/%d", cfg.NegativeSignals, cfg.MuteWeight, cfg.ReportWeight)
+	}
+
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+	configDir := tmpHome + "/deepfry"
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configContent := `relay_urls:
+  - wss://relay.damus.io
+crawl_negative_signals: false
+mute_weight: -1
+report_weight: 5
+`
+	if err := os.WriteFile(configDir+"/web-of-trust.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NegativeSignals || cfg.MuteWeight != 0 || cfg.ReportWeight != 5 {
+		t.Fatalf("explicit: want false/0/5, got %v/%d/%d", cfg.NegativeSignals, cfg.MuteWeight, cfg.ReportWeight)
+	}
+}
+
 // TestEjectRelayURL_MovesToEjected verifies that EjectRelayURL removes the URL
 // from relay_urls and appends it to ejected_relays, persisting to the YAML file.
 func TestEjectRelayURL_MovesToEjected(t *testing.T) {
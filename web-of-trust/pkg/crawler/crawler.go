@@ -109,6 +109,7 @@ type relayState struct {
 type followStore interface {
 	AddFollowers(ctx context.Context, signerPubkey string, kind3createdAt int64, follows map[string]struct{}, debug bool) error
 	TouchLastDBUpdate(ctx context.Context, pubkey string) (bool, error)
+	WriteSignals(ctx context.Context, s dgraph.Signals) error
 	Close() error
 }
 
@@ -131,6 +132,9 @@ type Crawler struct {
 	ejectionThresholds map[failureClass]int32
 	// Phase 8: EOSE-quorum fraction (D-12/D-13). 0 disables early exit.
 	quorum float64
+	// negativeSignals adds the mute-list and report filters to every relay
+	// query (see signals.go).
+	negativeSignals bool
 
 	// batchSeq is a monotonic per-batch generation counter incremented once at the
 	// top of every FetchAndUpdateFollows call. Per-relay goroutines stamp the current
@@ -162,6 +166,8 @@ type Config struct {
 	RelayEOSEQuorum float64
 	// MissBackoff provides the hit-refresh cadence for BackfillNextAttempt (HARD-01/IN-03).
 	MissBackoff config.MissBackoffParams
+	// NegativeSignals also fetches the authors' mute lists and reports.
+	NegativeSignals bool
 }
 
 func New(cfg Config) (*Crawler, error) {
@@ -243,6 +249,7 @@ func New(cfg Config) (*Crawler, error) {
 		onConnectFail:   cfg.OnConnectFail,
 		filterBatchSize: cfg.FilterBatchSize,
 		quorum:          cfg.RelayEOSEQuorum,
+		negativeSignals: cfg.NegativeSignals,
 		ejectionThresholds: map[failureClass]int32{
 			classTransport: int32(cfg.EjectionThresholds.Transport),
 			classFilterRej: int32(cfg.EjectionThresholds.FilterRej),
@@ -488,7 +495,9 @@ func quorumReached(done, queried int32, q float64) bool {
 // FetchAndUpdateFollows queries relays for kind 3 events for the given pubkeys
 // and updates the database. Hits contains successfully handled kind-3 pubkeys;
 // SkipAttempt contains pubkeys whose follow update failed transiently and must
-// not be stamped as attempted this batch.
+// not be stamped as attempted this batch. With negative signals enabled the
+// same queries also fetch the pubkeys' mute lists and reports, which are
+// stored but leave Hits and SkipAttempt alone.
 func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys map[string]int64) (FetchResult, error) {
 	result := FetchResult{
 		Hits:        make(map[string]struct{}),
@@ -633,6 +642,9 @@ func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys ma
 
 	// Map to keep track of processed event IDs
 	processedEventIDs := make(map[string]struct{})
+	// signals queues the batch's mute lists and reports; writeSignals stores
+	// them once the dispatch loop is done with kind 3.
+	var signals dgraph.Signals
 	// relayQueryDoneCh is the relay-query context's Done channel. When it fires,
 	// the dispatcher takes the independent timeout/quorum-exit path (HANG-01).
 	relayQueryDoneCh := relayQueryContext.Done()
@@ -703,7 +715,7 @@ func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys ma
 						continue
 					}
 					c.logSignatureValidationMetrics(ev.PubKey, true)
-					if err2 := c.processFetchedEvent(drainCtx, ev, pubkeys, processedEventIDs, &result); err2 != nil {
+					if err2 := c.processFetchedEvent(drainCtx, ev, pubkeys, processedEventIDs, &signals, &result); err2 != nil {
 						c.dbUpdateMutex.Unlock()
 						drainCancel()
 						return result, err2
@@ -802,6 +814,7 @@ func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys ma
 				}
 			}
 
+			c.writeSignals(relayContext, signals)
 			return result, nil
 
 		case <-relayContext.Done():
@@ -819,6 +832,7 @@ func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys ma
 					log.Printf("Processed follows for %d pubkeys across %d relays", len(processedEventIDs), len(c.relays))
 				}
 				c.dbUpdateMutex.Unlock()
+				c.writeSignals(relayContext, signals)
 				return result, nil
 			}
 
@@ -845,7 +859,7 @@ func (c *Crawler) FetchAndUpdateFollows(relayContext context.Context, pubkeys ma
 			}
 			c.logSignatureValidationMetrics(event.PubKey, true)
 
-			if err := c.processFetchedEvent(relayContext, event, pubkeys, processedEventIDs, &result); err != nil {
+			if err := c.processFetchedEvent(relayContext, event, pubkeys, processedEventIDs, &signals, &result); err != nil {
 				c.dbUpdateMutex.Unlock()
 				return result, err
 			}
@@ -885,10 +899,17 @@ func (c *Crawler) processFetchedEvent(
 	event *nostr.Event,
 	pubkeys map[string]int64,
 	processedEventIDs map[string]struct{},
+	signals *dgraph.Signals,
 	result *FetchResult,
 ) error {
 	c.forwardEvent(ctx, event)
 
+	if event.Kind != 3 {
+		queueSignalEvent(event, signals)
+		processedEventIDs[event.ID] = struct{}{}
+		return nil
+	}
+
 	if event.CreatedAt <= nostr.Timestamp(pubkeys[event.PubKey]) {
 		if c.debug {
 			fmt.Println("already have newer event for " + event.PubKey)
@@ -933,8 +954,8 @@ func (c *Crawler) drainSubscription(ctx context.Context, sub *nostr.Subscription
 		case event := <-sub.Events:
 			if event != nil {
 				if c.debug {
-					log.Printf("Found kind 3 event from relay %s: %s, created_at: %d, pubkey: %s",
-						relayURL, event.ID, event.CreatedAt, event.PubKey)
+					log.Printf("Found kind %d event from relay %s: %s, created_at: %d, pubkey: %s",
+						event.Kind, relayURL, event.ID, event.CreatedAt, event.PubKey)
 				}
 				// Check for context cancellation before sending to channel to avoid blocking
 				select {
@@ -1017,6 +1038,10 @@ func (c *Crawler) queryRelay(ctx context.Context, rs *relayState, filter nostr.F
 
 		chunkFilter := filter
 		chunkFilter.Authors = chunk
+		filters := []nostr.Filter{chunkFilter}
+		if c.negativeSignals {
+			filters = append(filters, signalFilters(chunk)...)
+		}
 
 		// HANG-02: go-nostr's Subscription.Fire() (subscription.go:187) blocks on a
 		// bare channel receive over the relay write queue and ignores the context
@@ -1053,7 +1078,7 @@ func (c *Crawler) queryRelay(ctx context.Context, rs *relayState, filter nostr.F
 		}
 		subResultCh := make(chan subscribeResult, 1)
 		go func() {
-			s, e := relay.Subscribe(ctx, []nostr.Filter{chunkFilter})
+			s, e := relay.Subscribe(ctx, filters)
 			subResultCh <- subscribeResult{sub: s, err: e}
 		}()
 
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"web-of-trust/pkg/dgraph"
+
 	"github.com/nbd-wtf/go-nostr"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -15,6 +17,11 @@ type fakeFollowStore struct {
 	mu       sync.Mutex
 	errs     map[string]error
 	addCalls []string
+	mutes    map[string]map[string]struct{}
+	reports  map[string]map[string]string
+
+	signalCalls int
+	signalErr   error
 }
 
 func (f *fakeFollowStore) AddFollowers(ctx context.Context, signerPubkey string, kind3createdAt int64, follows map[string]struct{}, debug bool) error {
@@ -28,6 +35,26 @@ func (f *fakeFollowStore) TouchLastDBUpdate(ctx context.Context, pubkey string)
 	return true, nil
 }
 
+func (f *fakeFollowStore) WriteSignals(ctx context.Context, s dgraph.Signals) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.signalCalls++
+	if f.signalErr != nil {
+		return f.signalErr
+	}
+	if f.mutes == nil {
+		f.mutes = make(map[string]map[string]struct{})
+		f.reports = make(map[string]map[string]string)
+	}
+	for pk, list := range s.Mutes {
+		f.mutes[pk] = list.Muted
+	}
+	for pk, reported := range s.Reports {
+		f.reports[pk] = reported
+	}
+	return nil
+}
+
 func (f *fakeFollowStore) Close() error { return nil }
 
 func (f *fakeFollowStore) saw(pubkey string) bool {
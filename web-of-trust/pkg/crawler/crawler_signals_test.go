@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func signedEvent(t *testing.T, secret string, kind int, tags nostr.Tags) *nostr.Event {
+	t.Helper()
+	pubkey, err := nostr.GetPublicKey(secret)
+	if err != nil {
+		t.Fatalf("GetPublicKey failed: %v", err)
+	}
+	event := &nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Kind:      kind,
+		Tags:      tags,
+	}
+	if err := event.Sign(secret); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	return event
+}
+
+func TestParseMuteList(t *testing.T) {
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	muted := parseMuteList(&nostr.Event{Tags: nostr.Tags{
+		{"p", a},
+		{"p", a},
+		{"p", "npub1notahexkey"},
+		{"t", "bitcoin"},
+		{"word", "gm"},
+		{"p", b, "wss://relay.example"},
+	}})
+	if len(muted) != 2 {
+		t.Fatalf("muted = %v, want exactly %s and %s", muted, a, b)
+	}
+	for _, pk := range []string{a, b} {
+		if _, ok := muted[pk]; !ok {
+			t.Errorf("muted missing %s", pk)
+		}
+	}
+}
+
+func TestParseReport(t *testing.T) {
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	// A profile report carries the type on the p tag.
+	got := parseReport(&nostr.Event{Tags: nostr.Tags{{"p", a, "impersonation"}, {"p", "bad"}}})
+	if len(got) != 1 || got[a] != "impersonation" {
+		t.Errorf("profile report = %v", got)
+	}
+
+	// A note report carries it on the e tag; the author's p tag inherits it.
+	got = parseReport(&nostr.Event{Tags: nostr.Tags{{"e", strings.Repeat("c", 64), "spam"}, {"p", a}, {"p", b, "nudity"}}})
+	if got[a] != "spam" || got[b] != "nudity" {
+		t.Errorf("note report = %v", got)
+	}
+
+	// No type at all is left empty for the store to default.
+	got = parseReport(&nostr.Event{Tags: nostr.Tags{{"p", a}}})
+	if typ, ok := got[a]; !ok || typ != "" {
+		t.Errorf("untyped report = %v", got)
+	}
+}
+
+func TestSignalFilters(t *testing.T) {
+	authors := []string{strings.Repeat("a", 64), strings.Repeat("b", 64)}
+	filters := signalFilters(authors)
+	if len(filters) != 2 {
+		t.Fatalf("got %d filters, want 2", len(filters))
+	}
+	if f := filters[0]; f.Kinds[0] != kindMuteList || f.Limit != 2 || len(f.Authors) != 2 {
+		t.Errorf("mute filter = %+v", f)
+	}
+	if f := filters[1]; f.Kinds[0] != kindReport || f.Limit != 2*reportsPerAuthor || len(f.Authors) != 2 {
+		t.Errorf("report filter = %+v", f)
+	}
+}
+
+// signalBatch runs one FetchAndUpdateFollows batch in which alice publishes
+// a kind 3, a mute list and a report, and bob only a report.
+func signalBatch(t *testing.T, store *fakeFollowStore) (alice, bob, target string, result FetchResult) {
+	t.Helper()
+	target = strings.Repeat("d", 64)
+
+	secret := nostr.GeneratePrivateKey()
+	follows := signedEvent(t, secret, 3, nostr.Tags{{"p", target}})
+	mutes := signedEvent(t, secret, kindMuteList, nostr.Tags{{"p", target}})
+	report := signedEvent(t, secret, kindReport, nostr.Tags{{"p", target, "spam"}})
+	bobReport := signedEvent(t, nostr.GeneratePrivateKey(), kindReport, nostr.Tags{{"p", target, "impersonation"}})
+
+	queryFn := func(ctx context.Context, rs *relayState, filter nostr.Filter, eventsChan chan<- *nostr.Event) error {
+		for _, ev := range []*nostr.Event{mutes, report, follows, bobReport, report} {
+			eventsChan <- ev
+		}
+		return nil
+	}
+
+	rs := &relayState{url: "wss://events.example", alive: true}
+	rs.filterCap.Store(10)
+	c := newTestCrawler([]*relayState{rs}, 500*time.Millisecond, 0, queryFn)
+	c.dgClient = store
+	c.negativeSignals = true
+
+	result, err := c.FetchAndUpdateFollows(context.Background(), map[string]int64{
+		follows.PubKey:   0,
+		bobReport.PubKey: 0,
+	})
+	if err != nil {
+		t.Fatalf("FetchAndUpdateFollows returned error: %v", err)
+	}
+	return follows.PubKey, bobReport.PubKey, target, result
+}
+
+// TestFetchAndUpdateFollows_StoresNegativeSignals verifies the mute lists and
+// reports arriving in a batch are stored in one write and never count as
+// kind-3 hits.
+func TestFetchAndUpdateFollows_StoresNegativeSignals(t *testing.T) {
+	store := &fakeFollowStore{}
+	alice, bob, target, result := signalBatch(t, store)
+
+	if store.signalCalls != 1 {
+		t.Errorf("WriteSignals called %d times, want once per batch", store.signalCalls)
+	}
+	if _, ok := store.mutes[alice][target]; !ok {
+		t.Errorf("mutes = %v, want %s muting %s", store.mutes, alice, target)
+	}
+	if typ := store.reports[alice][target]; typ != "spam" {
+		t.Errorf("reports = %v, want a spam report of %s by alice", store.reports, target)
+	}
+	if typ := store.reports[bob][target]; typ != "impersonation" {
+		t.Errorf("reports = %v, want an impersonation report of %s by bob", store.reports, target)
+	}
+	if len(result.Hits) != 1 || len(store.addCalls) != 1 {
+		t.Errorf("hits %v, AddFollowers calls %v: want only the kind 3 event", result.Hits, store.addCalls)
+	}
+	if _, ok := result.Hits[alice]; !ok {
+		t.Errorf("Hits missing kind 3 author %s", alice)
+	}
+}
+
+// TestFetchAndUpdateFollows_SignalWriteFailure verifies a failed signal write
+// neither fails the batch nor touches the kind-3 results.
+func TestFetchAndUpdateFollows_SignalWriteFailure(t *testing.T) {
+	store := &fakeFollowStore{signalErr: status.Error(codes.DeadlineExceeded, "context deadline exceeded")}
+	alice, _, _, result := signalBatch(t, store)
+
+	if store.signalCalls != 1 {
+		t.Errorf("WriteSignals called %d times, want once", store.signalCalls)
+	}
+	if _, ok := result.Hits[alice]; !ok || len(result.Hits) != 1 {
+		t.Errorf("Hits = %v, want only %s", result.Hits, alice)
+	}
+	if len(result.SkipAttempt) != 0 {
+		t.Errorf("SkipAttempt = %v, want a failed signal write to leave attempts alone", result.SkipAttempt)
+	}
+}
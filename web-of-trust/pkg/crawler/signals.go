@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"context"
+	"log"
+
+	"web-of-trust/pkg/dgraph"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Negative signals: besides kind 3, each relay REQ carries a filter for the
+// same authors' NIP-51 mute lists and one for their NIP-56 reports, stored
+// as mutes and reports edges for clusterscan's trust discount. They ride the
+// kind-3 query rather than a batch of their own, so they cost no extra round
+// trip, but they never count as hits or misses: the crawl schedule stays
+// driven by kind 3 alone.
+const (
+	kindMuteList = 10000
+	kindReport   = 1984
+
+	// reportsPerAuthor bounds the report filter's limit. Reports aren't
+	// replaceable, so a prolific reporter could otherwise flood the batch;
+	// relays return the newest first.
+	reportsPerAuthor = 20
+)
+
+// signalFilters returns the mute-list and report filters for authors. Each
+// has its own limit, so reports can't crowd kind 3 out of the response.
+func signalFilters(authors []string) []nostr.Filter {
+	return []nostr.Filter{
+		{Authors: authors, Kinds: []int{kindMuteList}, Limit: len(authors)},
+		{Authors: authors, Kinds: []int{kindReport}, Limit: len(authors) * reportsPerAuthor},
+	}
+}
+
+// parseMuteList returns the valid pubkeys a kind 10000 event mutes publicly.
+// Private mutes are encrypted in the content and stay private.
+func parseMuteList(event *nostr.Event) map[string]struct{} {
+	muted := make(map[string]struct{})
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && dgraph.ValidatePubkey(tag[1]) == nil {
+			muted[tag[1]] = struct{}{}
+		}
+	}
+	return muted
+}
+
+// parseReport returns the pubkeys a kind 1984 event reports, with the report
+// type. NIP-56 puts the type on the p tag when a profile is reported and on
+// the e tag when a note is, so a p tag without one takes the e tag's.
+// Unknown or missing types are left for dgraph.WriteSignals to store as
+// "other".
+func parseReport(event *nostr.Event) map[string]string {
+	var noteType string
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "e" {
+			noteType = tag[2]
+			break
+		}
+	}
+	reported := make(map[string]string)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "p" || dgraph.ValidatePubkey(tag[1]) != nil {
+			continue
+		}
+		typ := noteType
+		if len(tag) >= 3 && tag[2] != "" {
+			typ = tag[2]
+		}
+		reported[tag[1]] = typ
+	}
+	return reported
+}
+
+// queueSignalEvent adds a mute list or report to the batch's signals.
+func queueSignalEvent(event *nostr.Event, signals *dgraph.Signals) {
+	switch event.Kind {
+	case kindMuteList:
+		signals.AddMuteList(event.PubKey, int64(event.CreatedAt), parseMuteList(event))
+	case kindReport:
+		signals.AddReports(event.PubKey, parseReport(event))
+	}
+}
+
+// writeSignals stores the batch's queued signals in one transaction. It runs
+// after the dispatch loop, outside dbUpdateMutex, with its own c.timeout
+// budget, so signal writes neither hold up kind 3 nor eat the drain's
+// deadline; a batch's return can take up to one c.timeout longer. A failed
+// write is logged and never fails the batch: the signals are fetched again
+// when their authors are next crawled.
+func (c *Crawler) writeSignals(ctx context.Context, signals dgraph.Signals) {
+	if signals.Len() == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := c.dgClient.WriteSignals(ctx, signals); err != nil {
+		log.Printf("WARN: negative signal update failed mute_lists=%d reporters=%d transient=%t: %v",
+			len(signals.Mutes), len(signals.Reports), dgraph.IsTransientError(err), err)
+	}
+}
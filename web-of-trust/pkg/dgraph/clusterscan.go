@@ -6,16 +6,20 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/dgraph-io/dgo/v210/protos/api"
 )
 
 // Helpers for the clusterscan CLI: read-only queries that locate spam clusters
 // by graph shape. Trust flows out from seed pubkeys along `follows` edges; a
-// node joins the trusted set once at least K already-trusted accounts follow it.
+// node joins the trusted set once at least K already-trusted accounts follow it,
+// less any discount for trusted accounts that mute or report it.
 // Accounts that never join, yet still touch the trusted set through one or two
 // edges ("weak bridges"), are the entry points to candidate spam clusters.
 //
 // All graph computation stays inside DQL (counts, filters, uid() sets, math());
-// the caller only does set bookkeeping. Every query uses a read-only txn.
+// the caller only does set bookkeeping. Every query uses a read-only txn, except
+// WriteTrustScores, which persists a finished scan for the whitelist server.
 
 // WeakBridge is a non-trusted account that touches the trusted set through a
 // small number of edges. It is the suspected entry point to a spam cluster.
@@ -87,13 +91,27 @@ func (c *Client) ResolvePubkeysToUIDs(
 	return out, nil
 }
 
+// Discount weighs trusted accounts' negative signals against their follows
+// during trust propagation: each trusted account that mutes a node cancels
+// Mute of its endorsements, and each that reports it cancels Report. The zero
+// value leaves propagation on follows alone.
+type Discount struct {
+	Mute   int
+	Report int
+}
+
+// Enabled reports whether d discounts anything.
+func (d Discount) Enabled() bool { return d.Mute > 0 || d.Report > 0 }
+
 // ExpandTrustedSet runs one round of trust propagation: it returns the UIDs of
 // every node, not already trusted, that is followed by at least k members of
-// the current trusted set. Callers loop until this returns no new UIDs.
+// the current trusted set, after discount has taken off the weight of trusted
+// members that mute or report it. Callers loop until this returns no new UIDs.
 func (c *Client) ExpandTrustedSet(
 	ctx context.Context,
 	trustedUIDs []string,
 	k int,
+	discount Discount,
 ) ([]string, error) {
 	if len(trustedUIDs) == 0 {
 		return nil, nil
@@ -109,6 +127,21 @@ func (c *Client) ExpandTrustedSet(
 			uid
 		}
 	}`, uidList(trustedUIDs), k)
+	if discount.Enabled() {
+		query = fmt.Sprintf(`
+	{
+		trusted as var(func: uid(%s))
+		cand as var(func: has(pubkey)) @filter(NOT uid(trusted)) {
+			f as count(~follows @filter(uid(trusted)))
+			m as count(~mutes @filter(uid(trusted)))
+			r as count(~reports @filter(uid(trusted)))
+			e as math(f - %d * m - %d * r)
+		}
+		qualified(func: uid(cand)) @filter(ge(val(e), %d)) {
+			uid
+		}
+	}`, uidList(trustedUIDs), discount.Mute, discount.Report, k)
+	}
 
 	txn := c.dg.NewReadOnlyTxn()
 	defer txn.Discard(ctx)
@@ -282,3 +315,110 @@ func (c *Client) ClusterBeneath(
 	walk(result.Sub[0].Follows)
 	return members, nil
 }
+
+// scoreWriteBatch bounds the number of nodes per WriteTrustScores mutation so
+// each N-Quad payload stays well under the ~4MB gRPC message cap.
+const scoreWriteBatch = 5000
+
+// WriteTrustScores replaces the persisted clusterscan results: it writes
+// distances (UID -> trust-closure round, seeds = 0) and flags each UID in
+// flagged, then removes trust_distance and cluster_flagged from every node the
+// new scan no longer places or flags. New values land before stale ones go, so
+// a whitelist refresh racing this write never sees a node that is still
+// placed as unplaced; at worst it sees a node keep a value the scan dropped.
+func (c *Client) WriteTrustScores(
+	ctx context.Context,
+	distances map[string]int,
+	flagged []string,
+) error {
+	var nquads strings.Builder
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		mu := &api.Mutation{SetNquads: []byte(nquads.String()), CommitNow: true}
+		if _, err := c.dg.NewTxn().Mutate(ctx, mu); err != nil {
+			return fmt.Errorf("write trust scores failed: %w", err)
+		}
+		nquads.Reset()
+		n = 0
+		return nil
+	}
+
+	for uid, d := range distances {
+		fmt.Fprintf(&nquads, "<%s> <trust_distance> \"%d\" .\n", uid, d)
+		if n++; n >= scoreWriteBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	isFlagged := make(map[string]struct{}, len(flagged))
+	for _, uid := range flagged {
+		isFlagged[uid] = struct{}{}
+		fmt.Fprintf(&nquads, "<%s> <cluster_flagged> \"true\" .\n", uid)
+		if n++; n >= scoreWriteBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := c.pruneStale(ctx, "trust_distance", func(uid string) bool {
+		_, ok := distances[uid]
+		return ok
+	}); err != nil {
+		return err
+	}
+	return c.pruneStale(ctx, "cluster_flagged", func(uid string) bool {
+		_, ok := isFlagged[uid]
+		return ok
+	})
+}
+
+// pruneStale deletes pred from every node that carries it and for which keep
+// is false. It pages through has(pred) by uid cursor, scoreWriteBatch nodes at
+// a time, so neither the read nor the delete trips Dgraph's million-UID var
+// limit (see BackfillFollowerCount).
+func (c *Client) pruneStale(ctx context.Context, pred string, keep func(uid string) bool) error {
+	cursor := "0x0"
+	for {
+		txn := c.dg.NewReadOnlyTxn()
+		resp, err := txn.Query(ctx, fmt.Sprintf(`{
+			page(func: has(%s), first: %d, after: %s) { uid }
+		}`, pred, scoreWriteBatch, cursor))
+		txn.Discard(ctx)
+		if err != nil {
+			return fmt.Errorf("read %s failed: %w", pred, err)
+		}
+		var result struct {
+			Page []struct {
+				UID string `json:"uid"`
+			} `json:"page"`
+		}
+		if err := json.Unmarshal(resp.Json, &result); err != nil {
+			return fmt.Errorf("unmarshal %s page failed: %w", pred, err)
+		}
+
+		var del strings.Builder
+		for _, node := range result.Page {
+			if !keep(node.UID) {
+				fmt.Fprintf(&del, "<%s> <%s> * .\n", node.UID, pred)
+			}
+		}
+		if del.Len() > 0 {
+			mu := &api.Mutation{DelNquads: []byte(del.String()), CommitNow: true}
+			if _, err := c.dg.NewTxn().Mutate(ctx, mu); err != nil {
+				return fmt.Errorf("prune stale %s failed: %w", pred, err)
+			}
+		}
+		if len(result.Page) < scoreWriteBatch {
+			return nil
+		}
+		cursor = result.Page[len(result.Page)-1].UID
+	}
+}
@@ -74,6 +74,24 @@ func (c *Client) Close() error {
 // eq(uncrawled, 1) instead of full-scanning the 1.38M follower_count index for an
 // absent predicate. INVARIANT: uncrawled = 1 ⟺ node has never been attempted.
 // Set on node creation (AddFollowers), deleted on first attempt (MarkAttempted).
+// The one exception is a stub only mutes or reports point at (signals.go):
+// never attempted, but off the frontier until AddFollowers sees it followed.
+//
+// trust_distance and cluster_flagged (additive only) are written by clusterscan
+// --write-scores and read by the whitelist server to derive per-pubkey trust
+// tiers. trust_distance is the trust-closure round in which a node joined the
+// trusted set (seeds = 0); cluster_flagged marks members of a suspected spam
+// cluster. Both are absent on nodes clusterscan has not placed.
+//
+// trust_rank (additive only) is written by wot-rank: personalized PageRank
+// from the seed pubkeys, scaled so 1.0 is the average node's share. It is
+// absent on nodes the seeds can't reach.
+//
+// mutes, reports and mutesCreatedAt (additive only) hold the negative
+// signals the crawler fetches beside kind 3: NIP-51 mute lists (kind 10000,
+// replaceable, guarded by mutesCreatedAt like kind3CreatedAt) and NIP-56
+// reports (kind 1984, with the report type as a `type` facet on the edge).
+// Both are @reverse so clusterscan can count who mutes or reports a node.
 func (c *Client) EnsureSchema(ctx context.Context) error {
 	schema := `pubkey: string @index(exact) @upsert @unique .
 kind3CreatedAt: int @index(int) .
@@ -83,7 +101,13 @@ next_attempt: int @index(int) .
 miss_count: int .
 follower_count: int @index(int) .
 uncrawled: int @index(int) .
+trust_distance: int @index(int) .
+cluster_flagged: bool @index(bool) .
+trust_rank: float @index(float) .
+mutesCreatedAt: int .
 follows: [uid] @reverse .
+mutes: [uid] @reverse .
+reports: [uid] @reverse .
 
 type Profile {
   pubkey
@@ -95,6 +119,12 @@ type Profile {
   miss_count
   follower_count
   uncrawled
+  trust_distance
+  cluster_flagged
+  trust_rank
+  mutes
+  mutesCreatedAt
+  reports
 }`
 	return c.dg.Alter(ctx, &api.Operation{Schema: schema})
 }
@@ -531,7 +561,7 @@ func (c *Client) AddFollowers(
 			queryParts := make([]string, 0, len(window))
 			for i, followee := range window {
 				queryParts = append(queryParts, fmt.Sprintf(
-					`followee_%d(func: eq(pubkey, %q)) { uid }`,
+					`followee_%d(func: eq(pubkey, %q)) { uid last_attempt uncrawled }`,
 					i,
 					followee,
 				))
@@ -548,7 +578,9 @@ func (c *Client) AddFollowers(
 			progress.completeChunk()
 
 			var bulkResult map[string][]struct {
-				UID string `json:"uid"`
+				UID         string `json:"uid"`
+				LastAttempt int64  `json:"last_attempt"`
+				Uncrawled   int    `json:"uncrawled"`
 			}
 			if err := json.Unmarshal(bulkResp.Json, &bulkResult); err != nil {
 				return fail("unmarshal bulk followees failed: %w", err)
@@ -561,6 +593,12 @@ func (c *Client) AddFollowers(
 				key := fmt.Sprintf("followee_%d", i)
 				if nodes, exists := bulkResult[key]; exists && len(nodes) > 0 {
 					followeeUIDs[i] = nodes[0].UID
+					// An existing node with neither last_attempt nor uncrawled
+					// is a stub WriteSignals created, which stays off
+					// the frontier until someone follows it — now.
+					if nodes[0].LastAttempt == 0 && nodes[0].Uncrawled == 0 {
+						createNQuads += fmt.Sprintf("<%s> <uncrawled> \"1\" .\n", nodes[0].UID)
+					}
 				} else {
 					blankNodeID := fmt.Sprintf("new_followee_%d", i)
 					createNQuads += fmt.Sprintf("_:%s <pubkey> %q .\n",
@@ -585,7 +623,8 @@ func (c *Client) AddFollowers(
 				}
 			}
 
-			// Create missing followees in this window, if any.
+			// Create missing followees (and promote signal-only stubs) in this
+			// window, if any.
 			if createNQuads != "" {
 				mu := &api.Mutation{
 					SetNquads: []byte(createNQuads),
@@ -0,0 +1,129 @@
+//go:build integration
+
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestReadFollowGraphAndPubkeys inserts a -> b -> c and checks the dense read
+// carries both edges with c, which follows no one, present as a target.
+func TestReadFollowGraphAndPubkeys(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient("localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().UnixNano()
+	pa, pb, pc := fmt.Sprintf("%064x", base), fmt.Sprintf("%064x", base+1), fmt.Sprintf("%064x", base+2)
+	mustMutate(t, c, fmt.Sprintf(`_:a <pubkey> %q .
+_:b <pubkey> %q .
+_:c <pubkey> %q .
+_:a <follows> _:b .
+_:b <follows> _:c .
+`, pa, pb, pc))
+	uids, err := c.ResolvePubkeysToUIDs(ctx, []string{pa, pb, pc})
+	if err != nil || len(uids) != 3 {
+		t.Fatalf("resolve: %v, %v", uids, err)
+	}
+
+	g, err := c.ReadFollowGraph(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(g.NodeCount) != len(g.UIDs) || int(g.EdgeCount)*2 != len(g.Edges) {
+		t.Fatalf("counts: %d nodes / %d uids, %d edges / %d ints", g.NodeCount, len(g.UIDs), g.EdgeCount, len(g.Edges))
+	}
+	index := make(map[string]uint32, len(g.UIDs))
+	for i, u := range g.UIDs {
+		index[u] = uint32(i)
+	}
+	if _, ok := index[uids[pc]]; !ok {
+		t.Fatal("c, followed but following no one, is missing from the graph")
+	}
+	ia, ib, ic := index[uids[pa]], index[uids[pb]], index[uids[pc]]
+	found := 0
+	for i := 0; i+1 < len(g.Edges); i += 2 {
+		if (g.Edges[i] == ia && g.Edges[i+1] == ib) || (g.Edges[i] == ib && g.Edges[i+1] == ic) {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %d of the 2 inserted edges", found)
+	}
+
+	pks, err := c.PubkeysForUIDs(ctx, []string{uids[pa], uids[pc]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pks[uids[pa]] != pa || pks[uids[pc]] != pc {
+		t.Errorf("pubkeys = %v", pks)
+	}
+}
+
+// TestWriteTrustRanksPrunesStale ranks a and b, then only a: a keeps its new
+// rank and b loses trust_rank.
+func TestWriteTrustRanksPrunesStale(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient("localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().UnixNano()
+	pa, pb := fmt.Sprintf("%064x", base), fmt.Sprintf("%064x", base+1)
+	mustMutate(t, c, fmt.Sprintf("_:a <pubkey> %q .\n_:b <pubkey> %q .\n", pa, pb))
+	uids, err := c.ResolvePubkeysToUIDs(ctx, []string{pa, pb})
+	if err != nil || len(uids) != 2 {
+		t.Fatalf("resolve: %v, %v", uids, err)
+	}
+	ua, ub := uids[pa], uids[pb]
+
+	if err := c.WriteTrustRanks(ctx, map[string]float64{ua: 0.5, ub: 0.25}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteTrustRanks(ctx, map[string]float64{ua: 0.75}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.dg.NewReadOnlyTxn().Query(ctx, fmt.Sprintf(`{
+		nodes(func: uid(%s, %s)) { uid trust_rank }
+	}`, ua, ub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Nodes []struct {
+			UID       string   `json:"uid"`
+			TrustRank *float64 `json:"trust_rank"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range result.Nodes {
+		switch n.UID {
+		case ua:
+			if n.TrustRank == nil || *n.TrustRank != 0.75 {
+				t.Errorf("a: trust_rank = %v, want 0.75", n.TrustRank)
+			}
+		case ub:
+			if n.TrustRank != nil {
+				t.Errorf("b: stale trust_rank %v survived", *n.TrustRank)
+			}
+		}
+	}
+}
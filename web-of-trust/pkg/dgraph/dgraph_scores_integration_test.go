@@ -0,0 +1,70 @@
+//go:build integration
+
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestWriteTrustScoresPrunesStale writes a scan that places a and b and flags
+// b, then one that places only a: a keeps its distance, b loses both values.
+func TestWriteTrustScoresPrunesStale(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient("localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().UnixNano()
+	pa, pb := fmt.Sprintf("%064x", base), fmt.Sprintf("%064x", base+1)
+	mustMutate(t, c, fmt.Sprintf("_:a <pubkey> %q .\n_:b <pubkey> %q .\n", pa, pb))
+	uids, err := c.ResolvePubkeysToUIDs(ctx, []string{pa, pb})
+	if err != nil || len(uids) != 2 {
+		t.Fatalf("resolve: %v, %v", uids, err)
+	}
+	ua, ub := uids[pa], uids[pb]
+
+	if err := c.WriteTrustScores(ctx, map[string]int{ua: 0, ub: 1}, []string{ub}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteTrustScores(ctx, map[string]int{ua: 0}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.dg.NewReadOnlyTxn().Query(ctx, fmt.Sprintf(`{
+		nodes(func: uid(%s, %s)) { uid trust_distance cluster_flagged }
+	}`, ua, ub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Nodes []struct {
+			UID            string `json:"uid"`
+			TrustDistance  *int   `json:"trust_distance"`
+			ClusterFlagged *bool  `json:"cluster_flagged"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range result.Nodes {
+		switch n.UID {
+		case ua:
+			if n.TrustDistance == nil || *n.TrustDistance != 0 {
+				t.Errorf("a: trust_distance = %v, want 0", n.TrustDistance)
+			}
+		case ub:
+			if n.TrustDistance != nil || n.ClusterFlagged != nil {
+				t.Errorf("b: stale trust_distance %v / cluster_flagged %v survived", n.TrustDistance, n.ClusterFlagged)
+			}
+		}
+	}
+}
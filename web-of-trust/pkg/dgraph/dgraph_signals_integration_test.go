@@ -0,0 +1,156 @@
+//go:build integration
+
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestNegativeSignalsDiscountTrust writes mutes and reports through the
+// crawler's write path and checks ExpandTrustedSet discounts them: x and y
+// have enough trusted followers to join until a trusted mute or report
+// cancels some of them.
+func TestNegativeSignalsDiscountTrust(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient("localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().UnixNano()
+	pk := func(i int64) string { return fmt.Sprintf("%064x", base+i) }
+	s1, s2, s3, x, y := pk(0), pk(1), pk(2), pk(3), pk(4)
+	mustMutate(t, c, fmt.Sprintf(`_:s1 <pubkey> %q .
+_:s2 <pubkey> %q .
+_:s3 <pubkey> %q .
+_:x <pubkey> %q .
+_:y <pubkey> %q .
+_:s1 <follows> _:x .
+_:s2 <follows> _:x .
+_:s1 <follows> _:y .
+_:s2 <follows> _:y .
+_:s3 <follows> _:y .
+`, s1, s2, s3, x, y))
+
+	// An older list never replaces a newer one, whether it arrives in the
+	// same batch or a later one.
+	var batch Signals
+	batch.AddMuteList(s3, 200, map[string]struct{}{x: {}})
+	batch.AddMuteList(s3, 150, map[string]struct{}{y: {}})
+	batch.AddReports(s1, map[string]string{y: "spam", s1: "spam"})
+	if err := c.WriteSignals(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	var stale Signals
+	stale.AddMuteList(s3, 100, map[string]struct{}{y: {}})
+	if err := c.WriteSignals(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	uids, err := c.ResolvePubkeysToUIDs(ctx, []string{s1, s2, s3, x, y})
+	if err != nil || len(uids) != 5 {
+		t.Fatalf("resolve: %v, %v", uids, err)
+	}
+	seeds := []string{uids[s1], uids[s2], uids[s3]}
+
+	expand := func(d Discount) (gotX, gotY bool) {
+		t.Helper()
+		got, err := c.ExpandTrustedSet(ctx, seeds, 2, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slices.Contains(got, uids[x]), slices.Contains(got, uids[y])
+	}
+	if gotX, gotY := expand(Discount{}); !gotX || !gotY {
+		t.Errorf("no discount: x %v, y %v, want both", gotX, gotY)
+	}
+	if gotX, gotY := expand(Discount{Mute: 1}); gotX || !gotY {
+		t.Errorf("mute weight 1: x %v, y %v, want only y", gotX, gotY)
+	}
+	if gotX, gotY := expand(Discount{Mute: 1, Report: 2}); gotX || gotY {
+		t.Errorf("report weight 2: x %v, y %v, want neither", gotX, gotY)
+	}
+
+	// The report type rides on the edge; a self-report is dropped.
+	txn := c.dg.NewReadOnlyTxn()
+	defer txn.Discard(ctx)
+	resp, err := txn.Query(ctx, fmt.Sprintf(`{ q(func: uid(%s)) { reports @facets(type) { pubkey } } }`, uids[s1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Q []struct {
+			Reports []struct {
+				Pubkey string `json:"pubkey"`
+				Type   string `json:"reports|type"`
+			} `json:"reports"`
+		} `json:"q"`
+	}
+	if err := json.Unmarshal(resp.Json, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Q) != 1 || len(out.Q[0].Reports) != 1 || out.Q[0].Reports[0].Pubkey != y || out.Q[0].Reports[0].Type != "spam" {
+		t.Errorf("reports = %+v", out.Q)
+	}
+}
+
+// TestSignalStubsStayOffFrontier reports a pubkey the graph has never seen:
+// its stub must not carry uncrawled until someone follows it.
+func TestSignalStubsStayOffFrontier(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClient("localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().UnixNano()
+	reporter, target, follower := fmt.Sprintf("%064x", base), fmt.Sprintf("%064x", base+1), fmt.Sprintf("%064x", base+2)
+	mustMutate(t, c, fmt.Sprintf("_:r <pubkey> %q .\n", reporter))
+	var batch Signals
+	batch.AddReports(reporter, map[string]string{target: "spam"})
+	if err := c.WriteSignals(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	uncrawled := func() int {
+		t.Helper()
+		resp, err := c.dg.NewReadOnlyTxn().Query(ctx, fmt.Sprintf(`{
+			n(func: eq(pubkey, %q)) { uncrawled }
+		}`, target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			N []struct {
+				Uncrawled int `json:"uncrawled"`
+			} `json:"n"`
+		}
+		if err := json.Unmarshal(resp.Json, &result); err != nil || len(result.N) != 1 {
+			t.Fatalf("target lookup: %s, %v", resp.Json, err)
+		}
+		return result.N[0].Uncrawled
+	}
+	if got := uncrawled(); got != 0 {
+		t.Fatalf("reported stub has uncrawled = %d, want none", got)
+	}
+
+	if err := c.AddFollowers(ctx, follower, time.Now().Unix(), map[string]struct{}{target: {}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := uncrawled(); got != 1 {
+		t.Errorf("followed stub has uncrawled = %d, want 1", got)
+	}
+}
@@ -0,0 +1,160 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v210/protos/api"
+)
+
+// Helpers for the wot-rank CLI: one read of the whole follows graph in the
+// dense uint32 SoA form (a port of the explorer bridge's reader, which in
+// turn follows GetAllPubkeysPaginated's paging), and a batched write of the
+// resulting trust_rank scores.
+
+// followGraphPage is the has(follows) window per read. It bounds per-page
+// memory and gRPC response size; the client's raised receive cap covers it.
+const followGraphPage = 50000
+
+// FollowGraph is the whole follows graph with nodes remapped to dense
+// indices 0..NodeCount-1. Edges are flat [src,tgt] pairs; UIDs maps an
+// index back to its Dgraph uid.
+type FollowGraph struct {
+	Edges     []uint32
+	UIDs      []string
+	NodeCount uint32
+	EdgeCount uint32
+}
+
+// ReadFollowGraph pages every node with follows, READ-ONLY, by uid cursor
+// (after:, never offset). A uid gets its index on first sighting, as a
+// source or as a target, so accounts that follow no one are in the graph
+// too. Each page's read-only txn is discarded inline, never deferred in the
+// loop, so transactions don't pile up across pages.
+func (c *Client) ReadFollowGraph(ctx context.Context) (*FollowGraph, error) {
+	index := make(map[string]uint32)
+	g := &FollowGraph{}
+	indexOf := func(uid string) uint32 {
+		if i, ok := index[uid]; ok {
+			return i
+		}
+		i := uint32(len(g.UIDs))
+		index[uid] = i
+		g.UIDs = append(g.UIDs, uid)
+		return i
+	}
+
+	cursor := "0x0"
+	for {
+		query := fmt.Sprintf(`{
+			q(func: has(follows), first: %d, after: %s) {
+				uid
+				follows { uid }
+			}
+		}`, followGraphPage, cursor)
+
+		txn := c.dg.NewReadOnlyTxn()
+		resp, err := txn.Query(ctx, query)
+		txn.Discard(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read follow graph (cursor %s) failed: %w", cursor, err)
+		}
+
+		var page struct {
+			Q []struct {
+				UID     string `json:"uid"`
+				Follows []struct {
+					UID string `json:"uid"`
+				} `json:"follows"`
+			} `json:"q"`
+		}
+		if err := json.Unmarshal(resp.Json, &page); err != nil {
+			return nil, fmt.Errorf("unmarshal follow graph page failed: %w", err)
+		}
+		for _, n := range page.Q {
+			src := indexOf(n.UID)
+			for _, f := range n.Follows {
+				g.Edges = append(g.Edges, src, indexOf(f.UID))
+			}
+		}
+		if len(page.Q) < followGraphPage {
+			break
+		}
+		cursor = page.Q[len(page.Q)-1].UID
+	}
+
+	g.NodeCount = uint32(len(g.UIDs))
+	g.EdgeCount = uint32(len(g.Edges) / 2)
+	return g, nil
+}
+
+// PubkeysForUIDs returns the pubkey of each uid that has one.
+func (c *Client) PubkeysForUIDs(ctx context.Context, uids []string) (map[string]string, error) {
+	if len(uids) == 0 {
+		return map[string]string{}, nil
+	}
+	query := fmt.Sprintf(`{ nodes(func: uid(%s)) { uid pubkey } }`, uidList(uids))
+
+	txn := c.dg.NewReadOnlyTxn()
+	defer txn.Discard(ctx)
+
+	resp, err := txn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query pubkeys for uids failed: %w", err)
+	}
+	var result struct {
+		Nodes []struct {
+			UID    string `json:"uid"`
+			Pubkey string `json:"pubkey"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal pubkeys for uids failed: %w", err)
+	}
+	out := make(map[string]string, len(result.Nodes))
+	for _, n := range result.Nodes {
+		if n.Pubkey != "" {
+			out[n.UID] = n.Pubkey
+		}
+	}
+	return out, nil
+}
+
+// WriteTrustRanks replaces every node's trust_rank with ranks (uid -> rank)
+// in batches of scoreWriteBatch, like WriteTrustScores: the new values are
+// written first, then trust_rank is pruned from nodes missing from ranks, so
+// readers never see a ranked node without one.
+func (c *Client) WriteTrustRanks(ctx context.Context, ranks map[string]float64) error {
+	var nquads strings.Builder
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		mu := &api.Mutation{SetNquads: []byte(nquads.String()), CommitNow: true}
+		if _, err := c.dg.NewTxn().Mutate(ctx, mu); err != nil {
+			return fmt.Errorf("write trust ranks failed: %w", err)
+		}
+		nquads.Reset()
+		n = 0
+		return nil
+	}
+	for uid, r := range ranks {
+		fmt.Fprintf(&nquads, "<%s> <trust_rank> \"%s\"^^<xs:float> .\n", uid, strconv.FormatFloat(r, 'g', -1, 64))
+		if n++; n >= scoreWriteBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return c.pruneStale(ctx, "trust_rank", func(uid string) bool {
+		_, ok := ranks[uid]
+		return ok
+	})
+}
@@ -0,0 +1,349 @@
+package dgraph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v210"
+	"github.com/dgraph-io/dgo/v210/protos/api"
+)
+
+// Negative signals: the write path for NIP-51 mute lists (kind 10000) and
+// NIP-56 reports (kind 1984), stored as `mutes` and `reports` edges beside
+// `follows`. clusterscan reads them back through their reverse edges to
+// discount accounts that trusted accounts mute or report (see Discount).
+//
+// The crawler collects a batch's signals in a Signals and stores them with
+// one WriteSignals call, after the batch's kind 3 events.
+//
+// Accounts first seen as a mute or report target get a stub Profile with
+// follower_count = 0 but WITHOUT uncrawled = 1, so negative signals do not
+// grow the crawl frontier: a spam ring reporting thousands of throwaway keys
+// should not get them crawled. Such a stub has neither last_attempt nor
+// uncrawled; AddFollowers gives it uncrawled = 1 once someone follows it, and
+// it is crawled from then on like any followee.
+
+// reportTypes are the NIP-56 report types. A report whose type is missing or
+// not one of these is stored as "other".
+var reportTypes = map[string]struct{}{
+	"nudity":        {},
+	"malware":       {},
+	"profanity":     {},
+	"illegal":       {},
+	"spam":          {},
+	"impersonation": {},
+	"other":         {},
+}
+
+// MuteList is a signer's public mute list (kind 10000) as of CreatedAt.
+type MuteList struct {
+	CreatedAt int64
+	Muted     map[string]struct{}
+}
+
+// Signals collects one crawl batch's mute lists and reports for a single
+// WriteSignals call. The zero value is ready to use.
+type Signals struct {
+	Mutes   map[string]MuteList          // signer -> newest list seen
+	Reports map[string]map[string]string // reporter -> reported pubkey -> NIP-56 type
+}
+
+// AddMuteList keeps muted as signer's list unless a newer one is already held.
+func (s *Signals) AddMuteList(signer string, createdAt int64, muted map[string]struct{}) {
+	if old, ok := s.Mutes[signer]; ok && old.CreatedAt >= createdAt {
+		return
+	}
+	if s.Mutes == nil {
+		s.Mutes = make(map[string]MuteList)
+	}
+	s.Mutes[signer] = MuteList{CreatedAt: createdAt, Muted: muted}
+}
+
+// AddReports merges one report event's targets into reporter's.
+func (s *Signals) AddReports(reporter string, reported map[string]string) {
+	if len(reported) == 0 {
+		return
+	}
+	if s.Reports == nil {
+		s.Reports = make(map[string]map[string]string)
+	}
+	if s.Reports[reporter] == nil {
+		s.Reports[reporter] = make(map[string]string, len(reported))
+	}
+	for pk, typ := range reported {
+		s.Reports[reporter][pk] = typ
+	}
+}
+
+// Len is the number of mute lists and reporters held.
+func (s *Signals) Len() int {
+	return len(s.Mutes) + len(s.Reports)
+}
+
+// muteStateWindow bounds the signers whose current mutes edges one query
+// reads: a mute list can run to thousands of entries, so the batchSize used
+// for pubkey lookups could outgrow the gRPC cap.
+const muteStateWindow = 20
+
+// WriteSignals stores a batch of negative signals in one transaction.
+//
+// Mute lists replace the signer's mutes edges. Kind 10000 is replaceable, so,
+// as with kind3CreatedAt, a list no newer than the stored mutesCreatedAt is
+// ignored.
+//
+// Reports add a reports edge from the reporter to each reported pubkey, with
+// the report type as the edge's `type` facet. Reports are not replaceable:
+// edges accumulate across reports, and a newer report against the same
+// account overwrites the facet.
+func (c *Client) WriteSignals(ctx context.Context, s Signals) error {
+	var signers, reporters []string
+	targets := make(map[string][]string)
+	lines := 0
+	for pk, list := range s.Mutes {
+		if isValidHexPubkey(pk) {
+			signers = append(signers, pk)
+			targets[pk] = validTargets(pk, list.Muted)
+			lines += 1 + len(targets[pk])
+		}
+	}
+	reportTargets := make(map[string][]string)
+	for pk, reported := range s.Reports {
+		set := make(map[string]struct{}, len(reported))
+		for t := range reported {
+			set[t] = struct{}{}
+		}
+		if ts := validTargets(pk, set); isValidHexPubkey(pk) && len(ts) > 0 {
+			reporters = append(reporters, pk)
+			reportTargets[pk] = ts
+			lines += len(ts)
+		}
+	}
+	if len(signers)+len(reporters) == 0 {
+		return nil
+	}
+	sort.Strings(signers)
+	sort.Strings(reporters)
+
+	ctx, cancel := signalTimeout(ctx, lines)
+	defer cancel()
+	txn := c.dg.NewTxn()
+	defer txn.Discard(ctx)
+
+	state, err := readMuteState(ctx, txn, signers)
+	if err != nil {
+		return err
+	}
+	need := make(map[string]struct{})
+	var del []string
+	var applied []string
+	for _, pk := range signers {
+		st, ok := state[pk]
+		if ok && s.Mutes[pk].CreatedAt <= st.createdAt {
+			continue
+		}
+		for _, m := range st.mutes {
+			del = append(del, fmt.Sprintf("<%s> <mutes> <%s> .", st.uid, m))
+		}
+		applied = append(applied, pk)
+		need[pk] = struct{}{}
+		for _, t := range targets[pk] {
+			need[t] = struct{}{}
+		}
+	}
+	for _, pk := range reporters {
+		need[pk] = struct{}{}
+		for _, t := range reportTargets[pk] {
+			need[t] = struct{}{}
+		}
+	}
+	if len(need) == 0 {
+		return nil
+	}
+
+	for _, window := range chunkSlice(del, batchSize) {
+		mu := &api.Mutation{DelNquads: []byte(strings.Join(window, "\n") + "\n")}
+		if _, err := txn.Mutate(ctx, mu); err != nil {
+			return fmt.Errorf("remove existing mutes failed: %w", err)
+		}
+	}
+
+	pubkeys := make([]string, 0, len(need))
+	for pk := range need {
+		pubkeys = append(pubkeys, pk)
+	}
+	sort.Strings(pubkeys)
+	uids, err := resolveOrCreate(ctx, txn, pubkeys)
+	if err != nil {
+		return err
+	}
+
+	set := make([]string, 0, lines)
+	for _, pk := range applied {
+		set = append(set, fmt.Sprintf("<%s> <mutesCreatedAt> \"%d\" .", uids[pk], s.Mutes[pk].CreatedAt))
+		for _, t := range targets[pk] {
+			set = append(set, fmt.Sprintf("<%s> <mutes> <%s> .", uids[pk], uids[t]))
+		}
+	}
+	for _, pk := range reporters {
+		for _, t := range reportTargets[pk] {
+			typ := s.Reports[pk][t]
+			if _, ok := reportTypes[typ]; !ok {
+				typ = "other"
+			}
+			set = append(set, fmt.Sprintf("<%s> <reports> <%s> (type=%q) .", uids[pk], uids[t], typ))
+		}
+	}
+	if err := mutateLines(ctx, txn, set); err != nil {
+		return fmt.Errorf("write signals failed: %w", err)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		return fmt.Errorf("commit signals failed: %w", err)
+	}
+	return nil
+}
+
+type muteState struct {
+	uid       string
+	createdAt int64
+	mutes     []string // uids
+}
+
+// readMuteState returns the stored mutesCreatedAt and mutes edges of each
+// signer already in the graph, inside txn.
+func readMuteState(ctx context.Context, txn *dgo.Txn, signers []string) (map[string]muteState, error) {
+	state := make(map[string]muteState, len(signers))
+	for _, window := range chunkSlice(signers, muteStateWindow) {
+		quoted := make([]string, len(window))
+		for i, pk := range window {
+			quoted[i] = strconv.Quote(pk)
+		}
+		resp, err := txn.Query(ctx, fmt.Sprintf(`
+		{
+			signers(func: eq(pubkey, [%s])) {
+				uid
+				pubkey
+				mutesCreatedAt
+				mutes { uid }
+			}
+		}`, strings.Join(quoted, ", ")))
+		if err != nil {
+			return nil, fmt.Errorf("query muters failed: %w", err)
+		}
+		var result struct {
+			Signers []struct {
+				UID            string `json:"uid"`
+				Pubkey         string `json:"pubkey"`
+				MutesCreatedAt int64  `json:"mutesCreatedAt"`
+				Mutes          []struct {
+					UID string `json:"uid"`
+				} `json:"mutes"`
+			} `json:"signers"`
+		}
+		if err := json.Unmarshal(resp.Json, &result); err != nil {
+			return nil, fmt.Errorf("unmarshal muters failed: %w", err)
+		}
+		for _, n := range result.Signers {
+			st := muteState{uid: n.UID, createdAt: n.MutesCreatedAt}
+			for _, m := range n.Mutes {
+				st.mutes = append(st.mutes, m.UID)
+			}
+			state[n.Pubkey] = st
+		}
+	}
+	return state, nil
+}
+
+// validTargets returns the valid, sorted keys of set, without signer: an
+// account muting or reporting itself says nothing about it.
+func validTargets(signer string, set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for pk := range set {
+		if pk != signer && isValidHexPubkey(pk) {
+			out = append(out, pk)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// signalTimeout scales the deadline with the number of batchSize windows, as
+// AddFollowers does.
+func signalTimeout(ctx context.Context, lines int) (context.Context, context.CancelFunc) {
+	batches := (lines + batchSize - 1) / batchSize
+	return context.WithTimeout(ctx, baseTimeout+time.Duration(batches)*perBatchTimeout)
+}
+
+// resolveOrCreate returns the uid of each pubkey inside txn, creating a stub
+// Profile, off the frontier, for any not yet in the graph. It works in batchSize windows so
+// neither the query nor the mutation outgrows the gRPC cap.
+func resolveOrCreate(ctx context.Context, txn *dgo.Txn, pubkeys []string) (map[string]string, error) {
+	uids := make(map[string]string, len(pubkeys))
+	for _, window := range chunkSlice(pubkeys, batchSize) {
+		quoted := make([]string, len(window))
+		for i, pk := range window {
+			quoted[i] = strconv.Quote(pk)
+		}
+		resp, err := txn.Query(ctx, fmt.Sprintf(`
+		{
+			nodes(func: eq(pubkey, [%s])) {
+				uid
+				pubkey
+			}
+		}`, strings.Join(quoted, ", ")))
+		if err != nil {
+			return nil, fmt.Errorf("resolve pubkeys failed: %w", err)
+		}
+		var result struct {
+			Nodes []struct {
+				UID    string `json:"uid"`
+				Pubkey string `json:"pubkey"`
+			} `json:"nodes"`
+		}
+		if err := json.Unmarshal(resp.Json, &result); err != nil {
+			return nil, fmt.Errorf("unmarshal resolved pubkeys failed: %w", err)
+		}
+		for _, n := range result.Nodes {
+			uids[n.Pubkey] = n.UID
+		}
+
+		var create strings.Builder
+		blank := make(map[string]string)
+		for i, pk := range window {
+			if _, ok := uids[pk]; ok {
+				continue
+			}
+			id := fmt.Sprintf("stub_%d", i)
+			blank[id] = pk
+			fmt.Fprintf(&create, "_:%s <pubkey> %q .\n", id, pk)
+			fmt.Fprintf(&create, "_:%s <dgraph.type> \"Profile\" .\n", id)
+			fmt.Fprintf(&create, "_:%s <follower_count> \"0\" .\n", id)
+		}
+		if len(blank) == 0 {
+			continue
+		}
+		assigned, err := txn.Mutate(ctx, &api.Mutation{SetNquads: []byte(create.String())})
+		if err != nil {
+			return nil, fmt.Errorf("create stubs failed: %w", err)
+		}
+		for id, pk := range blank {
+			uids[pk] = assigned.Uids[id]
+		}
+	}
+	return uids, nil
+}
+
+// mutateLines sets the given N-Quad lines inside txn in batchSize windows.
+func mutateLines(ctx context.Context, txn *dgo.Txn, lines []string) error {
+	for _, window := range chunkSlice(lines, batchSize) {
+		mu := &api.Mutation{SetNquads: []byte(strings.Join(window, "\n") + "\n")}
+		if _, err := txn.Mutate(ctx, mu); err != nil {
+			return err
+		}
+	}
+	return nil
+}
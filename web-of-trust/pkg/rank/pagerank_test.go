@@ -0,0 +1,92 @@
+package rank
+
+import (
+	"math"
+	"testing"
+)
+
+func opts() Options {
+	return Options{Damping: DefaultDamping, Tolerance: DefaultTolerance, MaxIterations: DefaultMaxIterations}
+}
+
+func sum(xs []float64) float64 {
+	s := 0.0
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+func TestFromEdges(t *testing.T) {
+	// 0->1, 0->2, 2->0, and one pair out of range.
+	g := FromEdges(3, []uint32{0, 1, 2, 0, 0, 2, 1, 7})
+	if g.N() != 3 {
+		t.Fatalf("N = %d", g.N())
+	}
+	want := [][]uint32{{1, 2}, {}, {0}}
+	for i, w := range want {
+		got := g.Targets[g.Offsets[i]:g.Offsets[i+1]]
+		if len(got) != len(w) {
+			t.Fatalf("node %d follows %v, want %v", i, got, w)
+		}
+		for j := range w {
+			if got[j] != w[j] {
+				t.Fatalf("node %d follows %v, want %v", i, got, w)
+			}
+		}
+	}
+}
+
+func TestPersonalized(t *testing.T) {
+	// Seed 0 follows 1 and 2; 1 follows 3; 2 follows 3; 3 follows no one.
+	// 4 follows 3 but nobody reaches 4; 5 is isolated.
+	g := FromEdges(6, []uint32{0, 1, 0, 2, 1, 3, 2, 3, 4, 3})
+	var deltas []float64
+	o := opts()
+	o.Tolerance, o.MaxIterations = 1e-12, 500
+	o.Progress = func(_ int, d float64) { deltas = append(deltas, d) }
+	res := Personalized(g, []uint32{0, 0, 99}, o)
+
+	if !res.Converged || res.Delta >= o.Tolerance || len(deltas) != res.Iterations {
+		t.Fatalf("converged %v after %d iterations, delta %g, %d progress calls", res.Converged, res.Iterations, res.Delta, len(deltas))
+	}
+	s := res.Scores
+	if math.Abs(sum(s)-1) > 1e-9 {
+		t.Errorf("scores sum to %v", sum(s))
+	}
+	if s[4] != 0 || s[5] != 0 {
+		t.Errorf("unreachable nodes scored %v, %v", s[4], s[5])
+	}
+	if math.Abs(s[1]-s[2]) > 1e-12 {
+		t.Errorf("symmetric nodes differ: %v, %v", s[1], s[2])
+	}
+	// Closed form: with x = s[0], s1 = s2 = d·x/2, s3 = d·(s1+s2) = d²x and
+	// x = (1-d) + d·s3 (the dangling node jumps back) = (1-d) + d³x.
+	d := DefaultDamping
+	x := (1 - d) / (1 - d*d*d)
+	if math.Abs(s[0]-x) > 1e-10 || math.Abs(s[3]-d*d*x) > 1e-10 {
+		t.Errorf("scores = %v, want s0 = %v, s3 = %v", s, x, d*d*x)
+	}
+}
+
+func TestPersonalized_EndorsementsCount(t *testing.T) {
+	// Seeds 0 and 1. 2 is followed by both seeds, 3 by one seed, 4 only by 3.
+	g := FromEdges(5, []uint32{0, 2, 1, 2, 1, 3, 3, 4})
+	s := Personalized(g, []uint32{0, 1}, opts()).Scores
+	if !(s[2] > s[3] && s[3] > s[4] && s[4] > 0) {
+		t.Errorf("scores = %v, want 2 > 3 > 4 > 0", s)
+	}
+}
+
+func TestPersonalized_NoSeedsAndIterationCap(t *testing.T) {
+	g := FromEdges(2, []uint32{0, 1, 1, 0})
+	if res := Personalized(g, nil, opts()); !res.Converged || sum(res.Scores) != 0 {
+		t.Errorf("no seeds: %+v", res)
+	}
+	o := opts()
+	o.MaxIterations = 3
+	// A two-cycle from one seed oscillates and damps slowly.
+	if res := Personalized(g, []uint32{0}, o); res.Converged || res.Iterations != 3 {
+		t.Errorf("capped run: converged %v after %d iterations", res.Converged, res.Iterations)
+	}
+}
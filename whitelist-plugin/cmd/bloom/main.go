@@ -1,16 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"whitelist-plugin/pkg/bloomgate"
+	"whitelist-plugin/pkg/client"
 	"whitelist-plugin/pkg/config"
 	"whitelist-plugin/pkg/handler"
+	"whitelist-plugin/pkg/metrics"
+	"whitelist-plugin/pkg/pipeline"
+	"whitelist-plugin/pkg/policy"
+	"whitelist-plugin/pkg/recorder"
 )
 
 func main() {
@@ -33,64 +38,52 @@ func main() {
 	fetcher.Start()
 	defer fetcher.Stop()
 
+	// Membership is decided locally, but the operator's bans and write policy
+	// apply as in the client plugin; the client here only polls /moderation.
+	moderation := client.NewWhitelistClient(cfg.ServerURL, cfg.BloomFetchTimeout, logger)
+	go moderation.WatchModeration(ctx, cfg.ModerationInterval)
+
+	engine := policy.NewEngine(cfg.PolicyPath, logger)
+	if err := engine.Load(); err != nil {
+		logger.Printf("WARNING: %v", err)
+	}
+	logger.Printf("Write policy %s: %d rules", cfg.PolicyPath, engine.Len())
+	go engine.Watch(ctx, cfg.PolicyReloadInterval)
+
+	rec, err := recorder.FromConfig(cfg.BloomRecord, logger)
+	if err != nil {
+		logger.Fatalf("Failed to start recording: %v", err)
+	}
+	defer rec.Close()
+
 	// Reuse Handler and IOAdapter unchanged (GATE-01 / D-12).
 	h := handler.NewWhitelistHandler(checker, logger)
+	h.SetOnCheck(rec.Check)
+	h.SetPolicy(engine)
+	h.SetModerator(moderation)
 	ioAdapter := handler.NewJSONLIOAdapter(os.Stdout)
 
-	if err := runEventLoop(ctx, h, ioAdapter, logger); err != nil {
-		logger.Printf("Error in event loop: %v", err)
-		os.Exit(1)
+	var m *metrics.Plugin
+	if cfg.BloomMetricsAddr != "" {
+		m = metrics.NewPlugin("bloom")
+		go func() {
+			if err := m.Serve(ctx, cfg.BloomMetricsAddr, logger); err != nil {
+				logger.Printf("WARNING: metrics listener: %v", err)
+			}
+		}()
 	}
-}
-
-func runEventLoop(ctx context.Context, h handler.Handler, io handler.IOAdapter, logger *log.Logger) error {
-	const (
-		initBuf = 64 * 1024
-		maxBuf  = 10 * 1024 * 1024
-	)
 
-	scanner := bufio.NewScanner(os.Stdin)
-	buf := make([]byte, 0, initBuf)
-	scanner.Buffer(buf, maxBuf)
-
-	type scanResult struct {
-		line []byte
-		err  error
+	process := func(line []byte) []byte {
+		return processLine(line, h, ioAdapter, m, logger)
 	}
-	lines := make(chan scanResult)
-
-	go func() {
-		defer close(lines)
-		for scanner.Scan() {
-			line := make([]byte, len(scanner.Bytes()))
-			copy(line, scanner.Bytes())
-			lines <- scanResult{line: line}
-		}
-		if err := scanner.Err(); err != nil {
-			lines <- scanResult{err: err}
-		}
-	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case result, ok := <-lines:
-			if !ok {
-				return nil
-			}
-			if result.err != nil {
-				return result.err
-			}
-			response := processLine(result.line, h, io, logger)
-			if _, err := os.Stdout.Write(response); err != nil {
-				return err
-			}
-		}
+	if err := pipeline.Run(ctx, os.Stdin, os.Stdout, cfg.BloomPipelineWorkers, process, rec.Record); err != nil {
+		logger.Printf("Error in event loop: %v", err)
+		rec.Close()
+		os.Exit(1)
 	}
 }
 
-func processLine(line []byte, h handler.Handler, ioAd handler.IOAdapter, logger *log.Logger) []byte {
+func processLine(line []byte, h handler.Handler, ioAd handler.IOAdapter, m *metrics.Plugin, logger *log.Logger) []byte {
 	logger.Printf("Received line: %s", line)
 	inputMsg, err := ioAd.Input(line)
 	if err != nil {
@@ -98,11 +91,14 @@ func processLine(line []byte, h handler.Handler, ioAd handler.IOAdapter, logger
 		return safeOutput(ioAd, handler.RejectMalformed(), logger)
 	}
 
+	started := time.Now()
 	outputMsg, err := h.Handle(inputMsg)
 	if err != nil {
+		m.ObserveDecision("error", time.Since(started))
 		logger.Printf("Handler error: %v", err)
 		return safeOutput(ioAd, handler.RejectInternalWithError(inputMsg.Event.ID, err), logger)
 	}
+	m.ObserveDecision(string(outputMsg.Action), time.Since(started))
 
 	resp, err := ioAd.Output(outputMsg)
 	if err != nil {
@@ -0,0 +1,155 @@
+// Command plugin-replay feeds a recording made by a plugin's record mode back
+// through a handler and reports every decision that comes out differently.
+// Whitelist answers come from the recording, so a diff is down to the handler
+// or write policy being tested, not to the whitelist having moved since.
+//
+//	plugin-replay -plugin router -policy new-policy.yaml router.jsonl.2 router.jsonl.1 router.jsonl
+//
+// Pass rotated files oldest first. Operator bans (NIP-86 moderation) are not
+// recorded, so events they rejected show up as diffs. Exits 1 if any decision
+// changed.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"whitelist-plugin/pkg/handler"
+	"whitelist-plugin/pkg/policy"
+	"whitelist-plugin/pkg/recorder"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// discardEnqueuer stands in for the quarantine publisher: replayed events are
+// never sent anywhere.
+type discardEnqueuer struct{}
+
+func (discardEnqueuer) Enqueue(nostr.Event) bool { return true }
+
+func main() {
+	plugin := flag.String("plugin", "whitelist", "handler to replay through: whitelist (also for bloom recordings) or router")
+	policyPath := flag.String("policy", "", "write policy file to apply (default: none)")
+	quarantine := flag.Bool("quarantine", true, "router only: replay with quarantine enabled")
+	maxDiffs := flag.Int("max-diffs", 20, "print at most this many changed decisions (-1 = all)")
+	verbose := flag.Bool("v", false, "log every replayed decision")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "[plugin-replay] ", 0)
+	if flag.NArg() == 0 {
+		logger.Fatalf("usage: plugin-replay [flags] recording.jsonl...")
+	}
+
+	var handlerLogger *log.Logger
+	if *verbose {
+		handlerLogger = logger
+	}
+
+	var pol handler.PolicyEvaluator
+	if *policyPath != "" {
+		engine := policy.NewEngine(*policyPath, logger)
+		if err := engine.Load(); err != nil {
+			logger.Fatalf("Failed to load policy: %v", err)
+		}
+		logger.Printf("Write policy %s: %d rules", *policyPath, engine.Len())
+		pol = engine
+	}
+
+	checker := recorder.NewFakeChecker()
+	var decide func(line []byte) handler.OutputMsg
+	switch *plugin {
+	case "whitelist":
+		h := handler.NewWhitelistHandler(checker, handlerLogger)
+		if pol != nil {
+			h.SetPolicy(pol)
+		}
+		decide = func(line []byte) handler.OutputMsg {
+			msg, err := handler.DeserializeInputMsg(line)
+			if err != nil {
+				return handler.RejectMalformed()
+			}
+			return handle(h.Handle(msg))
+		}
+	case "router":
+		h := handler.NewRouterHandler(checker, discardEnqueuer{}, *quarantine, handlerLogger)
+		if pol != nil {
+			h.SetPolicy(pol)
+		}
+		decide = func(line []byte) handler.OutputMsg {
+			msg, err := handler.DeserializeRouterInputMsg(line)
+			if err != nil {
+				return handler.RejectMalformed()
+			}
+			return handle(h.Handle(msg))
+		}
+	default:
+		logger.Fatalf("unknown -plugin %q (want whitelist or router)", *plugin)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	printed := 0
+	onDiff := func(d recorder.Diff) {
+		if *maxDiffs >= 0 && printed >= *maxDiffs {
+			return
+		}
+		printed++
+		out.Encode(d)
+	}
+
+	var total recorder.Summary
+	total.Transitions = make(map[string]int)
+	for _, path := range flag.Args() {
+		sum, err := replayFile(path, checker, decide, onDiff)
+		if err != nil {
+			logger.Fatalf("%s: %v", path, err)
+		}
+		total.Events += sum.Events
+		total.Changed += sum.Changed
+		for t, n := range sum.Transitions {
+			total.Transitions[t] += n
+		}
+	}
+
+	printSummary(os.Stderr, total, checker.Unknown())
+	if total.Changed > 0 {
+		os.Exit(1)
+	}
+}
+
+// handle mirrors the plugins' processLine: a handler error is an internal
+// reject.
+func handle(msg handler.OutputMsg, err error) handler.OutputMsg {
+	if err != nil {
+		return handler.RejectInternalWithError("", err)
+	}
+	return msg
+}
+
+func replayFile(path string, checker *recorder.FakeChecker, decide func([]byte) handler.OutputMsg, onDiff func(recorder.Diff)) (recorder.Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return recorder.Summary{}, err
+	}
+	defer f.Close()
+	return recorder.Replay(f, checker, decide, onDiff)
+}
+
+func printSummary(w io.Writer, sum recorder.Summary, unknown int) {
+	fmt.Fprintf(w, "%d events replayed, %d decisions changed\n", sum.Events, sum.Changed)
+	transitions := make([]string, 0, len(sum.Transitions))
+	for t := range sum.Transitions {
+		transitions = append(transitions, t)
+	}
+	sort.Strings(transitions)
+	for _, t := range transitions {
+		fmt.Fprintf(w, "  %-28s %d\n", t, sum.Transitions[t])
+	}
+	if unknown > 0 {
+		fmt.Fprintf(w, "%d whitelist checks had no recorded answer (treated as not whitelisted)\n", unknown)
+	}
+}
@@ -6,18 +6,26 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"whitelist-plugin/pkg/capture"
 	"whitelist-plugin/pkg/client"
 	"whitelist-plugin/pkg/config"
+	"whitelist-plugin/pkg/decisions"
 	"whitelist-plugin/pkg/handler"
+	"whitelist-plugin/pkg/heuristics"
+	"whitelist-plugin/pkg/metrics"
+	"whitelist-plugin/pkg/pipeline"
+	"whitelist-plugin/pkg/policy"
 	"whitelist-plugin/pkg/quarantine"
+	"whitelist-plugin/pkg/recorder"
+	"whitelist-plugin/pkg/verify"
 )
 
 func main() {
@@ -32,6 +40,9 @@ func main() {
 	}
 
 	checker := client.NewWhitelistClient(cfg.ServerURL, cfg.CheckTimeout, logger)
+	if cfg.PipelineWorkers > 1 {
+		checker.EnableBulkChecks()
+	}
 	if err := checker.CheckHealth(); err != nil {
 		logger.Printf("WARNING: %v", err)
 		logger.Printf("Events will be rejected until the whitelist server is reachable")
@@ -39,28 +50,87 @@ func main() {
 		logger.Printf("Connected to whitelist server at %s", cfg.ServerURL)
 	}
 
+	go checker.WatchChanges(ctx, cfg.ChangeStream, cfg.DeltaInterval)
+	go checker.WatchModeration(ctx, cfg.ModerationInterval)
+
 	var publisher *quarantine.Publisher
 	if cfg.Quarantine.Enabled {
 		publisher = quarantine.NewPublisher(quarantine.Config{
 			RelayURL:        cfg.Quarantine.RelayURL,
+			RelayURLs:       cfg.Quarantine.RelayURLs,
 			BufferSize:      cfg.Quarantine.BufferSize,
+			MaxInflight:     cfg.Quarantine.MaxInflight,
 			PublishTimeout:  cfg.Quarantine.PublishTimeout,
 			MetricsInterval: cfg.Quarantine.MetricsInterval,
 		}, logger)
+		if cfg.Quarantine.SpoolDir != "" {
+			if err := publisher.EnableSpool(cfg.Quarantine.SpoolDir, cfg.Quarantine.SpoolMaxBytes); err != nil {
+				logger.Fatalf("Failed to open quarantine spool: %v", err)
+			}
+			m := publisher.Metrics()
+			logger.Printf("Quarantine spool %s: %d events (%d bytes) waiting", cfg.Quarantine.SpoolDir, m.SpoolDepth, m.SpoolBytes)
+		}
 		publisher.Start(ctx)
-		logger.Printf("Quarantine publisher started -> %s (buffer=%d)", cfg.Quarantine.RelayURL, cfg.Quarantine.BufferSize)
+		logger.Printf("Quarantine publisher started -> %s (buffer=%d, inflight=%d per relay)",
+			strings.Join(publisher.RelayURLs(), ", "), cfg.Quarantine.BufferSize, cfg.Quarantine.MaxInflight)
 	} else {
 		logger.Printf("Quarantine disabled by config; plugin will behave like the whitelist plugin")
 	}
 
+	rec, err := recorder.FromConfig(cfg.Record, logger)
+	if err != nil {
+		logger.Fatalf("Failed to start recording: %v", err)
+	}
+	defer rec.Close()
+
 	h := handler.NewRouterHandler(checker, publisher, cfg.Quarantine.Enabled, logger)
+	h.SetOnCheck(rec.Check)
+	h.SetPolicy(startPolicy(ctx, cfg.PolicyPath, cfg.PolicyReloadInterval, logger))
+	h.SetModerator(checker)
+	verifier := verify.NewVerifier(verify.DefaultCacheSize)
+	if cfg.PipelineWorkers > 1 {
+		verifier.EnableBatching()
+	}
+	h.SetVerifier(verifier)
+	h.SetCaptureLimiter(newCaptureLimiter(cfg.Capture, logger))
+	h.SetHeuristics(newHeuristics(cfg.Heuristics, logger))
+	store := openDecisionStore(ctx, cfg.Decisions, logger)
+	defer store.Close()
+	if store != nil {
+		h.SetDecisionStore(store, checker.Generation)
+	}
 	io := handler.NewRouterIOAdapter(os.Stdout)
 
-	if err := runEventLoop(ctx, h, io, logger); err != nil {
+	var m *metrics.Plugin
+	if cfg.MetricsAddr != "" {
+		m = metrics.NewPlugin("router")
+		h.SetOnHeuristicsDrop(m.ObserveHeuristicsDrop)
+		h.SetOnHeuristicsFlag(m.ObserveHeuristicsFlag)
+		h.SetOnCaptureDecision(m.ObserveCaptureDecision)
+		h.SetOnVerifyFailure(m.ObserveVerifyFailure)
+		if publisher != nil {
+			m.RegisterPublisher(publisher)
+		}
+		if store != nil {
+			m.RegisterDecisionStore(store)
+		}
+		go func() {
+			if err := m.Serve(ctx, cfg.MetricsAddr, logger); err != nil {
+				logger.Printf("WARNING: metrics listener: %v", err)
+			}
+		}()
+	}
+
+	process := func(line []byte) []byte {
+		return processLine(line, h, io, m, logger)
+	}
+	if err := pipeline.Run(ctx, os.Stdin, os.Stdout, cfg.PipelineWorkers, process, rec.Record); err != nil {
 		logger.Printf("Error in event loop: %v", err)
 		if publisher != nil {
 			publisher.Stop(2 * time.Second)
 		}
+		rec.Close()
+		store.Close()
 		os.Exit(1)
 	}
 
@@ -69,74 +139,98 @@ func main() {
 	}
 }
 
-type routerHandler interface {
-	Handle(input handler.RouterInputMsg) (handler.OutputMsg, error)
+// openDecisionStore opens the quarantine decision store and serves its HTTP
+// lookup if cfg.Path is set; otherwise it returns nil, which records nothing.
+func openDecisionStore(ctx context.Context, cfg config.DecisionsConfig, logger *log.Logger) *decisions.Store {
+	if cfg.Path == "" {
+		return nil
+	}
+	store, err := decisions.Open(decisions.Config{Path: cfg.Path, BufferSize: cfg.BufferSize, Retention: cfg.Retention}, logger)
+	if err != nil {
+		logger.Fatalf("Failed to open decision store: %v", err)
+	}
+	logger.Printf("Recording quarantine decisions to %s (retention %s)", cfg.Path, cfg.Retention)
+	if cfg.Addr != "" {
+		go func() {
+			if err := store.Serve(ctx, cfg.Addr, logger); err != nil {
+				logger.Printf("WARNING: decision lookup listener: %v", err)
+			}
+		}()
+	}
+	return store
 }
 
-type routerIO interface {
-	Input(input []byte) (handler.RouterInputMsg, error)
-	Output(msg handler.OutputMsg) ([]byte, error)
+// newHeuristics builds the content heuristics chain run after the MVP gate,
+// cheap stages first.
+func newHeuristics(cfg config.HeuristicsConfig, logger *log.Logger) *heuristics.Chain {
+	c := heuristics.NewChain(cfg.DropScore).
+		Add(heuristics.NewFutureStage(cfg.FutureDated.MaxSkew, nil), cfg.FutureDated.Weight).
+		Add(heuristics.NewPoWStage(cfg.PoW.MinDifficulty), cfg.PoW.Weight).
+		Add(heuristics.NewEntropyStage(cfg.Entropy.MinBits, cfg.Entropy.MinLength), cfg.Entropy.Weight).
+		Add(heuristics.NewURLDensityStage(cfg.URLDensity.MaxCount, cfg.URLDensity.MaxRatio), cfg.URLDensity.Weight).
+		Add(heuristics.NewMentionDensityStage(cfg.MentionDensity.MaxCount, cfg.MentionDensity.MaxRatio), cfg.MentionDensity.Weight).
+		Add(heuristics.NewDuplicateStage(cfg.Duplicate.Window, cfg.Duplicate.MaxDistance, cfg.Duplicate.MinLength), cfg.Duplicate.Weight).
+		Add(heuristics.SignatureStage, cfg.Signature.Weight)
+	logger.Printf("Heuristics: %d stages (drop score %g)", c.Len(), cfg.DropScore)
+	return c
 }
 
-func runEventLoop(ctx context.Context, h routerHandler, io routerIO, logger *log.Logger) error {
-	const (
-		initBuf = 64 * 1024
-		maxBuf  = 10 * 1024 * 1024
-	)
-
-	scanner := bufio.NewScanner(os.Stdin)
-	buf := make([]byte, 0, initBuf)
-	scanner.Buffer(buf, maxBuf)
-
-	type scanResult struct {
-		line []byte
-		err  error
+// newCaptureLimiter builds the quarantine sampling and rate limits. It returns
+// nil, which captures everything, when cfg limits nothing.
+func newCaptureLimiter(cfg config.CaptureConfig, logger *log.Logger) handler.CaptureLimiter {
+	l := capture.New(capture.Config{
+		SampleRate:  cfg.SampleRate,
+		PubkeyRate:  cfg.PubkeyRate,
+		PubkeyBurst: cfg.PubkeyBurst,
+		IPRate:      cfg.IPRate,
+		IPBurst:     cfg.IPBurst,
+		MaxKeys:     cfg.MaxKeys,
+	})
+	if l == nil {
+		logger.Printf("Quarantine capture unlimited")
+		return nil
 	}
-	lines := make(chan scanResult)
+	logger.Printf("Quarantine capture: sample=%g pubkey=%g/s (burst %d) ip=%g/s (burst %d)",
+		cfg.SampleRate, cfg.PubkeyRate, cfg.PubkeyBurst, cfg.IPRate, cfg.IPBurst)
+	return l
+}
 
-	go func() {
-		defer close(lines)
-		for scanner.Scan() {
-			line := make([]byte, len(scanner.Bytes()))
-			copy(line, scanner.Bytes())
-			lines <- scanResult{line: line}
-		}
-		if err := scanner.Err(); err != nil {
-			lines <- scanResult{err: err}
-		}
-	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case result, ok := <-lines:
-			if !ok {
-				return nil
-			}
-			if result.err != nil {
-				return result.err
-			}
-			response := processLine(result.line, h, io, logger)
-			if _, err := os.Stdout.Write(response); err != nil {
-				return err
-			}
-		}
+// startPolicy loads the write policy and watches it for edits. A missing file
+// means no policy; an invalid one is logged and the plugin starts without it.
+func startPolicy(ctx context.Context, path string, interval time.Duration, logger *log.Logger) *policy.Engine {
+	engine := policy.NewEngine(path, logger)
+	if err := engine.Load(); err != nil {
+		logger.Printf("WARNING: %v", err)
 	}
+	logger.Printf("Write policy %s: %d rules (reload every %s)", path, engine.Len(), interval)
+	go engine.Watch(ctx, interval)
+	return engine
+}
+
+type routerHandler interface {
+	Handle(input handler.RouterInputMsg) (handler.OutputMsg, error)
+}
+
+type routerIO interface {
+	Input(input []byte) (handler.RouterInputMsg, error)
+	Output(msg handler.OutputMsg) ([]byte, error)
 }
 
-func processLine(line []byte, h routerHandler, io routerIO, logger *log.Logger) []byte {
+func processLine(line []byte, h routerHandler, io routerIO, m *metrics.Plugin, logger *log.Logger) []byte {
 	inputMsg, err := io.Input(line)
 	if err != nil {
 		logger.Printf("Invalid input: %v", err)
 		return safeOutput(io, handler.RejectMalformed(), logger)
 	}
 
+	started := time.Now()
 	outputMsg, err := h.Handle(inputMsg)
 	if err != nil {
+		m.ObserveDecision("error", time.Since(started))
 		logger.Printf("Handler error: %v", err)
 		return safeOutput(io, handler.RejectInternalWithError("", err), logger)
 	}
+	m.ObserveDecision(string(outputMsg.Action), time.Since(started))
 
 	resp, err := io.Output(outputMsg)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"time"
 	"whitelist-plugin/pkg/bloom"
 	"whitelist-plugin/pkg/config"
+	"whitelist-plugin/pkg/overrides"
 	"whitelist-plugin/pkg/repository"
 	"whitelist-plugin/pkg/server"
 	"whitelist-plugin/pkg/whitelist"
@@ -34,9 +35,29 @@ func main() {
 		cfg.HTTPTimeout, cfg.IdleConnTimeout, cfg.QueryTimeout,
 	)
 	refresher := whitelist.NewWhitelistRefresher(ctx, keyRepo, cfg.RefreshInterval, cfg.RefreshRetryCount, logger)
+	refresher.SetDeltaInterval(cfg.DeltaInterval)
+
+	// Operator allow/deny overrides sit on top of every Dgraph load and take
+	// effect as soon as the admin API changes them.
+	overrideStore, err := overrides.Open(cfg.OverridesPath)
+	if err != nil {
+		logger.Fatalf("Failed to load overrides: %v", err)
+	}
+	refresher.SetOverrides(overrideStore)
+	if cfg.AdminToken == "" {
+		logger.Printf("admin_token not set: /overrides admin API disabled")
+	}
 
 	// Start HTTP server immediately so /health can respond during loading
 	srv := server.NewWhitelistServer(refresher.Whitelist(), cfg.ServerListenAddr, cfg.Debug, logger)
+	srv.SetChangeLog(refresher.Changes())
+	srv.SetOverrides(overrideStore, cfg.AdminToken)
+	if err := srv.SetNIP86(cfg.NIP86URL, cfg.NIP86Admins); err != nil {
+		logger.Fatalf("Invalid nip86_admins: %v", err)
+	}
+	if len(cfg.NIP86Admins) > 0 {
+		logger.Printf("NIP-86 relay management enabled for %d admins at %s", len(cfg.NIP86Admins), cfg.NIP86URL)
+	}
 
 	go func() {
 		if err := srv.ListenAndServe(ctx); err != nil {
@@ -44,25 +65,29 @@ func main() {
 		}
 	}()
 
-	// Register bloom rebuild callback before Start() so the initial synchronous
+	// Register bloom rebuild callbacks before Start() so the initial synchronous
 	// refresh builds the first filter in lockstep with the whitelist (SRV-01, D-01).
-	refresher.SetOnRefresh(func(keys [][32]byte) {
-		// Rebuild bloom filter from the refreshed key set (D-01, D-09).
-		b := bloom.NewBuilder(uint(len(keys)), cfg.BloomFPRate)
-		for _, k := range keys {
-			b.Add(k)
-		}
-		f, err := b.Build()
-		if err != nil {
-			logger.Printf("bloom build failed: %v", err)
-			return // no swap — prior filter preserved (D-02)
-		}
-		if err := srv.SwapFilter(f); err != nil {
-			logger.Printf("bloom serialize failed: %v", err)
-			return // no stats update — prior state preserved (D-02)
-		}
-		srv.SetStats(len(keys), time.Now()) // keep /stats live per refresh (D-10)
+	// A delta updates /bloom too, so it never lags the whitelist by more than one
+	// delta interval.
+	bp := &bloomPublisher{
+		srv:    srv,
+		fpRate: cfg.BloomFPRate,
+		cuckoo: cfg.BloomFormat == config.BloomFormatCuckoo,
+		logger: logger,
+	}
+	refresher.SetOnRefresh(func(records []repository.Record, ch whitelist.Changes) {
+		bp.update(ch, func() [][32]byte {
+			keys := make([][32]byte, len(records))
+			for i, rec := range records {
+				keys[i] = rec.Pubkey
+			}
+			return keys
+		})
+	})
+	refresher.SetOnDelta(func(ch whitelist.Changes) {
+		bp.update(ch, refresher.Whitelist().Keys)
 	})
+	refresher.SetOnFetch(srv.ObserveFetch)
 
 	// Block until initial whitelist is loaded
 	logger.Printf("Loading whitelist from %s ...", cfg.DgraphGraphQLURL)
@@ -75,3 +100,70 @@ func main() {
 	// Block until shutdown
 	<-ctx.Done()
 }
+
+// cuckooHeadroom is the growth a rebuilt cuckoo filter is sized for, as a
+// fraction of the current key count, before an insert fails and forces the
+// next rebuild.
+const cuckooHeadroom = 0.25
+
+// bloomPublisher keeps the server's /bloom filter in step with the whitelist.
+// Its callbacks all run on the refresher goroutine, so current needs no lock.
+type bloomPublisher struct {
+	srv     *server.WhitelistServer
+	fpRate  float64
+	cuckoo  bool          // bloom_format: cuckoo
+	current *bloom.Filter // last cuckoo filter published; nil until the first build
+	logger  *log.Logger
+}
+
+// update publishes the filter for a membership change. A cuckoo filter is
+// patched with ch, so plugins can fetch just the patch; a bloom filter, the
+// first cuckoo filter, and a cuckoo filter that has run out of room are
+// rebuilt from keys().
+func (p *bloomPublisher) update(ch whitelist.Changes, keys func() [][32]byte) {
+	if p.cuckoo && p.current != nil {
+		if ch.Len() == 0 {
+			p.srv.SetStats(p.current.Len(), time.Now())
+			return
+		}
+		next, patch, err := p.current.Update(ch.Added, ch.Removed)
+		if err == nil {
+			if err := p.srv.SwapFilterPatch(next, patch); err != nil {
+				p.logger.Printf("bloom serialize failed: %v", err)
+				return // no swap — prior filter preserved (D-02)
+			}
+			p.current = next
+			p.srv.SetStats(next.Len(), time.Now())
+			return
+		}
+		p.logger.Printf("bloom patch failed, rebuilding: %v", err)
+	}
+	p.rebuild(keys())
+}
+
+// rebuild builds a filter over keys and swaps it into srv.
+func (p *bloomPublisher) rebuild(keys [][32]byte) {
+	// Rebuild bloom filter from the refreshed key set (D-01, D-09).
+	var b *bloom.Builder
+	if p.cuckoo {
+		b = bloom.NewCuckooBuilder(uint(float64(len(keys))*(1+cuckooHeadroom)), p.fpRate)
+	} else {
+		b = bloom.NewBuilder(uint(len(keys)), p.fpRate)
+	}
+	for _, k := range keys {
+		b.Add(k)
+	}
+	f, err := b.Build()
+	if err != nil {
+		p.logger.Printf("bloom build failed: %v", err)
+		return // no swap — prior filter preserved (D-02)
+	}
+	if err := p.srv.SwapFilter(f); err != nil {
+		p.logger.Printf("bloom serialize failed: %v", err)
+		return // no stats update — prior state preserved (D-02)
+	}
+	if p.cuckoo {
+		p.current = f
+	}
+	p.srv.SetStats(len(keys), time.Now()) // keep /stats live per refresh (D-10)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"log"
 	"os"
@@ -10,6 +9,9 @@ import (
 	"whitelist-plugin/pkg/client"
 	"whitelist-plugin/pkg/config"
 	"whitelist-plugin/pkg/handler"
+	"whitelist-plugin/pkg/pipeline"
+	"whitelist-plugin/pkg/policy"
+	"whitelist-plugin/pkg/recorder"
 )
 
 func main() {
@@ -24,6 +26,9 @@ func main() {
 	}
 
 	checker := client.NewWhitelistClient(cfg.ServerURL, cfg.CheckTimeout, logger)
+	if cfg.PipelineWorkers > 1 {
+		checker.EnableBulkChecks()
+	}
 
 	if err := checker.CheckHealth(); err != nil {
 		logger.Printf("WARNING: %v", err)
@@ -32,59 +37,35 @@ func main() {
 		logger.Printf("Connected to whitelist server at %s", cfg.ServerURL)
 	}
 
-	h := handler.NewWhitelistHandler(checker, logger)
-	ioAdapter := handler.NewJSONLIOAdapter(os.Stdout)
+	go checker.WatchChanges(ctx, cfg.ChangeStream, cfg.DeltaInterval)
+	go checker.WatchModeration(ctx, cfg.ModerationInterval)
 
-	if err := runEventLoop(ctx, h, ioAdapter, logger); err != nil {
-		logger.Printf("Error in event loop: %v", err)
-		os.Exit(1)
+	engine := policy.NewEngine(cfg.PolicyPath, logger)
+	if err := engine.Load(); err != nil {
+		logger.Printf("WARNING: %v", err)
 	}
-}
-
-func runEventLoop(ctx context.Context, h handler.Handler, io handler.IOAdapter, logger *log.Logger) error {
-	const (
-		initBuf = 64 * 1024
-		maxBuf  = 10 * 1024 * 1024
-	)
+	logger.Printf("Write policy %s: %d rules", cfg.PolicyPath, engine.Len())
+	go engine.Watch(ctx, cfg.PolicyReloadInterval)
 
-	scanner := bufio.NewScanner(os.Stdin)
-	buf := make([]byte, 0, initBuf)
-	scanner.Buffer(buf, maxBuf)
-
-	type scanResult struct {
-		line []byte
-		err  error
+	rec, err := recorder.FromConfig(cfg.Record, logger)
+	if err != nil {
+		logger.Fatalf("Failed to start recording: %v", err)
 	}
-	lines := make(chan scanResult)
+	defer rec.Close()
 
-	go func() {
-		defer close(lines)
-		for scanner.Scan() {
-			line := make([]byte, len(scanner.Bytes()))
-			copy(line, scanner.Bytes())
-			lines <- scanResult{line: line}
-		}
-		if err := scanner.Err(); err != nil {
-			lines <- scanResult{err: err}
-		}
-	}()
+	h := handler.NewWhitelistHandler(checker, logger)
+	h.SetOnCheck(rec.Check)
+	h.SetPolicy(engine)
+	h.SetModerator(checker)
+	ioAdapter := handler.NewJSONLIOAdapter(os.Stdout)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case result, ok := <-lines:
-			if !ok {
-				return nil
-			}
-			if result.err != nil {
-				return result.err
-			}
-			response := processLine(result.line, h, io, logger)
-			if _, err := os.Stdout.Write(response); err != nil {
-				return err
-			}
-		}
+	process := func(line []byte) []byte {
+		return processLine(line, h, ioAdapter, logger)
+	}
+	if err := pipeline.Run(ctx, os.Stdin, os.Stdout, cfg.PipelineWorkers, process, rec.Record); err != nil {
+		logger.Printf("Error in event loop: %v", err)
+		rec.Close()
+		os.Exit(1)
 	}
 }
 
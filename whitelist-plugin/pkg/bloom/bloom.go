@@ -1,13 +1,16 @@
 // Package bloom provides a Builder (server-side filter construction) and an immutable
-// Filter (plugin-side membership query and serialization) wrapping
-// github.com/bits-and-blooms/bloom/v3.
+// Filter (plugin-side membership query and serialization). Format version 1 wraps
+// github.com/bits-and-blooms/bloom/v3; format version 2 is a cuckoo filter (cuckoo.go)
+// that also supports deletion, so it can be moved between generations with a Patch
+// instead of a full rebuild and re-download.
 //
 // Wire format (DFBF — big-endian throughout, D-05/D-06/D-07):
 //
 //	magic[4]="DFBF" | formatVersion:uint8 | fpRate:float64 | gen[32] | payloadLen:uint64 | payload
 //
-// The payload is the library's WriteTo/MarshalBinary output verbatim; m and k ride
-// inside it and are not re-stored in the header (D-06).
+// For version 1 the payload is the library's WriteTo/MarshalBinary output verbatim; m
+// and k ride inside it and are not re-stored in the header (D-06). For version 2 it is
+// the cuckoo table described in cuckoo.go.
 //
 // HARD INVARIANT (D-02): this package uses strictly big-endian byte order throughout.
 // The bitset global byte-order switch must never be used here — it silently corrupts
@@ -57,8 +60,10 @@ var (
 // Builder constructs a bloom filter server-side. It is mutable; call Build to freeze it
 // into an immutable Filter.
 type Builder struct {
-	bf *bbloom.BloomFilter
-	fp float64
+	bf  *bbloom.BloomFilter
+	cf  *cuckooTable // set instead of bf by NewCuckooBuilder
+	err error        // first cuckoo insert failure, reported by Build
+	fp  float64
 }
 
 // NewBuilder returns a Builder sized to hold n elements at false-positive rate fp using
@@ -73,6 +78,12 @@ func NewBuilder(n uint, fp float64) *Builder {
 // Add inserts k into the filter. It passes k[:] to the underlying library — an
 // alloc-free stack slice header; no heap copy is made (D-08).
 func (b *Builder) Add(k [32]byte) {
+	if b.cf != nil {
+		if b.err == nil {
+			b.err = b.cf.insert(k)
+		}
+		return
+	}
 	b.bf.Add(k[:])
 }
 
@@ -98,6 +109,17 @@ func (b *Builder) AddHex(s string) error {
 // not be used (behavior is undefined). The returned *Filter is safe to store behind an
 // atomic.Pointer[Filter] and read concurrently (D-09 immutability contract).
 func (b *Builder) Build() (*Filter, error) {
+	if b.cf != nil {
+		if b.err != nil {
+			return nil, fmt.Errorf("bloom: Build: %w", b.err)
+		}
+		return &Filter{
+			cf:      b.cf,
+			fp:      b.fp,
+			gen:     sha256.Sum256(b.cf.payload),
+			payload: b.cf.payload,
+		}, nil
+	}
 	payload, err := b.bf.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("bloom: Build: MarshalBinary: %w", err)
@@ -115,6 +137,7 @@ func (b *Builder) Build() (*Filter, error) {
 // goroutines after being returned from Builder.Build (D-09).
 type Filter struct {
 	bf      *bbloom.BloomFilter
+	cf      *cuckooTable // format version 2; exactly one of bf and cf is set
 	fp      float64
 	gen     [32]byte
 	payload []byte // cached MarshalBinary output — avoids recomputation on WriteTo
@@ -124,6 +147,9 @@ type Filter struct {
 // alloc-free slice view — to the underlying Test call. This is the 0-allocs hot path
 // (D-08). Do NOT call hex decode here.
 func (f *Filter) Contains(k [32]byte) bool {
+	if f.cf != nil {
+		return f.cf.contains(k)
+	}
 	return f.bf.Test(k[:])
 }
 
@@ -151,7 +177,13 @@ func (f *Filter) Generation() [32]byte {
 // ETag returns the generation marker as a quoted lowercase hex string suitable for use
 // as an HTTP ETag in Phase 2 (D-04). No recomputation — derived from the stored marker.
 func (f *Filter) ETag() string {
-	return `"` + hex.EncodeToString(f.gen[:]) + `"`
+	return ETagOf(f.gen)
+}
+
+// ETagOf formats a generation marker as an ETag, for matching a Patch's Base or
+// Target against one.
+func ETagOf(gen [32]byte) string {
+	return `"` + hex.EncodeToString(gen[:]) + `"`
 }
 
 // FalsePositiveRate returns the build-time fp parameter (proves success criterion 4:
@@ -174,7 +206,11 @@ func (f *Filter) WriteTo(w io.Writer) (int64, error) {
 	}
 
 	// formatVersion:uint8
-	if err = binary.Write(w, binary.BigEndian, formatVersion); err != nil {
+	ver := formatVersion
+	if f.cf != nil {
+		ver = formatVersionCuckoo
+	}
+	if err = binary.Write(w, binary.BigEndian, ver); err != nil {
 		return n, fmt.Errorf("bloom: WriteTo: write version: %w", err)
 	}
 	n++
@@ -220,6 +256,7 @@ func (f *Filter) MarshalBinary() ([]byte, error) {
 // ReadFilter deserializes a Filter from r in the DFBF format. It validates:
 //   - 4-byte magic (mismatch → ErrBadFormat)
 //   - formatVersion (unknown → ErrUnsupportedVersion, wrapped with ErrBadFormat)
+//   - for cuckoo filters, the table shape and the generation marker (→ ErrBadFormat)
 //   - payloadLen bound-check before consuming bytes (short read → ErrTruncated, D-07)
 //
 // All IO and decode failures are wrapped with fmt.Errorf so callers can use errors.Is.
@@ -238,7 +275,7 @@ func ReadFilter(r io.Reader) (*Filter, error) {
 	if err := binary.Read(r, binary.BigEndian, &ver); err != nil {
 		return nil, fmt.Errorf("bloom: ReadFilter: read version: %w", ErrTruncated)
 	}
-	if ver != formatVersion {
+	if ver != formatVersion && ver != formatVersionCuckoo {
 		return nil, fmt.Errorf("bloom: ReadFilter: unsupported format version %d: %w", ver, ErrUnsupportedVersion)
 	}
 
@@ -286,6 +323,23 @@ func ReadFilter(r io.Reader) (*Filter, error) {
 	payload := payloadBuf.Bytes()
 
 	// Reconstruct underlying filter from payload.
+	if ver == formatVersionCuckoo {
+		cf, err := parseCuckoo(payload)
+		if err != nil {
+			return nil, fmt.Errorf("bloom: ReadFilter: %w", err)
+		}
+		// Patches are matched and verified by generation, so a cuckoo filter's marker
+		// must really be its content hash.
+		if sha256.Sum256(payload) != gen {
+			return nil, fmt.Errorf("bloom: ReadFilter: generation does not match payload: %w", ErrBadFormat)
+		}
+		return &Filter{
+			cf:      cf,
+			fp:      fp,
+			gen:     gen,
+			payload: payload,
+		}, nil
+	}
 	bf := new(bbloom.BloomFilter)
 	if err := bf.UnmarshalBinary(payload); err != nil {
 		return nil, fmt.Errorf("bloom: ReadFilter: UnmarshalBinary: %w", err)
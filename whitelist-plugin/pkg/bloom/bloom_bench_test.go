@@ -103,3 +103,54 @@ func TestContainsZeroAllocs(t *testing.T) {
 			"k[:] may have escaped to the heap", avg)
 	}
 }
+
+// BenchmarkCuckooContains is BenchmarkContains for the format-version-2 cuckoo
+// filter, at the production-sized 500k member set.
+func BenchmarkCuckooContains(b *testing.B) {
+	const n = 500_000
+	keys := genKeys(n)
+	bld := NewCuckooBuilder(n, 1e-6)
+	for _, k := range keys {
+		bld.Add(k)
+	}
+	f, err := bld.Build()
+	if err != nil {
+		b.Fatalf("Build: %v", err)
+	}
+	missKey := genKeys(n + 1)[n]
+
+	b.Run("hit", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = f.Contains(keys[i%n])
+		}
+	})
+	b.Run("miss", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = f.Contains(missKey)
+		}
+	})
+}
+
+// BenchmarkCuckooUpdate measures the server's copy-on-write Update for a typical
+// delta (100 changes) against 500k members.
+func BenchmarkCuckooUpdate(b *testing.B) {
+	const n = 500_000
+	keys := genKeys(n + 100)
+	bld := NewCuckooBuilder(n+n/4, 1e-6)
+	for _, k := range keys[:n] {
+		bld.Add(k)
+	}
+	f, err := bld.Build()
+	if err != nil {
+		b.Fatalf("Build: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := f.Update(keys[n:], nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package bloom
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Cuckoo filters (format version 2) trade the bloom filter's append-only bitset for a
+// table of per-key fingerprints, so a member can be removed as well as added. That is
+// what makes patches possible: the server ships the pubkeys added and removed since the
+// plugin's generation and the plugin replays them (see Patch).
+//
+// Payload layout (big-endian, D-02):
+//
+//	fpBits:uint8 | buckets:uint64 | count:uint64 | slots[buckets*4]:uint32
+//
+// Each bucket holds four fingerprints; zero marks an empty slot. The payload is also
+// the in-memory table, so serialization and the generation hash need no extra copy.
+//
+// Every mutation is deterministic — a given filter plus a given sequence of inserts and
+// deletes always yields the same bytes — so a plugin replaying the server's patch
+// reproduces the server's table bit for bit, and the generation marker proves it.
+
+const (
+	formatVersionCuckoo = uint8(2)
+
+	cuckooBucketSize = 4
+	cuckooHeaderLen  = 1 + 8 + 8
+	cuckooMaxKicks   = 500
+	// cuckooLoadFactor is the occupancy sizing targets; insertion starts failing in
+	// earnest around 95% for 4-slot buckets.
+	cuckooLoadFactor = 0.9
+)
+
+// Errors specific to cuckoo filters and patches.
+var (
+	// ErrFull is returned when an insert cannot find a slot. The filter must be
+	// rebuilt with more capacity.
+	ErrFull = errors.New("bloom: cuckoo filter full")
+	// ErrNotPatchable is returned by Update and Apply on a format-version-1 bloom filter.
+	ErrNotPatchable = errors.New("bloom: filter does not support patches")
+	// ErrPatchMismatch is returned by Apply when the patch was cut against a different
+	// generation or does not reproduce its target generation.
+	ErrPatchMismatch = errors.New("bloom: patch does not match filter")
+)
+
+// cuckooTable is a partial-key cuckoo hash table of fingerprints stored directly in
+// its wire payload. It is mutated only before its Filter is published.
+type cuckooTable struct {
+	payload []byte
+	fpMask  uint32
+	mask    uint64 // buckets-1; buckets is a power of two
+}
+
+// cuckooFingerprintBits returns the fingerprint width that holds the false-positive
+// rate at or below fp: a lookup compares against 2*cuckooBucketSize fingerprints.
+func cuckooFingerprintBits(fp float64) uint8 {
+	b := math.Ceil(math.Log2(2 * cuckooBucketSize / fp))
+	return uint8(min(max(b, 8), 32))
+}
+
+func newCuckooTable(n uint, fp float64) *cuckooTable {
+	want := uint64(math.Ceil(float64(n) / (cuckooBucketSize * cuckooLoadFactor)))
+	buckets := uint64(1)
+	if want > 1 {
+		buckets = 1 << bits.Len64(want-1)
+	}
+	payload := make([]byte, cuckooHeaderLen+buckets*cuckooBucketSize*4)
+	payload[0] = cuckooFingerprintBits(fp)
+	binary.BigEndian.PutUint64(payload[1:], buckets)
+	return newCuckooView(payload)
+}
+
+func newCuckooView(payload []byte) *cuckooTable {
+	fpBits := payload[0]
+	buckets := binary.BigEndian.Uint64(payload[1:])
+	return &cuckooTable{
+		payload: payload,
+		fpMask:  uint32(uint64(1)<<fpBits - 1),
+		mask:    buckets - 1,
+	}
+}
+
+// parseCuckoo validates a version-2 payload and wraps it without copying.
+func parseCuckoo(payload []byte) (*cuckooTable, error) {
+	if len(payload) < cuckooHeaderLen {
+		return nil, fmt.Errorf("bloom: cuckoo payload is %d bytes: %w", len(payload), ErrTruncated)
+	}
+	fpBits := payload[0]
+	if fpBits < 8 || fpBits > 32 {
+		return nil, fmt.Errorf("bloom: cuckoo fingerprint width %d: %w", fpBits, ErrBadFormat)
+	}
+	buckets := binary.BigEndian.Uint64(payload[1:])
+	if buckets == 0 || buckets&(buckets-1) != 0 {
+		return nil, fmt.Errorf("bloom: cuckoo bucket count %d is not a power of two: %w", buckets, ErrBadFormat)
+	}
+	if uint64(len(payload)-cuckooHeaderLen)/(cuckooBucketSize*4) != buckets || (len(payload)-cuckooHeaderLen)%(cuckooBucketSize*4) != 0 {
+		return nil, fmt.Errorf("bloom: cuckoo table is %d bytes for %d buckets: %w", len(payload)-cuckooHeaderLen, buckets, ErrBadFormat)
+	}
+	return newCuckooView(payload), nil
+}
+
+func (t *cuckooTable) clone() *cuckooTable {
+	c := *t
+	c.payload = append([]byte(nil), t.payload...)
+	return &c
+}
+
+func (t *cuckooTable) count() uint64 {
+	return binary.BigEndian.Uint64(t.payload[9:])
+}
+
+func (t *cuckooTable) addCount(d int64) {
+	binary.BigEndian.PutUint64(t.payload[9:], uint64(int64(t.count())+d))
+}
+
+func (t *cuckooTable) slot(i uint64, j int) uint32 {
+	off := cuckooHeaderLen + (i*cuckooBucketSize+uint64(j))*4
+	return binary.BigEndian.Uint32(t.payload[off:])
+}
+
+func (t *cuckooTable) setSlot(i uint64, j int, fp uint32) {
+	off := cuckooHeaderLen + (i*cuckooBucketSize+uint64(j))*4
+	binary.BigEndian.PutUint32(t.payload[off:], fp)
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// index returns k's primary bucket and non-zero fingerprint. The bucket comes from
+// the low bits of the hash and the fingerprint from the high 32, so they are
+// independent for any table under 2^32 buckets.
+func (t *cuckooTable) index(k [32]byte) (uint64, uint32) {
+	h := mix64(binary.BigEndian.Uint64(k[0:]))
+	h = mix64(h ^ binary.BigEndian.Uint64(k[8:]))
+	h = mix64(h ^ binary.BigEndian.Uint64(k[16:]))
+	h = mix64(h ^ binary.BigEndian.Uint64(k[24:]))
+	fp := uint32(h>>32) & t.fpMask
+	if fp == 0 {
+		fp = 1
+	}
+	return h & t.mask, fp
+}
+
+// alt returns the other bucket fp may live in. alt(alt(i, fp), fp) == i.
+func (t *cuckooTable) alt(i uint64, fp uint32) uint64 {
+	return (i ^ mix64(uint64(fp))) & t.mask
+}
+
+func (t *cuckooTable) bucketHas(i uint64, fp uint32) bool {
+	for j := 0; j < cuckooBucketSize; j++ {
+		if t.slot(i, j) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *cuckooTable) contains(k [32]byte) bool {
+	i, fp := t.index(k)
+	return t.bucketHas(i, fp) || t.bucketHas(t.alt(i, fp), fp)
+}
+
+// place puts fp in the first empty slot of bucket i.
+func (t *cuckooTable) place(i uint64, fp uint32) bool {
+	for j := 0; j < cuckooBucketSize; j++ {
+		if t.slot(i, j) == 0 {
+			t.setSlot(i, j, fp)
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds k. Victims are chosen from the fingerprint and kick count rather than at
+// random, keeping every insert deterministic. On ErrFull one fingerprint has been
+// evicted and the table must be discarded.
+func (t *cuckooTable) insert(k [32]byte) error {
+	i, fp := t.index(k)
+	if t.place(i, fp) {
+		t.addCount(1)
+		return nil
+	}
+	i = t.alt(i, fp)
+	if t.place(i, fp) {
+		t.addCount(1)
+		return nil
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		j := int((uint64(fp) + uint64(n)) % cuckooBucketSize)
+		victim := t.slot(i, j)
+		t.setSlot(i, j, fp)
+		fp = victim
+		i = t.alt(i, fp)
+		if t.place(i, fp) {
+			t.addCount(1)
+			return nil
+		}
+	}
+	return ErrFull
+}
+
+// delete removes one copy of k's fingerprint, reporting whether one was found. Only
+// keys known to be members may be deleted; deleting a false positive would remove
+// another member's fingerprint.
+func (t *cuckooTable) delete(k [32]byte) bool {
+	i, fp := t.index(k)
+	for _, b := range [2]uint64{i, t.alt(i, fp)} {
+		for j := 0; j < cuckooBucketSize; j++ {
+			if t.slot(b, j) == fp {
+				t.setSlot(b, j, 0)
+				t.addCount(-1)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewCuckooBuilder returns a Builder that produces a format-version-2 cuckoo filter
+// sized for n elements at false-positive rate fp. Unlike a bloom filter the result
+// supports Update and Apply; size n with headroom for growth, as an insert into a full
+// table fails rather than degrading the false-positive rate.
+func NewCuckooBuilder(n uint, fp float64) *Builder {
+	return &Builder{
+		cf: newCuckooTable(n, fp),
+		fp: fp,
+	}
+}
+
+// Patchable reports whether f is a cuckoo filter that supports Update and Apply.
+func (f *Filter) Patchable() bool {
+	return f.cf != nil
+}
+
+// Len returns the number of members of a cuckoo filter, or 0 for a bloom filter.
+func (f *Filter) Len() int {
+	if f.cf == nil {
+		return 0
+	}
+	return int(f.cf.count())
+}
+
+// Update returns a new filter with removed deleted and then added inserted, and the
+// Patch that takes f to it. f is left untouched, so readers holding it are unaffected.
+// Removed keys that are not members are skipped and left out of the patch. On ErrFull
+// the caller should rebuild with more capacity.
+func (f *Filter) Update(added, removed [][32]byte) (*Filter, *Patch, error) {
+	if f.cf == nil {
+		return nil, nil, ErrNotPatchable
+	}
+	cf := f.cf.clone()
+	p := &Patch{Base: f.gen}
+	for _, k := range removed {
+		if cf.delete(k) {
+			p.ops = append(p.ops, patchOp{op: opRemove, key: k})
+		}
+	}
+	for _, k := range added {
+		if err := cf.insert(k); err != nil {
+			return nil, nil, fmt.Errorf("bloom: Update: %w", err)
+		}
+		p.ops = append(p.ops, patchOp{op: opAdd, key: k})
+	}
+	next := f.withTable(cf)
+	p.Target = next.gen
+	return next, p, nil
+}
+
+// Apply replays p against f and returns the resulting filter, leaving f untouched.
+// It fails with ErrPatchMismatch unless p was cut against f's generation and replaying
+// it reproduces p.Target exactly.
+func (f *Filter) Apply(p *Patch) (*Filter, error) {
+	if f.cf == nil {
+		return nil, ErrNotPatchable
+	}
+	if p.Base != f.gen {
+		return nil, fmt.Errorf("bloom: Apply: patch base %x, filter %x: %w", p.Base[:4], f.gen[:4], ErrPatchMismatch)
+	}
+	cf := f.cf.clone()
+	for _, o := range p.ops {
+		switch o.op {
+		case opAdd:
+			if err := cf.insert(o.key); err != nil {
+				return nil, fmt.Errorf("bloom: Apply: %w", err)
+			}
+		case opRemove:
+			if !cf.delete(o.key) {
+				return nil, fmt.Errorf("bloom: Apply: removed key %x not a member: %w", o.key[:4], ErrPatchMismatch)
+			}
+		}
+	}
+	next := f.withTable(cf)
+	if next.gen != p.Target {
+		return nil, fmt.Errorf("bloom: Apply: result %x, patch target %x: %w", next.gen[:4], p.Target[:4], ErrPatchMismatch)
+	}
+	return next, nil
+}
+
+// withTable wraps a mutated copy of f's table as a new immutable Filter.
+func (f *Filter) withTable(cf *cuckooTable) *Filter {
+	return &Filter{
+		cf:      cf,
+		fp:      f.fp,
+		gen:     sha256.Sum256(cf.payload),
+		payload: cf.payload,
+	}
+}
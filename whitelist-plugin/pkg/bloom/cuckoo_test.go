@@ -0,0 +1,270 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildCuckoo builds a cuckoo filter over keys sized for capacity, with the default
+// 1e-6 target.
+func buildCuckoo(t *testing.T, keys [][32]byte, capacity int) *Filter {
+	t.Helper()
+	b := NewCuckooBuilder(uint(capacity), 1e-6)
+	for _, k := range keys {
+		b.Add(k)
+	}
+	f, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return f
+}
+
+// reread round-trips f through the DFBF format, as the plugin receives it.
+func reread(t *testing.T, f *Filter) *Filter {
+	t.Helper()
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got, err := ReadFilter(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFilter: %v", err)
+	}
+	return got
+}
+
+// TestCuckooRoundTrip: a cuckoo filter serializes as format version 2, has no false
+// negatives and keeps its generation across the wire.
+func TestCuckooRoundTrip(t *testing.T) {
+	keys := genKeys(10_000)
+	f := buildCuckoo(t, keys, len(keys))
+	if !f.Patchable() || f.Len() != len(keys) {
+		t.Fatalf("Patchable=%v Len=%d, want true/%d", f.Patchable(), f.Len(), len(keys))
+	}
+
+	data, _ := f.MarshalBinary()
+	if data[4] != formatVersionCuckoo {
+		t.Fatalf("format version = %d, want %d", data[4], formatVersionCuckoo)
+	}
+	got := reread(t, f)
+	if got.ETag() != f.ETag() || !got.Patchable() {
+		t.Fatalf("round trip changed ETag or kind")
+	}
+	for i, k := range keys {
+		if !got.Contains(k) {
+			t.Fatalf("false negative for member %d", i)
+		}
+	}
+}
+
+// TestCuckooMeasuredFPRate mirrors TestMeasuredFPRate for the cuckoo format.
+func TestCuckooMeasuredFPRate(t *testing.T) {
+	const memberCount = 10_000
+	const sampleSize = 2_000_000
+	const targetFP = 1e-4
+	const toleranceFactor = 2.0
+
+	members := genKeys(memberCount)
+	b := NewCuckooBuilder(memberCount, targetFP)
+	for _, k := range members {
+		b.Add(k)
+	}
+	f, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	falsePositives := 0
+	for i := 0; i < sampleSize; i++ {
+		var k [32]byte
+		v := uint64(memberCount + 1 + i)
+		for j := 0; j < 32; j++ {
+			k[j] = byte(v >> ((j % 8) * 8))
+		}
+		if f.Contains(k) {
+			falsePositives++
+		}
+	}
+	measured := float64(falsePositives) / float64(sampleSize)
+	if measured > targetFP*toleranceFactor {
+		t.Errorf("measured FP rate %.2e exceeds %.2e (FPs=%d/%d)", measured, targetFP*toleranceFactor, falsePositives, sampleSize)
+	}
+	t.Logf("measured FP rate: %.4e (target=%.2e, FPs=%d/%d)", measured, targetFP, falsePositives, sampleSize)
+}
+
+// TestCuckooUpdateApply: the plugin replaying the server's patch reaches the server's
+// exact generation, and neither side's previous filter is modified.
+func TestCuckooUpdateApply(t *testing.T) {
+	keys := genKeys(5_000)
+	server := buildCuckoo(t, keys[:4_000], len(keys))
+	plugin := reread(t, server)
+
+	added, removed := keys[4_000:], keys[:500]
+	next, p, err := server.Update(added, removed)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if p.Len() != len(added)+len(removed) || p.Base != server.Generation() || p.Target != next.Generation() {
+		t.Fatalf("patch Len=%d base/target mismatch", p.Len())
+	}
+	if next.Len() != 4_500 {
+		t.Errorf("Len after update = %d, want 4500", next.Len())
+	}
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if len(data) != p.Size() {
+		t.Errorf("Size() = %d, serialized %d bytes", p.Size(), len(data))
+	}
+	wire, err := ReadPatch(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadPatch: %v", err)
+	}
+	applied, err := plugin.Apply(wire)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if applied.ETag() != next.ETag() {
+		t.Fatalf("applied ETag %s, server %s", applied.ETag(), next.ETag())
+	}
+	for _, k := range added {
+		if !applied.Contains(k) {
+			t.Fatal("added key missing after Apply")
+		}
+	}
+	removedHits := 0
+	for _, k := range removed {
+		if applied.Contains(k) {
+			removedHits++
+		}
+		if !plugin.Contains(k) || !server.Contains(k) {
+			t.Fatal("Update/Apply modified the source filter")
+		}
+	}
+	if removedHits > 0 {
+		t.Errorf("%d removed keys still reported present", removedHits)
+	}
+}
+
+func TestCuckooPatchChain(t *testing.T) {
+	keys := genKeys(300)
+	f0 := buildCuckoo(t, keys[:100], len(keys))
+	f1, p1, err := f0.Update(keys[100:200], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, p2, err := f1.Update(keys[200:], keys[:50])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := p1.Then(p2)
+	if err != nil {
+		t.Fatalf("Then: %v", err)
+	}
+	got, err := reread(t, f0).Apply(chain)
+	if err != nil {
+		t.Fatalf("Apply chain: %v", err)
+	}
+	if got.ETag() != f2.ETag() {
+		t.Fatal("chained patch did not reproduce the final generation")
+	}
+
+	if _, err := p2.Then(p1); !isErr(err, ErrPatchMismatch) {
+		t.Errorf("Then out of order: got %v, want ErrPatchMismatch", err)
+	}
+	if _, err := f2.Apply(p1); !isErr(err, ErrPatchMismatch) {
+		t.Errorf("Apply to wrong base: got %v, want ErrPatchMismatch", err)
+	}
+	forged := *p1
+	forged.Target[0] ^= 0xff
+	if _, err := f0.Apply(&forged); !isErr(err, ErrPatchMismatch) {
+		t.Errorf("Apply with wrong target: got %v, want ErrPatchMismatch", err)
+	}
+}
+
+func TestCuckooRemoveNonMemberSkipped(t *testing.T) {
+	keys := genKeys(20)
+	f := buildCuckoo(t, keys[:10], 10)
+	_, p, err := f.Update(nil, keys[10:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 0 {
+		t.Errorf("patch has %d ops for non-member removals, want 0", p.Len())
+	}
+}
+
+func TestCuckooFull(t *testing.T) {
+	b := NewCuckooBuilder(4, 1e-6) // 2 buckets, 8 slots
+	for _, k := range genKeys(100) {
+		b.Add(k)
+	}
+	if _, err := b.Build(); !isErr(err, ErrFull) {
+		t.Fatalf("Build over capacity: got %v, want ErrFull", err)
+	}
+}
+
+func TestBloomNotPatchable(t *testing.T) {
+	f := buildSmall(t)
+	if f.Patchable() {
+		t.Fatal("bloom filter reports Patchable")
+	}
+	if _, _, err := f.Update([][32]byte{makeKey(3)}, nil); !isErr(err, ErrNotPatchable) {
+		t.Errorf("Update: got %v, want ErrNotPatchable", err)
+	}
+	if _, err := f.Apply(&Patch{}); !isErr(err, ErrNotPatchable) {
+		t.Errorf("Apply: got %v, want ErrNotPatchable", err)
+	}
+}
+
+// TestReadFilterRejectsBadCuckoo: a version-2 payload with a tampered generation or
+// a table that does not match its bucket count is rejected.
+func TestReadFilterRejectsBadCuckoo(t *testing.T) {
+	data, _ := buildCuckoo(t, genKeys(10), 20).MarshalBinary()
+	const payloadOff = 4 + 1 + 8 + 32 + 8
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := ReadFilter(bytes.NewReader(tampered)); !isBadFormat(err) {
+		t.Errorf("tampered table: got %v, want ErrBadFormat", err)
+	}
+
+	badShape := bytes.Clone(data)
+	binary.BigEndian.PutUint64(badShape[payloadOff+1:], 3)
+	if _, err := ReadFilter(bytes.NewReader(badShape)); !isBadFormat(err) {
+		t.Errorf("non-power-of-two buckets: got %v, want ErrBadFormat", err)
+	}
+}
+
+func TestReadPatchRejects(t *testing.T) {
+	f := buildCuckoo(t, genKeys(10), 20)
+	_, p, err := f.Update(genKeys(12)[10:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := p.MarshalBinary()
+
+	badMagic := bytes.Clone(data)
+	copy(badMagic, "XXXX")
+	if _, err := ReadPatch(bytes.NewReader(badMagic)); !isBadFormat(err) {
+		t.Errorf("bad magic: got %v, want ErrBadFormat", err)
+	}
+	if _, err := ReadPatch(bytes.NewReader(data[:len(data)-1])); !isTruncated(err) {
+		t.Errorf("truncated: got %v, want ErrTruncated", err)
+	}
+	huge := bytes.Clone(data)
+	binary.BigEndian.PutUint64(huge[69:], maxPatchOps+1)
+	if _, err := ReadPatch(bytes.NewReader(huge)); !isBadFormat(err) {
+		t.Errorf("oversized opCount: got %v, want ErrBadFormat", err)
+	}
+	badOp := bytes.Clone(data)
+	badOp[77] = 9
+	if _, err := ReadPatch(bytes.NewReader(badOp)); !isBadFormat(err) {
+		t.Errorf("unknown op: got %v, want ErrBadFormat", err)
+	}
+}
@@ -0,0 +1,136 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Patch wire format (DFBP — big-endian, D-02):
+//
+//	magic[4]="DFBP" | patchVersion:uint8 | base[32] | target[32] | opCount:uint64 | ops
+//
+// where each op is op:uint8 (1=add, 2=remove) | key[32]. base and target are filter
+// generation markers, so a patch names exactly the filter it applies to and the
+// filter it must produce.
+
+const (
+	patchMagic   = "DFBP"
+	patchVersion = uint8(1)
+	patchOpLen   = 1 + 32
+
+	// maxPatchOps bounds the declared opCount ReadPatch accepts, for the same reason
+	// maxPayloadBytes bounds ReadFilter (D-07).
+	maxPatchOps = maxPayloadBytes / patchOpLen
+)
+
+// PatchIM is the instance-manipulation name for patches in RFC 3229 delta encoding:
+// a client sends "A-IM: dfbf-patch" with If-None-Match, and the server answers
+// "226 IM Used" with a Patch body when it can.
+const PatchIM = "dfbf-patch"
+
+const (
+	opAdd    = uint8(1)
+	opRemove = uint8(2)
+)
+
+type patchOp struct {
+	op  uint8
+	key [32]byte
+}
+
+// Patch is the ordered list of inserts and deletes that takes a cuckoo filter from
+// generation Base to generation Target. Produced by Filter.Update, consumed by
+// Filter.Apply. A Patch is immutable once returned.
+type Patch struct {
+	Base   [32]byte
+	Target [32]byte
+	ops    []patchOp
+}
+
+// Len returns the number of operations in the patch.
+func (p *Patch) Len() int {
+	return len(p.ops)
+}
+
+// Size returns the serialized length of the patch in bytes.
+func (p *Patch) Size() int {
+	return len(patchMagic) + 1 + 32 + 32 + 8 + len(p.ops)*patchOpLen
+}
+
+// Then returns the patch that applies p and then next, which must start where p ends.
+func (p *Patch) Then(next *Patch) (*Patch, error) {
+	if next.Base != p.Target {
+		return nil, fmt.Errorf("bloom: Then: patches are not consecutive: %w", ErrPatchMismatch)
+	}
+	ops := make([]patchOp, 0, len(p.ops)+len(next.ops))
+	ops = append(ops, p.ops...)
+	ops = append(ops, next.ops...)
+	return &Patch{Base: p.Base, Target: next.Target, ops: ops}, nil
+}
+
+// WriteTo serializes the patch to w in the DFBP format. Returns total bytes written.
+func (p *Patch) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 0, p.Size())
+	buf = append(buf, patchMagic...)
+	buf = append(buf, patchVersion)
+	buf = append(buf, p.Base[:]...)
+	buf = append(buf, p.Target[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(p.ops)))
+	for _, o := range p.ops {
+		buf = append(buf, o.op)
+		buf = append(buf, o.key[:]...)
+	}
+	n, err := w.Write(buf)
+	if err != nil {
+		return int64(n), fmt.Errorf("bloom: Patch.WriteTo: %w", err)
+	}
+	return int64(n), nil
+}
+
+// MarshalBinary serializes the patch to a byte slice.
+func (p *Patch) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadPatch deserializes a Patch from r in the DFBP format, validating the magic,
+// version, declared op count (before reading the ops) and every op code.
+func ReadPatch(r io.Reader) (*Patch, error) {
+	var hdr [4 + 1 + 32 + 32 + 8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("bloom: ReadPatch: read header: %w", ErrTruncated)
+	}
+	if string(hdr[:4]) != patchMagic {
+		return nil, fmt.Errorf("bloom: ReadPatch: wrong magic %q: %w", hdr[:4], ErrBadFormat)
+	}
+	if hdr[4] != patchVersion {
+		return nil, fmt.Errorf("bloom: ReadPatch: unsupported patch version %d: %w", hdr[4], ErrUnsupportedVersion)
+	}
+	p := &Patch{}
+	copy(p.Base[:], hdr[5:37])
+	copy(p.Target[:], hdr[37:69])
+	count := binary.BigEndian.Uint64(hdr[69:])
+	if count > maxPatchOps {
+		return nil, fmt.Errorf("bloom: ReadPatch: opCount %d exceeds max %d: %w", count, maxPatchOps, ErrBadFormat)
+	}
+
+	// Grow as ops arrive rather than trusting count up front.
+	var op [patchOpLen]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, op[:]); err != nil {
+			return nil, fmt.Errorf("bloom: ReadPatch: read op %d of %d: %w", i, count, ErrTruncated)
+		}
+		if op[0] != opAdd && op[0] != opRemove {
+			return nil, fmt.Errorf("bloom: ReadPatch: unknown op %d: %w", op[0], ErrBadFormat)
+		}
+		o := patchOp{op: op[0]}
+		copy(o.key[:], op[1:])
+		p.ops = append(p.ops, o)
+	}
+	return p, nil
+}
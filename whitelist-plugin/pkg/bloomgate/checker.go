@@ -4,6 +4,8 @@
 // Concurrency model: single-writer / many-reader.
 // The fetcher (Plan 02) is the only writer; it calls Store once per successful fetch.
 // The event hot path (IsWhitelisted) reads the atomic pointer concurrently with zero locks.
+// Cuckoo-filter patches do not change this: the fetcher applies each patch to a copy of
+// the held filter and Stores the result, so readers never see a half-applied patch.
 //
 // GATE-06 blocking contract: IsWhitelisted withholds its decision until the first filter
 // is stored. When no filter has ever been stored it waits on the ready channel; it does
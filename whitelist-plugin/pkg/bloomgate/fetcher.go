@@ -3,11 +3,18 @@
 // each valid 200 response, and atomically swaps the new filter into the BloomChecker.
 //
 // Lifecycle:
-//   - Start(): loads disk-first (D-04), then launches the background ticker goroutine.
-//   - Stop(): cancels context and waits for the goroutine.
+//   - Start(): loads disk-first (D-04), then launches the background ticker goroutine
+//     and, when enabled, the change-stream subscription.
+//   - Stop(): cancels context and waits for the goroutines.
+//
+// The ticker is the backstop. With the change stream enabled, every whitelist
+// generation that adds or removes keys (or a resync after a reconnect) kicks an
+// immediate conditional GET, so membership changes reach the gate in seconds.
 //
 // Wire contract consumed (Phase-2 D-06/D-07/D-08):
 //   - 200: application/octet-stream DFBF body + ETag → parse, store, persist (D-07/D-08/D-09)
+//   - 226: (cuckoo filters only, requested with A-IM: dfbf-patch) bloom.Patch body →
+//     apply to a copy of the held filter, store, persist the result
 //   - 304: nothing changed — no swap, no disk write (D-09)
 //   - 503: server has no filter yet — treat as transient, keep last good (D-08/D-10)
 //
@@ -17,6 +24,7 @@ package bloomgate
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -26,6 +34,7 @@ import (
 	"time"
 
 	"whitelist-plugin/pkg/bloom"
+	"whitelist-plugin/pkg/changestream"
 	"whitelist-plugin/pkg/config"
 )
 
@@ -41,6 +50,9 @@ type BloomFetcher struct {
 	interval   time.Duration  // how often to re-fetch
 	retryCount int            // how many times to retry a failed fetch per cycle
 	httpClient *http.Client   // shared transport for all fetches in this fetcher
+	stream     bool           // subscribe to the server's change stream
+	kick       chan struct{}  // change-stream → fetch loop; buffered 1, coalesces bursts
+	noPatch    bool           // last patch failed to apply; fetch the whole filter next
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
@@ -61,6 +73,8 @@ func NewBloomFetcher(checker *BloomChecker, cfg *config.BloomConfig, logger *log
 		httpClient: &http.Client{
 			Timeout: cfg.BloomFetchTimeout,
 		},
+		stream: cfg.BloomChangeStream,
+		kick:   make(chan struct{}, 1),
 		ctx:    ctx,
 		cancel: cancel,
 		logger: logger,
@@ -95,9 +109,37 @@ func (f *BloomFetcher) Start() {
 				return
 			case <-ticker.C:
 				f.FetchOnce()
+			case <-f.kick:
+				f.FetchOnce()
 			}
 		}
 	}()
+
+	// Phase 4: change-stream subscription. Fetches stay on the ticker
+	// goroutine so checker.Store keeps a single writer; this only kicks it.
+	if f.stream {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			sub := changestream.NewSubscriber(f.serverURL, f.logger)
+			err := sub.Run(f.ctx, 0, f.onChange)
+			if errors.Is(err, changestream.ErrUnsupported) {
+				f.logger.Printf("[bloom-fetcher] server has no change stream; relying on the %s ticker", f.interval)
+			}
+		}()
+	}
+}
+
+// onChange kicks a fetch for any generation that changed membership. The
+// empty delta a resumed connection opens with changes nothing and is skipped.
+func (f *BloomFetcher) onChange(ev changestream.Event) {
+	if !ev.Resync && len(ev.Added) == 0 && len(ev.Removed) == 0 {
+		return
+	}
+	select {
+	case f.kick <- struct{}{}:
+	default: // a fetch is already pending
+	}
 }
 
 // Stop cancels the fetcher context and waits for the goroutine to exit.
@@ -134,6 +176,7 @@ func (f *BloomFetcher) LoadDisk() {
 //
 // Decision tree per fetch attempt:
 //   - 304: no-op (D-09 — current in-memory filter is already current).
+//   - 226: apply the patch to the held cuckoo filter; on mismatch, refetch in full.
 //   - 503: treat as transient; keep last good, log (D-08/D-10).
 //   - 200: parse body via bloom.ReadFilter (D-07 parse-before-persist); on success
 //           call checker.Store and persist via temp+rename (D-08); on parse failure
@@ -178,8 +221,13 @@ func (f *BloomFetcher) doFetch() (done bool, retry bool) {
 	}
 
 	// Conditional GET: set If-None-Match to the current filter's ETag (D-09).
-	if cur := f.checker.filter.Load(); cur != nil {
+	// A cuckoo filter also asks for a patch from that generation (RFC 3229).
+	cur := f.checker.filter.Load()
+	if cur != nil {
 		req.Header.Set("If-None-Match", cur.ETag())
+		if cur.Patchable() && !f.noPatch {
+			req.Header.Set("A-IM", bloom.PatchIM)
+		}
 	}
 
 	resp, err := f.httpClient.Do(req)
@@ -195,6 +243,25 @@ func (f *BloomFetcher) doFetch() (done bool, retry bool) {
 		f.logger.Printf("[bloom-fetcher] 304 Not Modified — filter unchanged")
 		return true, false
 
+	case http.StatusIMUsed: // 226
+		patch, err := bloom.ReadPatch(resp.Body)
+		if err == nil && cur != nil {
+			var next *bloom.Filter
+			if next, err = cur.Apply(patch); err == nil {
+				// Copy-on-write: readers keep using cur until the swap (GATE-03).
+				f.checker.Store(next)
+				if err := f.persistFilter(next); err != nil {
+					f.logger.Printf("[bloom-fetcher] persist error (filter already swapped in memory): %v", err)
+				}
+				f.logger.Printf("[bloom-fetcher] 226: applied %d-op patch, filter stored and persisted to %s", patch.Len(), f.bloomPath)
+				return true, false
+			}
+		}
+		// Out of step with the server — fall back to one full download.
+		f.logger.Printf("[bloom-fetcher] 226: patch rejected (keeping last good, refetching in full): %v", err)
+		f.noPatch = true
+		return false, true
+
 	case http.StatusServiceUnavailable: // 503
 		// Server has no filter yet — treat as transient; keep last good (D-08/D-10).
 		f.logger.Printf("[bloom-fetcher] 503 Service Unavailable — server loading, keeping last good filter")
@@ -217,6 +284,7 @@ func (f *BloomFetcher) doFetch() (done bool, retry bool) {
 
 		// Atomic in-memory swap (D-07/GATE-03).
 		f.checker.Store(filter)
+		f.noPatch = false
 
 		// Persist via temp+rename (D-08). A persist failure logs but does NOT undo the swap.
 		if err := f.persist(body); err != nil {
@@ -232,6 +300,15 @@ func (f *BloomFetcher) doFetch() (done bool, retry bool) {
 	}
 }
 
+// persistFilter serializes filter and persists it (D-08).
+func (f *BloomFetcher) persistFilter(filter *bloom.Filter) error {
+	body, err := filter.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("serialize filter: %w", err)
+	}
+	return f.persist(body)
+}
+
 // persist writes body bytes to bloomPath atomically via temp+rename (D-08).
 // On success bloomPath is updated and the .tmp file is gone.
 // On failure the .tmp file may remain; bloomPath is untouched.
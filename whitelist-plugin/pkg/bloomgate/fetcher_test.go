@@ -6,11 +6,13 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"whitelist-plugin/pkg/bloom"
 	"whitelist-plugin/pkg/bloomgate"
+	"whitelist-plugin/pkg/changestream"
 	"whitelist-plugin/pkg/config"
 )
 
@@ -447,3 +449,134 @@ func TestBloomFetcherStart(t *testing.T) {
 		t.Fatalf("bloom.ReadFilter on persisted file: %v", err)
 	}
 }
+
+// TestBloomFetcherChangeStreamKicksFetch: with bloom_change_stream on, a delta
+// on /changes triggers a /bloom fetch well before the refresh ticker would.
+func TestBloomFetcherChangeStreamKicksFetch(t *testing.T) {
+	var oldKey, newKey [32]byte
+	oldKey[0], newKey[0] = 0x0a, 0x0b
+	oldData, _ := buildTestFilterBytes(t, oldKey)
+	newData, _ := buildTestFilterBytes(t, newKey)
+
+	var current atomic.Pointer[[]byte]
+	current.Store(&oldData)
+	publish := make(chan struct{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bloom", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"test"`)
+		w.Write(*current.Load())
+	})
+	mux.HandleFunc(changestream.Path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		changestream.Write(w, changestream.Event{Resync: true, Generation: 1})
+		w.(http.Flusher).Flush()
+		select {
+		case <-publish:
+		case <-r.Context().Done():
+			return
+		}
+		current.Store(&newData)
+		changestream.Write(w, changestream.Event{Since: 1, Generation: 2, Added: []string{hexOf(newKey)}})
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := testBloomConfig(srv.URL, filepath.Join(t.TempDir(), "bloom.dfbf"))
+	cfg.BloomRefreshInterval = time.Hour // only the stream can trigger a refetch
+	cfg.BloomChangeStream = true
+	checker := bloomgate.NewBloomChecker(logger())
+	fetcher := bloomgate.NewBloomFetcher(checker, cfg, logger())
+	fetcher.Start()
+	defer fetcher.Stop()
+
+	close(publish)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if ok, _ := checker.IsWhitelisted(hexOf(newKey)); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("change event did not trigger a bloom refetch")
+}
+
+// TestBloomFetcherAppliesPatch: holding a cuckoo filter, the fetcher asks for a patch
+// (A-IM), applies a 226 response to a copy of its filter and persists the result; a
+// patch that does not apply falls back to a full 200 download.
+func TestBloomFetcherAppliesPatch(t *testing.T) {
+	keys := make([][32]byte, 100)
+	for i := range keys {
+		keys[i][0], keys[i][1] = 0x20, byte(i)
+	}
+	b := bloom.NewCuckooBuilder(200, 1e-6)
+	for _, k := range keys[:50] {
+		b.Add(k)
+	}
+	f0, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	f1, p1, err := f0.Update(keys[50:], keys[:10])
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	full0, _ := f0.MarshalBinary()
+	full1, _ := f1.MarshalBinary()
+	patch, _ := p1.MarshalBinary()
+
+	var current atomic.Pointer[[]byte]
+	current.Store(&full0)
+	var badPatch atomic.Bool
+	var imRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("A-IM") == bloom.PatchIM && r.Header.Get("If-None-Match") == f0.ETag() {
+			imRequests.Add(1)
+			body := patch
+			if badPatch.Load() {
+				body = bytes.Clone(patch)
+				body[len(body)-1] ^= 0xff // corrupts the last op's key
+			}
+			w.Header().Set("ETag", f1.ETag())
+			w.WriteHeader(http.StatusIMUsed)
+			w.Write(body)
+			return
+		}
+		w.Write(*current.Load())
+	}))
+	defer srv.Close()
+
+	for _, bad := range []bool{false, true} {
+		bloomPath := filepath.Join(t.TempDir(), "bloom.dfbf")
+		checker := bloomgate.NewBloomChecker(logger())
+		fetcher := bloomgate.NewBloomFetcher(checker, testBloomConfig(srv.URL, bloomPath), logger())
+		current.Store(&full0)
+		fetcher.FetchOnce() // full f0
+
+		current.Store(&full1)
+		badPatch.Store(bad)
+		before := imRequests.Load()
+		fetcher.FetchOnce()
+		if imRequests.Load() != before+1 {
+			t.Fatalf("bad=%v: fetcher did not request a patch", bad)
+		}
+
+		for i, k := range keys {
+			ok, _ := checker.IsWhitelisted(hexOf(k))
+			if ok != (i >= 10) { // keys[:10] removed
+				t.Fatalf("bad=%v: key %d whitelisted=%v after update", bad, i, ok)
+			}
+		}
+		raw, err := os.ReadFile(bloomPath)
+		if err != nil {
+			t.Fatalf("bad=%v: ReadFile: %v", bad, err)
+		}
+		persisted, err := bloom.ReadFilter(bytes.NewReader(raw))
+		if err != nil || persisted.ETag() != f1.ETag() {
+			t.Fatalf("bad=%v: persisted filter %v, err %v; want generation %s", bad, persisted, err, f1.ETag())
+		}
+	}
+}
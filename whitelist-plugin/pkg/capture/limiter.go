@@ -0,0 +1,186 @@
+// Package capture decides which non-whitelisted events the router actually
+// sends to quarantine, so one flooding pubkey or IP cannot fill the quarantine
+// LMDB and the corpus stays spread over many pubkeys.
+//
+// Three gates run in order: a deterministic sample on the event id, then a
+// token bucket per pubkey and one per source IP. An event must get a token
+// from both buckets; it never spends one from either if the other is empty.
+package capture
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMaxKeys bounds how many pubkey and IP buckets are kept when config
+// omits a limit.
+const DefaultMaxKeys = 100000
+
+// Decision codes surfaced in logs and metrics.
+const (
+	DecisionCaptured   = "captured"
+	DecisionSampledOut = "sampled_out"
+	DecisionPubkeyRate = "pubkey_rate_limited"
+	DecisionIPRate     = "ip_rate_limited"
+)
+
+// Config configures a Limiter. A zero rate disables that bucket; SampleRate
+// is the fraction of events kept, 0 or >= 1 keeping them all.
+type Config struct {
+	SampleRate  float64
+	PubkeyRate  float64 // tokens per second
+	PubkeyBurst int
+	IPRate      float64 // tokens per second
+	IPBurst     int
+	MaxKeys     int // per bucket set
+}
+
+// Limiter is safe for concurrent use.
+type Limiter struct {
+	sampleBelow uint64 // keep events whose id hash is below this
+	sampleAll   bool
+	pubkeys     *buckets
+	ips         *buckets
+	now         func() time.Time
+}
+
+// New returns a Limiter, or nil if cfg limits nothing. A nil *Limiter
+// captures every event.
+func New(cfg Config) *Limiter {
+	l := &Limiter{
+		sampleAll: cfg.SampleRate <= 0 || cfg.SampleRate >= 1,
+		pubkeys:   newBuckets(cfg.PubkeyRate, cfg.PubkeyBurst, cfg.MaxKeys),
+		ips:       newBuckets(cfg.IPRate, cfg.IPBurst, cfg.MaxKeys),
+		now:       time.Now,
+	}
+	if !l.sampleAll {
+		l.sampleBelow = uint64(cfg.SampleRate * math.MaxUint64)
+	}
+	if l.sampleAll && l.pubkeys == nil && l.ips == nil {
+		return nil
+	}
+	return l
+}
+
+// Allow reports whether the event should be captured, with its decision code.
+// ip may be empty when the event did not come from a client connection.
+func (l *Limiter) Allow(id, pubkey, ip string) (bool, string) {
+	if l == nil {
+		return true, DecisionCaptured
+	}
+	if !l.sampleAll && sampleHash(id) >= l.sampleBelow {
+		return false, DecisionSampledOut
+	}
+
+	now := l.now()
+	pk := l.pubkeys.lock(pubkey, now)
+	defer l.pubkeys.unlock()
+	if pk != nil && pk.tokens < 1 {
+		return false, DecisionPubkeyRate
+	}
+	var addr *bucket
+	if ip != "" {
+		addr = l.ips.lock(ip, now)
+		defer l.ips.unlock()
+		if addr != nil && addr.tokens < 1 {
+			return false, DecisionIPRate
+		}
+	}
+	if pk != nil {
+		pk.tokens--
+	}
+	if addr != nil {
+		addr.tokens--
+	}
+	return true, DecisionCaptured
+}
+
+// sampleHash spreads event ids evenly over uint64, so the same event is
+// always sampled the same way and replays are reproducible. FNV alone leaves
+// the high bits of similar ids close together; the splitmix64 finalizer fixes
+// that.
+func sampleHash(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// buckets is one set of token buckets keyed by pubkey or IP. A nil *buckets
+// limits nothing.
+type buckets struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	maxKeys int
+	m       map[string]*bucket
+}
+
+func newBuckets(rate float64, burst, maxKeys int) *buckets {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &buckets{rate: rate, burst: float64(burst), maxKeys: maxKeys, m: make(map[string]*bucket)}
+}
+
+// lock takes the set's lock and returns key's bucket refilled up to now. The
+// caller must call unlock, also when lock returns nil.
+func (b *buckets) lock(key string, now time.Time) *bucket {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	bk, ok := b.m[key]
+	if !ok {
+		if len(b.m) >= b.maxKeys {
+			b.prune(now)
+		}
+		bk = &bucket{tokens: b.burst, last: now}
+		b.m[key] = bk
+		return bk
+	}
+	if elapsed := now.Sub(bk.last).Seconds(); elapsed > 0 {
+		bk.tokens = min(b.burst, bk.tokens+elapsed*b.rate)
+		bk.last = now
+	}
+	return bk
+}
+
+func (b *buckets) unlock() {
+	if b != nil {
+		b.mu.Unlock()
+	}
+}
+
+// prune drops the buckets that have refilled, which behave exactly like
+// missing ones. If every bucket is still draining the set is cleared, which at
+// worst lets each flooding key through one more burst.
+func (b *buckets) prune(now time.Time) {
+	full := time.Duration(b.burst / b.rate * float64(time.Second))
+	for k, bk := range b.m {
+		if now.Sub(bk.last) >= full {
+			delete(b.m, k)
+		}
+	}
+	if len(b.m) >= b.maxKeys {
+		clear(b.m)
+	}
+}
@@ -0,0 +1,103 @@
+package capture
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time               { return c.t }
+func (c *clock) advance(d time.Duration)      { c.t = c.t.Add(d) }
+func withClock(l *Limiter, c *clock) *Limiter { l.now = c.now; return l }
+
+func TestNew_NothingConfigured(t *testing.T) {
+	if l := New(Config{SampleRate: 1}); l != nil {
+		t.Fatalf("New with no limits = %+v, want nil", l)
+	}
+	var l *Limiter
+	if ok, d := l.Allow("e", "pk", "1.2.3.4"); !ok || d != DecisionCaptured {
+		t.Fatalf("nil Allow = %v, %s", ok, d)
+	}
+}
+
+func TestAllow_PubkeyBucket(t *testing.T) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	l := withClock(New(Config{PubkeyRate: 1, PubkeyBurst: 3}), c)
+
+	for i := range 3 {
+		if ok, _ := l.Allow(fmt.Sprint(i), "spammer", ""); !ok {
+			t.Fatalf("event %d within burst rejected", i)
+		}
+	}
+	if ok, d := l.Allow("x", "spammer", ""); ok || d != DecisionPubkeyRate {
+		t.Fatalf("over burst = %v, %s; want pubkey_rate_limited", ok, d)
+	}
+	if ok, _ := l.Allow("y", "someone-else", ""); !ok {
+		t.Fatal("another pubkey was limited by the spammer's bucket")
+	}
+
+	c.advance(2 * time.Second)
+	for i := range 2 {
+		if ok, _ := l.Allow(fmt.Sprint("r", i), "spammer", ""); !ok {
+			t.Fatalf("refilled token %d rejected", i)
+		}
+	}
+	if ok, _ := l.Allow("z", "spammer", ""); ok {
+		t.Fatal("bucket refilled more than 2 tokens in 2s")
+	}
+}
+
+func TestAllow_IPBucketDoesNotSpendPubkeyTokens(t *testing.T) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	l := withClock(New(Config{PubkeyRate: 1, PubkeyBurst: 1, IPRate: 1, IPBurst: 2}), c)
+
+	l.Allow("a", "pk1", "10.0.0.1")
+	l.Allow("b", "pk2", "10.0.0.1")
+	if ok, d := l.Allow("c", "pk3", "10.0.0.1"); ok || d != DecisionIPRate {
+		t.Fatalf("third event from one IP = %v, %s; want ip_rate_limited", ok, d)
+	}
+	// pk3 was refused by its IP, so its own token is still there.
+	if ok, _ := l.Allow("d", "pk3", "10.0.0.2"); !ok {
+		t.Fatal("pk3 lost a token to the IP limit")
+	}
+	// Events without a source IP skip the IP bucket.
+	if ok, _ := l.Allow("e", "pk4", ""); !ok {
+		t.Fatal("event without IP rejected")
+	}
+}
+
+func TestAllow_SamplingIsDeterministic(t *testing.T) {
+	l := New(Config{SampleRate: 0.25})
+	kept := 0
+	for i := range 10000 {
+		id := fmt.Sprintf("%064x", i)
+		ok, d := l.Allow(id, "pk", "")
+		if again, _ := l.Allow(id, "pk", ""); again != ok {
+			t.Fatalf("id %s sampled both ways", id)
+		}
+		if ok {
+			kept++
+		} else if d != DecisionSampledOut {
+			t.Fatalf("decision = %s, want sampled_out", d)
+		}
+	}
+	if kept < 2200 || kept > 2800 {
+		t.Errorf("kept %d of 10000 at rate 0.25", kept)
+	}
+}
+
+func TestBuckets_PruneBoundsKeys(t *testing.T) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	l := withClock(New(Config{PubkeyRate: 1, PubkeyBurst: 1, MaxKeys: 10}), c)
+	for i := range 100 {
+		l.Allow("e", fmt.Sprint("pk", i), "")
+		if i%20 == 0 {
+			c.advance(time.Second)
+		}
+	}
+	if n := len(l.pubkeys.m); n > 10 {
+		t.Fatalf("%d pubkey buckets kept, want at most 10", n)
+	}
+}
@@ -0,0 +1,237 @@
+// Package changestream is the whitelist server's push channel: a
+// Server-Sent Events feed of whitelist generations served at GET /changes,
+// and a Subscriber the plugins use to follow it.
+//
+// Wire format, one SSE message per generation the client has not seen:
+//
+//	event: delta
+//	id: <generation>
+//	data: {"since":S,"generation":G,"added":["<hex>",...],"removed":[...]}
+//
+//	event: resync
+//	id: <generation>
+//	data: {"generation":G}
+//
+// plus a ": ping" comment every HeartbeatInterval. The first message on every
+// connection is either a delta (possibly empty, confirming the client is
+// current) or a resync.
+//
+// Resume semantics: a client connects with ?since=<generation it holds>
+// (or the standard Last-Event-ID header). The server answers from its
+// ChangeLog, so the client either gets every change since that generation,
+// merged into one delta, or a resync telling it to drop its state and resume
+// from G. There is no window in which an update can be skipped: a dropped
+// connection just reconnects from the last generation the client applied.
+package changestream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Path is the server route of the stream.
+const Path = "/changes"
+
+// HeartbeatInterval is how often the server writes a keepalive comment.
+// Subscribers treat three missed heartbeats as a dead connection.
+const HeartbeatInterval = 15 * time.Second
+
+// Event types on the wire.
+const (
+	EventDelta  = "delta"
+	EventResync = "resync"
+)
+
+// ErrUnsupported is returned by Subscriber.Run when the server has no
+// change stream (it predates it), so the caller can fall back to polling.
+var ErrUnsupported = errors.New("whitelist server has no change stream")
+
+// Event is one stream message. Resync events carry only Generation; the
+// receiver must discard everything it derived from earlier generations.
+type Event struct {
+	Resync     bool     `json:"-"`
+	Since      uint64   `json:"since,omitempty"`
+	Generation uint64   `json:"generation"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+}
+
+// Write encodes ev as one SSE message.
+func Write(w io.Writer, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	name := EventDelta
+	if ev.Resync {
+		name = EventResync
+	}
+	_, err = fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", name, ev.Generation, data)
+	return err
+}
+
+// WriteHeartbeat writes a keepalive comment.
+func WriteHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": ping\n\n")
+	return err
+}
+
+// Subscriber follows a server's change stream, reconnecting with backoff.
+// The zero value is not valid; use NewSubscriber.
+type Subscriber struct {
+	url        string
+	httpClient *http.Client
+	logger     *log.Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	idle       time.Duration // no bytes for this long = dead connection
+}
+
+// NewSubscriber returns a Subscriber for the server at serverURL.
+func NewSubscriber(serverURL string, logger *log.Logger) *Subscriber {
+	return &Subscriber{
+		url: strings.TrimRight(serverURL, "/") + Path,
+		// No client timeout: the response body is read for as long as the
+		// connection lives. Dead connections are caught by the idle watchdog.
+		httpClient: &http.Client{},
+		logger:     logger,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		idle:       3 * HeartbeatInterval,
+	}
+}
+
+// Run calls fn for every event until ctx is cancelled, reconnecting after
+// any failure and resuming from the generation of the last event delivered
+// to fn. since is the generation the caller already holds; 0 means none, and
+// the server answers with a resync. fn runs on Run's goroutine.
+//
+// Run returns ctx.Err() on cancellation, or ErrUnsupported if the server
+// answers 404.
+func (s *Subscriber) Run(ctx context.Context, since uint64, fn func(Event)) error {
+	backoff := s.minBackoff
+	for {
+		delivered, err := s.stream(ctx, &since, fn)
+		if errors.Is(err, ErrUnsupported) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if delivered {
+			backoff = s.minBackoff
+		}
+		s.logger.Printf("[changestream] disconnected (resume from %d in %s): %v", since, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+	}
+}
+
+// stream holds one connection open, advancing *since as events are delivered.
+// It reports whether any event was delivered, to reset the backoff.
+func (s *Subscriber) stream(ctx context.Context, since *uint64, fn func(Event)) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?since=%d", s.url, *since), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, ErrUnsupported
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// Watchdog: cancel the request if the server goes quiet for longer than
+	// a few heartbeats (half-open TCP, stuck proxy).
+	watchdog := time.AfterFunc(s.idle, cancel)
+	defer watchdog.Stop()
+
+	delivered := false
+	var name, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20) // a large delta is one data line
+	for scanner.Scan() {
+		watchdog.Reset(s.idle)
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data == "" {
+				continue
+			}
+			ev, err := decode(name, data)
+			name, data = "", ""
+			if err != nil {
+				return delivered, err
+			}
+			fn(ev)
+			*since = ev.Generation
+			delivered = true
+		case strings.HasPrefix(line, ":"):
+			// comment / heartbeat
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+		// id: lines are ignored; the generation is also in the payload.
+	}
+	if err := scanner.Err(); err != nil {
+		return delivered, err
+	}
+	return delivered, io.ErrUnexpectedEOF
+}
+
+// decode parses one message's payload.
+func decode(name, data string) (Event, error) {
+	var ev Event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		return ev, fmt.Errorf("decode %s event: %w", name, err)
+	}
+	switch name {
+	case EventDelta:
+	case EventResync:
+		ev.Resync = true
+	default:
+		return ev, fmt.Errorf("unknown event type %q", name)
+	}
+	return ev, nil
+}
+
+// ParseSince reads the resume generation from a stream request: the since
+// query parameter, else the Last-Event-ID header, else 0.
+func ParseSince(r *http.Request) (uint64, error) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		v = r.Header.Get("Last-Event-ID")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
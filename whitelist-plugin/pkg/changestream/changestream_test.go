@@ -0,0 +1,146 @@
+package changestream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testSubscriber(url string) *Subscriber {
+	s := NewSubscriber(url, log.New(io.Discard, "", 0))
+	s.minBackoff = time.Millisecond
+	s.maxBackoff = 5 * time.Millisecond
+	return s
+}
+
+func TestWriteDecodeRoundTrip(t *testing.T) {
+	var b strings.Builder
+	want := Event{Since: 4, Generation: 7, Added: []string{"aa"}, Removed: []string{"bb"}}
+	if err := Write(&b, want); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "event: delta\nid: 7\ndata: ") {
+		t.Fatalf("unexpected framing %q", b.String())
+	}
+
+	b.Reset()
+	if err := Write(&b, Event{Resync: true, Generation: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "event: resync\nid: 9\ndata: {\"generation\":9}\n\n" {
+		t.Fatalf("unexpected resync framing %q", b.String())
+	}
+
+	if _, err := decode("bogus", `{"generation":1}`); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+}
+
+// TestSubscriberResumesFromLastEvent drops the connection after each event
+// and checks the reconnect asks for the generation last delivered.
+func TestSubscriberResumesFromLastEvent(t *testing.T) {
+	var mu sync.Mutex
+	var sinces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		n := len(sinces)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		WriteHeartbeat(w)
+		if n == 1 {
+			Write(w, Event{Resync: true, Generation: 10})
+		} else {
+			Write(w, Event{Since: 10, Generation: 11, Added: []string{"aa"}})
+		}
+		// Return: the subscriber sees EOF and reconnects.
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []Event
+	err := testSubscriber(srv.URL).Run(ctx, 0, func(ev Event) {
+		got = append(got, ev)
+		if len(got) == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v, want context.Canceled", err)
+	}
+	if len(got) != 2 || !got[0].Resync || got[0].Generation != 10 || got[1].Generation != 11 || got[1].Added[0] != "aa" {
+		t.Fatalf("events = %+v", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sinces[0] != "0" || sinces[1] != "10" {
+		t.Fatalf("since on connect = %v, want [0 10 ...]", sinces)
+	}
+}
+
+func TestSubscriberUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	err := testSubscriber(srv.URL).Run(context.Background(), 0, func(Event) {})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Run() = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestSubscriberIdleWatchdog(t *testing.T) {
+	var mu sync.Mutex
+	connects := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connects++
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // silent: no events, no heartbeats
+	}))
+	defer srv.Close()
+
+	sub := testSubscriber(srv.URL)
+	sub.idle = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	sub.Run(ctx, 0, func(Event) {})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if connects < 2 {
+		t.Fatalf("silent connection was not dropped: %d connects", connects)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/changes?since=12", nil)
+	r.Header.Set("Last-Event-ID", "99")
+	if v, err := ParseSince(r); err != nil || v != 12 {
+		t.Errorf("query param: got %d, %v", v, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/changes", nil)
+	r.Header.Set("Last-Event-ID", "99")
+	if v, err := ParseSince(r); err != nil || v != 99 {
+		t.Errorf("Last-Event-ID: got %d, %v", v, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/changes", nil)
+	if v, err := ParseSince(r); err != nil || v != 0 {
+		t.Errorf("absent: got %d, %v", v, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/changes?since=x", nil)
+	if _, err := ParseSince(r); err == nil {
+		t.Error("expected error for non-numeric since")
+	}
+}
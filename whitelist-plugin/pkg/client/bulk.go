@@ -0,0 +1,139 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// maxBulkInflight bounds concurrent POST /check requests. While that many are
+// in flight, new cache misses queue and go out together in the next request,
+// so batches grow with load and an idle plugin adds no wait.
+const maxBulkInflight = 2
+
+// maxBulkBatch caps the pubkeys in one POST /check, well under the server's
+// 100k limit.
+const maxBulkBatch = 1000
+
+type bulkRequest struct {
+	Pubkeys []string `json:"pubkeys"`
+}
+
+type bulkResponse struct {
+	Results map[string]bool          `json:"results"`
+	Scores  map[string]checkResponse `json:"scores"`
+}
+
+type bulkResult struct {
+	st  Status
+	err error
+}
+
+// bulkBatcher coalesces concurrent cache misses into POST /check requests.
+type bulkBatcher struct {
+	c        *WhitelistClient
+	mu       sync.Mutex
+	queue    []string                     // pubkeys not yet sent
+	waiters  map[string][]chan bulkResult // queued and in-flight pubkeys
+	inflight int
+}
+
+// EnableBulkChecks sends cache misses through the bulk POST /check endpoint:
+// concurrent Check calls share one request, and a pubkey already being
+// checked is not asked for twice. Worth it only when several goroutines call
+// Check at once, as the pipelined event loop does. Must be called before the
+// first Check.
+func (c *WhitelistClient) EnableBulkChecks() {
+	c.bulk = &bulkBatcher{c: c, waiters: make(map[string][]chan bulkResult)}
+}
+
+func (b *bulkBatcher) check(pubkey string) (Status, error) {
+	ch := make(chan bulkResult, 1)
+	b.mu.Lock()
+	if _, pending := b.waiters[pubkey]; !pending {
+		b.queue = append(b.queue, pubkey)
+	}
+	b.waiters[pubkey] = append(b.waiters[pubkey], ch)
+	batch := b.take()
+	b.mu.Unlock()
+
+	if batch != nil {
+		go b.flush(batch)
+	}
+	r := <-ch
+	return r.st, r.err
+}
+
+// take dequeues the next batch if another request may start. Called with mu held.
+func (b *bulkBatcher) take() []string {
+	if b.inflight >= maxBulkInflight || len(b.queue) == 0 {
+		return nil
+	}
+	n := min(len(b.queue), maxBulkBatch)
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+	b.inflight++
+	return batch
+}
+
+// flush sends batch, answers its waiters, and keeps sending whatever queued
+// up meanwhile.
+func (b *bulkBatcher) flush(batch []string) {
+	for batch != nil {
+		statuses, err := b.c.checkBulk(batch)
+
+		b.mu.Lock()
+		for _, pk := range batch {
+			r := bulkResult{err: err}
+			if err == nil {
+				st, ok := statuses[pk]
+				if !ok {
+					r.err = fmt.Errorf("pubkey missing from bulk response")
+				}
+				r.st = st
+			}
+			for _, ch := range b.waiters[pk] {
+				ch <- r
+			}
+			delete(b.waiters, pk)
+		}
+		b.inflight--
+		batch = b.take()
+		b.mu.Unlock()
+	}
+}
+
+// checkBulk asks POST /check for pubkeys and caches every answer.
+func (c *WhitelistClient) checkBulk(pubkeys []string) (map[string]Status, error) {
+	body, err := json.Marshal(bulkRequest{Pubkeys: pubkeys})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Post(c.serverURL+"/check", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("whitelist server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("whitelist server returned %d", resp.StatusCode)
+	}
+
+	var out bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode bulk whitelist response: %w", err)
+	}
+
+	statuses := make(map[string]Status, len(out.Results))
+	for pk, whitelisted := range out.Results {
+		st := Status{Whitelisted: whitelisted}
+		if whitelisted {
+			st.Tier = max(out.Scores[pk].Tier, 1)
+		}
+		c.cache.Set(pk, st)
+		statuses[pk] = st
+	}
+	return statuses, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkChecks_Coalesce(t *testing.T) {
+	var requests, pubkeys atomic.Int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/check" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req bulkRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if requests.Add(1) == 1 {
+			<-release // hold the first request so the rest queue up
+		}
+		pubkeys.Add(int32(len(req.Pubkeys)))
+		resp := bulkResponse{Results: map[string]bool{}, Scores: map[string]checkResponse{}}
+		for _, pk := range req.Pubkeys {
+			resp.Results[pk] = pk != "pk-odd"
+			resp.Scores[pk] = checkResponse{Tier: 2}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	c.EnableBulkChecks()
+
+	var wg sync.WaitGroup
+	check := func(pk string, wantOK bool) {
+		defer wg.Done()
+		ok, tier, err := c.CheckTier(pk)
+		if err != nil || ok != wantOK || (ok && tier != 2) {
+			t.Errorf("CheckTier(%s) = %v, %d, %v", pk, ok, tier, err)
+		}
+	}
+	wg.Add(1)
+	go check("pk-first", true)
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := range 50 {
+		wg.Add(2)
+		go check(fmt.Sprintf("pk-%d", i), true)
+		go check("pk-odd", false)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// 52 distinct pubkeys, but the misses queued behind the held request
+	// share a few bulk requests.
+	if n := requests.Load(); n >= 10 {
+		t.Errorf("%d requests for 52 pubkeys, want a handful", n)
+	}
+	if n := pubkeys.Load(); n != 52 {
+		t.Errorf("%d pubkeys sent, want 52 (no duplicates)", n)
+	}
+	if st, ok := c.cache.Get("pk-odd"); !ok || st.Whitelisted {
+		t.Errorf("bulk answer not cached: %+v, %v", st, ok)
+	}
+}
+
+func TestBulkChecks_ServerError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	c.EnableBulkChecks()
+	if ok, err := c.IsWhitelisted("aabbccdd"); err == nil || ok {
+		t.Fatalf("expected fail-closed error, got %v, %v", ok, err)
+	}
+	if c.cache.len() != 0 {
+		t.Error("transient error was cached")
+	}
+}
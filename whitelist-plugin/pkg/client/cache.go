@@ -7,7 +7,7 @@ import (
 )
 
 // ttlCache is a bounded LRU cache with per-entry TTL. It caches whitelist
-// decisions (true and false) so the plugin's stdin/stdout pipe — which
+// statuses (whitelisted and not, with the trust tier) so the plugin's stdin/stdout pipe — which
 // serialises every event the relay accepts — does not block on a fresh
 // HTTP round-trip per event.
 //
@@ -27,7 +27,7 @@ type ttlCache struct {
 
 type cacheEntry struct {
 	key       string
-	value     bool
+	value     Status
 	expiresAt time.Time
 }
 
@@ -44,24 +44,24 @@ func newTTLCache(size int, ttl time.Duration) *ttlCache {
 	}
 }
 
-func (c *ttlCache) Get(key string) (bool, bool) {
+func (c *ttlCache) Get(key string) (Status, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	el, ok := c.items[key]
 	if !ok {
-		return false, false
+		return Status{}, false
 	}
 	entry := el.Value.(*cacheEntry)
 	if c.now().After(entry.expiresAt) {
 		c.ll.Remove(el)
 		delete(c.items, key)
-		return false, false
+		return Status{}, false
 	}
 	c.ll.MoveToFront(el)
 	return entry.value, true
 }
 
-func (c *ttlCache) Set(key string, value bool) {
+func (c *ttlCache) Set(key string, value Status) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if el, ok := c.items[key]; ok {
@@ -84,6 +84,24 @@ func (c *ttlCache) Set(key string, value bool) {
 	})
 }
 
+// Delete drops key so the next lookup goes to the server.
+func (c *ttlCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Purge drops every entry.
+func (c *ttlCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	clear(c.items)
+}
+
 func (c *ttlCache) len() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -10,18 +10,18 @@ func TestTTLCache_HitAndMiss(t *testing.T) {
 	if _, ok := c.Get("a"); ok {
 		t.Fatal("empty cache returned hit")
 	}
-	c.Set("a", true)
+	c.Set("a", Status{Whitelisted: true})
 	v, ok := c.Get("a")
-	if !ok || !v {
+	if !ok || !v.Whitelisted {
 		t.Fatalf("expected hit=true got hit=%v val=%v", ok, v)
 	}
 }
 
 func TestTTLCache_NegativeIsCached(t *testing.T) {
 	c := newTTLCache(4, time.Minute)
-	c.Set("a", false)
+	c.Set("a", Status{})
 	v, ok := c.Get("a")
-	if !ok || v {
+	if !ok || v.Whitelisted {
 		t.Fatalf("expected cached false, got hit=%v val=%v", ok, v)
 	}
 }
@@ -31,7 +31,7 @@ func TestTTLCache_Expiry(t *testing.T) {
 	now := time.Unix(1_000_000, 0)
 	c.now = func() time.Time { return now }
 
-	c.Set("a", true)
+	c.Set("a", Status{Whitelisted: true})
 	if _, ok := c.Get("a"); !ok {
 		t.Fatal("entry should be live before TTL")
 	}
@@ -46,13 +46,13 @@ func TestTTLCache_Expiry(t *testing.T) {
 
 func TestTTLCache_LRUEvictionOnOverflow(t *testing.T) {
 	c := newTTLCache(2, time.Minute)
-	c.Set("a", true)
-	c.Set("b", true)
+	c.Set("a", Status{Whitelisted: true})
+	c.Set("b", Status{Whitelisted: true})
 	// Touch "a" so "b" becomes the LRU.
 	if _, ok := c.Get("a"); !ok {
 		t.Fatal("a missing")
 	}
-	c.Set("c", true) // evicts "b"
+	c.Set("c", Status{Whitelisted: true}) // evicts "b"
 
 	if _, ok := c.Get("b"); ok {
 		t.Fatal("b should have been evicted as LRU")
@@ -70,13 +70,13 @@ func TestTTLCache_OverwriteRefreshesTTL(t *testing.T) {
 	now := time.Unix(1_000_000, 0)
 	c.now = func() time.Time { return now }
 
-	c.Set("a", true)
+	c.Set("a", Status{Whitelisted: true})
 	now = now.Add(45 * time.Second)
-	c.Set("a", false) // refresh
+	c.Set("a", Status{}) // refresh
 	now = now.Add(45 * time.Second)
 
 	v, ok := c.Get("a")
-	if !ok || v {
+	if !ok || v.Whitelisted {
 		t.Fatalf("expected refreshed false within TTL, got hit=%v val=%v", ok, v)
 	}
 }
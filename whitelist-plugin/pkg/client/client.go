@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +23,9 @@ type WhitelistClient struct {
 	httpClient *http.Client
 	logger     *log.Logger
 	cache      *ttlCache
+	moderation atomic.Pointer[moderation] // nil until the first /moderation poll
+	bulk       *bulkBatcher               // nil = one GET /check per cache miss
+	generation atomic.Uint64              // last whitelist generation seen; 0 = none yet
 }
 
 func NewWhitelistClient(serverURL string, timeout time.Duration, logger *log.Logger) *WhitelistClient {
@@ -37,6 +41,15 @@ func NewWhitelistClient(serverURL string, timeout time.Duration, logger *log.Log
 
 type checkResponse struct {
 	Whitelisted bool `json:"whitelisted"`
+	Tier        int  `json:"tier"`
+}
+
+// Status is a pubkey's whitelist status as reported by the server. Tier is 0
+// for non-whitelisted pubkeys; servers that predate trust tiers omit it, so a
+// whitelisted pubkey with tier 0 is reported as tier 1.
+type Status struct {
+	Whitelisted bool
+	Tier        int
 }
 
 // CheckHealth calls the server's /health endpoint and returns any error.
@@ -60,27 +73,47 @@ func (c *WhitelistClient) CheckHealth() error {
 // closed on errors. Successful responses are cached for DefaultCacheTTL;
 // transient failures are not.
 func (c *WhitelistClient) IsWhitelisted(pubkey string) (bool, error) {
+	st, err := c.Check(pubkey)
+	return st.Whitelisted, err
+}
+
+// CheckTier reports whether pubkey is whitelisted and its trust tier. It
+// shares IsWhitelisted's cache and fail-closed semantics.
+func (c *WhitelistClient) CheckTier(pubkey string) (bool, int, error) {
+	st, err := c.Check(pubkey)
+	return st.Whitelisted, st.Tier, err
+}
+
+// Check returns the pubkey's full Status, consulting the cache first.
+func (c *WhitelistClient) Check(pubkey string) (Status, error) {
 	if v, ok := c.cache.Get(pubkey); ok {
 		return v, nil
 	}
+	if c.bulk != nil {
+		return c.bulk.check(pubkey)
+	}
 
 	url := fmt.Sprintf("%s/check/%s", c.serverURL, pubkey)
 
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
-		return false, fmt.Errorf("whitelist server unreachable: %w", err)
+		return Status{}, fmt.Errorf("whitelist server unreachable: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("whitelist server returned %d", resp.StatusCode)
+		return Status{}, fmt.Errorf("whitelist server returned %d", resp.StatusCode)
 	}
 
 	var body checkResponse
 	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return false, fmt.Errorf("decode whitelist response: %w", err)
+		return Status{}, fmt.Errorf("decode whitelist response: %w", err)
 	}
 
-	c.cache.Set(pubkey, body.Whitelisted)
-	return body.Whitelisted, nil
+	st := Status{Whitelisted: body.Whitelisted}
+	if body.Whitelisted {
+		st.Tier = max(body.Tier, 1)
+	}
+	c.cache.Set(pubkey, st)
+	return st, nil
 }
@@ -179,3 +179,43 @@ func TestIsWhitelisted_TransientErrorsNotCached(t *testing.T) {
 		t.Fatalf("transient failure should not be cached: calls=%d", calls)
 	}
 }
+
+func TestCheckTier(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/check/high":
+			w.Write([]byte(`{"whitelisted": true, "score": 0.9, "tier": 3}`))
+		case "/check/legacy":
+			w.Write([]byte(`{"whitelisted": true}`)) // server without trust tiers
+		default:
+			w.Write([]byte(`{"whitelisted": false, "score": 0, "tier": 0}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+
+	for _, tc := range []struct {
+		pubkey string
+		ok     bool
+		tier   int
+	}{
+		{"high", true, 3},
+		{"legacy", true, 1},
+		{"stranger", false, 0},
+	} {
+		ok, tier, err := c.CheckTier(tc.pubkey)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.pubkey, err)
+		}
+		if ok != tc.ok || tier != tc.tier {
+			t.Errorf("%s: CheckTier = (%v, %d), want (%v, %d)", tc.pubkey, ok, tier, tc.ok, tc.tier)
+		}
+	}
+
+	// Cached: a second lookup returns the same tier.
+	if _, tier, _ := c.CheckTier("high"); tier != 3 {
+		t.Errorf("cached tier = %d, want 3", tier)
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"whitelist-plugin/pkg/changestream"
+)
+
+// errDeltaUnsupported means the server predates GET /delta.
+var errDeltaUnsupported = errors.New("whitelist server has no /delta endpoint")
+
+// WatchChanges keeps the decision cache in step with the server's
+// whitelist. With stream set it follows the /changes stream and evicts
+// changed pubkeys as soon as the server publishes them, reconnecting and
+// resuming on its own. If stream is off, or the server predates the stream,
+// it falls back to WatchDelta polling every interval. Blocks until ctx is
+// cancelled.
+func (c *WhitelistClient) WatchChanges(ctx context.Context, stream bool, interval time.Duration) {
+	if stream {
+		err := changestream.NewSubscriber(c.serverURL, c.logger).Run(ctx, 0, c.applyChanges)
+		if !errors.Is(err, changestream.ErrUnsupported) {
+			return
+		}
+		c.logger.Printf("change stream unavailable, polling /delta every %s", interval)
+	}
+	c.WatchDelta(ctx, interval)
+}
+
+// Generation returns the whitelist generation the cache was last brought up
+// to date with, or 0 before the first change stream message or /delta poll.
+func (c *WhitelistClient) Generation() uint64 {
+	return c.generation.Load()
+}
+
+// applyChanges evicts every pubkey in ev from the cache, or the whole cache
+// on a resync.
+func (c *WhitelistClient) applyChanges(ev changestream.Event) {
+	defer c.generation.Store(ev.Generation)
+	if ev.Resync {
+		c.cache.Purge()
+		return
+	}
+	for _, pk := range ev.Added {
+		c.cache.Delete(pk)
+	}
+	for _, pk := range ev.Removed {
+		c.cache.Delete(pk)
+	}
+}
+
+// WatchDelta polls the server's /delta endpoint every interval and evicts the
+// cached status of every pubkey added to or removed from the whitelist, so a
+// membership change reaches this plugin within one interval rather than one
+// cache TTL. When the server cannot resume from our generation (first poll,
+// server restart, or we fell too far behind) the whole cache is purged.
+//
+// Re-scored pubkeys are not announced; their tier refreshes on cache expiry.
+// Blocks until ctx is cancelled; returns immediately if interval <= 0 and
+// stops early if the server has no /delta endpoint.
+func (c *WhitelistClient) WatchDelta(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var since uint64
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		gen, err := c.pollDelta(since)
+		switch {
+		case errors.Is(err, errDeltaUnsupported):
+			c.logger.Printf("delta watch disabled: %v", err)
+			return
+		case err != nil:
+			// Log the first failure of a run only; the server may be down for
+			// a while and the cache keeps failing closed on its own.
+			if !failing {
+				c.logger.Printf("delta poll failed: %v", err)
+				failing = true
+			}
+			continue
+		}
+		if failing {
+			c.logger.Printf("delta poll recovered at generation %d", gen)
+			failing = false
+		}
+		since = gen
+	}
+}
+
+// pollDelta fetches the changes since generation since, applies them to the
+// cache and returns the generation to poll from next.
+func (c *WhitelistClient) pollDelta(since uint64) (uint64, error) {
+	resp, err := c.httpClient.Get(fmt.Sprintf("%s/delta?since=%d", c.serverURL, since))
+	if err != nil {
+		return since, fmt.Errorf("whitelist server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusGone:
+		// /delta's body is a change stream event; 410 is its resync.
+		var ev changestream.Event
+		if err := json.NewDecoder(resp.Body).Decode(&ev); err != nil {
+			return since, fmt.Errorf("decode delta response: %w", err)
+		}
+		ev.Resync = resp.StatusCode == http.StatusGone
+		c.applyChanges(ev)
+		return ev.Generation, nil
+	case http.StatusNotFound:
+		return since, errDeltaUnsupported
+	default:
+		return since, fmt.Errorf("whitelist server returned %d", resp.StatusCode)
+	}
+}
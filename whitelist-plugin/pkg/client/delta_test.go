@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"whitelist-plugin/pkg/changestream"
+)
+
+func TestPollDelta_EvictsChangedKeys(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("since") != "7" {
+			t.Errorf("since = %q, want 7", r.URL.Query().Get("since"))
+		}
+		json.NewEncoder(w).Encode(changestream.Event{Generation: 9, Added: []string{"aa"}, Removed: []string{"bb"}})
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	c.cache.Set("aa", Status{})
+	c.cache.Set("bb", Status{Whitelisted: true, Tier: 2})
+	c.cache.Set("cc", Status{Whitelisted: true, Tier: 3})
+
+	gen, err := c.pollDelta(7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gen != 9 || c.Generation() != 9 {
+		t.Errorf("generation = %d (client %d), want 9", gen, c.Generation())
+	}
+	for _, k := range []string{"aa", "bb"} {
+		if _, ok := c.cache.Get(k); ok {
+			t.Errorf("%s still cached after delta", k)
+		}
+	}
+	if _, ok := c.cache.Get("cc"); !ok {
+		t.Error("unchanged key evicted")
+	}
+}
+
+func TestPollDelta_GonePurgesCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]uint64{"generation": 42})
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	c.cache.Set("aa", Status{Whitelisted: true, Tier: 1})
+
+	gen, err := c.pollDelta(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gen != 42 {
+		t.Errorf("generation = %d, want 42", gen)
+	}
+	if c.cache.len() != 0 {
+		t.Errorf("cache has %d entries after resync, want 0", c.cache.len())
+	}
+}
+
+func TestPollDelta_ErrorsKeepGeneration(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr error
+	}{
+		{"old server", http.StatusNotFound, errDeltaUnsupported},
+		{"loading", http.StatusServiceUnavailable, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+			gen, err := c.pollDelta(5)
+			if err == nil || gen != 5 {
+				t.Fatalf("pollDelta() = %d, %v; want 5 and an error", gen, err)
+			}
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errModerationUnsupported means the server predates GET /moderation or has
+// no override store.
+var errModerationUnsupported = errors.New("whitelist server has no /moderation endpoint")
+
+// moderation is one /moderation snapshot: the event ids and kinds the relay
+// operator has banned through NIP-86.
+type moderation struct {
+	etag   string
+	events map[string]struct{}
+	kinds  map[int]struct{}
+}
+
+type moderationResponse struct {
+	BannedEvents    []string `json:"banned_events"`
+	DisallowedKinds []int    `json:"disallowed_kinds"`
+}
+
+// BannedEvent reports whether the operator banned event id. False until the
+// first /moderation poll succeeds.
+func (c *WhitelistClient) BannedEvent(id string) bool {
+	m := c.moderation.Load()
+	if m == nil {
+		return false
+	}
+	_, ok := m.events[id]
+	return ok
+}
+
+// BannedKind reports whether the operator disallowed kind.
+func (c *WhitelistClient) BannedKind(kind int) bool {
+	m := c.moderation.Load()
+	if m == nil {
+		return false
+	}
+	_, ok := m.kinds[kind]
+	return ok
+}
+
+// WatchModeration polls the server's /moderation endpoint now and then every
+// interval, swapping in the operator's event and kind bans. A failed poll
+// keeps the last snapshot: bans are additive to the whitelist decision, so
+// serving a slightly stale list is better than dropping it.
+// Blocks until ctx is cancelled; returns immediately if interval <= 0 and
+// stops early if the server has no /moderation endpoint.
+func (c *WhitelistClient) WatchModeration(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		err := c.pollModeration()
+		switch {
+		case errors.Is(err, errModerationUnsupported):
+			c.logger.Printf("moderation watch disabled: %v", err)
+			return
+		case err != nil:
+			if !failing {
+				c.logger.Printf("moderation poll failed: %v", err)
+				failing = true
+			}
+		case failing:
+			c.logger.Printf("moderation poll recovered")
+			failing = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollModeration fetches /moderation, conditional on the current snapshot's
+// ETag, and swaps in the result.
+func (c *WhitelistClient) pollModeration() error {
+	req, err := http.NewRequest(http.MethodGet, c.serverURL+"/moderation", nil)
+	if err != nil {
+		return err
+	}
+	cur := c.moderation.Load()
+	if cur != nil {
+		req.Header.Set("If-None-Match", cur.etag)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("whitelist server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errModerationUnsupported
+	default:
+		return fmt.Errorf("whitelist server returned %d", resp.StatusCode)
+	}
+
+	var body moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode moderation response: %w", err)
+	}
+	next := &moderation{
+		etag:   resp.Header.Get("ETag"),
+		events: make(map[string]struct{}, len(body.BannedEvents)),
+		kinds:  make(map[int]struct{}, len(body.DisallowedKinds)),
+	}
+	for _, id := range body.BannedEvents {
+		next.events[id] = struct{}{}
+	}
+	for _, k := range body.DisallowedKinds {
+		next.kinds[k] = struct{}{}
+	}
+	if cur == nil || len(cur.events) != len(next.events) || len(cur.kinds) != len(next.kinds) {
+		c.logger.Printf("moderation: %d banned events, %d disallowed kinds", len(next.events), len(next.kinds))
+	}
+	c.moderation.Store(next)
+	return nil
+}
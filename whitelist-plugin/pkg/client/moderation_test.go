@@ -0,0 +1,61 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPollModeration(t *testing.T) {
+	polls, fail := 0, false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"banned_events": ["ee"], "disallowed_kinds": [4]}`))
+	}))
+	defer ts.Close()
+
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	if c.BannedEvent("ee") || c.BannedKind(4) {
+		t.Fatal("bans reported before the first poll")
+	}
+	if err := c.pollModeration(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if !c.BannedEvent("ee") || !c.BannedKind(4) || c.BannedEvent("ff") || c.BannedKind(1) {
+		t.Error("snapshot does not match the server's bans")
+	}
+
+	// 304 and a failing server both keep the snapshot.
+	if err := c.pollModeration(); err != nil {
+		t.Fatalf("conditional poll: %v", err)
+	}
+	fail = true
+	if err := c.pollModeration(); err == nil {
+		t.Fatal("expected an error from a 502")
+	}
+	if !c.BannedEvent("ee") || polls != 3 {
+		t.Errorf("snapshot lost after 304/502 (polls=%d)", polls)
+	}
+}
+
+func TestPollModeration_Unsupported(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	c := NewWhitelistClient(ts.URL, 2*time.Second, log.New(os.Stderr, "[test] ", 0))
+	if err := c.pollModeration(); !errors.Is(err, errModerationUnsupported) {
+		t.Fatalf("err = %v, want errModerationUnsupported", err)
+	}
+}
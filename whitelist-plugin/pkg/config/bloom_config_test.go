@@ -41,6 +41,37 @@ func TestLoadBloomConfigDefaults(t *testing.T) {
 		t.Errorf("RefreshRetryCount = %d; want %d", cfg.RefreshRetryCount, 3)
 	}
 
+	// BloomChangeStream default: true
+	if !cfg.BloomChangeStream {
+		t.Error("BloomChangeStream = false; want true")
+	}
+
+	// BloomMetricsAddr default: "" (no metrics listener)
+	if cfg.BloomMetricsAddr != "" {
+		t.Errorf("BloomMetricsAddr = %q; want \"\"", cfg.BloomMetricsAddr)
+	}
+
+	// BloomPipelineWorkers default: 4
+	if cfg.BloomPipelineWorkers != 4 {
+		t.Errorf("BloomPipelineWorkers = %d; want 4", cfg.BloomPipelineWorkers)
+	}
+
+	// BloomRecord default: no recording, 64 MiB x 5 files once enabled
+	if cfg.BloomRecord != (RecordConfig{MaxSize: 64 << 20, MaxFiles: 5}) {
+		t.Errorf("BloomRecord = %+v; want no path, 64 MiB, 5 files", cfg.BloomRecord)
+	}
+
+	// Policy and moderation share the client plugin's keys and defaults.
+	if cfg.PolicyPath != filepath.Join(tmpHome, "deepfry", "policy.yaml") {
+		t.Errorf("PolicyPath = %q; want ~/deepfry/policy.yaml", cfg.PolicyPath)
+	}
+	if cfg.PolicyReloadInterval != 5*time.Second {
+		t.Errorf("PolicyReloadInterval = %v; want 5s", cfg.PolicyReloadInterval)
+	}
+	if cfg.ModerationInterval != 30*time.Second {
+		t.Errorf("ModerationInterval = %v; want 30s", cfg.ModerationInterval)
+	}
+
 	// BloomPath default: must end with "bloom.dfbf" and be under tmpHome/deepfry (D-03)
 	wantSuffix := "bloom.dfbf"
 	if !strings.HasSuffix(cfg.BloomPath, wantSuffix) {
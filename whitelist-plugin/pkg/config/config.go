@@ -14,6 +14,7 @@ import (
 type ServerConfig struct {
 	DgraphGraphQLURL  string        `mapstructure:"dgraph_graphql_url"`
 	RefreshInterval   time.Duration `mapstructure:"refresh_interval"`
+	DeltaInterval     time.Duration `mapstructure:"delta_interval"`
 	RefreshRetryCount int           `mapstructure:"refresh_retry_count"`
 	IdleConnTimeout   time.Duration `mapstructure:"idle_conn_timeout"`
 	HTTPTimeout       time.Duration `mapstructure:"http_timeout"`
@@ -21,12 +22,38 @@ type ServerConfig struct {
 	ServerListenAddr  string        `mapstructure:"server_listen_addr"`
 	Debug             bool          `mapstructure:"debug"`
 	BloomFPRate       float64       `mapstructure:"bloom_fp_rate"`
+	BloomFormat       string        `mapstructure:"bloom_format"`
+	OverridesPath     string        `mapstructure:"overrides_path"`
+	AdminToken        string        `mapstructure:"admin_token"`
+	NIP86URL          string        `mapstructure:"nip86_url"`
+	NIP86Admins       []string      `mapstructure:"nip86_admins"`
 }
 
+// Filter formats served on /bloom.
+const (
+	BloomFormatBloom  = "bloom"  // format version 1, rebuilt on every change
+	BloomFormatCuckoo = "cuckoo" // format version 2, patched in place
+)
+
 // ClientConfig is used by the thin whitelist plugin (cmd/whitelist).
 type ClientConfig struct {
-	ServerURL    string        `mapstructure:"server_url"`
-	CheckTimeout time.Duration `mapstructure:"check_timeout"`
+	ServerURL            string        `mapstructure:"server_url"`
+	CheckTimeout         time.Duration `mapstructure:"check_timeout"`
+	PolicyPath           string        `mapstructure:"policy_path"`
+	PolicyReloadInterval time.Duration `mapstructure:"policy_reload_interval"`
+	DeltaInterval        time.Duration `mapstructure:"delta_interval"`
+	ChangeStream         bool          `mapstructure:"change_stream"`
+	ModerationInterval   time.Duration `mapstructure:"moderation_interval"`
+	PipelineWorkers      int           `mapstructure:"pipeline_workers"` // 1 = one event at a time
+	Record               RecordConfig  `mapstructure:"record"`
+}
+
+// RecordConfig turns on a plugin's traffic recording (pkg/recorder). An empty
+// Path records nothing.
+type RecordConfig struct {
+	Path     string `mapstructure:"path"`
+	MaxSize  int64  `mapstructure:"max_size"`  // bytes per file before rotating
+	MaxFiles int    `mapstructure:"max_files"` // files kept, current one included
 }
 
 func LoadServerConfig() (*ServerConfig, error) {
@@ -43,6 +70,7 @@ func LoadServerConfig() (*ServerConfig, error) {
 
 	v.SetDefault("dgraph_graphql_url", "http://localhost:8080/graphql")
 	v.SetDefault("refresh_interval", "6h")
+	v.SetDefault("delta_interval", "30s")
 	v.SetDefault("refresh_retry_count", 3)
 	v.SetDefault("idle_conn_timeout", "90s")
 	v.SetDefault("http_timeout", "30s")
@@ -50,6 +78,11 @@ func LoadServerConfig() (*ServerConfig, error) {
 	v.SetDefault("server_listen_addr", ":8081")
 	v.SetDefault("debug", true)
 	v.SetDefault("bloom_fp_rate", 0.000001) // 1e-6 per D-09
+	v.SetDefault("bloom_format", BloomFormatBloom)
+	v.SetDefault("overrides_path", filepath.Join(configDir, "overrides.json"))
+	v.SetDefault("admin_token", "")
+	v.SetDefault("nip86_url", "")
+	v.SetDefault("nip86_admins", []string{})
 
 	if err := readConfig(v, configDir, "whitelist.yaml"); err != nil {
 		return nil, err
@@ -59,6 +92,12 @@ func LoadServerConfig() (*ServerConfig, error) {
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("unable to decode config: %w", err)
 	}
+	if cfg.BloomFormat != BloomFormatBloom && cfg.BloomFormat != BloomFormatCuckoo {
+		return nil, fmt.Errorf("bloom_format %q: want %q or %q", cfg.BloomFormat, BloomFormatBloom, BloomFormatCuckoo)
+	}
+	if len(cfg.NIP86Admins) > 0 && cfg.NIP86URL == "" {
+		return nil, fmt.Errorf("nip86_url is required when nip86_admins is set")
+	}
 
 	return &cfg, nil
 }
@@ -77,6 +116,15 @@ func LoadClientConfig() (*ClientConfig, error) {
 
 	v.SetDefault("server_url", "http://localhost:8081")
 	v.SetDefault("check_timeout", "2s")
+	v.SetDefault("policy_path", filepath.Join(configDir, "policy.yaml"))
+	v.SetDefault("policy_reload_interval", "5s")
+	v.SetDefault("delta_interval", "5s")
+	v.SetDefault("change_stream", true)
+	v.SetDefault("moderation_interval", "30s")
+	v.SetDefault("pipeline_workers", 64)
+	v.SetDefault("record.path", "")
+	v.SetDefault("record.max_size", 64<<20)
+	v.SetDefault("record.max_files", 5)
 
 	if err := readConfig(v, configDir, "whitelist.yaml"); err != nil {
 		return nil, err
@@ -98,6 +146,13 @@ type BloomConfig struct {
 	BloomPath            string        `mapstructure:"bloom_path"`
 	BloomFetchTimeout    time.Duration `mapstructure:"bloom_fetch_timeout"`
 	RefreshRetryCount    int           `mapstructure:"refresh_retry_count"`
+	BloomChangeStream    bool          `mapstructure:"bloom_change_stream"`
+	BloomMetricsAddr     string        `mapstructure:"bloom_metrics_addr"` // "" = no /metrics listener
+	BloomPipelineWorkers int           `mapstructure:"bloom_pipeline_workers"`
+	BloomRecord          RecordConfig  `mapstructure:"bloom_record"`
+	PolicyPath           string        `mapstructure:"policy_path"`
+	PolicyReloadInterval time.Duration `mapstructure:"policy_reload_interval"`
+	ModerationInterval   time.Duration `mapstructure:"moderation_interval"`
 }
 
 // LoadBloomConfig reads the shared ~/deepfry/whitelist.yaml and returns a BloomConfig.
@@ -120,6 +175,15 @@ func LoadBloomConfig() (*BloomConfig, error) {
 	v.SetDefault("bloom_path", filepath.Join(configDir, "bloom.dfbf")) // D-03
 	v.SetDefault("bloom_fetch_timeout", "30s")                     // D-03
 	v.SetDefault("refresh_retry_count", 3)                         // D-03
+	v.SetDefault("bloom_change_stream", true)
+	v.SetDefault("bloom_metrics_addr", "")
+	v.SetDefault("bloom_pipeline_workers", 4) // lookups are local; workers only overlap JSON decoding
+	v.SetDefault("bloom_record.path", "")
+	v.SetDefault("bloom_record.max_size", 64<<20)
+	v.SetDefault("bloom_record.max_files", 5)
+	v.SetDefault("policy_path", filepath.Join(configDir, "policy.yaml"))
+	v.SetDefault("policy_reload_interval", "5s")
+	v.SetDefault("moderation_interval", "30s")
 
 	if err := readConfig(v, configDir, "whitelist.yaml"); err != nil {
 		return nil, err
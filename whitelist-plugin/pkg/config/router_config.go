@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,17 +19,80 @@ func envKeyReplacer() *strings.Replacer {
 type QuarantineConfig struct {
 	Enabled         bool          `mapstructure:"enabled"`
 	RelayURL        string        `mapstructure:"relay_url"`
+	RelayURLs       []string      `mapstructure:"relay_urls"` // extra destinations, each with its own queue
 	BufferSize      int           `mapstructure:"buffer_size"`
+	MaxInflight     int           `mapstructure:"max_inflight"`
 	PublishTimeout  time.Duration `mapstructure:"publish_timeout"`
 	MetricsInterval time.Duration `mapstructure:"metrics_interval"`
+	SpoolDir        string        `mapstructure:"spool_dir"`       // "" = in-memory queue only
+	SpoolMaxBytes   int64         `mapstructure:"spool_max_bytes"` // spool size cap; events are dropped beyond it
+}
+
+// CaptureConfig limits how much of the non-whitelisted traffic the router
+// sends to quarantine. A rate of 0 disables that limit.
+type CaptureConfig struct {
+	SampleRate  float64 `mapstructure:"sample_rate"`  // fraction of events kept, 1 = all
+	PubkeyRate  float64 `mapstructure:"pubkey_rate"`  // events per second per pubkey
+	PubkeyBurst int     `mapstructure:"pubkey_burst"` // events a quiet pubkey may send at once
+	IPRate      float64 `mapstructure:"ip_rate"`      // events per second per source IP
+	IPBurst     int     `mapstructure:"ip_burst"`
+	MaxKeys     int     `mapstructure:"max_keys"` // pubkeys (and IPs) tracked at once
+}
+
+// DecisionsConfig controls the sidecar store recording why each event was
+// quarantined.
+type DecisionsConfig struct {
+	Path       string        `mapstructure:"path"`        // "" = no decision records
+	Addr       string        `mapstructure:"addr"`        // "" = no HTTP lookup
+	BufferSize int           `mapstructure:"buffer_size"` // records waiting to be written
+	Retention  time.Duration `mapstructure:"retention"`   // 0 = keep forever
+}
+
+// HeuristicsConfig configures the router's content heuristics chain. An event
+// is kept out of quarantine once the weights of the stages it trips reach
+// DropScore; below that it is quarantined, tagged with them.
+type HeuristicsConfig struct {
+	DropScore      float64              `mapstructure:"drop_score"` // 0 = tag only
+	FutureDated    HeuristicStageConfig `mapstructure:"future_dated"`
+	PoW            HeuristicStageConfig `mapstructure:"pow"`
+	Entropy        HeuristicStageConfig `mapstructure:"entropy"`
+	URLDensity     HeuristicStageConfig `mapstructure:"url_density"`
+	MentionDensity HeuristicStageConfig `mapstructure:"mention_density"`
+	Duplicate      HeuristicStageConfig `mapstructure:"duplicate"`
+	Signature      HeuristicStageConfig `mapstructure:"signature"`
+}
+
+// HeuristicStageConfig is one heuristics stage. Weight 0 disables it; the
+// other fields apply to the stages noted.
+type HeuristicStageConfig struct {
+	Weight        float64       `mapstructure:"weight"`
+	MaxSkew       time.Duration `mapstructure:"max_skew"`       // future_dated
+	MinDifficulty int           `mapstructure:"min_difficulty"` // pow
+	MinBits       float64       `mapstructure:"min_bits"`       // entropy
+	MinLength     int           `mapstructure:"min_length"`     // entropy, duplicate
+	MaxCount      int           `mapstructure:"max_count"`      // url_density, mention_density
+	MaxRatio      float64       `mapstructure:"max_ratio"`      // url_density, mention_density
+	Window        int           `mapstructure:"window"`         // duplicate
+	MaxDistance   int           `mapstructure:"max_distance"`   // duplicate
 }
 
 // RouterConfig is used by the router plugin (cmd/router).
 // It embeds the thin whitelist client config plus a quarantine section.
 type RouterConfig struct {
-	ServerURL    string           `mapstructure:"server_url"`
-	CheckTimeout time.Duration    `mapstructure:"check_timeout"`
-	Quarantine   QuarantineConfig `mapstructure:"quarantine"`
+	ServerURL            string           `mapstructure:"server_url"`
+	CheckTimeout         time.Duration    `mapstructure:"check_timeout"`
+	PolicyPath           string           `mapstructure:"policy_path"`
+	PolicyReloadInterval time.Duration    `mapstructure:"policy_reload_interval"`
+	DeltaInterval        time.Duration    `mapstructure:"delta_interval"`
+	ChangeStream         bool             `mapstructure:"change_stream"`
+	ModerationInterval   time.Duration    `mapstructure:"moderation_interval"`
+	MetricsAddr          string           `mapstructure:"metrics_addr"`     // "" = no /metrics listener
+	PipelineWorkers      int              `mapstructure:"pipeline_workers"` // 1 = one event at a time
+	Record               RecordConfig     `mapstructure:"record"`
+	Quarantine           QuarantineConfig `mapstructure:"quarantine"`
+	Capture              CaptureConfig    `mapstructure:"capture"`
+	Heuristics           HeuristicsConfig `mapstructure:"heuristics"`
+	Decisions            DecisionsConfig  `mapstructure:"decisions"`
 }
 
 // LoadRouterConfig loads ~/deepfry/router.yaml, applying defaults and env overrides.
@@ -47,11 +111,54 @@ func LoadRouterConfig() (*RouterConfig, error) {
 
 	v.SetDefault("server_url", "http://localhost:8081")
 	v.SetDefault("check_timeout", "2s")
+	v.SetDefault("policy_path", filepath.Join(configDir, "policy.yaml"))
+	v.SetDefault("policy_reload_interval", "5s")
+	v.SetDefault("delta_interval", "5s")
+	v.SetDefault("change_stream", true)
+	v.SetDefault("moderation_interval", "30s")
+	v.SetDefault("metrics_addr", "")
+	v.SetDefault("pipeline_workers", 64)
+	v.SetDefault("record.path", "")
+	v.SetDefault("record.max_size", 64<<20)
+	v.SetDefault("record.max_files", 5)
 	v.SetDefault("quarantine.enabled", true)
 	v.SetDefault("quarantine.relay_url", "ws://strfry-quarantine:7778")
+	v.SetDefault("quarantine.relay_urls", []string{})
 	v.SetDefault("quarantine.buffer_size", 10000)
+	v.SetDefault("quarantine.max_inflight", 16)
 	v.SetDefault("quarantine.publish_timeout", "5s")
 	v.SetDefault("quarantine.metrics_interval", "60s")
+	v.SetDefault("quarantine.spool_dir", "")
+	v.SetDefault("quarantine.spool_max_bytes", 1<<30)
+	v.SetDefault("capture.sample_rate", 1.0)
+	v.SetDefault("capture.pubkey_rate", 0.05)
+	v.SetDefault("capture.pubkey_burst", 20)
+	v.SetDefault("capture.ip_rate", 1.0)
+	v.SetDefault("capture.ip_burst", 200)
+	v.SetDefault("capture.max_keys", 100000)
+	v.SetDefault("heuristics.drop_score", 1.0)
+	v.SetDefault("heuristics.future_dated.weight", 1.0)
+	v.SetDefault("heuristics.future_dated.max_skew", "15m")
+	v.SetDefault("heuristics.pow.weight", 0.0)
+	v.SetDefault("heuristics.pow.min_difficulty", 0)
+	v.SetDefault("heuristics.entropy.weight", 0.5)
+	v.SetDefault("heuristics.entropy.min_bits", 2.0)
+	v.SetDefault("heuristics.entropy.min_length", 32)
+	v.SetDefault("heuristics.url_density.weight", 0.5)
+	v.SetDefault("heuristics.url_density.max_count", 10)
+	v.SetDefault("heuristics.url_density.max_ratio", 0.5)
+	v.SetDefault("heuristics.mention_density.weight", 0.5)
+	v.SetDefault("heuristics.mention_density.max_count", 10)
+	v.SetDefault("heuristics.mention_density.max_ratio", 0.5)
+	v.SetDefault("heuristics.duplicate.weight", 1.0)
+	v.SetDefault("heuristics.duplicate.window", 4096)
+	v.SetDefault("heuristics.duplicate.max_distance", 3)
+	v.SetDefault("heuristics.duplicate.min_length", 64)
+	v.SetDefault("heuristics.signature.weight", 0.0)
+	v.SetDefault("decisions.path", "")
+	v.SetDefault("decisions.addr", "")
+	v.SetDefault("decisions.buffer_size", 4096)
+	v.SetDefault("decisions.retention", "720h")
 
 	v.SetEnvPrefix("ROUTER")
 	v.AutomaticEnv()
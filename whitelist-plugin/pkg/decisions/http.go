@@ -0,0 +1,97 @@
+package decisions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"whitelist-plugin/pkg/httpserve"
+)
+
+// Page sizes for GET /decisions.
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// Handler serves the store read-only:
+//
+//	GET /decisions/{id}   one record, 404 if the event was never quarantined
+//	GET /decisions        records by decision time, oldest first; query
+//	                      parameters since and until (unix seconds), reason,
+//	                      flag and limit (default 100, at most 1000)
+func (s *Store) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /decisions/{id}", s.handleGet)
+	mux.HandleFunc("GET /decisions", s.handleList)
+	return mux
+}
+
+func (s *Store) handleGet(w http.ResponseWriter, r *http.Request) {
+	rec, ok, err := s.Get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "no decision recorded for this event", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, rec)
+}
+
+func (s *Store) handleList(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recs, err := s.List(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if recs == nil {
+		recs = []Record{}
+	}
+	writeJSON(w, recs)
+}
+
+func parseQuery(r *http.Request) (Query, error) {
+	v := r.URL.Query()
+	q := Query{Reason: v.Get("reason"), Flag: v.Get("flag"), Limit: DefaultListLimit}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := v.Get(p.name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return q, errors.New(p.name + " must be a unix timestamp")
+			}
+			*p.dst = time.Unix(n, 0)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = min(n, MaxListLimit)
+	}
+	return q, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Serve exposes Handler on addr until ctx is cancelled.
+func (s *Store) Serve(ctx context.Context, addr string, logger *log.Logger) error {
+	return httpserve.Serve(ctx, "Decision lookup", addr, s.Handler(), logger)
+}
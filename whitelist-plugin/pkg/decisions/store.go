@@ -0,0 +1,356 @@
+// Package decisions keeps a sidecar record of why the router quarantined each
+// event: when and from where StrFry received it, the heuristics flags and
+// score it carried, and the whitelist generation the decision was made
+// against. Records live in a small bbolt file keyed by event id, never in the
+// event itself, so the quarantine relay stores the event exactly as it was
+// signed. Review and rescue tooling reads them back over HTTP.
+package decisions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Defaults for Config.BufferSize and the batch written per transaction.
+const (
+	DefaultBufferSize = 4096
+	maxBatch          = 512
+)
+
+// pruneInterval is how often records past the retention are deleted.
+const pruneInterval = time.Hour
+
+var (
+	bucketRecords = []byte("records") // event id -> JSON Record
+	bucketByTime  = []byte("by_time") // big-endian DecidedAt + event id -> nil
+)
+
+// Reasons a Record is written for.
+const (
+	ReasonNotInWoT = "not_in_wot" // the heuristics path
+	ReasonPolicy   = "policy"     // a write policy quarantine rule
+)
+
+// Record is why one event was quarantined.
+type Record struct {
+	ID         string   `json:"id"`
+	Pubkey     string   `json:"pubkey"`
+	Kind       int      `json:"kind"`
+	ReceivedAt int64    `json:"receivedAt"` // StrFry's receipt time, unix seconds
+	DecidedAt  int64    `json:"decidedAt"`  // the router's clock, unix seconds
+	SourceType string   `json:"sourceType"`
+	SourceInfo string   `json:"sourceInfo,omitempty"`
+	Reason     string   `json:"reason"`
+	Rule       string   `json:"rule,omitempty"` // policy rule, for ReasonPolicy
+	Score      float64  `json:"score"`
+	Flags      []string `json:"flags,omitempty"`
+	Generation uint64   `json:"generation"` // 0 = not yet known
+}
+
+// Config controls where a Store keeps its records and for how long.
+type Config struct {
+	Path       string
+	BufferSize int           // records waiting to be written; more are dropped
+	Retention  time.Duration // records decided longer ago are pruned; 0 keeps them
+}
+
+// Store writes Records in the background and looks them up by event id or
+// decision time. A nil *Store records nothing. Safe for concurrent use.
+type Store struct {
+	db        *bolt.DB
+	logger    *log.Logger
+	retention time.Duration
+	now       func() time.Time
+
+	queue   chan Record
+	mu      sync.RWMutex // Add holds it to read closed, Close to set it
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// Open opens or creates the store at cfg.Path and starts its writer.
+func Open(cfg Config, logger *log.Logger) (*Store, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	db, err := bolt.Open(cfg.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open decision store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketRecords, bucketByTime} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init decision store: %w", err)
+	}
+	s := &Store{
+		db:        db,
+		logger:    logger,
+		retention: cfg.Retention,
+		now:       time.Now,
+		queue:     make(chan Record, cfg.BufferSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Add queues r to be written without blocking. It returns false if the store
+// is closed or its buffer is full; the decision has been made either way.
+func (s *Store) Add(r Record) bool {
+	if s == nil {
+		return false
+	}
+	// Under the lock, no record can be queued once Close has stopped the
+	// writer, after its final drain.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.queue <- r:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped returns how many records Add turned away because the buffer was
+// full.
+func (s *Store) Dropped() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// Close writes the records still queued and closes the file.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	s.prune()
+
+	batch := make([]Record, 0, maxBatch)
+	for {
+		select {
+		case r := <-s.queue:
+			batch = append(batch[:0], r)
+			batch = s.fill(batch)
+			s.write(batch)
+		case <-ticker.C:
+			s.prune()
+		case <-s.stop:
+			for {
+				batch = s.fill(batch[:0])
+				if len(batch) == 0 {
+					return
+				}
+				s.write(batch)
+			}
+		}
+	}
+}
+
+// fill appends whatever is already queued to batch, up to maxBatch.
+func (s *Store) fill(batch []Record) []Record {
+	for len(batch) < maxBatch {
+		select {
+		case r := <-s.queue:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (s *Store) write(batch []Record) {
+	if err := s.put(batch); err != nil {
+		s.logger.Printf("WARNING: decision store: %d records lost: %v", len(batch), err)
+	}
+}
+
+func (s *Store) put(batch []Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		records, byTime := tx.Bucket(bucketRecords), tx.Bucket(bucketByTime)
+		for _, r := range batch {
+			// An event quarantined twice keeps its latest record only.
+			if old := records.Get([]byte(r.ID)); old != nil {
+				var prev Record
+				if json.Unmarshal(old, &prev) == nil {
+					byTime.Delete(timeKey(prev.DecidedAt, prev.ID))
+				}
+			}
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := records.Put([]byte(r.ID), data); err != nil {
+				return err
+			}
+			if err := byTime.Put(timeKey(r.DecidedAt, r.ID), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) prune() {
+	if s.retention <= 0 {
+		return
+	}
+	n, err := s.Prune(s.now().Add(-s.retention))
+	switch {
+	case err != nil:
+		s.logger.Printf("WARNING: decision store prune: %v", err)
+	case n > 0:
+		s.logger.Printf("Decision store: pruned %d records older than %s", n, s.retention)
+	}
+}
+
+// Prune deletes the records decided before t and returns how many it deleted.
+func (s *Store) Prune(t time.Time) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		records, byTime := tx.Bucket(bucketRecords), tx.Bucket(bucketByTime)
+		end := timeKey(t.Unix(), "")
+		c := byTime.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.First() {
+			id := bytes.Clone(k[8:])
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			if err := records.Delete(id); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Get returns the record for an event id.
+func (s *Store) Get(id string) (Record, bool, error) {
+	var r Record
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketRecords).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &r)
+	})
+	return r, found, err
+}
+
+// Query selects records by decision time and content. Zero fields other than
+// Limit match everything.
+type Query struct {
+	Since  time.Time // decided at or after
+	Until  time.Time // decided before
+	Reason string
+	Flag   string // one of the record's heuristics flags
+	Limit  int
+}
+
+// ErrLimit is returned for a Query without a positive Limit.
+var ErrLimit = errors.New("query limit must be positive")
+
+// List returns up to q.Limit matching records, oldest decision first.
+func (s *Store) List(q Query) ([]Record, error) {
+	if q.Limit <= 0 {
+		return nil, ErrLimit
+	}
+	var out []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(bucketRecords)
+		c := tx.Bucket(bucketByTime).Cursor()
+		var start []byte
+		if !q.Since.IsZero() {
+			start = timeKey(q.Since.Unix(), "")
+		}
+		var end []byte
+		if !q.Until.IsZero() {
+			end = timeKey(q.Until.Unix(), "")
+		}
+		k, _ := c.First()
+		if start != nil {
+			k, _ = c.Seek(start)
+		}
+		for ; k != nil && len(out) < q.Limit; k, _ = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			var r Record
+			if err := json.Unmarshal(records.Get(k[8:]), &r); err != nil {
+				return fmt.Errorf("decode record %s: %w", k[8:], err)
+			}
+			if q.matches(r) {
+				out = append(out, r)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (q Query) matches(r Record) bool {
+	if q.Reason != "" && r.Reason != q.Reason {
+		return false
+	}
+	if q.Flag == "" {
+		return true
+	}
+	for _, f := range r.Flags {
+		if f == q.Flag {
+			return true
+		}
+	}
+	return false
+}
+
+// timeKey orders records by decision time, then id. Times before the epoch
+// sort first.
+func timeKey(unix int64, id string) []byte {
+	k := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(k, uint64(max(unix, 0)))
+	return append(k, id...)
+}
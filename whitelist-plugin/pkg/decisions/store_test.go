@@ -0,0 +1,230 @@
+package decisions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(Config{Path: path}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return s
+}
+
+// seed writes recs and reopens the store, so every record is on disk.
+func seed(t *testing.T, recs ...Record) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "decisions.db")
+	s := openStore(t, path)
+	for _, r := range recs {
+		if !s.Add(r) {
+			t.Fatalf("add %s refused", r.ID)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	s = openStore(t, path)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_AddGetSurvivesReopen(t *testing.T) {
+	want := Record{
+		ID: "e1", Pubkey: "pk", Kind: 1, ReceivedAt: 1700000000, DecidedAt: 1700000001,
+		SourceType: "IP4", SourceInfo: "1.2.3.4", Reason: ReasonNotInWoT,
+		Score: 0.5, Flags: []string{"low_entropy"}, Generation: 42,
+	}
+	s := seed(t, want)
+
+	got, ok, err := s.Get("e1")
+	if err != nil || !ok {
+		t.Fatalf("get: ok=%v err=%v", ok, err)
+	}
+	if got.Generation != 42 || got.SourceInfo != "1.2.3.4" || len(got.Flags) != 1 || got.Score != 0.5 {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if _, ok, _ := s.Get("missing"); ok {
+		t.Fatal("found a record that was never added")
+	}
+}
+
+func TestStore_ListFiltersByTimeReasonAndFlag(t *testing.T) {
+	s := seed(t,
+		Record{ID: "a", DecidedAt: 100, Reason: ReasonNotInWoT},
+		Record{ID: "b", DecidedAt: 200, Reason: ReasonPolicy, Rule: "dms"},
+		Record{ID: "c", DecidedAt: 300, Reason: ReasonNotInWoT, Flags: []string{"url_density"}},
+		Record{ID: "d", DecidedAt: 400, Reason: ReasonNotInWoT},
+	)
+	ids := func(q Query) string {
+		t.Helper()
+		recs, err := s.List(q)
+		if err != nil {
+			t.Fatalf("list %+v: %v", q, err)
+		}
+		out := ""
+		for _, r := range recs {
+			out += r.ID
+		}
+		return out
+	}
+
+	for _, tt := range []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"all", Query{Limit: 10}, "abcd"},
+		{"limit", Query{Limit: 2}, "ab"},
+		{"since", Query{Since: time.Unix(200, 0), Limit: 10}, "bcd"},
+		{"until", Query{Until: time.Unix(300, 0), Limit: 10}, "ab"},
+		{"reason", Query{Reason: ReasonNotInWoT, Limit: 10}, "acd"},
+		{"flag", Query{Flag: "url_density", Limit: 10}, "c"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.q); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := s.List(Query{}); err != ErrLimit {
+		t.Fatalf("zero limit: %v", err)
+	}
+}
+
+func TestStore_RequarantinedEventKeepsLatestRecord(t *testing.T) {
+	s := seed(t,
+		Record{ID: "a", DecidedAt: 100, Generation: 1},
+		Record{ID: "a", DecidedAt: 500, Generation: 2},
+	)
+	recs, err := s.List(Query{Limit: 10})
+	if err != nil || len(recs) != 1 || recs[0].Generation != 2 {
+		t.Fatalf("got %+v (err %v), want only the generation 2 record", recs, err)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s := seed(t,
+		Record{ID: "old", DecidedAt: 100},
+		Record{ID: "older", DecidedAt: 50},
+		Record{ID: "new", DecidedAt: 1000},
+	)
+	n, err := s.Prune(time.Unix(500, 0))
+	if err != nil || n != 2 {
+		t.Fatalf("pruned %d (err %v), want 2", n, err)
+	}
+	for id, want := range map[string]bool{"old": false, "older": false, "new": true} {
+		if _, ok, _ := s.Get(id); ok != want {
+			t.Errorf("%s present = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestStore_AddAfterCloseAndNil(t *testing.T) {
+	s := openStore(t, filepath.Join(t.TempDir(), "decisions.db"))
+	s.Close()
+	if s.Add(Record{ID: "a"}) {
+		t.Fatal("closed store accepted a record")
+	}
+	var nilStore *Store
+	if nilStore.Add(Record{ID: "a"}) || nilStore.Close() != nil {
+		t.Fatal("nil store should record nothing")
+	}
+}
+
+// Every record Add accepts is written, even when Close races with it.
+func TestStore_AddRacingClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.db")
+	s := openStore(t, path)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted []string
+		closed   atomic.Bool
+	)
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; !closed.Load(); i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				if s.Add(Record{ID: id, DecidedAt: time.Now().Unix()}) {
+					mu.Lock()
+					accepted = append(accepted, id)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	closed.Store(true)
+	wg.Wait()
+
+	s = openStore(t, path)
+	defer s.Close()
+	for _, id := range accepted {
+		if _, ok, err := s.Get(id); !ok || err != nil {
+			t.Fatalf("accepted record %s not written: ok=%v err=%v", id, ok, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := seed(t,
+		Record{ID: "a", DecidedAt: 100, Reason: ReasonNotInWoT, Generation: 7},
+		Record{ID: "b", DecidedAt: 200, Reason: ReasonPolicy, Rule: "dms"},
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	get := func(path string, v any) int {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var rec Record
+	if code := get("/decisions/a", &rec); code != http.StatusOK || rec.Generation != 7 {
+		t.Fatalf("GET /decisions/a = %d %+v", code, rec)
+	}
+	if code := get("/decisions/zz", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown id = %d, want 404", code)
+	}
+
+	var recs []Record
+	if code := get("/decisions?reason=policy", &recs); code != http.StatusOK || len(recs) != 1 || recs[0].Rule != "dms" {
+		t.Fatalf("list by reason = %d %+v", code, recs)
+	}
+	if code := get("/decisions?since=300", &recs); code != http.StatusOK || len(recs) != 0 {
+		t.Fatalf("empty list = %d %+v", code, recs)
+	}
+	for _, bad := range []string{"/decisions?since=yesterday", "/decisions?limit=0"} {
+		if code := get(bad, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", bad, code)
+		}
+	}
+}
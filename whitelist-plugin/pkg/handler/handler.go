@@ -1,9 +1,33 @@
 package handler
 
+import "whitelist-plugin/pkg/policy"
+
 type Checker interface {
 	IsWhitelisted(pubkey string) (bool, error)
 }
 
+// TierChecker is a Checker that also reports the pubkey's trust tier. Checkers
+// that do not implement it are treated as tier 1 for whitelisted pubkeys.
+type TierChecker interface {
+	CheckTier(pubkey string) (whitelisted bool, tier int, err error)
+}
+
+// CheckObserver is told of the whitelist answer an event's decision was
+// based on, from the goroutine deciding it.
+type CheckObserver func(eventID, pubkey string, whitelisted bool, tier int, err error)
+
+// Moderator reports the relay operator's event and kind bans (NIP-86
+// banevent / disallowkind), which reject an event before any other check.
+type Moderator interface {
+	BannedEvent(id string) bool
+	BannedKind(kind int) bool
+}
+
+// PolicyEvaluator is the subset of *policy.Engine the handlers depend on.
+type PolicyEvaluator interface {
+	Evaluate(in policy.Input) (policy.Decision, bool)
+}
+
 type IOAdapter interface {
 	Input(input []byte) (InputMsg, error)
 	Output(OutputMsg) ([]byte, error)
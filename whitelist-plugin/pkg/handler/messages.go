@@ -42,18 +42,27 @@ const (
 	RejectReasonMalformed    RejectReason = "rejected: malformed event"
 	RejectReasonInternal     RejectReason = "rejected: internal error"
 	RejectReasonCheckFailed  RejectReason = "rejected: whitelist check unavailable"
+	RejectReasonPolicy       RejectReason = "rejected: blocked by policy"
+	RejectReasonBannedEvent  RejectReason = "blocked: event banned by relay operator"
+	RejectReasonBannedKind   RejectReason = "blocked: kind not allowed by relay operator"
 )
 
+// Event is the subset of the posted event the whitelist plugin reads: id and
+// pubkey for the whitelist check, plus kind, tags and content for the write
+// policy.
 type Event struct {
-	ID     string `json:"id"`
-	Pubkey string `json:"pubkey"`
+	ID      string     `json:"id"`
+	Pubkey  string     `json:"pubkey"`
+	Kind    int        `json:"kind"`
+	Tags    [][]string `json:"tags"`
+	Content string     `json:"content"`
 }
 
 // InputMsg represents the input message structure for the Strfry plugin.
 // This is received as JSONL from the relay for new events.
 type InputMsg struct {
 	Type       string     `json:"type"`       // Currently always "new" (use EventType constant)
-	Event      Event      `json:"event"`      // The event object posted by the client (we only deserialize id and pubkey)
+	Event      Event      `json:"event"`      // The event object posted by the client (we skip created_at and sig)
 	ReceivedAt int64      `json:"receivedAt"` // Unix timestamp of when the event was received by the relay
 	SourceType SourceType `json:"sourceType"` // Channel source: one of the SourceType constants
 	SourceInfo string     `json:"sourceInfo"` // Specifics of the source, e.g., an IP address
@@ -121,6 +130,16 @@ func Reject(eventId string, reason RejectReason) OutputMsg {
 	}
 }
 
+// ShadowReject creates an OutputMsg that tells StrFry to report success to the
+// client while dropping the event.
+func ShadowReject(eventId string) OutputMsg {
+	return OutputMsg{
+		Id:     eventId,
+		Action: ActionShadowReject,
+		Msg:    "",
+	}
+}
+
 func RejectMalformed() OutputMsg {
 	return OutputMsg{
 		Id:     "",
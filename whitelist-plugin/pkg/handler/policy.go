@@ -0,0 +1,53 @@
+package handler
+
+import "whitelist-plugin/pkg/policy"
+
+// checkTier asks the checker for whitelist status and tier, falling back to
+// tier 1 for whitelisted pubkeys when the checker has no notion of tiers.
+func checkTier(c Checker, pubkey string) (bool, int, error) {
+	if tc, ok := c.(TierChecker); ok {
+		return tc.CheckTier(pubkey)
+	}
+	ok, err := c.IsWhitelisted(pubkey)
+	if ok {
+		return true, 1, err
+	}
+	return false, 0, err
+}
+
+// tagNames returns the name (first element) of every non-empty tag.
+func tagNames[T ~[]string](tags []T) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if len(t) > 0 {
+			names = append(names, t[0])
+		}
+	}
+	return names
+}
+
+// moderate checks the operator's bans, returning the reject reason and a
+// log reason for a banned event or kind.
+func moderate(m Moderator, id string, kind int) (RejectReason, string, bool) {
+	switch {
+	case m == nil:
+		return "", "", false
+	case m.BannedEvent(id):
+		return RejectReasonBannedEvent, "banned_event", true
+	case m.BannedKind(kind):
+		return RejectReasonBannedKind, "banned_kind", true
+	}
+	return "", "", false
+}
+
+// policyReject builds the mainline reject for a policy decision, using the
+// rule's message when it has one.
+func policyReject(eventId string, d policy.Decision) OutputMsg {
+	if d.Message != "" {
+		return Reject(eventId, RejectReason(d.Message))
+	}
+	return Reject(eventId, RejectReasonPolicy)
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"whitelist-plugin/pkg/policy"
+)
+
+// tierChecker implements TierChecker with a fixed pubkey → tier map; tier 0
+// means not whitelisted.
+type tierChecker struct {
+	tiers map[string]int
+	err   error
+}
+
+func (c *tierChecker) IsWhitelisted(pk string) (bool, error) {
+	ok, _, err := c.CheckTier(pk)
+	return ok, err
+}
+
+func (c *tierChecker) CheckTier(pk string) (bool, int, error) {
+	if c.err != nil {
+		return false, 0, c.err
+	}
+	tier := c.tiers[pk]
+	return tier > 0, tier, nil
+}
+
+func loadTestPolicy(t *testing.T) *policy.RuleSet {
+	t.Helper()
+	rs, err := policy.LoadFile("testdata/policy.yaml")
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	return rs
+}
+
+// TestRouterHandler_PolicyReplay runs the recorded StrFry input lines in
+// testdata/router_input.jsonl through the router with testdata/policy.yaml.
+func TestRouterHandler_PolicyReplay(t *testing.T) {
+	checker := &tierChecker{tiers: map[string]int{
+		strings.Repeat("a", 64): 3,
+		strings.Repeat("b", 64): 1,
+	}}
+	enq := &fakeEnqueuer{}
+	var buf bytes.Buffer
+	h := NewRouterHandler(checker, enq, true, log.New(&buf, "", 0))
+	h.SetPolicy(loadTestPolicy(t))
+
+	want := []struct {
+		action Action
+		msg    string
+		rule   string // "" = built-in decision
+	}{
+		{ActionAccept, "", "notes-trusted"},
+		{ActionShadowReject, "", "notes-low-tier"},
+		{ActionAccept, "", "metadata-any-tier"},
+		{ActionReject, string(RejectReasonPolicy), "stranger-replies"},
+		{ActionReject, string(RejectReasonPolicy), "stranger-long-form"},
+		{ActionReject, string(RejectReasonNotInWoT), ""},
+		{ActionReject, "rejected: content too large", "oversized"},
+		{ActionReject, string(RejectReasonNotInWoT), ""},
+	}
+
+	f, err := os.Open("testdata/router_input.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 128*1024), 1<<20)
+	i := 0
+	for ; sc.Scan(); i++ {
+		if i >= len(want) {
+			t.Fatalf("more input lines than expectations")
+		}
+		var in RouterInputMsg
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		buf.Reset()
+		out, err := h.Handle(in)
+		if err != nil {
+			t.Fatalf("line %d: unexpected error: %v", i+1, err)
+		}
+		w := want[i]
+		if out.Action != w.action || out.Msg != w.msg {
+			t.Errorf("line %d: got %s %q, want %s %q", i+1, out.Action, out.Msg, w.action, w.msg)
+		}
+		if w.rule != "" && !strings.Contains(buf.String(), "rule="+w.rule) {
+			t.Errorf("line %d: expected rule=%s in log, got %q", i+1, w.rule, buf.String())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) {
+		t.Fatalf("replayed %d lines, want %d", i, len(want))
+	}
+
+	// Both quarantine rules enqueue; the Sync long-form event falls through
+	// to heuristics, which keep it as well.
+	if len(enq.events) < 2 || enq.events[0].Kind != 1 || enq.events[1].Kind != 30023 {
+		t.Fatalf("unexpected quarantine enqueues: %+v", enq.events)
+	}
+}
+
+func TestRouterHandler_PolicyCheckErrorStillRejects(t *testing.T) {
+	checker := &tierChecker{err: errors.New("server unreachable")}
+	enq := &fakeEnqueuer{}
+	h := NewRouterHandler(checker, enq, true, log.New(&bytes.Buffer{}, "", 0))
+	rs, err := policy.Compile([]policy.Rule{{Name: "allow-all", Action: policy.ActionAccept}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(rs)
+
+	out, _ := h.Handle(wrapEvent(t, baseEvt("e1", "pk-any", 1)))
+	if out.Action != ActionReject || out.Msg != string(RejectReasonCheckFailed) {
+		t.Fatalf("expected check_failed reject, got %+v", out)
+	}
+}
+
+func TestRouterHandler_PolicyQuarantineDisabled(t *testing.T) {
+	checker := &tierChecker{}
+	enq := &fakeEnqueuer{}
+	var buf bytes.Buffer
+	h := NewRouterHandler(checker, enq, false, log.New(&buf, "", 0))
+	rs, err := policy.Compile([]policy.Rule{{Name: "q", Action: policy.ActionQuarantine}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(rs)
+
+	out, _ := h.Handle(wrapEvent(t, baseEvt("e2", "pk-stranger", 1)))
+	if out.Action != ActionReject {
+		t.Fatalf("expected reject, got %+v", out)
+	}
+	if len(enq.events) != 0 {
+		t.Fatalf("expected no enqueue with quarantine disabled, got %d", len(enq.events))
+	}
+	if !strings.Contains(buf.String(), "cause=quarantine_disabled") {
+		t.Fatalf("expected quarantine_disabled log, got %q", buf.String())
+	}
+}
+
+func TestCheckTier_FallsBackForPlainChecker(t *testing.T) {
+	c := &fakeChecker{allow: map[string]bool{"pk-ok": true}}
+	if ok, tier, err := checkTier(c, "pk-ok"); !ok || tier != 1 || err != nil {
+		t.Fatalf("whitelisted: got %v %d %v", ok, tier, err)
+	}
+	if ok, tier, err := checkTier(c, "pk-no"); ok || tier != 0 || err != nil {
+		t.Fatalf("not whitelisted: got %v %d %v", ok, tier, err)
+	}
+}
+
+// fakeModerator bans a fixed event id and kind.
+type fakeModerator struct {
+	event string
+	kind  int
+}
+
+func (m fakeModerator) BannedEvent(id string) bool { return id == m.event }
+func (m fakeModerator) BannedKind(kind int) bool   { return kind == m.kind }
+
+// TestHandlers_Moderation: operator bans reject before the whitelist check
+// (so even a check failure cannot hide them) and are never quarantined.
+func TestHandlers_Moderation(t *testing.T) {
+	mod := fakeModerator{event: "banned-evt", kind: 4}
+	checker := &tierChecker{err: errors.New("server unreachable")}
+	enq := &fakeEnqueuer{}
+	router := NewRouterHandler(checker, enq, true, log.New(&bytes.Buffer{}, "", 0))
+	router.SetModerator(mod)
+	wl := NewWhitelistHandler(checker, log.New(&bytes.Buffer{}, "", 0))
+	wl.SetModerator(mod)
+
+	tests := []struct {
+		id   string
+		kind int
+		msg  string
+	}{
+		{"banned-evt", 1, string(RejectReasonBannedEvent)},
+		{"other-evt", 4, string(RejectReasonBannedKind)},
+		{"other-evt", 1, string(RejectReasonCheckFailed)},
+	}
+	for _, tt := range tests {
+		out, _ := router.Handle(wrapEvent(t, baseEvt(tt.id, "pk-any", tt.kind)))
+		if out.Action != ActionReject || out.Msg != tt.msg {
+			t.Errorf("router %s/%d: got %s %q, want reject %q", tt.id, tt.kind, out.Action, out.Msg, tt.msg)
+		}
+		out, _ = wl.Handle(InputMsg{Event: Event{ID: tt.id, Pubkey: "pk-any", Kind: tt.kind}})
+		if out.Action != ActionReject || out.Msg != tt.msg {
+			t.Errorf("whitelist %s/%d: got %s %q, want reject %q", tt.id, tt.kind, out.Action, out.Msg, tt.msg)
+		}
+	}
+	if len(enq.events) != 0 {
+		t.Errorf("banned events quarantined: %d", len(enq.events))
+	}
+}
+
+// TestHandlers_OnCheck: both handlers report the answer each event's decision
+// used, under that event's id.
+func TestHandlers_OnCheck(t *testing.T) {
+	checker := &tierChecker{tiers: map[string]int{"pk-alice": 2}}
+	type seen struct {
+		id, pubkey string
+		ok         bool
+		tier       int
+	}
+	var got []seen
+	onCheck := func(id, pubkey string, ok bool, tier int, err error) {
+		got = append(got, seen{id, pubkey, ok, tier})
+	}
+	router := NewRouterHandler(checker, &fakeEnqueuer{}, false, log.New(&bytes.Buffer{}, "", 0))
+	router.SetOnCheck(onCheck)
+	wl := NewWhitelistHandler(checker, log.New(&bytes.Buffer{}, "", 0))
+	wl.SetOnCheck(onCheck)
+
+	router.Handle(wrapEvent(t, baseEvt("evt-1", "pk-alice", 1)))
+	wl.Handle(InputMsg{Event: Event{ID: "evt-2", Pubkey: "pk-bob", Kind: 1}})
+
+	want := []seen{{"evt-1", "pk-alice", true, 2}, {"evt-2", "pk-bob", false, 0}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("checks = %+v, want %+v", got, want)
+	}
+}
@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"whitelist-plugin/pkg/decisions"
 	"whitelist-plugin/pkg/heuristics"
+	"whitelist-plugin/pkg/policy"
+	"whitelist-plugin/pkg/verify"
 
 	"github.com/nbd-wtf/go-nostr"
 )
@@ -14,15 +20,50 @@ type EventEnqueuer interface {
 	Enqueue(evt nostr.Event) bool
 }
 
+// EventVerifier checks an event's id and signature. Implemented by
+// *verify.Verifier.
+type EventVerifier interface {
+	Verify(evt *nostr.Event) error
+}
+
+// CaptureLimiter decides whether a non-whitelisted event is sent to
+// quarantine at all, returning a decision code for logs and metrics.
+// Implemented by *capture.Limiter.
+type CaptureLimiter interface {
+	Allow(id, pubkey, sourceIP string) (bool, string)
+}
+
+// DecisionRecorder keeps the sidecar record of why an event was quarantined.
+// Implemented by *decisions.Store.
+type DecisionRecorder interface {
+	Add(r decisions.Record) bool
+}
+
 // RouterHandler implements the event routing logic described in quarantine/SPEC.md §6.5:
 //  1. Whitelisted pubkey → Accept (event lands in main StrFry).
 //  2. Non-whitelisted pubkey → run heuristics; if the event passes, fire-and-forget
 //     to the quarantine relay; always Reject so mainline rejects the write.
+//
+// When a write policy is set, its first matching rule overrides both steps.
+// A whitelist check failure still rejects before the policy is consulted, and
+// an operator-banned event or kind rejects before anything else, unquarantined.
 type RouterHandler struct {
 	checker           Checker
 	publisher         EventEnqueuer
 	logger            *log.Logger
 	quarantineEnabled bool
+	policy            PolicyEvaluator
+	mod               Moderator
+	onCheck           CheckObserver
+	onDrop            func(reason string)
+	chain             *heuristics.Chain
+	onFlag            func(reason string)
+	verifier          EventVerifier
+	onVerifyFailure   func(reason string)
+	limiter           CaptureLimiter
+	onCapture         func(decision string)
+	decisions         DecisionRecorder
+	generation        func() uint64
 }
 
 func NewRouterHandler(checker Checker, publisher EventEnqueuer, quarantineEnabled bool, logger *log.Logger) *RouterHandler {
@@ -34,6 +75,80 @@ func NewRouterHandler(checker Checker, publisher EventEnqueuer, quarantineEnable
 	}
 }
 
+// SetPolicy installs the write policy. Must be called before the event loop
+// starts; the evaluator itself may hot-swap its rules.
+func (h *RouterHandler) SetPolicy(p PolicyEvaluator) {
+	h.policy = p
+}
+
+// SetModerator installs the operator's event and kind bans. Must be called
+// before the event loop starts.
+func (h *RouterHandler) SetModerator(m Moderator) {
+	h.mod = m
+}
+
+// SetOnCheck registers a callback that fires with every whitelist answer a
+// decision uses. Must be called before the event loop starts.
+func (h *RouterHandler) SetOnCheck(fn CheckObserver) {
+	h.onCheck = fn
+}
+
+// SetOnHeuristicsDrop registers a callback that fires with the heuristics
+// reason code whenever an event is kept out of quarantine by the heuristics
+// gate. Must be called before the event loop starts.
+func (h *RouterHandler) SetOnHeuristicsDrop(fn func(reason string)) {
+	h.onDrop = fn
+}
+
+// SetHeuristics installs the content heuristics chain run after the MVP gate.
+// Without one only heuristics.Filter applies. Must be called before the event
+// loop starts.
+func (h *RouterHandler) SetHeuristics(c *heuristics.Chain) {
+	h.chain = c
+}
+
+// SetOnHeuristicsFlag registers a callback that fires with each reason code a
+// heuristics chain stage flags, whether or not the event is then dropped.
+// Must be called before the event loop starts.
+func (h *RouterHandler) SetOnHeuristicsFlag(fn func(reason string)) {
+	h.onFlag = fn
+}
+
+// SetVerifier installs the id and signature check every event must pass
+// before it is quarantined. Must be called before the event loop starts.
+func (h *RouterHandler) SetVerifier(v EventVerifier) {
+	h.verifier = v
+}
+
+// SetOnVerifyFailure registers a callback that fires with verify.ReasonInvalidID
+// or verify.ReasonInvalidSignature for every event kept out of quarantine by
+// the verifier. Must be called before the event loop starts.
+func (h *RouterHandler) SetOnVerifyFailure(fn func(reason string)) {
+	h.onVerifyFailure = fn
+}
+
+// SetCaptureLimiter installs the sampling and rate limits applied to events
+// on their way to quarantine, whether sent by the heuristics path or by a
+// policy rule. Must be called before the event loop starts.
+func (h *RouterHandler) SetCaptureLimiter(l CaptureLimiter) {
+	h.limiter = l
+}
+
+// SetOnCaptureDecision registers a callback that fires with the limiter's
+// decision code for every event it is asked about. Must be called before the
+// event loop starts.
+func (h *RouterHandler) SetOnCaptureDecision(fn func(decision string)) {
+	h.onCapture = fn
+}
+
+// SetDecisionStore installs the store that records why each quarantined event
+// was quarantined. generation, if set, reports the whitelist generation the
+// decision was made against. Must be called before the event loop starts.
+func (h *RouterHandler) SetDecisionStore(d DecisionRecorder, generation func() uint64) {
+	h.decisions = d
+	h.generation = generation
+}
+
 // Handle applies the routing decision. Called once per stdin line.
 func (h *RouterHandler) Handle(input RouterInputMsg) (OutputMsg, error) {
 	evt, err := input.ParseFullEvent()
@@ -44,25 +159,58 @@ func (h *RouterHandler) Handle(input RouterInputMsg) (OutputMsg, error) {
 		return RejectMalformed(), nil
 	}
 
-	ok, checkErr := h.checker.IsWhitelisted(evt.PubKey)
+	if reason, logReason, banned := moderate(h.mod, evt.ID, evt.Kind); banned {
+		h.log("decision=reject id=%s pubkey=%s reason=%s quarantined=n", evt.ID, pubkeyPrefix(evt.PubKey), logReason)
+		return Reject(evt.ID, reason), nil
+	}
+
+	ok, tier, checkErr := checkTier(h.checker, evt.PubKey)
+	if h.onCheck != nil {
+		h.onCheck(evt.ID, evt.PubKey, ok, tier, checkErr)
+	}
 	if checkErr != nil {
 		h.log("decision=reject id=%s pubkey=%s reason=check_failed err=%v", evt.ID, pubkeyPrefix(evt.PubKey), checkErr)
 		return Reject(evt.ID, RejectReasonCheckFailed), nil
 	}
+
+	if h.policy != nil {
+		d, matched := h.policy.Evaluate(policy.Input{
+			Kind:         evt.Kind,
+			SourceType:   string(input.SourceType),
+			TagNames:     tagNames(evt.Tags),
+			ContentBytes: len(evt.Content),
+			Whitelisted:  ok,
+			Tier:         tier,
+		})
+		if matched {
+			return h.applyPolicy(evt, input, d), nil
+		}
+	}
+
 	if ok {
 		h.log("decision=accept id=%s pubkey=%s", evt.ID, pubkeyPrefix(evt.PubKey))
 		return Accept(evt.ID), nil
 	}
 
 	if h.quarantineEnabled && h.publisher != nil {
-		if res := heuristics.Filter(evt); res.Keep {
-			if h.publisher.Enqueue(evt) {
-				h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=y", evt.ID, pubkeyPrefix(evt.PubKey))
+		res := h.chain.Filter(evt)
+		if h.onFlag != nil {
+			for _, flag := range res.Flags {
+				h.onFlag(flag)
+			}
+		}
+		if res.Keep {
+			why := decisions.Record{Reason: decisions.ReasonNotInWoT, Score: res.Score, Flags: res.Flags}
+			if cause := h.capture(evt, input, why); cause == "" {
+				h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=y%s", evt.ID, pubkeyPrefix(evt.PubKey), flagsField(res))
 			} else {
-				h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=n cause=queue_full", evt.ID, pubkeyPrefix(evt.PubKey))
+				h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=n cause=%s%s", evt.ID, pubkeyPrefix(evt.PubKey), cause, flagsField(res))
 			}
 		} else {
-			h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=n cause=%s", evt.ID, pubkeyPrefix(evt.PubKey), res.Reason)
+			h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=n cause=%s%s", evt.ID, pubkeyPrefix(evt.PubKey), res.Reason, flagsField(res))
+			if h.onDrop != nil {
+				h.onDrop(res.Reason)
+			}
 		}
 	} else {
 		h.log("decision=reject id=%s pubkey=%s reason=not_in_wot quarantined=n cause=quarantine_disabled", evt.ID, pubkeyPrefix(evt.PubKey))
@@ -71,6 +219,96 @@ func (h *RouterHandler) Handle(input RouterInputMsg) (OutputMsg, error) {
 	return Reject(evt.ID, RejectReasonNotInWoT), nil
 }
 
+// applyPolicy maps a matched policy rule to the StrFry output. The quarantine
+// action enqueues without the heuristics gate: the rule has already chosen
+// which events are worth keeping.
+func (h *RouterHandler) applyPolicy(evt nostr.Event, input RouterInputMsg, d policy.Decision) OutputMsg {
+	switch d.Action {
+	case policy.ActionAccept:
+		h.log("decision=accept id=%s pubkey=%s reason=policy rule=%s", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule)
+		return Accept(evt.ID)
+	case policy.ActionShadowReject:
+		h.log("decision=shadowReject id=%s pubkey=%s reason=policy rule=%s", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule)
+		return ShadowReject(evt.ID)
+	case policy.ActionQuarantine:
+		if !h.quarantineEnabled || h.publisher == nil {
+			h.log("decision=reject id=%s pubkey=%s reason=policy rule=%s quarantined=n cause=quarantine_disabled", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule)
+		} else if cause := h.capture(evt, input, decisions.Record{Reason: decisions.ReasonPolicy, Rule: d.Rule}); cause == "" {
+			h.log("decision=reject id=%s pubkey=%s reason=policy rule=%s quarantined=y", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule)
+		} else {
+			h.log("decision=reject id=%s pubkey=%s reason=policy rule=%s quarantined=n cause=%s", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule, cause)
+		}
+		return policyReject(evt.ID, d)
+	default:
+		h.log("decision=reject id=%s pubkey=%s reason=policy rule=%s", evt.ID, pubkeyPrefix(evt.PubKey), d.Rule)
+		return policyReject(evt.ID, d)
+	}
+}
+
+// capture verifies the event, runs the capture limiter and enqueues the event
+// if both allow it, recording why alongside. It returns why the event was not
+// quarantined, or "" if it was. Forgeries are turned away before they can
+// spend rate-limit tokens.
+func (h *RouterHandler) capture(evt nostr.Event, input RouterInputMsg, why decisions.Record) string {
+	if h.verifier != nil {
+		if err := h.verifier.Verify(&evt); err != nil {
+			reason := verify.Reason(err)
+			if h.onVerifyFailure != nil {
+				h.onVerifyFailure(reason)
+			}
+			return reason
+		}
+	}
+	if h.limiter != nil {
+		ok, decision := h.limiter.Allow(evt.ID, evt.PubKey, sourceIP(input))
+		if h.onCapture != nil {
+			h.onCapture(decision)
+		}
+		if !ok {
+			return decision
+		}
+	}
+	if !h.publisher.Enqueue(evt) {
+		return "queue_full"
+	}
+	h.record(evt, input, why)
+	return ""
+}
+
+// record fills in why with the event's receipt details and the whitelist
+// generation and hands it to the decision store, if there is one.
+func (h *RouterHandler) record(evt nostr.Event, input RouterInputMsg, why decisions.Record) {
+	if h.decisions == nil {
+		return
+	}
+	why.ID, why.Pubkey, why.Kind = evt.ID, evt.PubKey, evt.Kind
+	why.ReceivedAt = input.ReceivedAt
+	why.DecidedAt = time.Now().Unix()
+	why.SourceType, why.SourceInfo = string(input.SourceType), input.SourceInfo
+	if h.generation != nil {
+		why.Generation = h.generation()
+	}
+	h.decisions.Add(why)
+}
+
+// flagsField formats the heuristics flags for a decision log line, or "" if
+// the event tripped none.
+func flagsField(res heuristics.Result) string {
+	if len(res.Flags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" flags=%s score=%g", strings.Join(res.Flags, ","), res.Score)
+}
+
+// sourceIP returns the client address of an event StrFry received over a
+// connection, or "" for imports, streams and syncs.
+func sourceIP(input RouterInputMsg) string {
+	if input.SourceType == SourceTypeIP4 || input.SourceType == SourceTypeIP6 {
+		return input.SourceInfo
+	}
+	return ""
+}
+
 func (h *RouterHandler) log(format string, args ...any) {
 	if h.logger != nil {
 		h.logger.Printf(format, args...)
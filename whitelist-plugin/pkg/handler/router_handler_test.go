@@ -8,6 +8,12 @@ import (
 	"strings"
 	"testing"
 
+	"whitelist-plugin/pkg/capture"
+	"whitelist-plugin/pkg/decisions"
+	"whitelist-plugin/pkg/heuristics"
+	"whitelist-plugin/pkg/policy"
+	"whitelist-plugin/pkg/verify"
+
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -39,6 +45,16 @@ func (f *fakeEnqueuer) Enqueue(evt nostr.Event) bool {
 	return true
 }
 
+// fakeRecorder keeps the decision records it is handed.
+type fakeRecorder struct {
+	records []decisions.Record
+}
+
+func (f *fakeRecorder) Add(r decisions.Record) bool {
+	f.records = append(f.records, r)
+	return true
+}
+
 func wrapEvent(t *testing.T, evt nostr.Event) RouterInputMsg {
 	t.Helper()
 	raw, err := json.Marshal(evt)
@@ -105,6 +121,8 @@ func TestRouterHandler_NonWhitelistedHeuristicDrop(t *testing.T) {
 	checker := &fakeChecker{allow: map[string]bool{}}
 	enq := &fakeEnqueuer{}
 	h := NewRouterHandler(checker, enq, true, log.New(&bytes.Buffer{}, "", 0))
+	var dropped []string
+	h.SetOnHeuristicsDrop(func(reason string) { dropped = append(dropped, reason) })
 
 	// Kind 7 (reaction) is not in the allowlist.
 	out, err := h.Handle(wrapEvent(t, baseEvt("e3", "pk-stranger", 7)))
@@ -117,6 +135,9 @@ func TestRouterHandler_NonWhitelistedHeuristicDrop(t *testing.T) {
 	if len(enq.events) != 0 {
 		t.Fatalf("expected no enqueue for disallowed kind, got %+v", enq.events)
 	}
+	if len(dropped) != 1 || dropped[0] != heuristics.ReasonKindNotAllowed {
+		t.Fatalf("expected one kind_not_allowed drop, got %v", dropped)
+	}
 }
 
 func TestRouterHandler_QuarantineDisabledStillRejects(t *testing.T) {
@@ -199,3 +220,137 @@ func TestRouterHandler_QueueFullLogs(t *testing.T) {
 		t.Fatalf("expected queue_full log, got %q", buf.String())
 	}
 }
+
+func TestRouterHandler_CaptureLimiter(t *testing.T) {
+	checker := &fakeChecker{allow: map[string]bool{}}
+	enq := &fakeEnqueuer{}
+	var buf bytes.Buffer
+	h := NewRouterHandler(checker, enq, true, log.New(&buf, "", 0))
+	h.SetCaptureLimiter(capture.New(capture.Config{PubkeyRate: 0.001, PubkeyBurst: 2}))
+	var decisions []string
+	h.SetOnCaptureDecision(func(d string) { decisions = append(decisions, d) })
+
+	for _, id := range []string{"f1", "f2", "f3"} {
+		if out, _ := h.Handle(wrapEvent(t, baseEvt(id, "pk-flood", 1))); out.Action != ActionReject {
+			t.Fatalf("expected reject for %s, got %+v", id, out)
+		}
+	}
+	if len(enq.events) != 2 {
+		t.Fatalf("expected the pubkey's burst of 2 enqueued, got %d", len(enq.events))
+	}
+	want := []string{capture.DecisionCaptured, capture.DecisionCaptured, capture.DecisionPubkeyRate}
+	if strings.Join(decisions, ",") != strings.Join(want, ",") {
+		t.Fatalf("decisions = %v, want %v", decisions, want)
+	}
+	if !strings.Contains(buf.String(), "quarantined=n cause=pubkey_rate_limited") {
+		t.Fatalf("expected rate-limit cause in log, got %q", buf.String())
+	}
+}
+
+func TestRouterHandler_HeuristicsChain(t *testing.T) {
+	checker := &fakeChecker{allow: map[string]bool{}}
+	enq := &fakeEnqueuer{}
+	var buf bytes.Buffer
+	h := NewRouterHandler(checker, enq, true, log.New(&buf, "", 0))
+	h.SetHeuristics(heuristics.NewChain(1).
+		Add(heuristics.NewEntropyStage(2, 8), 0.5).
+		Add(heuristics.NewPoWStage(4), 0.5))
+	var flags, dropped []string
+	h.SetOnHeuristicsFlag(func(reason string) { flags = append(flags, reason) })
+	h.SetOnHeuristicsDrop(func(reason string) { dropped = append(dropped, reason) })
+
+	// Low entropy alone is only a tag: quarantined, flagged.
+	tagged := baseEvt("0e1", "pk-stranger", 1)
+	tagged.Content = "aaaaaaaaaaaa"
+	h.Handle(wrapEvent(t, tagged))
+	if len(enq.events) != 1 || len(dropped) != 0 {
+		t.Fatalf("tagged event: enqueued %d, dropped %v", len(enq.events), dropped)
+	}
+	if !strings.Contains(buf.String(), "quarantined=y flags=low_entropy score=0.5") {
+		t.Fatalf("expected flags in log, got %q", buf.String())
+	}
+
+	// Both stages reach the drop score.
+	spam := baseEvt("fe2", "pk-stranger", 1)
+	spam.Content = "bbbbbbbbbbbb"
+	h.Handle(wrapEvent(t, spam))
+	if len(enq.events) != 1 {
+		t.Fatalf("spam was enqueued")
+	}
+	if len(dropped) != 1 || dropped[0] != heuristics.ReasonLowEntropy {
+		t.Fatalf("dropped = %v, want [low_entropy]", dropped)
+	}
+	if strings.Join(flags, ",") != "low_entropy,low_entropy,insufficient_pow" {
+		t.Fatalf("flags = %v", flags)
+	}
+}
+
+func TestRouterHandler_VerifierKeepsForgeriesOutOfQuarantine(t *testing.T) {
+	checker := &fakeChecker{allow: map[string]bool{}}
+	enq := &fakeEnqueuer{}
+	var buf bytes.Buffer
+	h := NewRouterHandler(checker, enq, true, log.New(&buf, "", 0))
+	h.SetVerifier(verify.NewVerifier(0))
+	var failures []string
+	h.SetOnVerifyFailure(func(reason string) { failures = append(failures, reason) })
+
+	good := nostr.Event{Kind: 1, Content: "hello", CreatedAt: 1700000000, Tags: nostr.Tags{}}
+	if err := good.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	forged := good
+	forged.Content = "send sats here"
+	forged.ID = forged.GetID()
+
+	for _, evt := range []nostr.Event{good, forged} {
+		if out, _ := h.Handle(wrapEvent(t, evt)); out.Action != ActionReject {
+			t.Fatalf("expected reject, got %+v", out)
+		}
+	}
+	if len(enq.events) != 1 || enq.events[0].ID != good.ID {
+		t.Fatalf("expected only the valid event quarantined, got %+v", enq.events)
+	}
+	if len(failures) != 1 || failures[0] != verify.ReasonInvalidSignature {
+		t.Fatalf("failures = %v, want [invalid_signature]", failures)
+	}
+	if !strings.Contains(buf.String(), "quarantined=n cause=invalid_signature") {
+		t.Fatalf("expected verify cause in log, got %q", buf.String())
+	}
+}
+
+func TestRouterHandler_DecisionStore(t *testing.T) {
+	checker := &fakeChecker{allow: map[string]bool{}}
+	enq := &fakeEnqueuer{}
+	h := NewRouterHandler(checker, enq, true, nil)
+	h.SetHeuristics(heuristics.NewChain(1).Add(heuristics.NewEntropyStage(2, 8), 0.5))
+	rec := &fakeRecorder{}
+	h.SetDecisionStore(rec, func() uint64 { return 42 })
+
+	tagged := baseEvt("d1", "pk-stranger", 1)
+	tagged.Content = "aaaaaaaaaaaa"
+	h.Handle(wrapEvent(t, tagged))
+	enq.full = true
+	h.Handle(wrapEvent(t, baseEvt("d2", "pk-stranger", 1)))
+
+	if len(rec.records) != 1 {
+		t.Fatalf("expected one record for the quarantined event, got %+v", rec.records)
+	}
+	r := rec.records[0]
+	if r.ID != "d1" || r.Pubkey != "pk-stranger" || r.Reason != decisions.ReasonNotInWoT ||
+		r.ReceivedAt != 1700000000 || r.SourceType != string(SourceTypeIP4) || r.SourceInfo != "127.0.0.1" ||
+		r.Score != 0.5 || len(r.Flags) != 1 || r.Flags[0] != heuristics.ReasonLowEntropy ||
+		r.Generation != 42 || r.DecidedAt == 0 {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	rs, err := policy.Compile([]policy.Rule{{Name: "q", Action: policy.ActionQuarantine}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(rs)
+	enq.full = false
+	h.Handle(wrapEvent(t, baseEvt("d3", "pk-stranger", 1)))
+	if len(rec.records) != 2 || rec.records[1].Reason != decisions.ReasonPolicy || rec.records[1].Rule != "q" {
+		t.Fatalf("expected a policy record for d3, got %+v", rec.records)
+	}
+}
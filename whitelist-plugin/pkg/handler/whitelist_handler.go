@@ -2,17 +2,40 @@ package handler
 
 import (
 	"log"
+
+	"whitelist-plugin/pkg/policy"
 )
 
 type WhitelistHandler struct {
 	checker Checker
 	logger  *log.Logger
+	policy  PolicyEvaluator
+	mod     Moderator
+	onCheck CheckObserver
 }
 
 func NewWhitelistHandler(checker Checker, logger *log.Logger) *WhitelistHandler {
 	return &WhitelistHandler{checker: checker, logger: logger}
 }
 
+// SetPolicy installs the write policy. Must be called before the event loop
+// starts; the evaluator itself may hot-swap its rules.
+func (h *WhitelistHandler) SetPolicy(p PolicyEvaluator) {
+	h.policy = p
+}
+
+// SetModerator installs the operator's event and kind bans. Must be called
+// before the event loop starts.
+func (h *WhitelistHandler) SetModerator(m Moderator) {
+	h.mod = m
+}
+
+// SetOnCheck registers a callback that fires with every whitelist answer a
+// decision uses. Must be called before the event loop starts.
+func (h *WhitelistHandler) SetOnCheck(fn CheckObserver) {
+	h.onCheck = fn
+}
+
 func (h *WhitelistHandler) Handle(input InputMsg) (OutputMsg, error) {
 	eventId, pubkey, err := input.ParseEvent()
 	if err != nil {
@@ -20,11 +43,34 @@ func (h *WhitelistHandler) Handle(input InputMsg) (OutputMsg, error) {
 		return RejectMalformed(), nil
 	}
 
-	ok, checkErr := h.checker.IsWhitelisted(pubkey)
+	if reason, logReason, banned := moderate(h.mod, eventId, input.Event.Kind); banned {
+		h.log("decision=reject id=%s pubkey=%s reason=%s", eventId, pubkeyPrefix(pubkey), logReason)
+		return Reject(eventId, reason), nil
+	}
+
+	ok, tier, checkErr := checkTier(h.checker, pubkey)
+	if h.onCheck != nil {
+		h.onCheck(eventId, pubkey, ok, tier, checkErr)
+	}
 	if checkErr != nil {
 		h.log("decision=reject id=%s pubkey=%s reason=check_failed err=%v", eventId, pubkeyPrefix(pubkey), checkErr)
 		return Reject(eventId, RejectReasonCheckFailed), nil
 	}
+
+	if h.policy != nil {
+		d, matched := h.policy.Evaluate(policy.Input{
+			Kind:         input.Event.Kind,
+			SourceType:   string(input.SourceType),
+			TagNames:     tagNames(input.Event.Tags),
+			ContentBytes: len(input.Event.Content),
+			Whitelisted:  ok,
+			Tier:         tier,
+		})
+		if matched {
+			return h.applyPolicy(eventId, pubkey, d), nil
+		}
+	}
+
 	if ok {
 		h.log("decision=accept id=%s pubkey=%s", eventId, pubkeyPrefix(pubkey))
 		return Accept(eventId), nil
@@ -33,6 +79,22 @@ func (h *WhitelistHandler) Handle(input InputMsg) (OutputMsg, error) {
 	return Reject(eventId, RejectReasonNotInWoT), nil
 }
 
+// applyPolicy maps a matched policy rule to the StrFry output. This plugin has
+// no quarantine path, so the quarantine action is a plain reject.
+func (h *WhitelistHandler) applyPolicy(eventId, pubkey string, d policy.Decision) OutputMsg {
+	switch d.Action {
+	case policy.ActionAccept:
+		h.log("decision=accept id=%s pubkey=%s reason=policy rule=%s", eventId, pubkeyPrefix(pubkey), d.Rule)
+		return Accept(eventId)
+	case policy.ActionShadowReject:
+		h.log("decision=shadowReject id=%s pubkey=%s reason=policy rule=%s", eventId, pubkeyPrefix(pubkey), d.Rule)
+		return ShadowReject(eventId)
+	default:
+		h.log("decision=reject id=%s pubkey=%s reason=policy rule=%s", eventId, pubkeyPrefix(pubkey), d.Rule)
+		return policyReject(eventId, d)
+	}
+}
+
 func (h *WhitelistHandler) log(format string, args ...any) {
 	if h.logger != nil {
 		h.logger.Printf(format, args...)
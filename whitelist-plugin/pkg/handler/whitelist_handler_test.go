@@ -7,6 +7,7 @@ import (
 	"log"
 	"testing"
 
+	"whitelist-plugin/pkg/policy"
 	"whitelist-plugin/pkg/whitelist"
 )
 
@@ -158,3 +159,38 @@ func TestWhitelistHandler_Handle(t *testing.T) {
 		}
 	})
 }
+
+func TestWhitelistHandler_Policy(t *testing.T) {
+	k := makeKey(0x04)
+	hexKey := hex.EncodeToString(k[:])
+	h := NewWhitelistHandler(whitelist.NewWhiteList([][32]byte{k}), log.New(&bytes.Buffer{}, "", 0))
+	rs, err := policy.Compile([]policy.Rule{
+		{Name: "no-dms", Kinds: []string{"4"}, Action: policy.ActionReject, Message: "rejected: DMs not accepted"},
+		{Name: "quiet-reactions", Kinds: []string{"7"}, Action: policy.ActionShadowReject},
+		{Name: "long-form", Kinds: []string{"30023"}, Action: policy.ActionQuarantine},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicy(rs)
+
+	tests := []struct {
+		kind   int
+		action Action
+		msg    string
+	}{
+		{1, ActionAccept, ""},
+		{4, ActionReject, "rejected: DMs not accepted"},
+		{7, ActionShadowReject, ""},
+		{30023, ActionReject, string(RejectReasonPolicy)},
+	}
+	for _, tt := range tests {
+		out, err := h.Handle(InputMsg{Event: Event{ID: "evt", Pubkey: hexKey, Kind: tt.kind}})
+		if err != nil {
+			t.Fatalf("kind %d: unexpected error: %v", tt.kind, err)
+		}
+		if out.Action != tt.action || out.Msg != tt.msg {
+			t.Errorf("kind %d: got %s %q, want %s %q", tt.kind, out.Action, out.Msg, tt.action, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package heuristics
+
+import "github.com/nbd-wtf/go-nostr"
+
+// Stage is one content check in a Chain. Check returns the stage's reason
+// code if evt trips it, or "" if it does not. Stages may be called
+// concurrently.
+type Stage interface {
+	Check(evt nostr.Event) string
+}
+
+// StageFunc adapts a plain function to Stage.
+type StageFunc func(evt nostr.Event) string
+
+// Check calls f.
+func (f StageFunc) Check(evt nostr.Event) string { return f(evt) }
+
+type weightedStage struct {
+	stage  Stage
+	weight float64
+}
+
+// Chain runs Filter and then its stages in order. An event that passes
+// Filter is dropped once the weights of the stages it trips reach dropScore;
+// below that it is kept, tagged with their reason codes. A nil *Chain is
+// Filter alone.
+type Chain struct {
+	stages    []weightedStage
+	dropScore float64
+}
+
+// NewChain returns an empty chain. dropScore <= 0 never drops on score, so
+// the stages only tag.
+func NewChain(dropScore float64) *Chain {
+	return &Chain{dropScore: dropScore}
+}
+
+// Add appends a stage with the given weight. A weight of 0 or less leaves the
+// stage out. Must be called before the chain is used.
+func (c *Chain) Add(s Stage, weight float64) *Chain {
+	if weight > 0 {
+		c.stages = append(c.stages, weightedStage{stage: s, weight: weight})
+	}
+	return c
+}
+
+// Len returns the number of stages after the MVP gate.
+func (c *Chain) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.stages)
+}
+
+// Filter applies the MVP gate, then every stage. Every stage runs, even once
+// the drop score is reached, so stateful ones such as the duplicate detector
+// see all traffic. A score drop reports the first tripped stage as Reason.
+func (c *Chain) Filter(evt nostr.Event) Result {
+	res := Filter(evt)
+	if c == nil || !res.Keep {
+		return res
+	}
+	for _, ws := range c.stages {
+		if reason := ws.stage.Check(evt); reason != "" {
+			res.Flags = append(res.Flags, reason)
+			res.Score += ws.weight
+		}
+	}
+	if c.dropScore > 0 && res.Score >= c.dropScore {
+		res.Keep = false
+		res.Reason = res.Flags[0]
+	}
+	return res
+}
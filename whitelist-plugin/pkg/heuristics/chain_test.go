@@ -0,0 +1,182 @@
+package heuristics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func fixed(reason string) Stage {
+	return StageFunc(func(nostr.Event) string { return reason })
+}
+
+func TestChain_ScoreAndDrop(t *testing.T) {
+	c := NewChain(1).
+		Add(fixed("a"), 0.5).
+		Add(fixed(""), 1).
+		Add(fixed("b"), 0). // weight 0: left out
+		Add(fixed("c"), 0.5)
+
+	res := c.Filter(baseEvent())
+	if res.Keep || res.Reason != "a" || res.Score != 1 {
+		t.Fatalf("got %+v, want drop with reason a at score 1", res)
+	}
+	if strings.Join(res.Flags, ",") != "a,c" {
+		t.Fatalf("flags = %v, want [a c]", res.Flags)
+	}
+}
+
+func TestChain_TagOnlyBelowDropScore(t *testing.T) {
+	res := NewChain(1).Add(fixed("a"), 0.5).Filter(baseEvent())
+	if !res.Keep || len(res.Flags) != 1 || res.Flags[0] != "a" {
+		t.Fatalf("got %+v, want kept and tagged a", res)
+	}
+	res = NewChain(0).Add(fixed("a"), 5).Filter(baseEvent())
+	if !res.Keep {
+		t.Fatalf("drop score 0 dropped %+v", res)
+	}
+}
+
+func TestChain_GateRunsFirst(t *testing.T) {
+	evt := baseEvent()
+	evt.Kind = 7
+	res := NewChain(1).Add(fixed("a"), 1).Filter(evt)
+	if res.Keep || res.Reason != ReasonKindNotAllowed || len(res.Flags) != 0 {
+		t.Fatalf("got %+v, want the MVP gate's kind drop", res)
+	}
+	var nilChain *Chain
+	if res := nilChain.Filter(evt); res.Keep || res.Reason != ReasonKindNotAllowed {
+		t.Fatalf("nil chain got %+v", res)
+	}
+}
+
+func TestDuplicateStage(t *testing.T) {
+	d := NewDuplicateStage(3, 3, 20)
+	spam := "Buy cheap followers now at the best price on the whole network today"
+	evt := func(id, content string) nostr.Event {
+		return nostr.Event{ID: id, PubKey: "pk", Kind: 1, Content: content}
+	}
+
+	if r := d.Check(evt("1", spam)); r != "" {
+		t.Fatalf("first sighting flagged %q", r)
+	}
+	if r := d.Check(evt("1", spam)); r != "" {
+		t.Fatalf("the same event again flagged %q", r)
+	}
+	if r := d.Check(evt("2", strings.ToUpper(spam)+"!")); r != ReasonDuplicateContent {
+		t.Fatalf("near copy = %q, want duplicate_content", r)
+	}
+	if r := d.Check(evt("3", "gm")); r != "" {
+		t.Fatalf("short content flagged %q", r)
+	}
+	if r := d.Check(evt("4", "A completely different note about mountains, rivers and long walks")); r != "" {
+		t.Fatalf("unrelated content flagged %q", r)
+	}
+
+	// Push the spam out of the 3-event window.
+	for i := range 3 {
+		d.Check(evt(fmt.Sprint("x", i), fmt.Sprintf("filler note number %d with some words of its own %d", i, i*7919)))
+	}
+	if r := d.Check(evt("5", spam)); r != "" {
+		t.Fatalf("copy outside the window flagged %q", r)
+	}
+}
+
+func TestDensityStages(t *testing.T) {
+	urls := NewURLDensityStage(5, 0.5)
+	mentions := NewMentionDensityStage(3, 0.5)
+	tests := []struct {
+		name  string
+		stage Stage
+		evt   nostr.Event
+		want  string
+	}{
+		{"one image", urls, nostr.Event{Kind: 1, Content: "https://img.example/a.png"}, ""},
+		{"link list", urls, nostr.Event{Kind: 1, Content: "https://a.io https://b.io https://c.io buy"}, ReasonURLDensity},
+		{"many links in prose", urls, nostr.Event{Kind: 1, Content: strings.Repeat("see https://x.io and more words here ", 6)}, ReasonURLDensity},
+		{"links in prose", urls, nostr.Event{Kind: 1, Content: "read https://a.io then https://b.io and https://c.io for the full story of it"}, ""},
+		{"mass mention", mentions, nostr.Event{Kind: 1, Content: "hey", Tags: nostr.Tags{{"p", "1"}, {"p", "2"}, {"p", "3"}, {"p", "4"}}}, ReasonMentionDensity},
+		{"contact list", mentions, nostr.Event{Kind: 3, Tags: nostr.Tags{{"p", "1"}, {"p", "2"}, {"p", "3"}, {"p", "4"}}}, ""},
+		{"inline mentions", mentions, nostr.Event{Kind: 1, Content: "nostr:npub1abc nostr:npub1def #[0]"}, ReasonMentionDensity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stage.Check(tt.evt); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntropyStage(t *testing.T) {
+	s := NewEntropyStage(2, 32)
+	if r := s.Check(nostr.Event{Content: strings.Repeat("a", 100)}); r != ReasonLowEntropy {
+		t.Fatalf("repeated char = %q", r)
+	}
+	if r := s.Check(nostr.Event{Content: strings.Repeat("ha", 50)}); r != ReasonLowEntropy {
+		t.Fatalf("repeated pattern = %q", r)
+	}
+	if r := s.Check(nostr.Event{Content: "aaaa"}); r != "" {
+		t.Fatalf("short content = %q", r)
+	}
+	if r := s.Check(nostr.Event{Content: "The quick brown fox jumps over the lazy dog, twice."}); r != "" {
+		t.Fatalf("prose = %q", r)
+	}
+}
+
+func TestSignatureStage(t *testing.T) {
+	evt := nostr.Event{Kind: 1, Content: "hello", CreatedAt: nostr.Now()}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if r := SignatureStage.Check(evt); r != "" {
+		t.Fatalf("valid event flagged %q", r)
+	}
+
+	tampered := evt
+	tampered.Content = "goodbye"
+	if r := SignatureStage.Check(tampered); r != ReasonInvalidID {
+		t.Fatalf("tampered content = %q, want invalid_id", r)
+	}
+	tampered.ID = tampered.GetID()
+	if r := SignatureStage.Check(tampered); r != ReasonInvalidSignature {
+		t.Fatalf("re-hashed without re-signing = %q, want invalid_signature", r)
+	}
+}
+
+func TestFutureStage(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewFutureStage(15*time.Minute, func() time.Time { return now })
+	if r := s.Check(nostr.Event{CreatedAt: nostr.Timestamp(now.Add(10 * time.Minute).Unix())}); r != "" {
+		t.Fatalf("within skew flagged %q", r)
+	}
+	if r := s.Check(nostr.Event{CreatedAt: nostr.Timestamp(now.Add(time.Hour).Unix())}); r != ReasonFutureCreatedAt {
+		t.Fatalf("an hour ahead = %q", r)
+	}
+}
+
+func TestDifficultyAndPoWStage(t *testing.T) {
+	for id, want := range map[string]int{
+		"ffff": 0,
+		"7fff": 1,
+		"0fff": 4,
+		"000000000e9d97a1ab09fc381030b346cdd7a142ad57e6df0b46dc9bef6c7e2d": 36,
+		"0000": 16,
+		"00zz": 8,
+		"":     0,
+	} {
+		if got := Difficulty(id); got != want {
+			t.Errorf("Difficulty(%q) = %d, want %d", id, got, want)
+		}
+	}
+	s := NewPoWStage(8)
+	if r := s.Check(nostr.Event{ID: "0fff"}); r != ReasonInsufficientPoW {
+		t.Fatalf("difficulty 4 = %q", r)
+	}
+	if r := s.Check(nostr.Event{ID: "00ff"}); r != "" {
+		t.Fatalf("difficulty 8 = %q", r)
+	}
+}
@@ -1,6 +1,10 @@
-// Package heuristics implements the MVP pre-quarantine garbage gate.
+// Package heuristics implements the pre-quarantine garbage gate.
 // It is NOT a spam classifier — its only job is to drop obvious junk so the
 // quarantine LMDB does not fill with noise. See quarantine/SPEC.md §6.3.
+//
+// Filter is the MVP gate. A Chain runs it and then a configurable list of
+// content stages (chain.go), tagging the event with each stage it trips and
+// dropping it once their weights add up to the chain's drop score.
 package heuristics
 
 import "github.com/nbd-wtf/go-nostr"
@@ -17,9 +21,13 @@ const (
 )
 
 // Result communicates the filter decision plus a reason for dropped events.
+// Flags lists the reason codes of every Chain stage the event tripped, kept or
+// not, and Score is the sum of their weights.
 type Result struct {
 	Keep   bool
 	Reason string
+	Score  float64
+	Flags  []string
 }
 
 // keep returns an accept result.
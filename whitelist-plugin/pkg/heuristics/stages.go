@@ -0,0 +1,278 @@
+package heuristics
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"whitelist-plugin/pkg/verify"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Reason codes of the Chain stages.
+const (
+	ReasonDuplicateContent = "duplicate_content"
+	ReasonURLDensity       = "url_density"
+	ReasonMentionDensity   = "mention_density"
+	ReasonLowEntropy       = "low_entropy"
+	ReasonInvalidID        = verify.ReasonInvalidID
+	ReasonInvalidSignature = verify.ReasonInvalidSignature
+	ReasonFutureCreatedAt  = "future_created_at"
+	ReasonInsufficientPoW  = "insufficient_pow"
+)
+
+// minDensityCount is how many links or mentions an event needs before the
+// density stages look at their ratio to words: a note that is just one image
+// URL is normal.
+const minDensityCount = 3
+
+// DuplicateStage flags events whose content is a near copy of one of the
+// last window events seen, comparing 64-bit simhashes by Hamming distance.
+// Content shorter than minLength bytes is ignored; short replies ("gm") are
+// duplicated legitimately all the time.
+type DuplicateStage struct {
+	maxDistance int
+	minLength   int
+
+	mu   sync.Mutex
+	ring []fingerprint
+	next int
+}
+
+type fingerprint struct {
+	hash uint64
+	id   string
+}
+
+// NewDuplicateStage returns a DuplicateStage remembering window events.
+func NewDuplicateStage(window, maxDistance, minLength int) *DuplicateStage {
+	if window < 1 {
+		window = 1
+	}
+	return &DuplicateStage{
+		maxDistance: maxDistance,
+		minLength:   minLength,
+		ring:        make([]fingerprint, 0, window),
+	}
+}
+
+// Check records evt's fingerprint and flags it if a different event in the
+// window is within maxDistance bits. The same event seen twice is not a
+// duplicate of itself.
+func (d *DuplicateStage) Check(evt nostr.Event) string {
+	if len(evt.Content) < d.minLength {
+		return ""
+	}
+	h := simhash(evt.Content)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dup := false
+	for _, fp := range d.ring {
+		if fp.id != evt.ID && bits.OnesCount64(fp.hash^h) <= d.maxDistance {
+			dup = true
+			break
+		}
+	}
+	if len(d.ring) < cap(d.ring) {
+		d.ring = append(d.ring, fingerprint{hash: h, id: evt.ID})
+	} else {
+		d.ring[d.next] = fingerprint{hash: h, id: evt.ID}
+		d.next = (d.next + 1) % len(d.ring)
+	}
+	if dup {
+		return ReasonDuplicateContent
+	}
+	return ""
+}
+
+// simhash is Charikar's simhash over the lower-cased words of s and their
+// bigrams, so reordering a few words moves only a few bits.
+func simhash(s string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var v [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		x := h.Sum64()
+		for i := range v {
+			if x&(1<<i) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+	for i, w := range words {
+		add(w)
+		if i > 0 {
+			add(words[i-1] + " " + w)
+		}
+	}
+	var out uint64
+	for i, n := range v {
+		if n > 0 {
+			out |= 1 << i
+		}
+	}
+	return out
+}
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://\S+`)
+	mentionPattern = regexp.MustCompile(`nostr:(?:npub1|nprofile1)[0-9a-z]+|#\[\d+\]`)
+)
+
+// densityStage flags an event with more than maxCount matches, or, from
+// minDensityCount matches up, more than maxRatio matches per word.
+type densityStage struct {
+	reason   string
+	count    func(evt nostr.Event) int
+	maxCount int
+	maxRatio float64
+}
+
+func (d densityStage) Check(evt nostr.Event) string {
+	n := d.count(evt)
+	if n == 0 {
+		return ""
+	}
+	if d.maxCount > 0 && n > d.maxCount {
+		return d.reason
+	}
+	words := len(strings.Fields(evt.Content))
+	if d.maxRatio > 0 && n >= minDensityCount && float64(n) > d.maxRatio*float64(max(words, 1)) {
+		return d.reason
+	}
+	return ""
+}
+
+// NewURLDensityStage flags events with more than maxCount links, or more
+// than maxRatio links per word.
+func NewURLDensityStage(maxCount int, maxRatio float64) Stage {
+	return densityStage{
+		reason:   ReasonURLDensity,
+		count:    func(evt nostr.Event) int { return len(urlPattern.FindAllStringIndex(evt.Content, -1)) },
+		maxCount: maxCount,
+		maxRatio: maxRatio,
+	}
+}
+
+// NewMentionDensityStage flags text notes with more than maxCount mentions,
+// or more than maxRatio mentions per word. Mentions are nostr: profile links
+// and legacy #[n] references in the content plus p tags. Only kind 1 is
+// checked: a contact list is nothing but p tags.
+func NewMentionDensityStage(maxCount int, maxRatio float64) Stage {
+	return densityStage{
+		reason: ReasonMentionDensity,
+		count: func(evt nostr.Event) int {
+			if evt.Kind != 1 {
+				return 0
+			}
+			n := len(mentionPattern.FindAllStringIndex(evt.Content, -1))
+			for _, tag := range evt.Tags {
+				if len(tag) >= 2 && tag[0] == "p" {
+					n++
+				}
+			}
+			return n
+		},
+		maxCount: maxCount,
+		maxRatio: maxRatio,
+	}
+}
+
+// NewEntropyStage flags content of at least minLength bytes whose Shannon
+// entropy over characters is below minBits per character, such as long runs
+// of one repeated character or a short pattern pasted over and over.
+func NewEntropyStage(minBits float64, minLength int) Stage {
+	return StageFunc(func(evt nostr.Event) string {
+		if len(evt.Content) < minLength || len(evt.Content) == 0 {
+			return ""
+		}
+		if charEntropy(evt.Content) < minBits {
+			return ReasonLowEntropy
+		}
+		return ""
+	})
+}
+
+func charEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// SignatureStage flags events whose id is not the hash of their contents or
+// whose signature does not verify against their pubkey. The router verifies
+// every event before quarantining it anyway; the stage only matters to count
+// forgeries as heuristics drops.
+var SignatureStage Stage = StageFunc(func(evt nostr.Event) string {
+	if err := verify.Event(&evt); err != nil {
+		return verify.Reason(err)
+	}
+	return ""
+})
+
+// NewFutureStage flags events dated more than maxSkew after now.
+func NewFutureStage(maxSkew time.Duration, now func() time.Time) Stage {
+	if now == nil {
+		now = time.Now
+	}
+	return StageFunc(func(evt nostr.Event) string {
+		if time.Unix(int64(evt.CreatedAt), 0).After(now().Add(maxSkew)) {
+			return ReasonFutureCreatedAt
+		}
+		return ""
+	})
+}
+
+// NewPoWStage flags events whose id has fewer than minDifficulty leading
+// zero bits (NIP-13).
+func NewPoWStage(minDifficulty int) Stage {
+	return StageFunc(func(evt nostr.Event) string {
+		if Difficulty(evt.ID) < minDifficulty {
+			return ReasonInsufficientPoW
+		}
+		return ""
+	})
+}
+
+// Difficulty returns the NIP-13 proof-of-work difficulty of a hex event id:
+// its number of leading zero bits.
+func Difficulty(id string) int {
+	n := 0
+	for _, c := range id {
+		var nibble int
+		switch {
+		case c >= '0' && c <= '9':
+			nibble = int(c - '0')
+		case c >= 'a' && c <= 'f':
+			nibble = int(c-'a') + 10
+		default:
+			return n
+		}
+		if nibble != 0 {
+			return n + bits.LeadingZeros8(uint8(nibble)) - 4
+		}
+		n += 4
+	}
+	return n
+}
@@ -0,0 +1,40 @@
+// Package httpserve runs the plugins' side listeners (metrics, decision
+// lookup): serve a handler until the context is cancelled, then shut down
+// gracefully.
+package httpserve
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout bounds how long in-flight requests get after cancel.
+const shutdownTimeout = 5 * time.Second
+
+// Serve serves h on addr until ctx is cancelled. name labels the startup log
+// line, e.g. "Metrics". It returns nil after a clean shutdown and the error
+// if the listener fails.
+func Serve(ctx context.Context, name, addr string, h http.Handler, logger *log.Logger) error {
+	srv := &http.Server{Addr: addr, Handler: h}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Printf("%s listening on %s", name, addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
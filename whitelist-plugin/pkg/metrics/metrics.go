@@ -0,0 +1,185 @@
+// Package metrics holds the StrFry plugins' Prometheus metrics and the
+// optional HTTP listener that exposes them. StrFry owns a plugin's stdin and
+// stdout, so /metrics is served on a separate address.
+package metrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"whitelist-plugin/pkg/decisions"
+	"whitelist-plugin/pkg/httpserve"
+	"whitelist-plugin/pkg/quarantine"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Plugin is one plugin's metrics registry. A nil *Plugin records nothing, so
+// the event loop does not need to care whether metrics are enabled.
+type Plugin struct {
+	registry  *prometheus.Registry
+	decisions *prometheus.CounterVec // action
+	latency   prometheus.Histogram
+	drops     *prometheus.CounterVec // reason
+	flags     *prometheus.CounterVec // reason
+	captures  *prometheus.CounterVec // decision
+	invalid   *prometheus.CounterVec // reason
+}
+
+// NewPlugin returns a registry whose metrics carry plugin=name.
+func NewPlugin(name string) *Plugin {
+	labels := prometheus.Labels{"plugin": name}
+	p := &Plugin{
+		registry: prometheus.NewRegistry(),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "plugin_decisions_total",
+			Help:        "Write policy decisions, by action (accept, reject, shadowReject, error).",
+			ConstLabels: labels,
+		}, []string{"action"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "plugin_decision_duration_seconds",
+			Help:        "Time to decide one event, whitelist and policy checks included.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.00005, 4, 10), // 50µs .. ~13s
+		}),
+		drops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "plugin_heuristics_drops_total",
+			Help:        "Non-whitelisted events kept out of quarantine by the heuristics gate, by reason.",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+		flags: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "plugin_heuristics_flags_total",
+			Help:        "Heuristics chain stages tripped by non-whitelisted events, dropped or not, by reason.",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+		captures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "plugin_capture_decisions_total",
+			Help:        "Quarantine capture sampling and rate-limit decisions, by decision.",
+			ConstLabels: labels,
+		}, []string{"decision"}),
+		invalid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "plugin_verify_failures_total",
+			Help:        "Events kept out of quarantine because their id or signature did not verify, by reason.",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+	}
+	p.registry.MustRegister(p.decisions, p.latency, p.drops, p.flags, p.captures, p.invalid)
+	return p
+}
+
+// ObserveDecision records one event's decision and how long it took.
+func (p *Plugin) ObserveDecision(action string, d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.decisions.WithLabelValues(action).Inc()
+	p.latency.Observe(d.Seconds())
+}
+
+// ObserveHeuristicsDrop records one heuristics drop. Its signature matches
+// RouterHandler.SetOnHeuristicsDrop.
+func (p *Plugin) ObserveHeuristicsDrop(reason string) {
+	if p == nil {
+		return
+	}
+	p.drops.WithLabelValues(reason).Inc()
+}
+
+// ObserveHeuristicsFlag records one tripped heuristics stage. Its signature
+// matches RouterHandler.SetOnHeuristicsFlag.
+func (p *Plugin) ObserveHeuristicsFlag(reason string) {
+	if p == nil {
+		return
+	}
+	p.flags.WithLabelValues(reason).Inc()
+}
+
+// ObserveCaptureDecision records one capture limiter decision. Its signature
+// matches RouterHandler.SetOnCaptureDecision.
+func (p *Plugin) ObserveCaptureDecision(decision string) {
+	if p == nil {
+		return
+	}
+	p.captures.WithLabelValues(decision).Inc()
+}
+
+// ObserveVerifyFailure records one event that failed verification. Its
+// signature matches RouterHandler.SetOnVerifyFailure.
+func (p *Plugin) ObserveVerifyFailure(reason string) {
+	if p == nil {
+		return
+	}
+	p.invalid.WithLabelValues(reason).Inc()
+}
+
+// RegisterPublisher exposes pub's counters, read from Publisher.Metrics at
+// scrape time, with one series per destination relay (label relay).
+func (p *Plugin) RegisterPublisher(pub *quarantine.Publisher) {
+	if p == nil {
+		return
+	}
+	for i, url := range pub.RelayURLs() {
+		labels := prometheus.Labels{"relay": url}
+		get := func() quarantine.DestinationMetrics { return pub.Metrics().Destinations[i] }
+		counter := func(name, help string, v func(quarantine.DestinationMetrics) uint64) prometheus.Collector {
+			return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels},
+				func() float64 { return float64(v(get())) })
+		}
+		gauge := func(name, help string, v func(quarantine.DestinationMetrics) int64) prometheus.Collector {
+			return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels},
+				func() float64 { return float64(v(get())) })
+		}
+		p.registry.MustRegister(
+			counter("quarantine_enqueued_total", "Events accepted into the quarantine queue.",
+				func(m quarantine.DestinationMetrics) uint64 { return m.Enqueued }),
+			counter("quarantine_dropped_total", "Events dropped because the quarantine queue or spool was full.",
+				func(m quarantine.DestinationMetrics) uint64 { return m.Dropped }),
+			counter("quarantine_published_total", "Events published to the quarantine relay.",
+				func(m quarantine.DestinationMetrics) uint64 { return m.Published }),
+			counter("quarantine_publish_errors_total", "Failed publishes to the quarantine relay.",
+				func(m quarantine.DestinationMetrics) uint64 { return m.PublishErrors }),
+			counter("quarantine_reconnects_total", "Reconnects to the quarantine relay.",
+				func(m quarantine.DestinationMetrics) uint64 { return m.ReconnectCount }),
+			gauge("quarantine_connected", "1 while the publisher holds a connection to the quarantine relay.",
+				func(m quarantine.DestinationMetrics) int64 {
+					if m.Connected {
+						return 1
+					}
+					return 0
+				}),
+			gauge("quarantine_inflight", "Publishes awaiting the quarantine relay's OK.",
+				func(m quarantine.DestinationMetrics) int64 { return m.Inflight }),
+			gauge("quarantine_spool_depth", "Spooled events not yet published to the quarantine relay.",
+				func(m quarantine.DestinationMetrics) int64 { return m.SpoolDepth }),
+			gauge("quarantine_spool_bytes", "Size of the quarantine spool on disk.",
+				func(m quarantine.DestinationMetrics) int64 { return m.SpoolBytes }),
+		)
+	}
+}
+
+// RegisterDecisionStore exposes how many decision records s turned away
+// because its write buffer was full.
+func (p *Plugin) RegisterDecisionStore(s *decisions.Store) {
+	if p == nil {
+		return
+	}
+	p.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "quarantine_decision_records_dropped_total",
+		Help: "Quarantine decision records not stored because the decision store's buffer was full.",
+	}, func() float64 { return float64(s.Dropped()) }))
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (p *Plugin) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// Serve exposes GET /metrics on addr until ctx is cancelled.
+func (p *Plugin) Serve(ctx context.Context, addr string, logger *log.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", p.Handler())
+	return httpserve.Serve(ctx, "Metrics", addr, mux, logger)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"whitelist-plugin/pkg/decisions"
+	"whitelist-plugin/pkg/quarantine"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func scrape(t *testing.T, p *Plugin) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestPlugin(t *testing.T) {
+	p := NewPlugin("router")
+	p.ObserveDecision("accept", time.Millisecond)
+	p.ObserveDecision("reject", time.Millisecond)
+	p.ObserveDecision("reject", time.Millisecond)
+	p.ObserveHeuristicsDrop("kind_not_allowed")
+	p.ObserveCaptureDecision("pubkey_rate_limited")
+	p.ObserveHeuristicsFlag("duplicate_content")
+	p.ObserveVerifyFailure("invalid_signature")
+
+	pub := quarantine.NewPublisher(quarantine.Config{
+		RelayURL:   "ws://127.0.0.1:1",
+		RelayURLs:  []string{"ws://127.0.0.1:2"},
+		BufferSize: 1,
+	}, log.New(os.Stderr, "[test] ", 0))
+	pub.Enqueue(nostr.Event{})
+	pub.Enqueue(nostr.Event{})
+	p.RegisterPublisher(pub)
+
+	store, err := decisions.Open(decisions.Config{Path: filepath.Join(t.TempDir(), "decisions.db")}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("open decision store: %v", err)
+	}
+	defer store.Close()
+	p.RegisterDecisionStore(store)
+
+	body := scrape(t, p)
+	for _, want := range []string{
+		`plugin_decisions_total{action="accept",plugin="router"} 1`,
+		`plugin_decisions_total{action="reject",plugin="router"} 2`,
+		`plugin_decision_duration_seconds_count{plugin="router"} 3`,
+		`plugin_heuristics_drops_total{plugin="router",reason="kind_not_allowed"} 1`,
+		`plugin_capture_decisions_total{decision="pubkey_rate_limited",plugin="router"} 1`,
+		`plugin_heuristics_flags_total{plugin="router",reason="duplicate_content"} 1`,
+		`plugin_verify_failures_total{plugin="router",reason="invalid_signature"} 1`,
+		`quarantine_enqueued_total{relay="ws://127.0.0.1:1"} 1`,
+		`quarantine_dropped_total{relay="ws://127.0.0.1:1"} 1`,
+		`quarantine_enqueued_total{relay="ws://127.0.0.1:2"} 1`,
+		`quarantine_connected{relay="ws://127.0.0.1:2"} 0`,
+		`quarantine_inflight{relay="ws://127.0.0.1:1"} 0`,
+		`quarantine_spool_depth{relay="ws://127.0.0.1:1"} 0`,
+		`quarantine_decision_records_dropped_total 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestPlugin_Nil(t *testing.T) {
+	var p *Plugin
+	p.ObserveDecision("accept", time.Millisecond)
+	p.ObserveHeuristicsDrop("kind_not_allowed")
+	p.ObserveCaptureDecision("captured")
+	p.ObserveHeuristicsFlag("low_entropy")
+	p.ObserveVerifyFailure("invalid_id")
+	p.RegisterPublisher(nil)
+	p.RegisterDecisionStore(nil)
+}
@@ -0,0 +1,92 @@
+// Package nip98 verifies NIP-98 HTTP Auth: an "Authorization: Nostr <base64>"
+// header carrying a kind 27235 event, signed by the caller, that binds one
+// request's absolute URL, method and body.
+package nip98
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Kind is the NIP-98 HTTP Auth event kind.
+const Kind = 27235
+
+// Window is how far an auth event's created_at may be from the server's clock.
+// NIP-98 suggests 60s; it is the only replay protection the scheme has.
+const Window = 60 * time.Second
+
+// maxHeaderBytes bounds the base64 event so a huge header is rejected before
+// it is decoded.
+const maxHeaderBytes = 16 << 10
+
+// ErrUnauthorized wraps every verification failure.
+var ErrUnauthorized = errors.New("nip98: unauthorized")
+
+// Verify checks an Authorization header value for a request with the given
+// method, absolute url and body, and returns the signer's hex pubkey.
+// A payload tag is required whenever body is non-empty.
+func Verify(header, method, url string, body []byte, now time.Time) (string, error) {
+	encoded, ok := strings.CutPrefix(header, "Nostr ")
+	if !ok {
+		return "", fmt.Errorf("%w: missing Nostr authorization", ErrUnauthorized)
+	}
+	if len(encoded) > maxHeaderBytes {
+		return "", fmt.Errorf("%w: authorization too large", ErrUnauthorized)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("%w: bad base64: %v", ErrUnauthorized, err)
+	}
+	var evt nostr.Event
+	if err := json.Unmarshal(raw, &evt); err != nil {
+		return "", fmt.Errorf("%w: bad event: %v", ErrUnauthorized, err)
+	}
+
+	if evt.Kind != Kind {
+		return "", fmt.Errorf("%w: kind %d, want %d", ErrUnauthorized, evt.Kind, Kind)
+	}
+	created := time.Unix(int64(evt.CreatedAt), 0)
+	if d := now.Sub(created); d > Window || d < -Window {
+		return "", fmt.Errorf("%w: created_at %s outside %s window", ErrUnauthorized, created.UTC().Format(time.RFC3339), Window)
+	}
+	if got := tagValue(evt.Tags, "u"); got != url {
+		return "", fmt.Errorf("%w: u tag %q, want %q", ErrUnauthorized, got, url)
+	}
+	if got := tagValue(evt.Tags, "method"); !strings.EqualFold(got, method) {
+		return "", fmt.Errorf("%w: method tag %q, want %q", ErrUnauthorized, got, method)
+	}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		if got := tagValue(evt.Tags, "payload"); !strings.EqualFold(got, hex.EncodeToString(sum[:])) {
+			return "", fmt.Errorf("%w: payload tag does not match body", ErrUnauthorized)
+		}
+	}
+
+	if !evt.CheckID() {
+		return "", fmt.Errorf("%w: event id does not match content", ErrUnauthorized)
+	}
+	if ok, err := evt.CheckSignature(); err != nil {
+		return "", fmt.Errorf("%w: bad signature: %v", ErrUnauthorized, err)
+	} else if !ok {
+		return "", fmt.Errorf("%w: bad signature", ErrUnauthorized)
+	}
+	return evt.PubKey, nil
+}
+
+// tagValue returns the value of the first tag named name, or "".
+func tagValue(tags nostr.Tags, name string) string {
+	for _, t := range tags {
+		if len(t) >= 2 && t[0] == name {
+			return t[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package nip98
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const testURL = "https://relay.example.com/"
+
+// authHeader signs a NIP-98 event with sk and encodes it as a header value.
+// edit, if set, mutates the event before signing.
+func authHeader(t *testing.T, sk string, body []byte, created time.Time, edit func(*nostr.Event)) string {
+	t.Helper()
+	sum := sha256.Sum256(body)
+	evt := nostr.Event{
+		Kind:      Kind,
+		CreatedAt: nostr.Timestamp(created.Unix()),
+		Tags: nostr.Tags{
+			{"u", testURL},
+			{"method", "POST"},
+			{"payload", hex.EncodeToString(sum[:])},
+		},
+	}
+	if edit != nil {
+		edit(&evt)
+	}
+	if err := evt.Sign(sk); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	raw, _ := json.Marshal(evt)
+	return "Nostr " + base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestVerify(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	body := []byte(`{"method":"supportedmethods","params":[]}`)
+	now := time.Now()
+
+	got, err := Verify(authHeader(t, sk, body, now, nil), "POST", testURL, body, now)
+	if err != nil || got != pk {
+		t.Fatalf("Verify = %q, %v; want %q", got, err, pk)
+	}
+
+	cases := map[string]struct {
+		header string
+		body   []byte
+	}{
+		"no header":   {"", body},
+		"basic auth":  {"Basic dXNlcjpwYXNz", body},
+		"bad base64":  {"Nostr !!!", body},
+		"stale":       {authHeader(t, sk, body, now.Add(-2*time.Minute), nil), body},
+		"future":      {authHeader(t, sk, body, now.Add(2*time.Minute), nil), body},
+		"other body":  {authHeader(t, sk, body, now, nil), []byte(`{"method":"banpubkey"}`)},
+		"wrong kind":  {authHeader(t, sk, body, now, func(e *nostr.Event) { e.Kind = 1 }), body},
+		"wrong url":   {authHeader(t, sk, body, now, func(e *nostr.Event) { e.Tags[0][1] = "https://evil.example/" }), body},
+		"wrong verb":  {authHeader(t, sk, body, now, func(e *nostr.Event) { e.Tags[1][1] = "GET" }), body},
+		"no payload":  {authHeader(t, sk, body, now, func(e *nostr.Event) { e.Tags = e.Tags[:2] }), body},
+		"tampered id": {tamper(t, authHeader(t, sk, body, now, nil)), body},
+	}
+	for name, tc := range cases {
+		if _, err := Verify(tc.header, "POST", testURL, tc.body, now); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: err = %v, want ErrUnauthorized", name, err)
+		}
+	}
+}
+
+// tamper re-encodes a signed header with its content changed after signing.
+func tamper(t *testing.T, header string) string {
+	t.Helper()
+	raw, _ := base64.StdEncoding.DecodeString(header[len("Nostr "):])
+	var evt nostr.Event
+	json.Unmarshal(raw, &evt)
+	evt.Content = "changed"
+	raw, _ = json.Marshal(evt)
+	return "Nostr " + base64.StdEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,317 @@
+// Package overrides is the whitelist server's operator override store: pubkeys
+// explicitly allowed or denied regardless of what the web-of-trust graph says,
+// plus the event and kind decisions made through the NIP-86 management API.
+//
+// Overrides are persisted as one JSON object, rewritten via temp+rename on
+// every change so a crash never leaves a torn file:
+//
+//	{"pubkeys": {"<pubkey>": {"action": "deny", "reason": "compromised key", "created": "2026-04-16T07:00:00Z"}},
+//	 "events":  {"<event id>": {"action": "deny", ...}},
+//	 "kinds":   {"4": {"action": "deny", ...}}}
+//
+// Files from before event and kind overrides, a flat {"<pubkey>": {...}} map,
+// are read as pubkey overrides and rewritten in the layout above on the first
+// change.
+//
+// The store only records intent. The refresher applies pubkey overrides on top
+// of every Dgraph load and, via Updated, as soon as one changes; the plugins
+// enforce event and kind overrides from the server's /moderation snapshot.
+package overrides
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is what an override does to a pubkey.
+type Action string
+
+const (
+	// Allow whitelists the pubkey at the top tier, as if hardcoded.
+	Allow Action = "allow"
+	// Deny removes the pubkey from the whitelist, including hardcoded keys.
+	Deny Action = "deny"
+)
+
+// Valid reports whether a is a known action.
+func (a Action) Valid() bool {
+	return a == Allow || a == Deny
+}
+
+// Override is one operator decision about a pubkey.
+type Override struct {
+	Action  Action    `json:"action"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// ErrInvalidPubkey is returned by ParsePubkey for anything but 64 hex chars.
+var ErrInvalidPubkey = errors.New("invalid pubkey: want 64 hex chars")
+
+// ParsePubkey decodes a 64-character hex pubkey. Event ids have the same
+// shape and are parsed with it too.
+func ParsePubkey(s string) ([32]byte, error) {
+	var k [32]byte
+	if len(s) != 64 {
+		return k, ErrInvalidPubkey
+	}
+	if _, err := hex.Decode(k[:], []byte(strings.ToLower(s))); err != nil {
+		return k, ErrInvalidPubkey
+	}
+	return k, nil
+}
+
+// Store is the persisted override set. It is safe for concurrent use.
+// The zero value is not valid; use Open.
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	state   state
+	updated chan struct{} // buffered 1; kicked after every change
+}
+
+// state is every override, replaced wholesale on each change.
+type state struct {
+	pubkeys map[[32]byte]Override
+	events  map[[32]byte]Override
+	kinds   map[int]Override
+}
+
+// file is the on-disk layout of a state.
+type file struct {
+	Pubkeys map[string]Override `json:"pubkeys"`
+	Events  map[string]Override `json:"events"`
+	Kinds   map[int]Override    `json:"kinds"`
+}
+
+func (st state) clone() state {
+	return state{
+		pubkeys: maps.Clone(st.pubkeys),
+		events:  maps.Clone(st.events),
+		kinds:   maps.Clone(st.kinds),
+	}
+}
+
+// Open loads the store persisted at path. A missing file is an empty store;
+// it is created on the first change.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		state: state{
+			pubkeys: make(map[[32]byte]Override),
+			events:  make(map[[32]byte]Override),
+			kinds:   make(map[int]Override),
+		},
+		updated: make(chan struct{}, 1),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read overrides %s: %w", path, err)
+	}
+	f, err := parseFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse overrides %s: %w", path, err)
+	}
+	if err := decodeKeyed(f.Pubkeys, s.state.pubkeys); err != nil {
+		return nil, fmt.Errorf("overrides %s: pubkeys: %w", path, err)
+	}
+	if err := decodeKeyed(f.Events, s.state.events); err != nil {
+		return nil, fmt.Errorf("overrides %s: events: %w", path, err)
+	}
+	for kind, o := range f.Kinds {
+		if !o.Action.Valid() {
+			return nil, fmt.Errorf("overrides %s: kind %d: unknown action %q", path, kind, o.Action)
+		}
+		s.state.kinds[kind] = o
+	}
+	return s, nil
+}
+
+// parseFile decodes data in either layout. Any top-level key other than
+// pubkeys, events and kinds means the flat pubkey map, whose keys
+// decodeKeyed then has to accept as pubkeys.
+func parseFile(data []byte) (file, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return file{}, err
+	}
+	var f file
+	for k := range top {
+		if k != "pubkeys" && k != "events" && k != "kinds" {
+			err := json.Unmarshal(data, &f.Pubkeys)
+			return f, err
+		}
+	}
+	err := json.Unmarshal(data, &f)
+	return f, err
+}
+
+// decodeKeyed validates raw's hex keys and actions into dst.
+func decodeKeyed(raw map[string]Override, dst map[[32]byte]Override) error {
+	for hk, o := range raw {
+		k, err := ParsePubkey(hk)
+		if err != nil {
+			return fmt.Errorf("%q: %w", hk, err)
+		}
+		if !o.Action.Valid() {
+			return fmt.Errorf("%s: unknown action %q", hk, o.Action)
+		}
+		dst[k] = o
+	}
+	return nil
+}
+
+// Updated returns a channel that receives after overrides change. Changes
+// made in quick succession may be coalesced into one receive.
+func (s *Store) Updated() <-chan struct{} {
+	return s.updated
+}
+
+// Get returns the override for pubkey pk, if any.
+func (s *Store) Get(pk [32]byte) (Override, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.state.pubkeys[pk]
+	return o, ok
+}
+
+// All returns a copy of every pubkey override.
+func (s *Store) All() map[[32]byte]Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.state.pubkeys)
+}
+
+// Set records o for pubkey pk, replacing any previous override, and persists
+// the store. Nothing changes if persisting fails.
+func (s *Store) Set(pk [32]byte, o Override) error {
+	return s.update(o, func(next state) { next.pubkeys[pk] = o })
+}
+
+// Delete removes the override for pubkey pk and persists the store, reporting
+// whether there was one.
+func (s *Store) Delete(pk [32]byte) (bool, error) {
+	return s.remove(func(st state) bool { _, ok := st.pubkeys[pk]; return ok },
+		func(next state) { delete(next.pubkeys, pk) })
+}
+
+// Events returns a copy of every event override, keyed by event id.
+func (s *Store) Events() map[[32]byte]Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.state.events)
+}
+
+// SetEvent records o for event id, replacing any previous override.
+func (s *Store) SetEvent(id [32]byte, o Override) error {
+	return s.update(o, func(next state) { next.events[id] = o })
+}
+
+// DeleteEvent removes the override for event id, reporting whether there was one.
+func (s *Store) DeleteEvent(id [32]byte) (bool, error) {
+	return s.remove(func(st state) bool { _, ok := st.events[id]; return ok },
+		func(next state) { delete(next.events, id) })
+}
+
+// Kinds returns a copy of every kind override.
+func (s *Store) Kinds() map[int]Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.state.kinds)
+}
+
+// SetKind records o for kind, replacing any previous override.
+func (s *Store) SetKind(kind int, o Override) error {
+	if kind < 0 {
+		return fmt.Errorf("invalid kind %d", kind)
+	}
+	return s.update(o, func(next state) { next.kinds[kind] = o })
+}
+
+// DeleteKind removes the override for kind, reporting whether there was one.
+func (s *Store) DeleteKind(kind int) (bool, error) {
+	return s.remove(func(st state) bool { _, ok := st.kinds[kind]; return ok },
+		func(next state) { delete(next.kinds, kind) })
+}
+
+// update validates o, applies set to a copy of the state and commits it.
+func (s *Store) update(o Override, set func(next state)) error {
+	if !o.Action.Valid() {
+		return fmt.Errorf("unknown action %q", o.Action)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.state.clone()
+	set(next)
+	return s.commit(next)
+}
+
+// remove commits the state with del applied if has reports an entry.
+func (s *Store) remove(has func(state) bool, del func(next state)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !has(s.state) {
+		return false, nil
+	}
+	next := s.state.clone()
+	del(next)
+	return true, s.commit(next)
+}
+
+// commit persists next and makes it current. s.mu must be held.
+func (s *Store) commit(next state) error {
+	f := file{
+		Pubkeys: encodeKeyed(next.pubkeys),
+		Events:  encodeKeyed(next.events),
+		Kinds:   next.kinds,
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode overrides: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.state = next
+	select {
+	case s.updated <- struct{}{}:
+	default: // a notification is already pending
+	}
+	return nil
+}
+
+func encodeKeyed(m map[[32]byte]Override) map[string]Override {
+	raw := make(map[string]Override, len(m))
+	for k, o := range m {
+		raw[hex.EncodeToString(k[:])] = o
+	}
+	return raw
+}
+
+// writeFileAtomic writes data to path via temp+rename in the same directory.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create overrides dir: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return fmt.Errorf("write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return fmt.Errorf("rename %s -> %s: %w", tmpPath, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package overrides
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "overrides.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(missing) = %v", err)
+	}
+	if len(s.All()) != 0 {
+		t.Fatal("new store not empty")
+	}
+
+	deny, allow := [32]byte{1}, [32]byte{2}
+	created := time.Date(2026, 4, 16, 7, 0, 0, 0, time.UTC)
+	if err := s.Set(deny, Override{Action: Deny, Reason: "compromised", Created: created}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set(allow, Override{Action: Allow, Created: created}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	select {
+	case <-s.Updated():
+	default:
+		t.Error("Set did not signal Updated")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if o, ok := reopened.Get(deny); !ok || o.Action != Deny || o.Reason != "compromised" || !o.Created.Equal(created) {
+		t.Errorf("reopened deny = %+v, %v", o, ok)
+	}
+
+	if ok, err := reopened.Delete(deny); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if ok, _ := reopened.Delete(deny); ok {
+		t.Error("second Delete reported an override")
+	}
+	again, _ := Open(path)
+	if _, ok := again.Get(deny); ok {
+		t.Error("deleted override came back after reopen")
+	}
+	if _, ok := again.Get(allow); !ok {
+		t.Error("allow override lost")
+	}
+}
+
+func TestStore_RejectsBadInput(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(filepath.Join(dir, "overrides.json"))
+	if err := s.Set([32]byte{1}, Override{Action: "block"}); err == nil {
+		t.Error("Set accepted an unknown action")
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"pubkeys": {"zz": {"action": "deny"}}}`), 0600)
+	if _, err := Open(bad); err == nil || !strings.Contains(err.Error(), "invalid pubkey") {
+		t.Errorf("Open(bad pubkey) = %v", err)
+	}
+	os.WriteFile(bad, []byte(`{"events": {"`+strings.Repeat("ab", 32)+`": {"action": "mute"}}}`), 0600)
+	if _, err := Open(bad); err == nil {
+		t.Error("Open accepted an unknown action")
+	}
+	if err := s.SetKind(-1, Override{Action: Deny}); err == nil {
+		t.Error("SetKind accepted a negative kind")
+	}
+}
+
+func TestStore_EventsAndKinds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	s, _ := Open(path)
+	id := [32]byte{9}
+	if err := s.SetEvent(id, Override{Action: Deny, Reason: "spam"}); err != nil {
+		t.Fatalf("SetEvent: %v", err)
+	}
+	if err := s.SetKind(4, Override{Action: Deny}); err != nil {
+		t.Fatalf("SetKind: %v", err)
+	}
+	if err := s.SetKind(1, Override{Action: Allow}); err != nil {
+		t.Fatalf("SetKind: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if o := reopened.Events()[id]; o.Action != Deny || o.Reason != "spam" {
+		t.Errorf("reopened event = %+v", o)
+	}
+	kinds := reopened.Kinds()
+	if len(kinds) != 2 || kinds[4].Action != Deny || kinds[1].Action != Allow {
+		t.Errorf("reopened kinds = %+v", kinds)
+	}
+	if len(reopened.All()) != 0 {
+		t.Error("event/kind overrides leaked into pubkeys")
+	}
+
+	if ok, err := reopened.DeleteKind(4); !ok || err != nil {
+		t.Fatalf("DeleteKind = %v, %v", ok, err)
+	}
+	if ok, _ := reopened.DeleteEvent([32]byte{8}); ok {
+		t.Error("DeleteEvent reported a missing override")
+	}
+	again, _ := Open(path)
+	if _, ok := again.Kinds()[4]; ok {
+		t.Error("deleted kind override came back after reopen")
+	}
+}
+
+func TestStore_MigratesFlatFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	pk := strings.Repeat("ab", 32)
+	old := `{"` + pk + `": {"action": "deny", "reason": "compromised", "created": "2026-04-16T07:00:00Z"}}`
+	if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(flat) = %v", err)
+	}
+	key, _ := ParsePubkey(pk)
+	if o, ok := s.Get(key); !ok || o.Action != Deny || o.Reason != "compromised" {
+		t.Fatalf("migrated override = %+v, %v", o, ok)
+	}
+
+	// The next change rewrites the file in the current layout.
+	if err := s.SetKind(4, Override{Action: Deny}); err != nil {
+		t.Fatalf("SetKind: %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if _, ok := reopened.Get(key); !ok {
+		t.Error("migrated override lost on rewrite")
+	}
+	if _, ok := reopened.Kinds()[4]; !ok {
+		t.Error("kind override lost on rewrite")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"nonsense": {"action": "deny"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Open accepted a non-pubkey top-level key")
+	}
+}
+
+func TestParsePubkey(t *testing.T) {
+	if _, err := ParsePubkey(strings.Repeat("AB", 32)); err != nil {
+		t.Errorf("uppercase hex rejected: %v", err)
+	}
+	for _, s := range []string{"", "abc", strings.Repeat("zz", 32)} {
+		if _, err := ParsePubkey(s); err != ErrInvalidPubkey {
+			t.Errorf("ParsePubkey(%q) = %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package pipeline runs a StrFry plugin's event loop. StrFry writes one JSONL
+// request per line and expects the responses in the same order; Run reads
+// ahead, decides up to workers requests at once, and writes each response as
+// soon as every earlier one has been written.
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+const (
+	initBuf = 64 * 1024
+	maxBuf  = 10 * 1024 * 1024
+)
+
+// readAhead is how many requests per worker may be read before the oldest
+// one's response is written.
+const readAhead = 4
+
+// Process turns one request line into its response line. It must be safe for
+// concurrent use when Run is given more than one worker.
+type Process func(line []byte) []byte
+
+// Written is told of each request line and its response once the response
+// has been written, in input order and from one goroutine, so it can keep a
+// log that matches what StrFry saw.
+type Written func(line, resp []byte)
+
+type job struct {
+	line []byte
+	out  chan []byte
+}
+
+// Run feeds lines from r through process on workers goroutines and writes the
+// responses to w in input order. It returns nil on EOF or when ctx is
+// cancelled, and the error if reading r or writing w fails. With one worker it
+// behaves like a sequential read-decide-write loop. written may be nil.
+func Run(ctx context.Context, r io.Reader, w io.Writer, workers int, process Process, written Written) error {
+	workers = max(workers, 1)
+	jobs := make(chan job)
+	pending := make(chan job, workers*readAhead) // in input order
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, initBuf), maxBuf)
+		for scanner.Scan() {
+			j := job{line: append([]byte(nil), scanner.Bytes()...), out: make(chan []byte, 1)}
+			select {
+			case pending <- j:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			readErr <- err
+		}
+	}()
+
+	for range workers {
+		go func() {
+			for j := range jobs {
+				j.out <- process(j.line)
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case j, ok := <-pending:
+			if !ok {
+				select {
+				case err := <-readErr:
+					return err
+				default:
+					return nil
+				}
+			}
+			var resp []byte
+			select {
+			case resp = <-j.out:
+			case <-ctx.Done():
+				return nil
+			}
+			if _, err := w.Write(resp); err != nil {
+				return err
+			}
+			if written != nil {
+				written(j.line, resp)
+			}
+		}
+	}
+}
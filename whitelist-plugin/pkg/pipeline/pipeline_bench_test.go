@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"whitelist-plugin/pkg/client"
+	"whitelist-plugin/pkg/handler"
+	"whitelist-plugin/pkg/server"
+	"whitelist-plugin/pkg/whitelist"
+)
+
+// benchRelays is how many upstream relays stream events into the benchmark
+// plugin, interleaved the way StrFry's router feeds them.
+const benchRelays = 24
+
+// benchRTT is the simulated round trip to the whitelist server.
+const benchRTT = time.Millisecond
+
+// relayStream builds n StrFry requests from benchRelays relays. Every event
+// has a distinct author, so each one misses the plugin's cache; every other
+// author is whitelisted.
+func relayStream(n int) ([]byte, [][32]byte) {
+	var buf bytes.Buffer
+	var keys [][32]byte
+	for i := range n {
+		var pk [32]byte
+		binary.BigEndian.PutUint64(pk[:], uint64(i+1))
+		if i%2 == 0 {
+			keys = append(keys, pk)
+		}
+		line, _ := handler.SerializeInputMsg(handler.InputMsg{
+			Type: "new",
+			Event: handler.Event{
+				ID:     fmt.Sprintf("%064x", i),
+				Pubkey: hex.EncodeToString(pk[:]),
+				Kind:   1,
+			},
+			ReceivedAt: time.Now().Unix(),
+			SourceType: handler.SourceTypeStream,
+			SourceInfo: fmt.Sprintf("wss://relay-%d.example", i%benchRelays),
+		})
+		buf.Write(line)
+	}
+	return buf.Bytes(), keys
+}
+
+// BenchmarkRun_Relays measures plugin throughput (events/s) on a stream from
+// benchRelays relays whose authors are all unknown to the cache, against a
+// whitelist server benchRTT away: the sequential loop pays one GET /check per
+// event; the pipeline overlaps checks and batches them into POST /check.
+func BenchmarkRun_Relays(b *testing.B) {
+	for _, workers := range []int{1, 8, 32, 128} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			input, keys := relayStream(b.N)
+			srv := server.NewWhitelistServer(whitelist.NewWhiteList(keys), ":0", false, nil)
+			api := srv.Handler()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(benchRTT)
+				api.ServeHTTP(w, r)
+			}))
+			defer ts.Close()
+
+			checker := client.NewWhitelistClient(ts.URL, 5*time.Second, nil)
+			if workers > 1 {
+				checker.EnableBulkChecks()
+			}
+			h := handler.NewWhitelistHandler(checker, nil)
+			ioAdapter := handler.NewJSONLIOAdapter(io.Discard)
+			process := func(line []byte) []byte {
+				in, _ := ioAdapter.Input(line)
+				out, _ := h.Handle(in)
+				resp, _ := ioAdapter.Output(out)
+				return resp
+			}
+
+			b.ResetTimer()
+			start := time.Now()
+			if err := Run(context.Background(), bytes.NewReader(input), io.Discard, workers, process, nil); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun_KeepsOrder(t *testing.T) {
+	var in strings.Builder
+	for i := range 500 {
+		fmt.Fprintf(&in, "%d\n", i)
+	}
+	var running, peak atomic.Int32
+	process := func(line []byte) []byte {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+		running.Add(-1)
+		return append(append([]byte("out-"), line...), '\n')
+	}
+
+	var out bytes.Buffer
+	if err := Run(context.Background(), strings.NewReader(in.String()), &out, 16, process, nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 500 {
+		t.Fatalf("got %d responses, want 500", len(lines))
+	}
+	for i, l := range lines {
+		if l != fmt.Sprintf("out-%d", i) {
+			t.Fatalf("response %d = %q: out of order", i, l)
+		}
+	}
+	if peak.Load() < 2 {
+		t.Error("lines were never processed concurrently")
+	}
+}
+
+func TestRun_SingleWorker(t *testing.T) {
+	var running atomic.Int32
+	process := func(line []byte) []byte {
+		if running.Add(1) > 1 {
+			t.Error("concurrent process calls with one worker")
+		}
+		defer running.Add(-1)
+		return append(line, '\n')
+	}
+	var out bytes.Buffer
+	if err := Run(context.Background(), strings.NewReader("a\nb\nc\n"), &out, 1, process, nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if out.String() != "a\nb\nc\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRun_WrittenInOrder(t *testing.T) {
+	var in strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&in, "%d\n", i)
+	}
+	process := func(line []byte) []byte {
+		time.Sleep(time.Duration(rand.IntN(300)) * time.Microsecond)
+		return append(append([]byte("out-"), line...), '\n')
+	}
+	var got []string
+	written := func(line, resp []byte) {
+		got = append(got, string(line)+" "+string(resp))
+	}
+	if err := Run(context.Background(), strings.NewReader(in.String()), io.Discard, 16, process, written); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(got) != 200 {
+		t.Fatalf("written %d times, want 200", len(got))
+	}
+	for i, g := range got {
+		if want := fmt.Sprintf("%d out-%d\n", i, i); g != want {
+			t.Fatalf("written %d = %q, want %q", i, g, want)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestRun_WriteError(t *testing.T) {
+	err := Run(context.Background(), strings.NewReader("a\nb\n"), failingWriter{}, 4, func(l []byte) []byte { return l }, nil)
+	if err == nil || err.Error() != "broken pipe" {
+		t.Fatalf("err = %v, want broken pipe", err)
+	}
+}
+
+func TestRun_LineTooLong(t *testing.T) {
+	in := strings.Repeat("x", maxBuf+1) + "\n"
+	err := Run(context.Background(), strings.NewReader(in), io.Discard, 4, func(l []byte) []byte { return l }, nil)
+	if err == nil {
+		t.Fatal("expected a scanner error for an oversized line")
+	}
+}
+
+func TestRun_ContextCancel(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, pr, io.Discard, 4, func(l []byte) []byte { return l }, nil) }()
+
+	pw.Write([]byte("a\n"))
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v after cancel", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
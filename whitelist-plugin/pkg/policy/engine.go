@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultReloadInterval is how often Watch polls the policy file for changes.
+const DefaultReloadInterval = 5 * time.Second
+
+// Engine holds the active RuleSet behind an atomic pointer so the plugin hot
+// path evaluates lock-free while Watch swaps in edits. A file that fails to
+// parse or validate never replaces the active set: the last good policy keeps
+// serving until the file is fixed.
+type Engine struct {
+	path   string
+	rules  atomic.Pointer[RuleSet]
+	logger *log.Logger
+
+	// Last observed file state; only touched by Load (Watch's goroutine after
+	// startup), so it needs no synchronisation.
+	modTime time.Time
+	size    int64
+	present bool
+}
+
+// NewEngine returns an Engine for the policy file at path with an empty
+// RuleSet. Call Load before serving to apply the file.
+func NewEngine(path string, logger *log.Logger) *Engine {
+	if logger == nil {
+		logger = log.Default()
+	}
+	e := &Engine{path: path, logger: logger}
+	e.rules.Store(&RuleSet{})
+	return e
+}
+
+// Evaluate applies the active RuleSet. See RuleSet.Evaluate.
+func (e *Engine) Evaluate(in Input) (Decision, bool) {
+	return e.rules.Load().Evaluate(in)
+}
+
+// Len returns the number of rules in the active RuleSet.
+func (e *Engine) Len() int {
+	return e.rules.Load().Len()
+}
+
+// Load reads and compiles the policy file and swaps it in. A missing file is
+// not an error: it clears the policy so the plugin falls back to its built-in
+// decision. Parse or validation errors leave the active RuleSet untouched.
+func (e *Engine) Load() error {
+	info, err := os.Stat(e.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		e.present = false
+		e.rules.Store(&RuleSet{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat policy file %s: %w", e.path, err)
+	}
+	e.present = true
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+
+	rs, err := LoadFile(e.path)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(rs)
+	return nil
+}
+
+// LoadFile parses and compiles a policy YAML file.
+func LoadFile(path string) (*RuleSet, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read policy file %s: %w", path, err)
+	}
+
+	var f File
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, fmt.Errorf("decode policy file %s: %w", path, err)
+	}
+	return Compile(f.Rules)
+}
+
+// Watch polls the policy file every interval and reloads it when its mtime,
+// size or existence changes. Polling rather than inotify survives editors that
+// replace the file by rename and ConfigMap-style symlink swaps. Blocks until
+// ctx is cancelled.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.changed() {
+				continue
+			}
+			if err := e.Load(); err != nil {
+				e.logger.Printf("policy reload failed, keeping previous %d rules: %v", e.Len(), err)
+				continue
+			}
+			e.logger.Printf("policy reloaded from %s: %d rules", e.path, e.Len())
+		}
+	}
+}
+
+// changed reports whether the file differs from what Load last saw.
+func (e *Engine) changed() bool {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return e.present
+	}
+	return !e.present || !info.ModTime().Equal(e.modTime) || info.Size() != e.size
+}
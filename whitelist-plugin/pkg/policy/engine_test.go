@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const samplePolicy = `
+rules:
+  - name: notes-mid
+    kinds: [1]
+    min_tier: 2
+    action: accept
+  - name: long-form
+    kinds: ["30000-39999"]
+    source_types: [IP4, IP6]
+    whitelisted: false
+    action: quarantine
+  - name: big
+    min_content_bytes: 65536
+    action: reject
+    message: "rejected: content too large"
+`
+
+func writePolicy(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+}
+
+func TestLoadFile_DecodesYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, samplePolicy)
+
+	rs, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if rs.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", rs.Len())
+	}
+
+	// Unquoted YAML ints in kinds must decode to kind strings.
+	if d, ok := rs.Evaluate(Input{Kind: 1, Whitelisted: true, Tier: 2}); !ok || d.Action != ActionAccept {
+		t.Errorf("kind 1 tier 2: got %+v, %v", d, ok)
+	}
+	if d, ok := rs.Evaluate(Input{Kind: 30023, SourceType: "IP6"}); !ok || d.Action != ActionQuarantine {
+		t.Errorf("kind 30023: got %+v, %v", d, ok)
+	}
+	if d, ok := rs.Evaluate(Input{Kind: 7, ContentBytes: 70000}); !ok || d.Message != "rejected: content too large" {
+		t.Errorf("oversized: got %+v, %v", d, ok)
+	}
+}
+
+func TestEngine_MissingFileIsEmptyPolicy(t *testing.T) {
+	e := NewEngine(filepath.Join(t.TempDir(), "absent.yaml"), log.New(io.Discard, "", 0))
+	if err := e.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if e.Len() != 0 {
+		t.Fatalf("Len() = %d, want 0", e.Len())
+	}
+}
+
+func TestEngine_InvalidFileKeepsPrevious(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, samplePolicy)
+	e := NewEngine(path, log.New(io.Discard, "", 0))
+	if err := e.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	writePolicy(t, path, "rules:\n  - kinds: [1]\n    action: explode\n")
+	if err := e.Load(); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+	if e.Len() != 3 {
+		t.Fatalf("Len() = %d after failed load, want previous 3", e.Len())
+	}
+}
+
+func TestEngine_WatchHotReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, samplePolicy)
+	e := NewEngine(path, log.New(io.Discard, "", 0))
+	if err := e.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 10*time.Millisecond)
+
+	writePolicy(t, path, "rules:\n  - name: only\n    action: reject\n")
+	waitFor(t, func() bool { return e.Len() == 1 })
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return e.Len() == 0 })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met within 2s")
+}
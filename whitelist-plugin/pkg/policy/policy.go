@@ -0,0 +1,256 @@
+// Package policy implements the declarative write policy shared by the StrFry
+// plugins. A policy is an ordered list of rules; the first rule whose every
+// condition matches an event decides its action. Events no rule matches fall
+// through to the plugin's built-in whitelist decision, so an empty policy is
+// exactly the legacy behaviour.
+//
+// The package has no dependency on the StrFry message types or go-nostr: the
+// handlers project each event into an Input, which keeps rules unit-testable
+// without a relay.
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Action is what a matching rule does with an event.
+type Action string
+
+// Allowed Action values. ActionQuarantine rejects the event on mainline and,
+// in the router plugin, forwards it to the quarantine relay.
+const (
+	ActionAccept       Action = "accept"
+	ActionReject       Action = "reject"
+	ActionShadowReject Action = "shadowReject"
+	ActionQuarantine   Action = "quarantine"
+)
+
+// sourceTypes mirrors handler.SourceType; duplicated so this package does not
+// import the handler (which imports it).
+var sourceTypes = map[string]struct{}{
+	"IP4": {}, "IP6": {}, "Import": {}, "Stream": {}, "Sync": {}, "Stored": {},
+}
+
+// File is the on-disk policy document.
+type File struct {
+	Rules []Rule `mapstructure:"rules"`
+}
+
+// Rule is one policy entry as written in YAML. Every set condition must match;
+// unset conditions match anything.
+type Rule struct {
+	Name            string   `mapstructure:"name"`
+	Kinds           []string `mapstructure:"kinds"`        // "1", "0-3", "30000-39999"
+	SourceTypes     []string `mapstructure:"source_types"` // any of; e.g. IP4, Stream, Sync
+	Tags            []string `mapstructure:"tags"`         // all of these tag names present
+	MinContentBytes *int     `mapstructure:"min_content_bytes"`
+	MaxContentBytes *int     `mapstructure:"max_content_bytes"`
+	Whitelisted     *bool    `mapstructure:"whitelisted"`
+	MinTier         *int     `mapstructure:"min_tier"`
+	MaxTier         *int     `mapstructure:"max_tier"`
+	Action          Action   `mapstructure:"action"`
+	Message         string   `mapstructure:"message"` // reject message; defaults per action
+}
+
+// Input is the projection of one event that rules are evaluated against.
+type Input struct {
+	Kind         int
+	SourceType   string
+	TagNames     []string
+	ContentBytes int
+	Whitelisted  bool
+	Tier         int // 0 when not whitelisted
+}
+
+// Decision is the outcome of the first matching rule.
+type Decision struct {
+	Rule    string
+	Action  Action
+	Message string
+}
+
+type kindRange struct{ min, max int }
+
+// compiledRule is a validated Rule with its kind ranges parsed.
+type compiledRule struct {
+	name        string
+	kinds       []kindRange
+	sourceTypes map[string]struct{}
+	tags        []string
+	minContent  int
+	maxContent  int // -1 = unbounded
+	whitelisted *bool
+	minTier     int
+	maxTier     int // -1 = unbounded
+	action      Action
+	message     string
+}
+
+// RuleSet is an immutable, compiled policy. The zero value matches nothing.
+type RuleSet struct {
+	rules []compiledRule
+}
+
+// Compile validates rules and returns a RuleSet. Rule order is preserved.
+func Compile(rules []Rule) (*RuleSet, error) {
+	rs := &RuleSet{rules: make([]compiledRule, 0, len(rules))}
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = "rule-" + strconv.Itoa(i+1)
+		}
+		cr, err := compileRule(name, r)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule %q: %w", name, err)
+		}
+		rs.rules = append(rs.rules, cr)
+	}
+	return rs, nil
+}
+
+func compileRule(name string, r Rule) (compiledRule, error) {
+	cr := compiledRule{
+		name:        name,
+		tags:        r.Tags,
+		maxContent:  -1,
+		whitelisted: r.Whitelisted,
+		maxTier:     -1,
+		action:      r.Action,
+		message:     r.Message,
+	}
+
+	switch r.Action {
+	case ActionAccept, ActionReject, ActionShadowReject, ActionQuarantine:
+	case "":
+		return cr, fmt.Errorf("missing action")
+	default:
+		return cr, fmt.Errorf("unknown action %q", r.Action)
+	}
+
+	for _, k := range r.Kinds {
+		kr, err := parseKindRange(k)
+		if err != nil {
+			return cr, err
+		}
+		cr.kinds = append(cr.kinds, kr)
+	}
+
+	if len(r.SourceTypes) > 0 {
+		cr.sourceTypes = make(map[string]struct{}, len(r.SourceTypes))
+		for _, st := range r.SourceTypes {
+			if _, ok := sourceTypes[st]; !ok {
+				return cr, fmt.Errorf("unknown source type %q", st)
+			}
+			cr.sourceTypes[st] = struct{}{}
+		}
+	}
+
+	if r.MinContentBytes != nil {
+		cr.minContent = *r.MinContentBytes
+	}
+	if r.MaxContentBytes != nil {
+		cr.maxContent = *r.MaxContentBytes
+	}
+	if cr.minContent < 0 || (cr.maxContent >= 0 && cr.maxContent < cr.minContent) {
+		return cr, fmt.Errorf("invalid content size bounds %d..%d", cr.minContent, cr.maxContent)
+	}
+
+	if r.MinTier != nil {
+		cr.minTier = *r.MinTier
+	}
+	if r.MaxTier != nil {
+		cr.maxTier = *r.MaxTier
+	}
+	if cr.minTier < 0 || (cr.maxTier >= 0 && cr.maxTier < cr.minTier) {
+		return cr, fmt.Errorf("invalid tier bounds %d..%d", cr.minTier, cr.maxTier)
+	}
+
+	return cr, nil
+}
+
+// parseKindRange accepts "N" or "N-M" (inclusive).
+func parseKindRange(s string) (kindRange, error) {
+	s = strings.TrimSpace(s)
+	loStr, hiStr, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(loStr))
+	if err != nil || lo < 0 {
+		return kindRange{}, fmt.Errorf("invalid kind %q", s)
+	}
+	if !isRange {
+		return kindRange{lo, lo}, nil
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(hiStr))
+	if err != nil || hi < lo {
+		return kindRange{}, fmt.Errorf("invalid kind range %q", s)
+	}
+	return kindRange{lo, hi}, nil
+}
+
+// Len returns the number of rules in the set.
+func (rs *RuleSet) Len() int {
+	if rs == nil {
+		return 0
+	}
+	return len(rs.rules)
+}
+
+// Evaluate returns the decision of the first rule that matches in, and false
+// when no rule matches.
+func (rs *RuleSet) Evaluate(in Input) (Decision, bool) {
+	if rs == nil {
+		return Decision{}, false
+	}
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if r.matches(in) {
+			return Decision{Rule: r.name, Action: r.action, Message: r.message}, true
+		}
+	}
+	return Decision{}, false
+}
+
+func (r *compiledRule) matches(in Input) bool {
+	if len(r.kinds) > 0 {
+		ok := false
+		for _, kr := range r.kinds {
+			if in.Kind >= kr.min && in.Kind <= kr.max {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if r.sourceTypes != nil {
+		if _, ok := r.sourceTypes[in.SourceType]; !ok {
+			return false
+		}
+	}
+	for _, want := range r.tags {
+		if !hasTag(in.TagNames, want) {
+			return false
+		}
+	}
+	if in.ContentBytes < r.minContent || (r.maxContent >= 0 && in.ContentBytes > r.maxContent) {
+		return false
+	}
+	if r.whitelisted != nil && *r.whitelisted != in.Whitelisted {
+		return false
+	}
+	if in.Tier < r.minTier || (r.maxTier >= 0 && in.Tier > r.maxTier) {
+		return false
+	}
+	return true
+}
+
+func hasTag(names []string, want string) bool {
+	for _, n := range names {
+		if n == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+
+func TestCompile_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{"missing action", Rule{Kinds: []string{"1"}}, "missing action"},
+		{"unknown action", Rule{Action: "drop"}, "unknown action"},
+		{"bad kind", Rule{Kinds: []string{"one"}, Action: ActionAccept}, "invalid kind"},
+		{"inverted kind range", Rule{Kinds: []string{"9-3"}, Action: ActionAccept}, "invalid kind range"},
+		{"unknown source type", Rule{SourceTypes: []string{"Carrier"}, Action: ActionAccept}, "unknown source type"},
+		{"inverted content bounds", Rule{MinContentBytes: intPtr(10), MaxContentBytes: intPtr(5), Action: ActionReject}, "content size"},
+		{"inverted tier bounds", Rule{MinTier: intPtr(3), MaxTier: intPtr(1), Action: ActionReject}, "tier bounds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]Rule{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Compile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleSet_Evaluate(t *testing.T) {
+	rs, err := Compile([]Rule{
+		{Name: "big", MinContentBytes: intPtr(1000), Action: ActionReject, Message: "rejected: too big"},
+		{Name: "notes-mid", Kinds: []string{"1"}, MinTier: intPtr(2), Action: ActionAccept},
+		{Name: "notes-low", Kinds: []string{"1"}, Whitelisted: boolPtr(true), Action: ActionShadowReject},
+		{Name: "meta-low", Kinds: []string{"0", "3"}, MinTier: intPtr(1), Action: ActionAccept},
+		{Name: "replies-from-strangers", Kinds: []string{"1"}, Tags: []string{"e", "p"}, Whitelisted: boolPtr(false), Action: ActionQuarantine},
+		{Name: "long-form-from-clients", Kinds: []string{"30000-39999"}, SourceTypes: []string{"IP4", "IP6"}, Action: ActionQuarantine},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		in       Input
+		wantRule string // "" = no match
+	}{
+		{"oversized wins first", Input{Kind: 1, ContentBytes: 5000, Whitelisted: true, Tier: 3}, "big"},
+		{"tier 2 note accepted", Input{Kind: 1, Whitelisted: true, Tier: 2}, "notes-mid"},
+		{"tier 1 note shadow-rejected", Input{Kind: 1, Whitelisted: true, Tier: 1}, "notes-low"},
+		{"tier 1 profile accepted", Input{Kind: 0, Whitelisted: true, Tier: 1}, "meta-low"},
+		{"tier 0 profile falls through", Input{Kind: 0}, ""},
+		{"stranger reply quarantined", Input{Kind: 1, TagNames: []string{"p", "e"}}, "replies-from-strangers"},
+		{"stranger reply missing p falls through", Input{Kind: 1, TagNames: []string{"e"}}, ""},
+		{"long form from IP4", Input{Kind: 30023, SourceType: "IP4"}, "long-form-from-clients"},
+		{"long form from Sync falls through", Input{Kind: 30023, SourceType: "Sync"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := rs.Evaluate(tt.in)
+			if tt.wantRule == "" {
+				if ok {
+					t.Fatalf("expected no match, got %+v", d)
+				}
+				return
+			}
+			if !ok || d.Rule != tt.wantRule {
+				t.Fatalf("Evaluate() = %+v, %v; want rule %q", d, ok, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRuleSet_DefaultNames(t *testing.T) {
+	rs, err := Compile([]Rule{{Action: ActionAccept}})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	d, ok := rs.Evaluate(Input{})
+	if !ok || d.Rule != "rule-1" {
+		t.Fatalf("Evaluate() = %+v, %v; want rule-1", d, ok)
+	}
+}
+
+func TestRuleSet_NilAndEmpty(t *testing.T) {
+	var nilSet *RuleSet
+	if _, ok := nilSet.Evaluate(Input{Kind: 1}); ok {
+		t.Error("nil RuleSet should match nothing")
+	}
+	if _, ok := (&RuleSet{}).Evaluate(Input{Kind: 1}); ok {
+		t.Error("empty RuleSet should match nothing")
+	}
+}
@@ -0,0 +1,266 @@
+package quarantine
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// destination is one quarantine relay: its own queue, optional spool,
+// connection and counters.
+type destination struct {
+	p           *Publisher
+	url         string
+	queue       chan nostr.Event
+	spool       *spool
+	maxInflight int
+
+	enqueued       atomic.Uint64
+	dropped        atomic.Uint64
+	published      atomic.Uint64
+	publishErrors  atomic.Uint64
+	reconnectCount atomic.Uint64
+	connected      atomic.Bool
+	inflight       atomic.Int64
+}
+
+// job is one event on its way to the relay. seq identifies it in the spool;
+// rejections counts the relay's OK false replies to it.
+type job struct {
+	evt        nostr.Event
+	seq        uint64
+	rejections int
+}
+
+type result struct {
+	job
+	relay *nostr.Relay
+	err   error
+}
+
+func newDestination(p *Publisher, url string, bufferSize, maxInflight int) *destination {
+	return &destination{
+		p:           p,
+		url:         url,
+		queue:       make(chan nostr.Event, bufferSize),
+		maxInflight: maxInflight,
+	}
+}
+
+func (d *destination) enqueue(evt nostr.Event) bool {
+	select {
+	case d.queue <- evt:
+		d.enqueued.Add(1)
+		return true
+	default:
+		d.dropped.Add(1)
+		return false
+	}
+}
+
+func (d *destination) metrics() DestinationMetrics {
+	m := DestinationMetrics{
+		RelayURL:       d.url,
+		Enqueued:       d.enqueued.Load(),
+		Dropped:        d.dropped.Load(),
+		Published:      d.published.Load(),
+		PublishErrors:  d.publishErrors.Load(),
+		ReconnectCount: d.reconnectCount.Load(),
+		Connected:      d.connected.Load(),
+		Inflight:       d.inflight.Load(),
+	}
+	if d.spool != nil {
+		m.SpoolDepth, m.SpoolBytes = d.spool.stats()
+	}
+	return m
+}
+
+// runSpool moves queued events to the spool, flushing once the queue is
+// empty. On shutdown it spools whatever is left in the queue and closes the
+// spool.
+func (d *destination) runSpool(ctx context.Context) {
+	defer d.p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			d.spoolQueued()
+			d.closeSpool()
+			return
+		case <-d.p.done:
+			d.spoolQueued()
+			d.closeSpool()
+			return
+		case evt := <-d.queue:
+			d.spoolEvent(evt)
+			d.spoolQueued()
+			if err := d.spool.flush(); err != nil {
+				d.p.logger.Printf("quarantine: %v", err)
+			}
+		}
+	}
+}
+
+// spoolQueued spools every event already in the queue without waiting.
+func (d *destination) spoolQueued() {
+	for {
+		select {
+		case evt := <-d.queue:
+			d.spoolEvent(evt)
+		default:
+			return
+		}
+	}
+}
+
+func (d *destination) spoolEvent(evt nostr.Event) {
+	if err := d.spool.append(evt); err != nil {
+		d.dropped.Add(1)
+		d.p.logger.Printf("quarantine: spool %s id=%s: %v", d.url, evt.ID, err)
+	}
+}
+
+func (d *destination) closeSpool() {
+	if err := d.spool.close(); err != nil {
+		d.p.logger.Printf("quarantine: close spool %s: %v", d.url, err)
+	}
+}
+
+// runDrain owns the destination's WS connection and keeps up to maxInflight
+// publishes awaiting their OK at once. After a publish fails for want of an
+// OK it lets the rest of the window come back, then reconnects; a refusal
+// keeps the connection. Spooled events that failed are sent again first;
+// events from the in-memory queue are fire-and-forget.
+func (d *destination) runDrain(ctx context.Context) {
+	defer d.p.wg.Done()
+	var relay *nostr.Relay
+	defer func() {
+		if relay != nil {
+			_ = relay.Close()
+		}
+	}()
+
+	results := make(chan result, d.maxInflight)
+	var retry []job
+	delay := initialReconnectDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.p.done:
+			return
+		default:
+		}
+
+		if relay == nil && d.inflight.Load() == 0 {
+			newRelay, err := d.connect(ctx)
+			if err != nil {
+				d.p.logger.Printf("quarantine: connect to %s failed: %v (retry in %s)", d.url, err, delay)
+				if !sleepCancel(ctx, d.p.done, delay) {
+					return
+				}
+				delay = nextBackoff(delay)
+				continue
+			}
+			relay = newRelay
+			d.connected.Store(true)
+			d.reconnectCount.Add(1)
+			delay = initialReconnectDelay
+			d.p.logger.Printf("quarantine: connected to %s", d.url)
+		}
+
+		// Fill the window, retries first.
+		canSend := relay != nil && d.inflight.Load() < int64(d.maxInflight)
+		if canSend && len(retry) > 0 {
+			d.send(ctx, relay, retry[0], results)
+			retry = retry[1:]
+			continue
+		}
+		if canSend && d.spool != nil {
+			if rec, ok := d.spool.next(); ok {
+				d.send(ctx, relay, job{evt: rec.evt, seq: rec.seq}, results)
+				continue
+			}
+		}
+
+		var queue <-chan nostr.Event
+		var spooled <-chan struct{}
+		if canSend {
+			if d.spool != nil {
+				spooled = d.spool.notify
+			} else {
+				queue = d.queue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.p.done:
+			return
+		case <-spooled:
+		case evt := <-queue:
+			d.send(ctx, relay, job{evt: evt}, results)
+		case res := <-results:
+			d.inflight.Add(-1)
+			if res.err == nil {
+				d.published.Add(1)
+				d.ack(res.job)
+				continue
+			}
+			d.publishErrors.Add(1)
+			d.p.logger.Printf("quarantine: publish to %s id=%s failed: %v", d.url, res.evt.ID, res.err)
+			rejected := isRejection(res.err)
+			if !rejected && res.relay == relay && relay != nil {
+				// Force a reconnect once the rest of the window is back.
+				_ = relay.Close()
+				relay = nil
+				d.connected.Store(false)
+			}
+			if d.spool == nil {
+				continue
+			}
+			if rejected {
+				res.rejections++
+			}
+			if res.rejections < maxSpoolAttempts {
+				retry = append(retry, res.job)
+				continue
+			}
+			d.p.logger.Printf("quarantine: giving up on spooled id=%s for %s after %d rejections", res.evt.ID, d.url, res.rejections)
+			d.ack(res.job)
+		}
+	}
+}
+
+func (d *destination) send(ctx context.Context, relay *nostr.Relay, j job, results chan<- result) {
+	d.inflight.Add(1)
+	go func() {
+		results <- result{job: j, relay: relay, err: d.publishOne(ctx, relay, j.evt)}
+	}()
+}
+
+func (d *destination) ack(j job) {
+	if d.spool != nil {
+		d.spool.ack(j.seq)
+	}
+}
+
+func (d *destination) connect(ctx context.Context) (*nostr.Relay, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, d.p.publishTimeout)
+	defer cancel()
+	return nostr.RelayConnect(dialCtx, d.url)
+}
+
+func (d *destination) publishOne(ctx context.Context, relay *nostr.Relay, evt nostr.Event) error {
+	pubCtx, cancel := context.WithTimeout(ctx, d.p.publishTimeout)
+	defer cancel()
+	return relay.Publish(pubCtx, evt)
+}
+
+// isRejection reports whether a publish failed because the relay answered
+// OK false, which go-nostr returns as "msg: <reason>", rather than for want of
+// an answer.
+func isRejection(err error) bool {
+	return strings.HasPrefix(err.Error(), "msg: ")
+}
@@ -1,23 +1,31 @@
 // Package quarantine implements the async publisher that forwards
-// non-whitelisted Nostr events to the quarantine relay.
+// non-whitelisted Nostr events to the quarantine relays.
 //
-// The plugin hot path must never block on this — Enqueue drops on full queue,
-// and a single background goroutine maintains the WS connection and publishes.
-// See quarantine/SPEC.md §6.4.
+// The plugin hot path must never block on this — Enqueue drops on full queue.
+// Each destination relay has its own queue and background goroutine that
+// maintains its WS connection and keeps several publishes in flight, so a slow
+// destination never holds up the others. With a spool enabled, a second
+// goroutine per destination moves queued events to disk and the destination
+// drains the spool instead, so nothing queued is lost to a restart or a relay
+// outage. See quarantine/SPEC.md §6.4.
 package quarantine
 
 import (
 	"context"
 	"log"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
 )
 
 const (
-	// DefaultBufferSize is the enqueue channel size when config omits one.
+	// DefaultBufferSize is the per-destination enqueue channel size when
+	// config omits one.
 	DefaultBufferSize = 10000
 
 	// DefaultPublishTimeout caps one Relay.Publish call.
@@ -26,11 +34,26 @@ const (
 	// DefaultMetricsInterval controls how often the publisher logs counters.
 	DefaultMetricsInterval = 60 * time.Second
 
+	// DefaultMaxInflight is how many publishes per destination may await
+	// their OK at once when config omits a limit.
+	DefaultMaxInflight = 16
+
 	initialReconnectDelay = 500 * time.Millisecond
 	maxReconnectDelay     = 30 * time.Second
+
+	// maxSpoolAttempts is how many times the relay may refuse a spooled event
+	// (OK false) before it is given up on, so one event the relay refuses
+	// cannot stall the spool behind it. Timeouts and dropped connections do
+	// not count: those events stay spooled and are retried after reconnect
+	// for as long as the outage lasts.
+	maxSpoolAttempts = 3
 )
 
-// Metrics is a snapshot of publisher counters.
+// Metrics is a snapshot of publisher counters. Counters are summed over the
+// destinations, so an event sent to two relays is enqueued twice; Connected
+// is true only while every destination is connected. Dropped counts events
+// lost before publishing: a queue was full, or a spool was full or failing.
+// SpoolDepth and SpoolBytes are zero without a spool.
 type Metrics struct {
 	Enqueued       uint64
 	Dropped        uint64
@@ -38,32 +61,45 @@ type Metrics struct {
 	PublishErrors  uint64
 	ReconnectCount uint64
 	Connected      bool
+	SpoolDepth     int64 // spooled events not yet published
+	SpoolBytes     int64 // spool size on disk
+	Destinations   []DestinationMetrics
+}
+
+// DestinationMetrics is one destination relay's share of Metrics.
+type DestinationMetrics struct {
+	RelayURL       string
+	Enqueued       uint64
+	Dropped        uint64
+	Published      uint64
+	PublishErrors  uint64
+	ReconnectCount uint64
+	Connected      bool
+	Inflight       int64 // publishes awaiting the relay's OK
+	SpoolDepth     int64
+	SpoolBytes     int64
 }
 
-// Publisher asynchronously forwards events to a Nostr relay.
+// Publisher asynchronously forwards events to one or more Nostr relays.
 type Publisher struct {
-	relayURL        string
 	publishTimeout  time.Duration
 	metricsInterval time.Duration
 	logger          *log.Logger
 
-	queue chan nostr.Event
+	dests []*destination
 	done  chan struct{}
-
-	enqueued       atomic.Uint64
-	dropped        atomic.Uint64
-	published      atomic.Uint64
-	publishErrors  atomic.Uint64
-	reconnectCount atomic.Uint64
-	connected      atomic.Bool
+	wg    sync.WaitGroup
 
 	stopOnce sync.Once
 }
 
-// Config configures a Publisher.
+// Config configures a Publisher. Events go to RelayURL and every entry of
+// RelayURLs; BufferSize and MaxInflight apply to each destination.
 type Config struct {
 	RelayURL        string
+	RelayURLs       []string
 	BufferSize      int
+	MaxInflight     int
 	PublishTimeout  time.Duration
 	MetricsInterval time.Duration
 }
@@ -73,6 +109,9 @@ func NewPublisher(cfg Config, logger *log.Logger) *Publisher {
 	if cfg.BufferSize <= 0 {
 		cfg.BufferSize = DefaultBufferSize
 	}
+	if cfg.MaxInflight <= 0 {
+		cfg.MaxInflight = DefaultMaxInflight
+	}
 	if cfg.PublishTimeout <= 0 {
 		cfg.PublishTimeout = DefaultPublishTimeout
 	}
@@ -82,128 +121,122 @@ func NewPublisher(cfg Config, logger *log.Logger) *Publisher {
 	if logger == nil {
 		logger = log.Default()
 	}
-	return &Publisher{
-		relayURL:        cfg.RelayURL,
+	p := &Publisher{
 		publishTimeout:  cfg.PublishTimeout,
 		metricsInterval: cfg.MetricsInterval,
 		logger:          logger,
-		queue:           make(chan nostr.Event, cfg.BufferSize),
 		done:            make(chan struct{}),
 	}
+	var urls []string
+	for _, u := range append([]string{cfg.RelayURL}, cfg.RelayURLs...) {
+		if u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	for _, u := range urls {
+		p.dests = append(p.dests, newDestination(p, u, cfg.BufferSize, cfg.MaxInflight))
+	}
+	return p
 }
 
-// Enqueue attempts to enqueue an event for publication. Never blocks.
-// Returns true if the event was enqueued; false if the queue was full.
+// RelayURLs returns the destination relays in Metrics.Destinations order.
+func (p *Publisher) RelayURLs() []string {
+	urls := make([]string, len(p.dests))
+	for i, d := range p.dests {
+		urls[i] = d.url
+	}
+	return urls
+}
+
+// Enqueue offers an event to every destination's queue. Never blocks.
+// Returns true if every destination took it; false if any queue was full.
 func (p *Publisher) Enqueue(evt nostr.Event) bool {
-	select {
-	case p.queue <- evt:
-		p.enqueued.Add(1)
-		return true
-	default:
-		p.dropped.Add(1)
-		return false
+	ok := true
+	for _, d := range p.dests {
+		ok = d.enqueue(evt) && ok
 	}
+	return ok
+}
+
+// EnableSpool gives each destination an on-disk spool, holding up to
+// maxBytes, in its own subdirectory of dir. Events left there by a previous
+// run are published first. Must be called before Start.
+func (p *Publisher) EnableSpool(dir string, maxBytes int64) error {
+	for _, d := range p.dests {
+		s, err := openSpool(filepath.Join(dir, spoolDirName(d.url)), maxBytes, p.logger)
+		if err != nil {
+			return err
+		}
+		d.spool = s
+	}
+	return nil
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// spoolDirName turns a relay URL into a directory name, e.g.
+// ws://strfry-quarantine:7778 -> strfry-quarantine_7778.
+func spoolDirName(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	return strings.Trim(unsafePathChars.ReplaceAllString(url, "_"), "_")
 }
 
 // Start begins the background drain + metrics goroutines.
 // The returned goroutines exit when ctx is cancelled or Stop is called.
 func (p *Publisher) Start(ctx context.Context) {
-	go p.runDrain(ctx)
+	for _, d := range p.dests {
+		if d.spool != nil {
+			p.wg.Add(1)
+			go d.runSpool(ctx)
+		}
+		p.wg.Add(1)
+		go d.runDrain(ctx)
+	}
+	p.wg.Add(1)
 	go p.runMetrics(ctx)
 }
 
-// Stop cancels the drain loop and waits up to timeout for it to finish.
+// Stop cancels the drain loops and waits up to timeout for the background
+// goroutines to finish. With a spool, everything still queued is written to
+// disk before the spool closes.
 func (p *Publisher) Stop(timeout time.Duration) {
 	p.stopOnce.Do(func() { close(p.done) })
 	if timeout <= 0 {
 		return
 	}
+	stopped := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(stopped)
+	}()
 	select {
+	case <-stopped:
 	case <-time.After(timeout):
 	}
 }
 
 // Metrics returns a snapshot of current counters.
 func (p *Publisher) Metrics() Metrics {
-	return Metrics{
-		Enqueued:       p.enqueued.Load(),
-		Dropped:        p.dropped.Load(),
-		Published:      p.published.Load(),
-		PublishErrors:  p.publishErrors.Load(),
-		ReconnectCount: p.reconnectCount.Load(),
-		Connected:      p.connected.Load(),
-	}
-}
-
-// runDrain owns the single WS connection and publishes queued events.
-func (p *Publisher) runDrain(ctx context.Context) {
-	var relay *nostr.Relay
-	defer func() {
-		if relay != nil {
-			_ = relay.Close()
-		}
-	}()
-
-	delay := initialReconnectDelay
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-p.done:
-			return
-		default:
-		}
-
-		if relay == nil || !relay.IsConnected() {
-			newRelay, err := p.connect(ctx)
-			if err != nil {
-				p.logger.Printf("quarantine: connect to %s failed: %v (retry in %s)", p.relayURL, err, delay)
-				if !sleepCancel(ctx, p.done, delay) {
-					return
-				}
-				delay = nextBackoff(delay)
-				continue
-			}
-			relay = newRelay
-			p.connected.Store(true)
-			p.reconnectCount.Add(1)
-			delay = initialReconnectDelay
-			p.logger.Printf("quarantine: connected to %s", p.relayURL)
-		}
-
-		select {
-		case <-ctx.Done():
-			return
-		case <-p.done:
-			return
-		case evt := <-p.queue:
-			if err := p.publishOne(ctx, relay, evt); err != nil {
-				p.publishErrors.Add(1)
-				p.logger.Printf("quarantine: publish id=%s failed: %v", evt.ID, err)
-				// Force reconnect on next iteration.
-				_ = relay.Close()
-				relay = nil
-				p.connected.Store(false)
-			} else {
-				p.published.Add(1)
-			}
-		}
+	m := Metrics{Connected: len(p.dests) > 0}
+	for _, d := range p.dests {
+		dm := d.metrics()
+		m.Enqueued += dm.Enqueued
+		m.Dropped += dm.Dropped
+		m.Published += dm.Published
+		m.PublishErrors += dm.PublishErrors
+		m.ReconnectCount += dm.ReconnectCount
+		m.Connected = m.Connected && dm.Connected
+		m.SpoolDepth += dm.SpoolDepth
+		m.SpoolBytes += dm.SpoolBytes
+		m.Destinations = append(m.Destinations, dm)
 	}
-}
-
-func (p *Publisher) connect(ctx context.Context) (*nostr.Relay, error) {
-	dialCtx, cancel := context.WithTimeout(ctx, p.publishTimeout)
-	defer cancel()
-	return nostr.RelayConnect(dialCtx, p.relayURL)
-}
-
-func (p *Publisher) publishOne(ctx context.Context, relay *nostr.Relay, evt nostr.Event) error {
-	pubCtx, cancel := context.WithTimeout(ctx, p.publishTimeout)
-	defer cancel()
-	return relay.Publish(pubCtx, evt)
+	return m
 }
 
 func (p *Publisher) runMetrics(ctx context.Context) {
+	defer p.wg.Done()
 	ticker := time.NewTicker(p.metricsInterval)
 	defer ticker.Stop()
 	for {
@@ -213,9 +246,11 @@ func (p *Publisher) runMetrics(ctx context.Context) {
 		case <-p.done:
 			return
 		case <-ticker.C:
-			m := p.Metrics()
-			p.logger.Printf("quarantine metrics: enqueued=%d dropped=%d published=%d publishErrors=%d reconnects=%d connected=%t queueDepth=%d",
-				m.Enqueued, m.Dropped, m.Published, m.PublishErrors, m.ReconnectCount, m.Connected, len(p.queue))
+			for _, d := range p.dests {
+				m := d.metrics()
+				p.logger.Printf("quarantine metrics: relay=%s enqueued=%d dropped=%d published=%d publishErrors=%d reconnects=%d connected=%t queueDepth=%d inflight=%d spoolDepth=%d spoolBytes=%d",
+					m.RelayURL, m.Enqueued, m.Dropped, m.Published, m.PublishErrors, m.ReconnectCount, m.Connected, len(d.queue), m.Inflight, m.SpoolDepth, m.SpoolBytes)
+			}
 		}
 	}
 }
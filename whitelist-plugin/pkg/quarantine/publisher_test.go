@@ -36,6 +36,10 @@ type fakeRelay struct {
 	srv       *httptest.Server
 	received  chan nostr.Event
 	rejectAll atomic.Bool
+	silent    atomic.Bool // read EVENTs but never answer OK
+	okDelay   time.Duration // answer OK this long after each EVENT, concurrently
+	inflight  atomic.Int32  // EVENTs not yet answered
+	peak      atomic.Int32
 	closeOnce sync.Once
 	connMu    sync.Mutex
 	conns     []*websocket.Conn
@@ -43,7 +47,12 @@ type fakeRelay struct {
 
 func newFakeRelay(t *testing.T) *fakeRelay {
 	t.Helper()
-	r := &fakeRelay{received: make(chan nostr.Event, 100)}
+	return newSlowRelay(t, 0)
+}
+
+func newSlowRelay(t *testing.T, okDelay time.Duration) *fakeRelay {
+	t.Helper()
+	r := &fakeRelay{received: make(chan nostr.Event, 100), okDelay: okDelay}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", r.handle)
 	r.srv = httptest.NewServer(mux)
@@ -88,14 +97,33 @@ func (r *fakeRelay) handle(w http.ResponseWriter, req *http.Request) {
 		if err := json.Unmarshal(msg[1], &evt); err != nil {
 			continue
 		}
+		if r.silent.Load() {
+			continue
+		}
 		ok := !r.rejectAll.Load()
 		reply, _ := json.Marshal([]interface{}{"OK", evt.ID, ok, ""})
-		_ = c.Write(ctx, websocket.MessageText, reply)
-		if ok {
-			select {
-			case r.received <- evt:
-			default:
-			}
+		if r.okDelay == 0 {
+			_ = c.Write(ctx, websocket.MessageText, reply)
+			r.deliver(ok, evt)
+			continue
+		}
+		n := r.inflight.Add(1)
+		for p := r.peak.Load(); n > p && !r.peak.CompareAndSwap(p, n); p = r.peak.Load() {
+		}
+		go func() {
+			time.Sleep(r.okDelay)
+			r.inflight.Add(-1)
+			_ = c.Write(ctx, websocket.MessageText, reply)
+			r.deliver(ok, evt)
+		}()
+	}
+}
+
+func (r *fakeRelay) deliver(ok bool, evt nostr.Event) {
+	if ok {
+		select {
+		case r.received <- evt:
+		default:
 		}
 	}
 }
@@ -307,8 +335,11 @@ func TestPublisher_MetricsTickerAndContextCancel(t *testing.T) {
 
 func TestPublisher_DefaultsApplied(t *testing.T) {
 	p := NewPublisher(Config{RelayURL: "ws://127.0.0.1:1"}, nil)
-	if cap(p.queue) != DefaultBufferSize {
-		t.Fatalf("queue cap = %d, want %d", cap(p.queue), DefaultBufferSize)
+	if cap(p.dests[0].queue) != DefaultBufferSize {
+		t.Fatalf("queue cap = %d, want %d", cap(p.dests[0].queue), DefaultBufferSize)
+	}
+	if p.dests[0].maxInflight != DefaultMaxInflight {
+		t.Fatalf("maxInflight = %d, want %d", p.dests[0].maxInflight, DefaultMaxInflight)
 	}
 	if p.publishTimeout != DefaultPublishTimeout {
 		t.Fatalf("publishTimeout = %v, want %v", p.publishTimeout, DefaultPublishTimeout)
@@ -317,3 +348,79 @@ func TestPublisher_DefaultsApplied(t *testing.T) {
 		t.Fatalf("metricsInterval = %v, want %v", p.metricsInterval, DefaultMetricsInterval)
 	}
 }
+
+func TestPublisher_FanOutSlowDestination(t *testing.T) {
+	fast := newFakeRelay(t)
+	slow := newSlowRelay(t, 300*time.Millisecond)
+
+	p := NewPublisher(Config{
+		RelayURL:        fast.wsURL(),
+		RelayURLs:       []string{slow.wsURL(), fast.wsURL()}, // duplicate is ignored
+		BufferSize:      100,
+		MaxInflight:     8,
+		PublishTimeout:  2 * time.Second,
+		MetricsInterval: time.Hour,
+	}, silentLogger())
+	if len(p.dests) != 2 {
+		t.Fatalf("%d destinations, want 2", len(p.dests))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.Start(ctx)
+	defer p.Stop(time.Second)
+
+	const n = 16
+	for i := range n {
+		if !p.Enqueue(makeEvent(fmt.Sprint(i))) {
+			t.Fatalf("enqueue %d dropped", i)
+		}
+	}
+
+	// The fast relay gets everything while the slow one is still on its first
+	// OKs.
+	for i := range n {
+		select {
+		case <-fast.received:
+		case <-time.After(250 * time.Millisecond):
+			t.Fatalf("fast relay got %d/%d events; held up by the slow one", i, n)
+		}
+	}
+
+	// The slow relay answers 300ms after each EVENT; one at a time would take
+	// 4.8s.
+	waitFor(t, 2*time.Second, "slow relay published all events",
+		func() bool { return p.Metrics().Destinations[1].Published == n })
+	if peak := slow.peak.Load(); peak < 2 {
+		t.Errorf("slow relay saw at most %d EVENTs awaiting OK; publishes were not pipelined", peak)
+	}
+	if peak := slow.peak.Load(); peak > 8 {
+		t.Errorf("slow relay saw %d EVENTs awaiting OK, over MaxInflight", peak)
+	}
+
+	m := p.Metrics()
+	if m.Enqueued != 2*n || m.Published != 2*n {
+		t.Errorf("metrics = %+v, want %d enqueued and published over both destinations", m, 2*n)
+	}
+	if m.Destinations[0].RelayURL != fast.wsURL() || m.Destinations[0].Published != n {
+		t.Errorf("fast destination = %+v", m.Destinations[0])
+	}
+}
+
+func TestPublisher_EnqueueFullDestination(t *testing.T) {
+	p := NewPublisher(Config{
+		RelayURL:        "ws://127.0.0.1:1",
+		RelayURLs:       []string{"ws://127.0.0.1:2"},
+		BufferSize:      1,
+		MetricsInterval: time.Hour,
+	}, silentLogger())
+	p.dests[1].queue <- makeEvent("filler") // second destination is full
+
+	if p.Enqueue(makeEvent("1")) {
+		t.Fatal("Enqueue reported success with a destination full")
+	}
+	m := p.Metrics()
+	if m.Destinations[0].Enqueued != 1 || m.Destinations[1].Dropped != 1 {
+		t.Fatalf("destinations = %+v; the free one should still take the event", m.Destinations)
+	}
+}
@@ -0,0 +1,463 @@
+package quarantine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// DefaultSpoolMaxBytes caps the spool on disk when config omits a limit.
+	DefaultSpoolMaxBytes = 1 << 30
+
+	// spoolSegmentSize is the size at which the spool starts a new segment
+	// file. Fully published segments are deleted whole.
+	spoolSegmentSize = 16 << 20
+
+	// spoolCursorEvery bounds how often the read position is persisted. After
+	// a crash at most this much publishing is repeated; the relay dedupes
+	// events by id.
+	spoolCursorEvery = time.Second
+
+	spoolHeaderSize = 8 // uint32 payload length, uint32 CRC-32C of the payload
+	spoolMaxRecord  = 4 << 20
+	spoolSegExt     = ".seg"
+	spoolCursorFile = "cursor"
+)
+
+var (
+	errSpoolFull   = errors.New("spool full")
+	errSpoolClosed = errors.New("spool closed")
+	crcTable       = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// spool is an append-only queue of events in numbered segment files under
+// dir. Each record is a length and CRC-32C header followed by the event's
+// JSON. The reader takes records in order, several at a time if it likes,
+// and acks each once the relay has it; the saved position only moves past
+// records acked with everything before them, so events survive restarts and
+// relay outages. A torn or corrupt record ends its segment: the reader skips
+// to the next one.
+type spool struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+	logger      *log.Logger
+	notify      chan struct{} // signalled when records are flushed
+
+	mu      sync.Mutex
+	closed  bool
+	segs    []uint64 // segment ids on disk, oldest first; the last is being written
+	w       *os.File
+	wbuf    *bufio.Writer
+	wSize   int64
+	r       *os.File
+	rSeg    uint64
+	rOff    int64
+	cur     spoolCursor    // everything before it is acked
+	pending []spoolPending // taken by the reader and not yet behind cur
+	seq     uint64         // seq of the next record taken
+	depth   int64
+	bytes   int64
+	saved   time.Time
+}
+
+// spoolRecord is an event taken from the spool; ack it by seq.
+type spoolRecord struct {
+	seq uint64
+	evt nostr.Event
+}
+
+// spoolPending tracks a taken record, or with endOf set the end of a segment
+// the reader has moved past, until it can be folded into the cursor.
+type spoolPending struct {
+	acked bool
+	seg   uint64
+	end   int64
+	endOf bool
+}
+
+type spoolCursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// openSpool opens or creates the spool in dir and counts the records still
+// to publish. Writing always starts in a new segment, so a record torn by a
+// crash is never appended to.
+func openSpool(dir string, maxBytes int64, logger *log.Logger) (*spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpoolMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &spool{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: spoolSegmentSize,
+		logger:      logger,
+		notify:      make(chan struct{}, 1),
+	}
+
+	segs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	cur := s.loadCursor()
+	for len(segs) > 0 && segs[0] < cur.Segment {
+		os.Remove(s.segPath(segs[0]))
+		segs = segs[1:]
+	}
+	if len(segs) > 0 && segs[0] != cur.Segment {
+		cur = spoolCursor{Segment: segs[0]}
+	}
+	for _, id := range segs {
+		from := int64(0)
+		if id == cur.Segment {
+			from = cur.Offset
+		}
+		n, size, err := s.scanSegment(id, from)
+		if err != nil {
+			return nil, err
+		}
+		s.depth += n
+		s.bytes += size
+	}
+	s.segs = segs
+
+	next := uint64(1)
+	if len(segs) > 0 {
+		next = segs[len(segs)-1] + 1
+	}
+	if err := s.startSegment(next); err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		cur = spoolCursor{Segment: next}
+	}
+	s.cur = cur
+	s.rSeg, s.rOff = cur.Segment, cur.Offset
+	if err := s.openReader(); err != nil {
+		s.w.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spool) segPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, spoolSegExt))
+}
+
+func (s *spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), spoolSegExt)
+		if !ok {
+			continue
+		}
+		if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *spool) loadCursor() spoolCursor {
+	var cur spoolCursor
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	if err != nil {
+		return cur
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		s.logger.Printf("quarantine: spool cursor unreadable, replaying spool from the start: %v", err)
+		return spoolCursor{}
+	}
+	return cur
+}
+
+// saveCursor persists the read position with a temp file and rename. Called
+// with mu held.
+func (s *spool) saveCursor() error {
+	data, _ := json.Marshal(s.cur)
+	path := filepath.Join(s.dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	s.saved = time.Now()
+	return os.Rename(tmp, path)
+}
+
+// scanSegment counts the valid records in segment id from offset on and
+// returns them with the segment's size.
+func (s *spool) scanSegment(id uint64, from int64) (int64, int64, error) {
+	f, err := os.Open(s.segPath(id))
+	if err != nil {
+		return 0, 0, fmt.Errorf("open spool segment: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("stat spool segment: %w", err)
+	}
+	var n int64
+	for off := from; ; n++ {
+		_, size, err := readRecord(f, off)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.Printf("quarantine: spool segment %d: %v at offset %d; later records in it are skipped", id, err, off)
+			}
+			return n, st.Size(), nil
+		}
+		off += size
+	}
+}
+
+// readRecord decodes the record at off and returns it with its size on disk.
+// io.EOF means no complete record starts there.
+func readRecord(f *os.File, off int64) (nostr.Event, int64, error) {
+	var evt nostr.Event
+	var hdr [spoolHeaderSize]byte
+	if _, err := f.ReadAt(hdr[:], off); err != nil {
+		return evt, 0, io.EOF
+	}
+	n := binary.LittleEndian.Uint32(hdr[:4])
+	if n == 0 || n > spoolMaxRecord {
+		return evt, 0, fmt.Errorf("bad record length %d", n)
+	}
+	payload := make([]byte, n)
+	if _, err := f.ReadAt(payload, off+spoolHeaderSize); err != nil {
+		return evt, 0, io.EOF
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return evt, 0, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return evt, 0, fmt.Errorf("decode record: %w", err)
+	}
+	return evt, spoolHeaderSize + int64(n), nil
+}
+
+// startSegment closes the current segment, if any, and starts writing id.
+// Called with mu held.
+func (s *spool) startSegment(id uint64) error {
+	if s.w != nil {
+		if err := s.wbuf.Flush(); err != nil {
+			return err
+		}
+		if err := s.w.Sync(); err != nil {
+			return err
+		}
+		s.w.Close()
+	}
+	f, err := os.OpenFile(s.segPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("create spool segment: %w", err)
+	}
+	s.w, s.wbuf, s.wSize = f, bufio.NewWriter(f), 0
+	s.segs = append(s.segs, id)
+	return nil
+}
+
+func (s *spool) openReader() error {
+	f, err := os.Open(s.segPath(s.rSeg))
+	if err != nil {
+		return fmt.Errorf("open spool segment: %w", err)
+	}
+	s.r = f
+	return nil
+}
+
+// append buffers evt at the tail of the spool; flush makes it readable.
+func (s *spool) append(evt nostr.Event) error {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if len(payload) > spoolMaxRecord {
+		return fmt.Errorf("event %s too large to spool", evt.ID)
+	}
+	size := int64(spoolHeaderSize + len(payload))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSpoolClosed
+	}
+	if s.bytes+size > s.maxBytes {
+		return errSpoolFull
+	}
+	if s.wSize > 0 && s.wSize+size > s.segmentSize {
+		if err := s.startSegment(s.segs[len(s.segs)-1] + 1); err != nil {
+			return err
+		}
+	}
+	var hdr [spoolHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[4:], crc32.Checksum(payload, crcTable))
+	s.wbuf.Write(hdr[:])
+	if _, err := s.wbuf.Write(payload); err != nil {
+		return fmt.Errorf("write spool: %w", err)
+	}
+	s.wSize += size
+	s.bytes += size
+	s.depth++
+	return nil
+}
+
+// flush writes buffered records to the segment file and wakes the reader.
+func (s *spool) flush() error {
+	s.mu.Lock()
+	err := s.flushLocked()
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+func (s *spool) flushLocked() error {
+	if s.closed {
+		return nil
+	}
+	if err := s.wbuf.Flush(); err != nil {
+		return fmt.Errorf("flush spool: %w", err)
+	}
+	return nil
+}
+
+// next takes the oldest record the reader has not taken yet, or returns
+// false if there is none.
+func (s *spool) next() (spoolRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return spoolRecord{}, false
+	}
+	for {
+		evt, size, err := readRecord(s.r, s.rOff)
+		if err == nil {
+			s.rOff += size
+			rec := spoolRecord{seq: s.seq, evt: evt}
+			s.push(spoolPending{seg: s.rSeg, end: s.rOff})
+			return rec, true
+		}
+		if s.rSeg == s.segs[len(s.segs)-1] {
+			// A short read at the tail of the live segment is a record
+			// still in the write buffer, not corruption.
+			return spoolRecord{}, false
+		}
+		if !errors.Is(err, io.EOF) {
+			s.logger.Printf("quarantine: spool segment %d: %v at offset %d; skipping to the next segment", s.rSeg, err, s.rOff)
+		}
+		if err := s.nextSegment(); err != nil {
+			s.logger.Printf("quarantine: spool: %v", err)
+			return spoolRecord{}, false
+		}
+	}
+}
+
+func (s *spool) push(p spoolPending) {
+	s.pending = append(s.pending, p)
+	s.seq++
+}
+
+// nextSegment moves the reader to the segment after the one it has read to
+// the end. The old segment is deleted once every record in it is acked.
+// Called with mu held.
+func (s *spool) nextSegment() error {
+	s.r.Close()
+	i := slices.Index(s.segs, s.rSeg)
+	s.push(spoolPending{acked: true, seg: s.rSeg, endOf: true})
+	s.rSeg, s.rOff = s.segs[i+1], 0
+	s.advance()
+	return s.openReader()
+}
+
+// ack marks the record taken with seq as published.
+func (s *spool) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := s.seq - uint64(len(s.pending))
+	if s.closed || seq < first || seq >= s.seq || s.pending[seq-first].acked {
+		return
+	}
+	s.pending[seq-first].acked = true
+	s.depth--
+	s.advance()
+}
+
+// advance moves the cursor past the acked prefix of pending, deleting
+// segments it leaves behind. Called with mu held.
+func (s *spool) advance() {
+	moved, deleted := false, false
+	for len(s.pending) > 0 && s.pending[0].acked {
+		p := s.pending[0]
+		s.pending = s.pending[1:]
+		moved = true
+		if !p.endOf {
+			s.cur = spoolCursor{Segment: p.seg, Offset: p.end}
+			continue
+		}
+		if st, err := os.Stat(s.segPath(p.seg)); err == nil {
+			s.bytes -= st.Size()
+		}
+		os.Remove(s.segPath(p.seg))
+		s.segs = slices.DeleteFunc(s.segs, func(id uint64) bool { return id == p.seg })
+		s.cur = spoolCursor{Segment: s.segs[0]}
+		deleted = true
+	}
+	if deleted || (moved && time.Since(s.saved) >= spoolCursorEvery) {
+		if err := s.saveCursor(); err != nil {
+			s.logger.Printf("quarantine: save spool cursor: %v", err)
+		}
+	}
+}
+
+// stats returns the records still to publish and the bytes on disk.
+func (s *spool) stats() (depth, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth, s.bytes
+}
+
+// close flushes and syncs the spool and saves the read position.
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	err := s.flushLocked()
+	if err == nil {
+		err = s.w.Sync()
+	}
+	if cerr := s.saveCursor(); err == nil {
+		err = cerr
+	}
+	s.w.Close()
+	s.r.Close()
+	s.closed = true
+	return err
+}
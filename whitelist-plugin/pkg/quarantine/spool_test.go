@@ -0,0 +1,249 @@
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func drainSpool(t *testing.T, s *spool) []string {
+	t.Helper()
+	var ids []string
+	for {
+		rec, ok := s.next()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, rec.evt.ID)
+		s.ack(rec.seq)
+	}
+}
+
+func TestSpool_OrderAcrossSegmentsAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 0, silentLogger())
+	if err != nil {
+		t.Fatalf("openSpool: %v", err)
+	}
+	s.segmentSize = 512 // a few events per segment
+
+	for i := range 20 {
+		if err := s.append(makeEvent(fmt.Sprintf("e%02d", i))); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	s.flush()
+	if depth, _ := s.stats(); depth != 20 {
+		t.Fatalf("depth = %d, want 20", depth)
+	}
+
+	// Take the first 8 and ack all but the 6th (still in flight), then
+	// restart: publishing resumes from the 6th.
+	var recs []spoolRecord
+	for i := range 8 {
+		rec, ok := s.next()
+		if !ok || rec.evt.ID != fmt.Sprintf("e%02d", i) {
+			t.Fatalf("next %d = %q, %v", i, rec.evt.ID, ok)
+		}
+		recs = append(recs, rec)
+	}
+	for i, rec := range recs {
+		if i != 5 {
+			s.ack(rec.seq)
+		}
+	}
+	if depth, _ := s.stats(); depth != 13 {
+		t.Fatalf("depth = %d, want 13", depth)
+	}
+	if err := s.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	s, err = openSpool(dir, 0, silentLogger())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.close()
+	if depth, _ := s.stats(); depth != 15 {
+		t.Fatalf("depth after restart = %d, want 15", depth)
+	}
+	ids := drainSpool(t, s)
+	if len(ids) != 15 || ids[0] != "e05" || ids[1] != "e06" || ids[14] != "e19" {
+		t.Fatalf("drained %v", ids)
+	}
+
+	// Fully read segments are deleted; only the live one is left.
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegExt))
+	if len(segs) != 1 {
+		t.Errorf("%d segments on disk after draining, want 1", len(segs))
+	}
+}
+
+func TestSpool_TornTailIsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := openSpool(dir, 0, silentLogger())
+	s.append(makeEvent("a"))
+	s.append(makeEvent("b"))
+	s.close()
+
+	// Simulate a crash mid-write: chop the last record in half.
+	path := s.segPath(1)
+	st, _ := os.Stat(path)
+	os.Truncate(path, st.Size()-10)
+
+	s, err := openSpool(dir, 0, silentLogger())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.close()
+	s.append(makeEvent("c"))
+	s.flush()
+	if depth, _ := s.stats(); depth != 2 {
+		t.Fatalf("depth = %d, want 2 (a, c)", depth)
+	}
+	if ids := drainSpool(t, s); len(ids) != 2 || ids[0] != "a" || ids[1] != "c" {
+		t.Fatalf("drained %v, want [a c]", ids)
+	}
+}
+
+func TestSpool_CorruptRecordSkipsRestOfSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := openSpool(dir, 0, silentLogger())
+	s.append(makeEvent("a"))
+	s.append(makeEvent("b"))
+	s.close()
+
+	f, _ := os.OpenFile(s.segPath(1), os.O_RDWR, 0)
+	f.WriteAt([]byte("X"), spoolHeaderSize+2) // inside a's payload
+	f.Close()
+
+	s, _ = openSpool(dir, 0, silentLogger())
+	defer s.close()
+	s.append(makeEvent("c"))
+	s.flush()
+	if ids := drainSpool(t, s); len(ids) != 1 || ids[0] != "c" {
+		t.Fatalf("drained %v, want [c]", ids)
+	}
+}
+
+func TestSpool_Full(t *testing.T) {
+	s, _ := openSpool(t.TempDir(), 300, silentLogger())
+	defer s.close()
+	var err error
+	n := 0
+	for ; err == nil; n++ {
+		err = s.append(makeEvent(fmt.Sprint(n)))
+	}
+	if err != errSpoolFull {
+		t.Fatalf("err = %v, want errSpoolFull", err)
+	}
+	if _, bytes := s.stats(); bytes > 300 {
+		t.Errorf("spool holds %d bytes, over its 300-byte cap", bytes)
+	}
+}
+
+func TestPublisher_SpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		RelayURL:        "ws://127.0.0.1:1",
+		BufferSize:      100,
+		PublishTimeout:  50 * time.Millisecond,
+		MetricsInterval: time.Hour,
+	}
+
+	p := NewPublisher(cfg, silentLogger())
+	if err := p.EnableSpool(dir, 0); err != nil {
+		t.Fatalf("EnableSpool: %v", err)
+	}
+	// Run only the spool writer, so the events stay on disk whatever the relay
+	// does.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.wg.Add(1)
+	go p.dests[0].runSpool(ctx)
+	for i := range 10 {
+		if !p.Enqueue(makeEvent(fmt.Sprint(i))) {
+			t.Fatalf("enqueue %d dropped", i)
+		}
+	}
+	waitFor(t, 2*time.Second, "events spooled", func() bool { return p.Metrics().SpoolDepth == 10 })
+	p.Stop(2 * time.Second)
+
+	p = NewPublisher(cfg, silentLogger())
+	if err := p.EnableSpool(dir, 0); err != nil {
+		t.Fatalf("EnableSpool after restart: %v", err)
+	}
+	m := p.Metrics()
+	if m.SpoolDepth != 10 || m.SpoolBytes == 0 {
+		t.Fatalf("after restart metrics = %+v, want 10 spooled events", m)
+	}
+	if ids := drainSpool(t, p.dests[0].spool); len(ids) != 10 || ids[0] != "0" || ids[9] != "9" {
+		t.Fatalf("drained %v", ids)
+	}
+	p.dests[0].spool.close()
+}
+
+// TestPublisher_SpoolKeptWhileRelayNeverAnswers: a relay that takes EVENTs but
+// never sends OK must not cost the spool anything, however many times each
+// publish times out.
+func TestPublisher_SpoolKeptWhileRelayNeverAnswers(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.silent.Store(true)
+	p := NewPublisher(Config{
+		RelayURL:        relay.wsURL(),
+		BufferSize:      100,
+		PublishTimeout:  20 * time.Millisecond,
+		MetricsInterval: time.Hour,
+	}, silentLogger())
+	if err := p.EnableSpool(t.TempDir(), 0); err != nil {
+		t.Fatalf("EnableSpool: %v", err)
+	}
+	p.Start(context.Background())
+	defer p.Stop(2 * time.Second)
+
+	for i := range 3 {
+		if !p.Enqueue(makeEvent(fmt.Sprint(i))) {
+			t.Fatalf("enqueue %d dropped", i)
+		}
+	}
+	waitFor(t, 5*time.Second, "every event timed out more than maxSpoolAttempts times", func() bool {
+		return p.Metrics().PublishErrors > 3*maxSpoolAttempts+3
+	})
+	if depth := p.Metrics().SpoolDepth; depth != 3 {
+		t.Fatalf("spool depth = %d after timeouts, want all 3 events kept", depth)
+	}
+
+	// Once the relay answers, the kept events are published.
+	relay.silent.Store(false)
+	waitFor(t, 5*time.Second, "spool drained", func() bool { return p.Metrics().SpoolDepth == 0 })
+}
+
+// TestPublisher_SpoolGivesUpOnRefusedEvent: an event the relay keeps refusing
+// is dropped from the spool after maxSpoolAttempts refusals.
+func TestPublisher_SpoolGivesUpOnRefusedEvent(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.rejectAll.Store(true)
+	p := NewPublisher(Config{
+		RelayURL:        relay.wsURL(),
+		BufferSize:      100,
+		PublishTimeout:  time.Second,
+		MetricsInterval: time.Hour,
+	}, silentLogger())
+	if err := p.EnableSpool(t.TempDir(), 0); err != nil {
+		t.Fatalf("EnableSpool: %v", err)
+	}
+	p.Start(context.Background())
+	defer p.Stop(2 * time.Second)
+
+	p.Enqueue(makeEvent("refused"))
+	waitFor(t, 5*time.Second, "refused event given up", func() bool {
+		m := p.Metrics()
+		return m.PublishErrors >= maxSpoolAttempts && m.SpoolDepth == 0
+	})
+	if m := p.Metrics(); m.PublishErrors != maxSpoolAttempts || m.ReconnectCount != 1 {
+		t.Errorf("metrics = %+v, want %d refusals on one connection", m, maxSpoolAttempts)
+	}
+}
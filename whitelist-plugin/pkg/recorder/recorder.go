@@ -0,0 +1,274 @@
+// Package recorder tees a StrFry plugin's traffic to rotating JSONL files:
+// every request line with the response the plugin wrote, and the whitelist
+// answers its decisions were based on. cmd/plugin-replay feeds a recording
+// back through a handler to see which decisions a change would alter.
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"whitelist-plugin/pkg/config"
+)
+
+// Defaults for Config.MaxSize and Config.MaxFiles.
+const (
+	DefaultMaxSize  = 64 << 20
+	DefaultMaxFiles = 5
+)
+
+// maxSeen bounds the per-pubkey answers remembered to skip repeated check
+// entries, and the answers awaiting their events; past it the memory starts
+// over.
+const maxSeen = 1 << 14
+
+// Entry is one line of a recording: an event (Input and Output) or a
+// whitelist answer (Check). A Check applies to the events recorded after it.
+type Entry struct {
+	Time   time.Time       `json:"time"`
+	Input  json.RawMessage `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Check  *Check          `json:"check,omitempty"`
+}
+
+// Check is the whitelist's answer for a pubkey.
+type Check struct {
+	Pubkey      string `json:"pubkey"`
+	Whitelisted bool   `json:"whitelisted"`
+	Tier        int    `json:"tier,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Config controls where a Recorder writes and how much it keeps.
+type Config struct {
+	Path     string // current file; rotated files get .1, .2, ... (oldest last)
+	MaxSize  int64  // rotate once the current file reaches this many bytes
+	MaxFiles int    // files kept, current one included
+}
+
+// Recorder appends entries to Config.Path. A nil *Recorder records nothing.
+// Write failures are logged, never returned: recording must not change a
+// plugin's decisions.
+type Recorder struct {
+	cfg     Config
+	logger  *log.Logger
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	failing bool
+	seen    map[string]Check   // last answer recorded per pubkey
+	pending map[string][]Check // answers not yet recorded, by event id
+}
+
+// Open starts recording to cfg.Path, appending to an existing file.
+func Open(cfg Config, logger *log.Logger) (*Recorder, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+	cfg.MaxFiles = max(cfg.MaxFiles, 1)
+	r := &Recorder{cfg: cfg, logger: logger, seen: make(map[string]Check), pending: make(map[string][]Check)}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// FromConfig starts recording as a plugin's record config says. With no
+// path it returns nil, which records nothing.
+func FromConfig(cfg config.RecordConfig, logger *log.Logger) (*Recorder, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	r, err := Open(Config{Path: cfg.Path, MaxSize: cfg.MaxSize, MaxFiles: cfg.MaxFiles}, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Recording traffic to %s (max %d bytes x %d files)", cfg.Path, r.cfg.MaxSize, r.cfg.MaxFiles)
+	return r, nil
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(r.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open recording: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat recording: %w", err)
+	}
+	r.f, r.size = f, st.Size()
+	return nil
+}
+
+// Check holds the whitelist answer eventID's decision used until Record
+// writes that event. It is a handler.CheckObserver.
+func (r *Recorder) Check(eventID, pubkey string, ok bool, tier int, err error) {
+	if r == nil {
+		return
+	}
+	c := Check{Pubkey: pubkey, Whitelisted: ok, Tier: tier}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) >= maxSeen {
+		clear(r.pending) // answers whose responses never named their event
+	}
+	r.pending[eventID] = append(r.pending[eventID], c)
+}
+
+// Record appends one request line and the response written for it, preceded
+// by the whitelist answer its decision used when that differs from the last
+// one recorded for the pubkey. It is a pipeline.Written, so plugins record in
+// the order StrFry saw responses and every answer lands just ahead of the
+// events decided with it.
+func (r *Recorder) Record(input, output []byte) {
+	if r == nil {
+		return
+	}
+	now := time.Now().UTC()
+	if c, ok := r.takeCheck(output); ok {
+		r.write(Entry{Time: now, Check: &c})
+	}
+	r.write(Entry{Time: now, Input: rawJSON(input), Output: rawJSON(output)})
+}
+
+// takeCheck returns the oldest pending answer for the event output responds
+// to, if it is news for its pubkey.
+func (r *Recorder) takeCheck(output []byte) (Check, bool) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(output, &resp) != nil {
+		return Check{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := r.pending[resp.ID]
+	if len(queue) == 0 {
+		return Check{}, false
+	}
+	c := queue[0]
+	if len(queue) == 1 {
+		delete(r.pending, resp.ID)
+	} else {
+		r.pending[resp.ID] = queue[1:]
+	}
+	if last, seen := r.seen[c.Pubkey]; seen && last == c {
+		return Check{}, false
+	}
+	if len(r.seen) >= maxSeen {
+		clear(r.seen)
+	}
+	r.seen[c.Pubkey] = c
+	return c, true
+}
+
+func (r *Recorder) write(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		r.logger.Printf("recorder: encode entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil && r.size+int64(len(line)) > r.cfg.MaxSize && r.size > 0 {
+		err = r.rotate()
+	}
+	if err == nil && r.f == nil {
+		err = r.open()
+	}
+	if err == nil {
+		var n int
+		n, err = r.f.Write(line)
+		r.size += int64(n)
+	}
+	switch {
+	case err != nil && !r.failing:
+		r.logger.Printf("recorder: %v", err)
+		r.failing = true
+	case err == nil && r.failing:
+		r.logger.Printf("recorder: writing again")
+		r.failing = false
+	}
+}
+
+// rotate shifts path to path.1, path.1 to path.2 and so on, dropping the
+// oldest, and starts a new file with the remembered answers, so every file
+// replays on its own. Called with mu held.
+func (r *Recorder) rotate() error {
+	r.f.Close()
+	r.f = nil
+	if err := r.shift(); err != nil {
+		return fmt.Errorf("rotate recording: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.carryChecks()
+}
+
+func (r *Recorder) shift() error {
+	backups := r.cfg.MaxFiles - 1
+	if backups == 0 {
+		return os.Remove(r.cfg.Path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", r.cfg.Path, backups))
+	for i := backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.cfg.Path, i), fmt.Sprintf("%s.%d", r.cfg.Path, i+1))
+	}
+	return os.Rename(r.cfg.Path, r.cfg.Path+".1")
+}
+
+// carryChecks writes every remembered answer to the current file. Called with
+// mu held.
+func (r *Recorder) carryChecks() error {
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	for _, c := range r.seen {
+		line, err := json.Marshal(Entry{Time: now, Check: &c})
+		if err != nil {
+			return fmt.Errorf("encode entry: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	n, err := r.f.Write(buf.Bytes())
+	r.size += int64(n)
+	return err
+}
+
+// Close flushes and closes the current file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// rawJSON returns line without its newline, as a JSON string if it is not
+// valid JSON (a malformed request is worth recording too).
+func rawJSON(line []byte) json.RawMessage {
+	line = bytes.TrimRight(line, "\r\n")
+	if json.Valid(line) {
+		return append(json.RawMessage(nil), line...)
+	}
+	s, _ := json.Marshal(string(line))
+	return s
+}
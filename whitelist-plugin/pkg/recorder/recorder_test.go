@@ -0,0 +1,251 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"whitelist-plugin/pkg/config"
+	"whitelist-plugin/pkg/handler"
+)
+
+type stubChecker struct {
+	tiers map[string]int
+	err   error
+}
+
+func (s *stubChecker) IsWhitelisted(pubkey string) (bool, error) {
+	ok, _, err := s.CheckTier(pubkey)
+	return ok, err
+}
+
+func (s *stubChecker) CheckTier(pubkey string) (bool, int, error) {
+	if s.err != nil {
+		return false, 0, s.err
+	}
+	tier, ok := s.tiers[pubkey]
+	return ok, tier, nil
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("bad entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRecorder_RecordsEventsAndChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, err := Open(Config{Path: path}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	rec.Check("e1", "alice", true, 2, nil)
+	rec.Check("e2", "alice", true, 2, nil) // same answer: not recorded again
+	rec.Check("e3", "bob", false, 0, nil)
+	rec.Record([]byte(`{"type":"new","event":{"id":"e1"}}`+"\n"), []byte(`{"id":"e1","action":"accept","msg":""}`+"\n"))
+	rec.Record([]byte(`{"type":"new","event":{"id":"e2"}}`+"\n"), []byte(`{"id":"e2","action":"accept","msg":""}`+"\n"))
+	rec.Record([]byte(`{"type":"new","event":{"id":"e3"}}`+"\n"), []byte(`{"id":"e3","action":"reject","msg":""}`+"\n"))
+	rec.Record([]byte("not json\n"), []byte(`{"id":"","action":"reject","msg":"malformed"}`+"\n"))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	entries := readEntries(t, path)
+	if len(entries) != 6 {
+		t.Fatalf("got %d entries, want 6", len(entries))
+	}
+	if c := entries[0].Check; c == nil || *c != (Check{Pubkey: "alice", Whitelisted: true, Tier: 2}) {
+		t.Errorf("entry 0 = %+v, want alice's answer", entries[0])
+	}
+	if string(entries[1].Input) != `{"type":"new","event":{"id":"e1"}}` {
+		t.Errorf("input = %s", entries[1].Input)
+	}
+	if c := entries[3].Check; c == nil || *c != (Check{Pubkey: "bob"}) {
+		t.Errorf("entry 3 = %+v, want bob's answer", entries[3])
+	}
+	if string(entries[5].Input) != `"not json"` {
+		t.Errorf("malformed input = %s, want a JSON string", entries[5].Input)
+	}
+}
+
+func TestRecorder_CheckErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, _ := Open(Config{Path: path}, log.New(io.Discard, "", 0))
+	rec.Check("e1", "carol", false, 0, errors.New("server down"))
+	rec.Record([]byte(`{"type":"new"}`), []byte(`{"id":"e1","action":"reject","msg":""}`))
+	rec.Close()
+
+	entries := readEntries(t, path)
+	if len(entries) != 2 || entries[0].Check == nil || *entries[0].Check != (Check{Pubkey: "carol", Error: "server down"}) {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+// TestRecorder_ChecksFollowResponseOrder decides two of alice's events on
+// concurrent workers, the later one first and after her answer changed: each
+// answer must still land just before the event decided with it.
+func TestRecorder_ChecksFollowResponseOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, _ := Open(Config{Path: path}, log.New(io.Discard, "", 0))
+	rec.Check("e2", "alice", false, 0, nil)
+	rec.Check("e1", "alice", true, 1, nil)
+	rec.Record([]byte(`{"type":"new"}`), []byte(`{"id":"e1","action":"accept","msg":""}`))
+	rec.Record([]byte(`{"type":"new"}`), []byte(`{"id":"e2","action":"reject","msg":""}`))
+	rec.Close()
+
+	entries := readEntries(t, path)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	if c := entries[0].Check; c == nil || !c.Whitelisted {
+		t.Errorf("entry 0 = %+v, want e1's whitelisted answer", entries[0])
+	}
+	if c := entries[2].Check; c == nil || c.Whitelisted {
+		t.Errorf("entry 2 = %+v, want e2's rejected answer", entries[2])
+	}
+}
+
+func TestRecorder_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, _ := Open(Config{Path: path, MaxSize: 300, MaxFiles: 3}, log.New(io.Discard, "", 0))
+	for range 20 {
+		rec.Check("e", "alice", true, 1, nil)
+		rec.Record([]byte(`{"type":"new"}`), []byte(`{"id":"e","action":"accept","msg":""}`))
+	}
+	rec.Close()
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		entries := readEntries(t, p)
+		if len(entries) == 0 {
+			t.Fatalf("%s is empty", p)
+		}
+		if st, _ := os.Stat(p); st.Size() > 300 {
+			t.Errorf("%s is %d bytes, over MaxSize", p, st.Size())
+		}
+		if p != path && entries[0].Check == nil {
+			t.Errorf("%s does not start with the check its events need", p)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than MaxFiles files")
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var rec *Recorder
+	rec.Check("x", "alice", true, 1, nil)
+	rec.Record([]byte("x"), []byte("y"))
+	if err := rec.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	if rec, err := FromConfig(config.RecordConfig{}, logger); rec != nil || err != nil {
+		t.Fatalf("FromConfig(no path) = %v, %v; want nil, nil", rec, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, err := FromConfig(config.RecordConfig{Path: path, MaxFiles: 2}, logger)
+	if err != nil {
+		t.Fatalf("FromConfig: %v", err)
+	}
+	rec.Record([]byte(`{"type":"new"}`), []byte(`{"id":"e","action":"accept","msg":""}`))
+	rec.Close()
+	if got := readEntries(t, path); len(got) != 1 {
+		t.Errorf("%d entries, want 1", len(got))
+	}
+
+	if _, err := FromConfig(config.RecordConfig{Path: filepath.Join(t.TempDir(), "missing", "x.jsonl")}, logger); err == nil {
+		t.Error("FromConfig accepted a path in a missing directory")
+	}
+}
+
+func TestReplay_DiffsDecisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.jsonl")
+	rec, _ := Open(Config{Path: path}, log.New(io.Discard, "", 0))
+
+	// Record a run of the whitelist handler: alice whitelisted, bob not.
+	recorded := handler.NewWhitelistHandler(&stubChecker{tiers: map[string]int{"alice": 1}}, nil)
+	recorded.SetOnCheck(rec.Check)
+	for _, pk := range []string{"alice", "bob", "alice"} {
+		line, _ := handler.SerializeInputMsg(handler.InputMsg{Type: "new", Event: handler.Event{ID: "id-" + pk, Pubkey: pk}})
+		in, _ := handler.DeserializeInputMsg(line)
+		out, _ := recorded.Handle(in)
+		resp, _ := handler.SerializeOutputMsg(out)
+		rec.Record(line, resp)
+	}
+	rec.Close()
+
+	// Replay against a change that rejects alice's events.
+	fake := NewFakeChecker()
+	h := handler.NewWhitelistHandler(fake, nil)
+	decide := func(line []byte) handler.OutputMsg {
+		in, _ := handler.DeserializeInputMsg(line)
+		if in.Event.Pubkey == "alice" {
+			return handler.Reject(in.Event.ID, handler.RejectReasonPolicy)
+		}
+		out, _ := h.Handle(in)
+		return out
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	var diffs []Diff
+	sum, err := Replay(f, fake, decide, func(d Diff) { diffs = append(diffs, d) })
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if sum.Events != 3 || sum.Changed != 2 || sum.Transitions["accept -> reject"] != 2 {
+		t.Errorf("summary = %+v", sum)
+	}
+	if len(diffs) != 2 || !strings.Contains(string(diffs[0].Input), "id-alice") {
+		t.Errorf("diffs = %+v", diffs)
+	}
+	if fake.Unknown() != 0 {
+		t.Errorf("%d checks had no recorded answer", fake.Unknown())
+	}
+}
+
+func TestReplay_SameHandlerNoDiffs(t *testing.T) {
+	in := strings.Join([]string{
+		`{"time":"2026-01-01T00:00:00Z","check":{"pubkey":"alice","whitelisted":true,"tier":1}}`,
+		`{"time":"2026-01-01T00:00:00Z","input":{"type":"new","event":{"id":"e1","pubkey":"alice"}},"output":{"id":"e1","action":"accept","msg":""}}`,
+		`{"time":"2026-01-01T00:00:00Z","check":{"pubkey":"alice","whitelisted":false}}`,
+		`{"time":"2026-01-01T00:00:00Z","input":{"type":"new","event":{"id":"e2","pubkey":"alice"}},"output":{"id":"e2","action":"reject","msg":"rejected: not in web of trust"}}`,
+	}, "\n")
+	fake := NewFakeChecker()
+	h := handler.NewWhitelistHandler(fake, nil)
+	decide := func(line []byte) handler.OutputMsg {
+		msg, _ := handler.DeserializeInputMsg(line)
+		out, _ := h.Handle(msg)
+		return out
+	}
+	sum, err := Replay(strings.NewReader(in), fake, decide, nil)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if sum.Events != 2 || sum.Changed != 0 {
+		t.Errorf("summary = %+v", sum)
+	}
+}
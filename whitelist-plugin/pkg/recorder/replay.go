@@ -0,0 +1,121 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"whitelist-plugin/pkg/handler"
+)
+
+// FakeChecker answers whitelist checks from a recording's Check entries. A
+// pubkey the recording never checked is not whitelisted.
+type FakeChecker struct {
+	mu      sync.Mutex
+	answers map[string]Check
+	unknown int
+}
+
+func NewFakeChecker() *FakeChecker {
+	return &FakeChecker{answers: make(map[string]Check)}
+}
+
+// Set records c as the answer for its pubkey from now on.
+func (f *FakeChecker) Set(c Check) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[c.Pubkey] = c
+}
+
+func (f *FakeChecker) IsWhitelisted(pubkey string) (bool, error) {
+	ok, _, err := f.CheckTier(pubkey)
+	return ok, err
+}
+
+func (f *FakeChecker) CheckTier(pubkey string) (bool, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.answers[pubkey]
+	if !ok {
+		f.unknown++
+		return false, 0, nil
+	}
+	if c.Error != "" {
+		return false, 0, errors.New(c.Error)
+	}
+	return c.Whitelisted, c.Tier, nil
+}
+
+// Unknown is how many checks asked for a pubkey with no recorded answer.
+func (f *FakeChecker) Unknown() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.unknown
+}
+
+// Diff is an event whose replayed decision differs from the recorded one.
+type Diff struct {
+	Input    json.RawMessage   `json:"input"`
+	Recorded handler.OutputMsg `json:"recorded"`
+	Replayed handler.OutputMsg `json:"replayed"`
+}
+
+// Summary counts a replay's events and decision changes. Transitions is
+// keyed "recorded -> replayed" by action, e.g. "accept -> reject"; a changed
+// reject message counts as "reject -> reject".
+type Summary struct {
+	Events      int
+	Changed     int
+	Transitions map[string]int
+}
+
+// Replay reads a recording from r and feeds every event's input line to
+// decide, with checker answering as the recording's whitelist did at that
+// point. It calls onDiff for every decision that changed.
+func Replay(r io.Reader, checker *FakeChecker, decide func(line []byte) handler.OutputMsg, onDiff func(Diff)) (Summary, error) {
+	sum := Summary{Transitions: make(map[string]int)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 20*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return sum, fmt.Errorf("line %d: %w", n, err)
+		}
+		if e.Check != nil {
+			checker.Set(*e.Check)
+			continue
+		}
+		if e.Input == nil {
+			continue
+		}
+		var recorded handler.OutputMsg
+		if err := json.Unmarshal(e.Output, &recorded); err != nil {
+			return sum, fmt.Errorf("line %d: recorded output: %w", n, err)
+		}
+
+		sum.Events++
+		replayed := decide(inputLine(e.Input))
+		if replayed == recorded {
+			continue
+		}
+		sum.Changed++
+		sum.Transitions[fmt.Sprintf("%s -> %s", recorded.Action, replayed.Action)]++
+		if onDiff != nil {
+			onDiff(Diff{Input: e.Input, Recorded: recorded, Replayed: replayed})
+		}
+	}
+	return sum, scanner.Err()
+}
+
+// inputLine undoes rawJSON: a request that was not valid JSON was recorded
+// as a JSON string.
+func inputLine(raw json.RawMessage) []byte {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
@@ -13,8 +13,8 @@ import (
 )
 
 // GraphQLRepository retrieves whitelisted pubkeys from Dgraph. It fetches all
-// Profile pubkeys, merges them with hardcoded keys, deduplicates, and returns
-// the combined list.
+// Profile pubkeys with their trust signals, merges them with hardcoded keys,
+// deduplicates, and returns the combined list of records.
 //
 // Pagination uses Dgraph's DQL endpoint (/query) with uid-cursor pagination
 // (func: type(Profile), after: <lastUID>) rather than GraphQL offset pagination.
@@ -66,118 +66,175 @@ func deriveDQLEndpoint(graphqlURL string) string {
 	return strings.TrimRight(graphqlURL, "/") + "/query"
 }
 
-// GetAll retrieves all whitelisted pubkeys from Dgraph and merges with hardcoded keys.
-// Returns deduplicated list of pubkeys as [32]byte arrays.
-func (r *GraphQLRepository) GetAll(ctx context.Context) ([][32]byte, error) {
+// GetAll retrieves all whitelisted pubkeys from Dgraph with their trust
+// signals and merges in the hardcoded keys as pinned records.
+// Returns one deduplicated Record per pubkey.
+func (r *GraphQLRepository) GetAll(ctx context.Context) ([]Record, error) {
 	ctx, cancel := context.WithTimeout(ctx, r.queryTimeout)
 	defer cancel()
 
-	// Fetch all pubkeys from Dgraph
-	dgraphPubkeys, err := r.fetchAllPubkeysFromDgraph(ctx)
+	// Fetch all profiles from Dgraph
+	dgraphRecords, err := r.fetchAllPubkeysFromDgraph(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch pubkeys from Dgraph: %w", err)
 	}
 
 	// Get hardcoded pubkeys for known forwarders and admins
-	hardcodedPubkeys := getHardcodedPubkeys()
-
-	// Merge and deduplicate
-	allPubkeys := mergePubkeys(dgraphPubkeys, hardcodedPubkeys)
-
-	// Convert to [32]byte arrays with pre-allocated capacity
-	keys := make([][32]byte, 0, len(allPubkeys))
-	for i, hexStr := range allPubkeys {
+	hardcoded := getHardcodedPubkeys()
+	pinned := make([][32]byte, 0, len(hardcoded))
+	for _, hexStr := range hardcoded {
 		k, err := hexTo32ByteArray(hexStr)
 		if err != nil {
-			r.logger.Printf("invalid pubkey from Dgraph or hardcoded list: %d %d %s", len(allPubkeys), i, hexStr)
+			r.logger.Printf("invalid hardcoded pubkey: %s", hexStr)
 			continue
 		}
-		keys = append(keys, k)
+		pinned = append(pinned, k)
 	}
 
-	return keys, nil
+	// Merge and deduplicate
+	return mergeRecords(dgraphRecords, pinned), nil
 }
 
 // fetchAllPubkeysFromDgraph paginates through all Profile records in Dgraph
-// using a uid cursor and returns their pubkeys as hex strings.
-func (r *GraphQLRepository) fetchAllPubkeysFromDgraph(ctx context.Context) ([]string, error) {
+// using a uid cursor and returns them as scored records.
+func (r *GraphQLRepository) fetchAllPubkeysFromDgraph(ctx context.Context) ([]Record, error) {
+	records, _, err := r.fetchProfiles(ctx, "type(Profile)")
+	return records, err
+}
+
+// GetChangedSince returns the profiles whose last_db_update is at or after
+// since, with hardcoded keys marked pinned, plus the highest last_db_update
+// seen (since itself when nothing changed).
+//
+// The bound is inclusive so a write landing in the same second as the
+// previous watermark is not missed; the rows at the boundary are re-read,
+// which is harmless because applying a record is idempotent. trust_distance
+// and cluster_flagged are written by clusterscan without touching
+// last_db_update, so score changes from a scan wait for the next GetAll.
+func (r *GraphQLRepository) GetChangedSince(ctx context.Context, since int64) ([]Record, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	records, maxUpdate, err := r.fetchProfiles(ctx, fmt.Sprintf("ge(last_db_update, %d)", since))
+	if err != nil {
+		return nil, since, fmt.Errorf("failed to fetch changed pubkeys from Dgraph: %w", err)
+	}
+
+	pinned := make(map[[32]byte]struct{})
+	for _, hexStr := range getHardcodedPubkeys() {
+		if k, err := hexTo32ByteArray(hexStr); err == nil {
+			pinned[k] = struct{}{}
+		}
+	}
+	for i := range records {
+		if _, ok := pinned[records[i].Pubkey]; ok {
+			records[i].Pinned = true
+		}
+	}
+
+	return records, max(since, maxUpdate), nil
+}
+
+// fetchProfiles paginates through the Profile nodes matched by the DQL root
+// function using a uid cursor. It returns them as scored records together
+// with the highest last_db_update among them.
+func (r *GraphQLRepository) fetchProfiles(ctx context.Context, root string) ([]Record, int64, error) {
 	// Pre-allocate with estimated capacity to reduce reallocations
 	// Start with 2x pageSize as a reasonable minimum
-	allPubkeys := make([]string, 0, r.pageSize*2)
+	allRecords := make([]Record, 0, r.pageSize*2)
+	var maxUpdate int64
 	after := "" // empty cursor => start from the beginning
 
 	for {
 		// Context cancellation is checked automatically by http.Request
-		pubkeys, lastUID, rowCount, err := r.fetchPubkeysPage(ctx, after, r.pageSize)
+		page, err := r.fetchPubkeysPage(ctx, root, after, r.pageSize)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch page after uid %q: %w", after, err)
+			return nil, 0, fmt.Errorf("failed to fetch page after uid %q: %w", after, err)
 		}
 
 		// No more results
-		if rowCount == 0 {
+		if page.rows == 0 {
 			break
 		}
 
-		r.logger.Printf("Fetched %d pubkeys from Dgraph after uid %q\n", len(pubkeys), after)
+		r.logger.Printf("Fetched %d pubkeys from Dgraph after uid %q\n", len(page.records), after)
 
-		allPubkeys = append(allPubkeys, pubkeys...)
+		allRecords = append(allRecords, page.records...)
+		maxUpdate = max(maxUpdate, page.maxUpdate)
 
 		// A short page (fewer rows than requested) means we've reached the end.
-		// Use the page's row count, not len(pubkeys), since rows without a
+		// Use the page's row count, not len(records), since rows without a
 		// pubkey value are skipped from the result but still fill the page.
-		if rowCount < r.pageSize {
+		if page.rows < r.pageSize {
 			break
 		}
 
 		// Defensive guard against an infinite loop if the cursor fails to advance.
-		if lastUID == "" || lastUID == after {
+		if page.lastUID == "" || page.lastUID == after {
 			break
 		}
-		after = lastUID
+		after = page.lastUID
 	}
 
-	return allPubkeys, nil
+	return allRecords, maxUpdate, nil
 }
 
-// fetchPubkeysPage fetches a single page of pubkeys from Dgraph's DQL /query
-// endpoint, seeking past the given uid cursor. It returns the pubkeys found on
-// the page and the uid of the last row (the cursor for the next page); an empty
-// lastUID signals the end of pagination.
-func (r *GraphQLRepository) fetchPubkeysPage(ctx context.Context, after string, limit int) ([]string, string, int, error) {
+// profilePage is one uid-cursor page of Profile rows.
+type profilePage struct {
+	records   []Record
+	lastUID   string // cursor for the next page; empty at the end
+	rows      int    // rows returned, including ones skipped for a bad pubkey
+	maxUpdate int64  // highest last_db_update on the page
+}
+
+// fetchPubkeysPage fetches a single page of the profiles matched by the DQL
+// root function from Dgraph's DQL /query endpoint, seeking past the given uid
+// cursor. Only Profile nodes carry last_db_update, so the delta root needs no
+// type filter.
+//
+// trust_distance and cluster_flagged are written by clusterscan --write-scores
+// and are absent on nodes it has not placed; follower_count and last_db_update
+// are maintained by the crawler.
+func (r *GraphQLRepository) fetchPubkeysPage(ctx context.Context, root, after string, limit int) (profilePage, error) {
 	// DQL query with uid-cursor pagination. The cursor (after) is a Dgraph-issued
-	// uid (e.g. "0x140000"), so it is trusted and safe to inline.
+	// uid (e.g. "0x140000"), so it is trusted and safe to inline; root is built
+	// by this package from integers only.
 	cursor := ""
 	if after != "" {
 		cursor = fmt.Sprintf(", after: %s", after)
 	}
-	query := fmt.Sprintf(`{ q(func: type(Profile), first: %d%s) { uid pubkey } }`, limit, cursor)
+	query := fmt.Sprintf(`{ q(func: %s, first: %d%s) { uid pubkey follower_count trust_distance cluster_flagged last_db_update } }`, root, limit, cursor)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", r.dqlEndpoint, bytes.NewBufferString(query))
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to create request: %w", err)
+		return profilePage{}, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/dql")
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to execute request: %w", err)
+		return profilePage{}, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to read response body: %w", err)
+		return profilePage{}, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, "", 0, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+		return profilePage{}, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
 	}
 
 	var response struct {
 		Data struct {
 			Q []struct {
-				UID    string `json:"uid"`
-				Pubkey string `json:"pubkey"`
+				UID            string `json:"uid"`
+				Pubkey         string `json:"pubkey"`
+				FollowerCount  int    `json:"follower_count"`
+				TrustDistance  *int   `json:"trust_distance"`
+				ClusterFlagged bool   `json:"cluster_flagged"`
+				LastDBUpdate   int64  `json:"last_db_update"`
 			} `json:"q"`
 		} `json:"data"`
 		Errors []struct {
@@ -186,26 +243,46 @@ func (r *GraphQLRepository) fetchPubkeysPage(ctx context.Context, after string,
 	}
 
 	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, "", 0, fmt.Errorf("failed to unmarshal response: %w", err)
+		return profilePage{}, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if len(response.Errors) > 0 {
-		return nil, "", 0, fmt.Errorf("DQL error: %s", response.Errors[0].Message)
+		return profilePage{}, fmt.Errorf("DQL error: %s", response.Errors[0].Message)
 	}
 
 	rows := response.Data.Q
 	if len(rows) == 0 {
-		return nil, "", 0, nil
+		return profilePage{}, nil
 	}
 
-	pubkeys := make([]string, 0, len(rows))
+	page := profilePage{
+		records: make([]Record, 0, len(rows)),
+		lastUID: rows[len(rows)-1].UID,
+		rows:    len(rows),
+	}
 	for _, row := range rows {
-		if row.Pubkey != "" {
-			pubkeys = append(pubkeys, row.Pubkey)
+		page.maxUpdate = max(page.maxUpdate, row.LastDBUpdate)
+		if row.Pubkey == "" {
+			continue
+		}
+		k, err := hexTo32ByteArray(row.Pubkey)
+		if err != nil {
+			r.logger.Printf("invalid pubkey from Dgraph: uid=%s %s", row.UID, row.Pubkey)
+			continue
 		}
+		rec := Record{
+			Pubkey:        k,
+			FollowerCount: row.FollowerCount,
+			Distance:      NoDistance,
+			Flagged:       row.ClusterFlagged,
+		}
+		if row.TrustDistance != nil {
+			rec.Distance = *row.TrustDistance
+		}
+		page.records = append(page.records, rec)
 	}
 
-	return pubkeys, rows[len(rows)-1].UID, len(rows), nil
+	return page, nil
 }
 
 // getHardcodedPubkeys returns a list of hardcoded pubkeys for known forwarders and admins.
@@ -220,28 +297,31 @@ func getHardcodedPubkeys() []string {
 	}
 }
 
-// mergePubkeys merges two slices of pubkeys and deduplicates them.
-// Optimized to pre-size the map based on expected total keys.
-func mergePubkeys(dgraphKeys, hardcodedKeys []string) []string {
-	// Pre-size map with expected total to reduce rehashing
-	expectedSize := len(dgraphKeys) + len(hardcodedKeys)
-	seen := make(map[string]struct{}, expectedSize)
-	result := make([]string, 0, expectedSize)
-
-	// Add dgraph keys
-	for _, key := range dgraphKeys {
-		if _, exists := seen[key]; !exists {
-			seen[key] = struct{}{}
-			result = append(result, key)
+// mergeRecords deduplicates the Dgraph records by pubkey and marks every
+// hardcoded key as pinned, appending the ones Dgraph does not know about.
+// Optimized to pre-size the index based on expected total keys.
+func mergeRecords(dgraphRecords []Record, pinned [][32]byte) []Record {
+	// Pre-size index with expected total to reduce rehashing
+	expectedSize := len(dgraphRecords) + len(pinned)
+	index := make(map[[32]byte]int, expectedSize)
+	result := make([]Record, 0, expectedSize)
+
+	// Add dgraph records
+	for _, rec := range dgraphRecords {
+		if _, exists := index[rec.Pubkey]; !exists {
+			index[rec.Pubkey] = len(result)
+			result = append(result, rec)
 		}
 	}
 
-	// Add hardcoded keys
-	for _, key := range hardcodedKeys {
-		if _, exists := seen[key]; !exists {
-			seen[key] = struct{}{}
-			result = append(result, key)
+	// Pin hardcoded keys, keeping any Dgraph signals they already have
+	for _, k := range pinned {
+		if i, exists := index[k]; exists {
+			result[i].Pinned = true
+			continue
 		}
+		index[k] = len(result)
+		result = append(result, Record{Pubkey: k, Distance: NoDistance, Pinned: true})
 	}
 
 	return result
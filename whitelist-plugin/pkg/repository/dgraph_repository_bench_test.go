@@ -114,25 +114,24 @@ func BenchmarkFetchPubkeysPage(b *testing.B) {
 	}
 }
 
-// BenchmarkMergePubkeys tests the deduplication logic
-func BenchmarkMergePubkeys(b *testing.B) {
-	// Create 10,000 dgraph keys and 5 hardcoded keys (2 duplicates)
-	dgraphKeys := make([]string, 10000)
+// BenchmarkMergeRecords tests the deduplication logic
+func BenchmarkMergeRecords(b *testing.B) {
+	// Create 10,000 dgraph records and 5 hardcoded keys (2 duplicates)
+	dgraphRecords := make([]Record, 10000)
 	for i := 0; i < 10000; i++ {
-		dgraphKeys[i] = fmt.Sprintf("%064x", i)
+		k, _ := hexTo32ByteArray(fmt.Sprintf("%064x", i))
+		dgraphRecords[i] = Record{Pubkey: k, Distance: NoDistance}
 	}
 
-	hardcodedKeys := []string{
-		fmt.Sprintf("%064x", 0),     // duplicate
-		fmt.Sprintf("%064x", 1),     // duplicate
-		fmt.Sprintf("%064x", 10000), // unique
-		fmt.Sprintf("%064x", 10001), // unique
-		fmt.Sprintf("%064x", 10002), // unique
+	pinned := make([][32]byte, 0, 5)
+	for _, i := range []int{0, 1, 10000, 10001, 10002} { // 0 and 1 are duplicates
+		k, _ := hexTo32ByteArray(fmt.Sprintf("%064x", i))
+		pinned = append(pinned, k)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		result := mergePubkeys(dgraphKeys, hardcodedKeys)
+		result := mergeRecords(dgraphRecords, pinned)
 		if len(result) != 10003 {
 			b.Fatalf("Expected 10,003 unique keys, got %d", len(result))
 		}
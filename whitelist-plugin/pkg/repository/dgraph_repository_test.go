@@ -115,8 +115,8 @@ func TestGraphQLRepository_GetAll(t *testing.T) {
 
 				// Verify all keys are 32 bytes
 				for i, key := range keys {
-					if len(key) != 32 {
-						t.Errorf("Key at index %d has length %d, expected 32", i, len(key))
+					if len(key.Pubkey) != 32 {
+						t.Errorf("Key at index %d has length %d, expected 32", i, len(key.Pubkey))
 					}
 				}
 			}
@@ -280,66 +280,180 @@ func TestGraphQLRepository_ContextCancellation(t *testing.T) {
 	}
 }
 
-func TestMergePubkeys(t *testing.T) {
+func TestMergeRecords(t *testing.T) {
+	a, b, c, d := [32]byte{0xa}, [32]byte{0xb}, [32]byte{0xc}, [32]byte{0xd}
+	rec := func(k [32]byte) Record { return Record{Pubkey: k, Distance: NoDistance} }
+
 	tests := []struct {
-		name           string
-		dgraphKeys     []string
-		hardcodedKeys  []string
-		expectedCount  int
-		expectedUnique bool
+		name          string
+		dgraphRecords []Record
+		pinned        [][32]byte
+		expectedCount int
 	}{
-		{
-			name:           "no duplicates",
-			dgraphKeys:     []string{"aaaa", "bbbb"},
-			hardcodedKeys:  []string{"cccc", "dddd"},
-			expectedCount:  4,
-			expectedUnique: true,
-		},
-		{
-			name:           "with duplicates",
-			dgraphKeys:     []string{"aaaa", "bbbb", "cccc"},
-			hardcodedKeys:  []string{"cccc", "dddd"},
-			expectedCount:  4,
-			expectedUnique: true,
-		},
-		{
-			name:           "empty dgraph keys",
-			dgraphKeys:     []string{},
-			hardcodedKeys:  []string{"aaaa", "bbbb"},
-			expectedCount:  2,
-			expectedUnique: true,
-		},
-		{
-			name:           "empty hardcoded keys",
-			dgraphKeys:     []string{"aaaa", "bbbb"},
-			hardcodedKeys:  []string{},
-			expectedCount:  2,
-			expectedUnique: true,
-		},
+		{"no duplicates", []Record{rec(a), rec(b)}, [][32]byte{c, d}, 4},
+		{"with duplicates", []Record{rec(a), rec(b), rec(c), rec(a)}, [][32]byte{c, d}, 4},
+		{"empty dgraph records", nil, [][32]byte{a, b}, 2},
+		{"empty pinned keys", []Record{rec(a), rec(b)}, nil, 2},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := mergePubkeys(tt.dgraphKeys, tt.hardcodedKeys)
+			result := mergeRecords(tt.dgraphRecords, tt.pinned)
 
 			if len(result) != tt.expectedCount {
-				t.Errorf("Expected %d keys, got %d", tt.expectedCount, len(result))
+				t.Errorf("Expected %d records, got %d", tt.expectedCount, len(result))
 			}
 
-			if tt.expectedUnique {
-				// Check for uniqueness
-				seen := make(map[string]bool)
-				for _, key := range result {
-					if seen[key] {
-						t.Errorf("Duplicate key found: %s", key)
+			seen := make(map[[32]byte]bool)
+			for _, r := range result {
+				if seen[r.Pubkey] {
+					t.Errorf("Duplicate key found: %x", r.Pubkey)
+				}
+				seen[r.Pubkey] = true
+			}
+			for _, k := range tt.pinned {
+				for _, r := range result {
+					if r.Pubkey == k && !r.Pinned {
+						t.Errorf("Expected hardcoded key %x to be pinned", k)
 					}
-					seen[key] = true
 				}
 			}
 		})
 	}
 }
 
+func TestGraphQLRepository_GetAll_Signals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, pred := range []string{"follower_count", "trust_distance", "cluster_flagged"} {
+			if !strings.Contains(string(body), pred) {
+				t.Errorf("Request body missing predicate %s: %s", pred, string(body))
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"data": {
+				"q": [
+					{"uid": "0x2", "pubkey": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "follower_count": 42, "trust_distance": 0},
+					{"uid": "0x3", "pubkey": "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "cluster_flagged": true},
+					{"uid": "0x4", "pubkey": "f6b07746e51d757fce1a030ef6fbe5dae6805df857f26ddce4e414bc3f983c4d", "follower_count": 7}
+				]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	repo := &GraphQLRepository{
+		dqlEndpoint:  server.URL,
+		httpClient:   &http.Client{Timeout: 5 * time.Second},
+		pageSize:     1000,
+		queryTimeout: 2 * time.Minute,
+		logger:       log.New(io.Discard, "", 0),
+	}
+
+	records, err := repo.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll() failed: %v", err)
+	}
+	if len(records) != 7 { // 3 from Dgraph (one also hardcoded) + 4 other hardcoded
+		t.Fatalf("Expected 7 records, got %d", len(records))
+	}
+
+	byKey := make(map[[32]byte]Record, len(records))
+	for _, r := range records {
+		byKey[r.Pubkey] = r
+	}
+	mustKey := func(h string) [32]byte {
+		k, err := hexTo32ByteArray(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	seed := byKey[mustKey("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")]
+	if seed.FollowerCount != 42 || seed.Distance != 0 || seed.Flagged || seed.Pinned {
+		t.Errorf("seed record = %+v", seed)
+	}
+	flagged := byKey[mustKey("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")]
+	if !flagged.Flagged || flagged.Distance != NoDistance {
+		t.Errorf("flagged record = %+v, want Flagged with NoDistance", flagged)
+	}
+	forwarder := byKey[mustKey("f6b07746e51d757fce1a030ef6fbe5dae6805df857f26ddce4e414bc3f983c4d")]
+	if !forwarder.Pinned || forwarder.FollowerCount != 7 {
+		t.Errorf("hardcoded record = %+v, want Pinned keeping Dgraph signals", forwarder)
+	}
+}
+
+func TestGraphQLRepository_GetChangedSince(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "ge(last_db_update, 1700000000)") {
+			t.Errorf("Request body missing last_db_update bound: %s", string(body))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"data": {
+				"q": [
+					{"uid": "0x2", "pubkey": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "follower_count": 3, "last_db_update": 1700000050},
+					{"uid": "0x4", "pubkey": "f6b07746e51d757fce1a030ef6fbe5dae6805df857f26ddce4e414bc3f983c4d", "last_db_update": 1700000020}
+				]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	repo := &GraphQLRepository{
+		dqlEndpoint:  server.URL,
+		httpClient:   &http.Client{Timeout: 5 * time.Second},
+		pageSize:     1000,
+		queryTimeout: 2 * time.Minute,
+		logger:       log.New(io.Discard, "", 0),
+	}
+
+	records, watermark, err := repo.GetChangedSince(context.Background(), 1700000000)
+	if err != nil {
+		t.Fatalf("GetChangedSince() failed: %v", err)
+	}
+	if watermark != 1700000050 {
+		t.Errorf("watermark = %d, want 1700000050", watermark)
+	}
+	// Only changed rows: hardcoded keys are not padded in, but are marked.
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Pinned || records[0].FollowerCount != 3 {
+		t.Errorf("changed record = %+v", records[0])
+	}
+	if !records[1].Pinned {
+		t.Errorf("hardcoded record = %+v, want Pinned", records[1])
+	}
+}
+
+func TestGraphQLRepository_GetChangedSince_NoChanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data": {"q": []}}`))
+	}))
+	defer server.Close()
+
+	repo := &GraphQLRepository{
+		dqlEndpoint:  server.URL,
+		httpClient:   &http.Client{Timeout: 5 * time.Second},
+		pageSize:     1000,
+		queryTimeout: 2 * time.Minute,
+		logger:       log.New(io.Discard, "", 0),
+	}
+
+	records, watermark, err := repo.GetChangedSince(context.Background(), 1700000000)
+	if err != nil {
+		t.Fatalf("GetChangedSince() failed: %v", err)
+	}
+	if len(records) != 0 || watermark != 1700000000 {
+		t.Errorf("got %d records, watermark %d; want none and the input watermark", len(records), watermark)
+	}
+}
+
 func TestGetHardcodedPubkeys(t *testing.T) {
 	keys := getHardcodedPubkeys()
 
@@ -6,9 +6,36 @@ import (
 	"fmt"
 )
 
-// This file is intentionally left blank.
+// KeyRepository loads the full whitelist as scored records.
 type KeyRepository interface {
-	GetAll(ctx context.Context) ([][32]byte, error)
+	GetAll(ctx context.Context) ([]Record, error)
+}
+
+// DeltaRepository is a KeyRepository that can also read just the records
+// changed since a watermark, so refreshes between full loads cost only the
+// change volume. Watermarks are last_db_update unix seconds; the returned
+// watermark is the one to pass on the next call.
+//
+// Deltas only ever add or re-score pubkeys: a node deleted from Dgraph leaves
+// no trace to read, so removals are picked up by the next GetAll.
+type DeltaRepository interface {
+	KeyRepository
+	GetChangedSince(ctx context.Context, since int64) ([]Record, int64, error)
+}
+
+// NoDistance is the Record.Distance of a pubkey clusterscan has not placed in
+// the trusted set.
+const NoDistance = -1
+
+// Record is one whitelisted pubkey together with the web-of-trust signals its
+// trust score is derived from. Signals missing from Dgraph decode to their
+// zero value, except Distance, which is NoDistance.
+type Record struct {
+	Pubkey        [32]byte
+	FollowerCount int  // stored follower_count
+	Distance      int  // trust-closure round from the seed set (seeds = 0)
+	Flagged       bool // member of a clusterscan suspected spam cluster
+	Pinned        bool // hardcoded forwarder/admin key, always top tier
 }
 
 // hexTo32ByteArray decodes a 64-character hex string to a [32]byte array.
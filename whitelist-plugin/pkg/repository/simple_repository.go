@@ -6,7 +6,7 @@ import (
 )
 
 type SimpleRepository struct {
-	keys [][32]byte
+	keys []Record
 }
 
 func NewSimpleRepository() *SimpleRepository {
@@ -17,18 +17,18 @@ func NewSimpleRepository() *SimpleRepository {
 		"ba1838441e720ee91360d38321a19cbf8596e6540cfa045c9c5d429f1a2b9e3a", //macro88
 	}
 
-	keys := make([][32]byte, 0, len(pubKeys))
+	keys := make([]Record, 0, len(pubKeys))
 	for _, s := range pubKeys {
 		k, err := hexTo32ByteArray(s)
 		if err != nil {
 			panic(fmt.Errorf("failed to convert pubkey to 32-byte array: %w", err))
 		}
-		keys = append(keys, k)
+		keys = append(keys, Record{Pubkey: k, Distance: NoDistance, Pinned: true})
 	}
 
 	return &SimpleRepository{keys: keys}
 }
 
-func (r *SimpleRepository) GetAll(_ context.Context) ([][32]byte, error) {
+func (r *SimpleRepository) GetAll(_ context.Context) ([]Record, error) {
 	return r.keys, nil
 }
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serverMetrics are the Prometheus collectors behind GET /metrics. Each server
+// owns its registry, so tests can run several servers in one process.
+type serverMetrics struct {
+	registry     *prometheus.Registry
+	checks       *prometheus.CounterVec   // endpoint, result
+	bulkSize     prometheus.Histogram     // pubkeys per POST /check
+	fetchSeconds *prometheus.HistogramVec // kind
+	fetchErrors  *prometheus.CounterVec   // kind
+	bloomSwaps   *prometheus.CounterVec   // mode
+}
+
+func newServerMetrics(s *WhitelistServer) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		checks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whitelist_checks_total",
+			Help: "Pubkeys checked, by endpoint (check, bulk) and result (whitelisted, not_whitelisted).",
+		}, []string{"endpoint", "result"}),
+		bulkSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "whitelist_bulk_check_size",
+			Help:    "Pubkeys per bulk check request.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 9), // 1 .. 65536
+		}),
+		fetchSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "whitelist_refresh_duration_seconds",
+			Help:    "Duration of whitelist reads from Dgraph, by kind (full, delta), failed attempts included.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms .. ~100s
+		}, []string{"kind"}),
+		fetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whitelist_dgraph_errors_total",
+			Help: "Failed whitelist reads from Dgraph, by kind (full, delta).",
+		}, []string{"kind"}),
+		bloomSwaps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whitelist_bloom_swaps_total",
+			Help: "Bloom filters published, by mode (full, patch).",
+		}, []string{"mode"}),
+	}
+	m.registry.MustRegister(
+		m.checks, m.bulkSize, m.fetchSeconds, m.fetchErrors, m.bloomSwaps,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whitelist_entries",
+			Help: "Pubkeys in the whitelist as of the last refresh.",
+		}, func() float64 { return float64(s.entries.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whitelist_last_refresh_timestamp_seconds",
+			Help: "Unix time of the last successful refresh; 0 before the first.",
+		}, func() float64 {
+			if t := s.lastRefresh.Load(); t != nil {
+				return float64(t.UnixNano()) / 1e9
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whitelist_generation",
+			Help: "Current whitelist generation served by /delta and /changes.",
+		}, func() float64 {
+			if s.changes == nil {
+				return 0
+			}
+			return float64(s.changes.Generation())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whitelist_bloom_size_bytes",
+			Help: "Size of the serialized filter served by /bloom; 0 before the first build.",
+		}, func() float64 {
+			if snap := s.bloomSnapshot.Load(); snap != nil {
+				return float64(len(snap.bytes))
+			}
+			return 0
+		}),
+	)
+	return m
+}
+
+func (m *serverMetrics) observeCheck(endpoint string, whitelisted bool) {
+	result := "not_whitelisted"
+	if whitelisted {
+		result = "whitelisted"
+	}
+	m.checks.WithLabelValues(endpoint, result).Inc()
+}
+
+// ObserveFetch records one whitelist read from Dgraph. Its signature matches
+// WhitelistRefresher.SetOnFetch.
+func (s *WhitelistServer) ObserveFetch(kind string, d time.Duration, err error) {
+	s.metrics.fetchSeconds.WithLabelValues(kind).Observe(d.Seconds())
+	if err != nil {
+		s.metrics.fetchErrors.WithLabelValues(kind).Inc()
+	}
+}
+
+// handleMetrics serves the server's metrics in the Prometheus text format
+// (GET /metrics).
+func (s *WhitelistServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"whitelist-plugin/pkg/bloom"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	k := makeKey(0x01)
+	s, ts := setupServer([][32]byte{k}, true)
+	defer ts.Close()
+
+	resp, _ := http.Get(ts.URL + "/check/" + hex.EncodeToString(k[:]))
+	resp.Body.Close()
+	body := `{"pubkeys": ["` + hex.EncodeToString(k[:]) + `", "00"]}`
+	resp, _ = http.Post(ts.URL+"/check", "application/json", bytes.NewBufferString(body))
+	resp.Body.Close()
+
+	b := bloom.NewBuilder(1, 1e-6)
+	b.Add(k)
+	f, err := b.Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if err := s.SwapFilter(f); err != nil {
+		t.Fatalf("SwapFilter failed: %v", err)
+	}
+	s.ObserveFetch("full", 2*time.Second, nil)
+	s.ObserveFetch("delta", time.Second, errors.New("dgraph down"))
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	out := string(raw)
+	for _, want := range []string{
+		`whitelist_checks_total{endpoint="check",result="whitelisted"} 1`,
+		`whitelist_checks_total{endpoint="bulk",result="whitelisted"} 1`,
+		`whitelist_checks_total{endpoint="bulk",result="not_whitelisted"} 1`,
+		`whitelist_bulk_check_size_count 1`,
+		`whitelist_refresh_duration_seconds_count{kind="full"} 1`,
+		`whitelist_dgraph_errors_total{kind="delta"} 1`,
+		`whitelist_bloom_swaps_total{mode="full"} 1`,
+		`whitelist_entries 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+	if strings.Contains(out, "whitelist_bloom_size_bytes 0\n") {
+		t.Error("bloom size not reported after SwapFilter")
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"whitelist-plugin/pkg/nip98"
+	"whitelist-plugin/pkg/overrides"
+
+	"github.com/nbd-wtf/go-nostr/nip86"
+)
+
+// NIP86ContentType is the content type of NIP-86 relay management requests.
+const NIP86ContentType = "application/nostr+json+rpc"
+
+// maxNIP86BodyBytes bounds a NIP-86 request body.
+const maxNIP86BodyBytes = 64 << 10
+
+// nip86Methods are the NIP-86 methods served, as reported by supportedmethods.
+// Pubkey methods write pubkey overrides; event and kind methods write the
+// overrides the plugins enforce from /moderation.
+var nip86Methods = []string{
+	"supportedmethods",
+	"banpubkey", "allowpubkey", "listbannedpubkeys", "listallowedpubkeys",
+	"banevent", "allowevent", "listbannedevents", "listallowedevents",
+	"allowkind", "disallowkind", "listallowedkinds", "listdisallowedkinds",
+}
+
+// SetNIP86 enables the NIP-86 relay management API at POST / for the given
+// admin pubkeys (hex). url is the absolute URL admin clients send requests to
+// — the relay's public URL when a proxy forwards management requests here —
+// and must match the NIP-98 u tag exactly. No admins keeps the API disabled
+// (403). Requires SetOverrides. Must be called before ListenAndServe.
+func (s *WhitelistServer) SetNIP86(url string, admins []string) error {
+	set := make(map[string]struct{}, len(admins))
+	for _, a := range admins {
+		pk, err := overrides.ParsePubkey(a)
+		if err != nil {
+			return fmt.Errorf("nip86 admin %q: %w", a, err)
+		}
+		set[hex.EncodeToString(pk[:])] = struct{}{}
+	}
+	s.nip86URL = url
+	s.nip86Admins = set
+	return nil
+}
+
+// handleNIP86 serves NIP-86 JSON-RPC. Request: {"method": "...", "params": [...]}.
+// - no override store → 404; no admins configured → 403
+// - Content-Type not application/nostr+json+rpc → 415
+// - missing or invalid NIP-98 auth → 401 with WWW-Authenticate: Nostr
+// - signer not an admin → 403
+// - otherwise → 200 {"result": ...} or {"error": "..."}
+func (s *WhitelistServer) handleNIP86(w http.ResponseWriter, r *http.Request) {
+	if s.overrides == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if len(s.nip86Admins) == 0 {
+		http.Error(w, "NIP-86 API disabled", http.StatusForbidden)
+		return
+	}
+	if ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";"); strings.TrimSpace(ct) != NIP86ContentType {
+		http.Error(w, "Content-Type must be "+NIP86ContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNIP86BodyBytes))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	signer, err := nip98.Verify(r.Header.Get("Authorization"), r.Method, s.nip86URL, body, time.Now())
+	if err != nil {
+		if s.debug {
+			s.logger.Printf("NIP-86 auth: %v", err)
+		}
+		w.Header().Set("WWW-Authenticate", "Nostr")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, ok := s.nip86Admins[signer]; !ok {
+		s.logger.Printf("NIP-86 request from non-admin %s", signer)
+		http.Error(w, "not a relay admin", http.StatusForbidden)
+		return
+	}
+
+	resp := s.nip86Dispatch(body)
+	if resp.method != "" {
+		s.logger.Printf("NIP-86 %s by %s", resp.method, signer)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp.Response)
+}
+
+// nip86Result is a NIP-86 response plus the mutating method it answered, if
+// any, for the audit log.
+type nip86Result struct {
+	nip86.Response
+	method string
+}
+
+// nip86Dispatch decodes and executes one NIP-86 request body.
+func (s *WhitelistServer) nip86Dispatch(body []byte) nip86Result {
+	var req nip86.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nip86Result{Response: nip86.Response{Error: "invalid request: " + err.Error()}}
+	}
+	// Checked before decoding: DecodeRequest panics on some malformed params
+	// of methods this server does not implement anyway.
+	if !slices.Contains(nip86Methods, req.Method) {
+		return nip86Result{Response: nip86.Response{Error: fmt.Sprintf("method '%s' not supported", req.Method)}}
+	}
+	params, err := nip86.DecodeRequest(req)
+	if err != nil {
+		return nip86Result{Response: nip86.Response{Error: err.Error()}}
+	}
+	result, err := s.nip86Call(params)
+	if err != nil {
+		return nip86Result{Response: nip86.Response{Error: err.Error()}}
+	}
+	var res nip86Result
+	res.Result = result
+	if !strings.HasPrefix(req.Method, "list") && req.Method != "supportedmethods" {
+		res.method = fmt.Sprintf("%s %v", req.Method, req.Params)
+	}
+	return res
+}
+
+// nip86Call executes one decoded NIP-86 method against the override store.
+func (s *WhitelistServer) nip86Call(params nip86.MethodParams) (any, error) {
+	now := time.Now().UTC()
+	switch p := params.(type) {
+	case nip86.SupportedMethods:
+		return nip86Methods, nil
+
+	case nip86.BanPubKey:
+		return setKeyed(s.overrides.Set, p.PubKey, overrides.Override{Action: overrides.Deny, Reason: p.Reason, Created: now})
+	case nip86.AllowPubKey:
+		return setKeyed(s.overrides.Set, p.PubKey, overrides.Override{Action: overrides.Allow, Reason: p.Reason, Created: now})
+	case nip86.ListBannedPubKeys:
+		return listPubkeys(s.overrides.All(), overrides.Deny), nil
+	case nip86.ListAllowedPubKeys:
+		return listPubkeys(s.overrides.All(), overrides.Allow), nil
+
+	case nip86.BanEvent:
+		return setKeyed(s.overrides.SetEvent, p.ID, overrides.Override{Action: overrides.Deny, Reason: p.Reason, Created: now})
+	case nip86.AllowEvent:
+		return setKeyed(s.overrides.SetEvent, p.ID, overrides.Override{Action: overrides.Allow, Reason: p.Reason, Created: now})
+	case nip86.ListBannedEvents:
+		return listEvents(s.overrides.Events(), overrides.Deny), nil
+	case nip86.ListAllowedEvents:
+		return listEvents(s.overrides.Events(), overrides.Allow), nil
+
+	case nip86.AllowKind:
+		return setKind(s.overrides, p.Kind, overrides.Override{Action: overrides.Allow, Created: now})
+	case nip86.DisallowKind:
+		return setKind(s.overrides, p.Kind, overrides.Override{Action: overrides.Deny, Created: now})
+	case nip86.ListAllowedKinds:
+		return listKinds(s.overrides.Kinds(), overrides.Allow), nil
+	case nip86.ListDisallowedKinds:
+		return listKinds(s.overrides.Kinds(), overrides.Deny), nil
+
+	default:
+		return nil, fmt.Errorf("method '%s' not supported", params.MethodName())
+	}
+}
+
+// setKeyed records o under the hex key k with set.
+func setKeyed(set func([32]byte, overrides.Override) error, k string, o overrides.Override) (any, error) {
+	key, err := overrides.ParsePubkey(k)
+	if err != nil {
+		return nil, err
+	}
+	if err := set(key, o); err != nil {
+		return nil, fmt.Errorf("failed to persist override: %w", err)
+	}
+	return true, nil
+}
+
+func setKind(store *overrides.Store, kind int, o overrides.Override) (any, error) {
+	if err := store.SetKind(kind, o); err != nil {
+		return nil, fmt.Errorf("failed to persist override: %w", err)
+	}
+	return true, nil
+}
+
+func listPubkeys(all map[[32]byte]overrides.Override, action overrides.Action) []nip86.PubKeyReason {
+	out := []nip86.PubKeyReason{}
+	for k, o := range all {
+		if o.Action == action {
+			out = append(out, nip86.PubKeyReason{PubKey: hex.EncodeToString(k[:]), Reason: o.Reason})
+		}
+	}
+	slices.SortFunc(out, func(a, b nip86.PubKeyReason) int { return strings.Compare(a.PubKey, b.PubKey) })
+	return out
+}
+
+func listEvents(all map[[32]byte]overrides.Override, action overrides.Action) []nip86.IDReason {
+	out := []nip86.IDReason{}
+	for k, o := range all {
+		if o.Action == action {
+			out = append(out, nip86.IDReason{ID: hex.EncodeToString(k[:]), Reason: o.Reason})
+		}
+	}
+	slices.SortFunc(out, func(a, b nip86.IDReason) int { return strings.Compare(a.ID, b.ID) })
+	return out
+}
+
+func listKinds(all map[int]overrides.Override, action overrides.Action) []int {
+	out := []int{}
+	for k, o := range all {
+		if o.Action == action {
+			out = append(out, k)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// moderationResponse is the event and kind bans the plugins enforce.
+type moderationResponse struct {
+	BannedEvents    []string `json:"banned_events"`
+	DisallowedKinds []int    `json:"disallowed_kinds"`
+}
+
+// handleModeration serves the event and kind bans for the plugins to enforce
+// (GET /moderation). Unauthenticated, like /bloom: it only names what to reject.
+// - no override store → 404
+// - If-None-Match matches → 304
+// - otherwise → 200 moderationResponse with an ETag over the body
+func (s *WhitelistServer) handleModeration(w http.ResponseWriter, r *http.Request) {
+	if s.overrides == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var resp moderationResponse
+	for _, e := range listEvents(s.overrides.Events(), overrides.Deny) {
+		resp.BannedEvents = append(resp.BannedEvents, e.ID)
+	}
+	resp.DisallowedKinds = listKinds(s.overrides.Kinds(), overrides.Deny)
+	if resp.BannedEvents == nil {
+		resp.BannedEvents = []string{}
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "encode moderation", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
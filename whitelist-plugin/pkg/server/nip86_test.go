@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"whitelist-plugin/pkg/nip98"
+	"whitelist-plugin/pkg/overrides"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// nip86Call posts a NIP-86 request to url signed by sk (unsigned if sk is
+// empty) and returns the HTTP status and decoded response.
+func nip86Call(t *testing.T, url, sk, method string, params ...any) (int, map[string]any) {
+	t.Helper()
+	if params == nil {
+		params = []any{}
+	}
+	body, _ := json.Marshal(map[string]any{"method": method, "params": params})
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", NIP86ContentType)
+	if sk != "" {
+		sum := sha256.Sum256(body)
+		evt := nostr.Event{
+			Kind:      nip98.Kind,
+			CreatedAt: nostr.Now(),
+			Tags:      nostr.Tags{{"u", url}, {"method", "POST"}, {"payload", hex.EncodeToString(sum[:])}},
+		}
+		if err := evt.Sign(sk); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		raw, _ := json.Marshal(evt)
+		req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(raw))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, out
+}
+
+func TestNIP86_Auth(t *testing.T) {
+	s, ts := setupServer(nil, true)
+	defer ts.Close()
+	url := ts.URL + "/"
+	admin := nostr.GeneratePrivateKey()
+	adminPK, _ := nostr.GetPublicKey(admin)
+
+	if code, _ := nip86Call(t, url, admin, "supportedmethods"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a store, got %d", code)
+	}
+	store, _ := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	s.SetOverrides(store, "")
+	if code, _ := nip86Call(t, url, admin, "supportedmethods"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 with no admins, got %d", code)
+	}
+	if err := s.SetNIP86(url, []string{"nothex"}); err == nil {
+		t.Fatal("SetNIP86 accepted an invalid admin pubkey")
+	}
+	if err := s.SetNIP86(url, []string{strings.ToUpper(adminPK)}); err != nil {
+		t.Fatalf("SetNIP86: %v", err)
+	}
+
+	if code, _ := nip86Call(t, url, "", "supportedmethods"); code != http.StatusUnauthorized {
+		t.Errorf("unsigned: expected 401, got %d", code)
+	}
+	if code, _ := nip86Call(t, url, nostr.GeneratePrivateKey(), "supportedmethods"); code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", code)
+	}
+	resp, err := http.Post(url, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("wrong content type: expected 415, got %d", resp.StatusCode)
+	}
+
+	code, out := nip86Call(t, url, admin, "supportedmethods")
+	if code != http.StatusOK || len(out["result"].([]any)) != len(nip86Methods) {
+		t.Errorf("supportedmethods = %d %v", code, out)
+	}
+}
+
+func TestNIP86_Methods(t *testing.T) {
+	s, ts := setupServer(nil, true)
+	defer ts.Close()
+	url := ts.URL + "/"
+	admin := nostr.GeneratePrivateKey()
+	adminPK, _ := nostr.GetPublicKey(admin)
+	store, _ := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	s.SetOverrides(store, "")
+	s.SetNIP86(url, []string{adminPK})
+
+	target, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	eventID := strings.Repeat("ab", 32)
+	for _, call := range []struct {
+		method string
+		params []any
+	}{
+		{"banpubkey", []any{target, "spam"}},
+		{"banevent", []any{eventID, "illegal"}},
+		{"disallowkind", []any{4}},
+		{"allowkind", []any{1}},
+	} {
+		if _, out := nip86Call(t, url, admin, call.method, call.params...); out["result"] != true {
+			t.Fatalf("%s = %v", call.method, out)
+		}
+	}
+
+	pk, _ := overrides.ParsePubkey(target)
+	if o, ok := store.Get(pk); !ok || o.Action != overrides.Deny || o.Reason != "spam" {
+		t.Errorf("banpubkey stored %+v, %v", o, ok)
+	}
+	_, out := nip86Call(t, url, admin, "listbannedpubkeys")
+	if got := out["result"].([]any); len(got) != 1 || got[0].(map[string]any)["pubkey"] != target {
+		t.Errorf("listbannedpubkeys = %v", out)
+	}
+	_, out = nip86Call(t, url, admin, "listdisallowedkinds")
+	if got := out["result"].([]any); len(got) != 1 || got[0] != float64(4) {
+		t.Errorf("listdisallowedkinds = %v", out)
+	}
+
+	for _, bad := range []struct {
+		method string
+		params []any
+	}{
+		{"banpubkey", []any{"nothex"}},
+		{"blockip", []any{"10.0.0.1"}},
+		{"nosuchmethod", nil},
+	} {
+		if _, out := nip86Call(t, url, admin, bad.method, bad.params...); out["error"] == nil || out["result"] != nil {
+			t.Errorf("%s: expected an error response, got %v", bad.method, out)
+		}
+	}
+}
+
+func TestHandleModeration(t *testing.T) {
+	s, ts := setupServer(nil, true)
+	defer ts.Close()
+
+	resp, _ := http.Get(ts.URL + "/moderation")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without a store, got %d", resp.StatusCode)
+	}
+
+	store, _ := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	s.SetOverrides(store, "")
+	store.SetEvent([32]byte{1}, overrides.Override{Action: overrides.Deny})
+	store.SetEvent([32]byte{2}, overrides.Override{Action: overrides.Allow})
+	store.SetKind(4, overrides.Override{Action: overrides.Deny})
+	store.SetKind(1, overrides.Override{Action: overrides.Allow})
+
+	resp, err := http.Get(ts.URL + "/moderation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body moderationResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	banned := [32]byte{1}
+	if len(body.BannedEvents) != 1 || body.BannedEvents[0] != hex.EncodeToString(banned[:]) {
+		t.Errorf("banned_events = %v", body.BannedEvents)
+	}
+	if len(body.DisallowedKinds) != 1 || body.DisallowedKinds[0] != 4 {
+		t.Errorf("disallowed_kinds = %v", body.DisallowedKinds)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/moderation", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", resp2.StatusCode)
+	}
+}
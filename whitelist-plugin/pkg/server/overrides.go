@@ -0,0 +1,133 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"whitelist-plugin/pkg/overrides"
+)
+
+// maxOverrideBodyBytes bounds the POST /overrides/{pubkey} body.
+const maxOverrideBodyBytes = 4 << 10
+
+// SetOverrides enables the admin API on store. Requests must carry
+// "Authorization: Bearer <token>"; an empty token keeps the API disabled (403)
+// so a missing config value never exposes it. Must be called before
+// ListenAndServe.
+func (s *WhitelistServer) SetOverrides(store *overrides.Store, token string) {
+	s.overrides = store
+	s.adminToken = token
+}
+
+type overrideRequest struct {
+	Action overrides.Action `json:"action"`
+	Reason string           `json:"reason"`
+}
+
+// authorizeAdmin reports whether r may use the admin API, writing the error
+// response if not.
+// - no override store → 404
+// - no admin token configured → 403
+// - missing or wrong bearer token → 401 with WWW-Authenticate
+func (s *WhitelistServer) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.overrides == nil {
+		http.NotFound(w, r)
+		return false
+	}
+	if s.adminToken == "" {
+		http.Error(w, "admin API disabled", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="whitelist-admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleListOverrides serves every override as {"<hex>": Override, ...}.
+func (s *WhitelistServer) handleListOverrides(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	all := s.overrides.All()
+	resp := make(map[string]overrides.Override, len(all))
+	for k, o := range all {
+		resp[hex.EncodeToString(k[:])] = o
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleSetOverride records an allow or deny for a pubkey. Body:
+//
+//	{"action": "allow"|"deny", "reason": "..."}
+//
+// - invalid pubkey, JSON or action → 400
+// - persisting fails → 500, nothing changes
+// - otherwise → 200 with the stored Override; the refresher applies it to the
+// whitelist and /bloom without waiting for the next Dgraph refresh
+func (s *WhitelistServer) handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	pk, err := overrides.ParsePubkey(r.PathValue("pubkey"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxOverrideBodyBytes)
+	var req overrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Action.Valid() {
+		http.Error(w, `action must be "allow" or "deny"`, http.StatusBadRequest)
+		return
+	}
+
+	o := overrides.Override{Action: req.Action, Reason: req.Reason, Created: time.Now().UTC()}
+	if err := s.overrides.Set(pk, o); err != nil {
+		s.logger.Printf("override %s: %v", r.PathValue("pubkey"), err)
+		http.Error(w, "failed to persist override", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Printf("override %s: %s (%s)", hex.EncodeToString(pk[:]), o.Action, o.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o)
+}
+
+// handleDeleteOverride lifts the override for a pubkey, returning it to
+// whatever the web-of-trust graph says.
+// - invalid pubkey → 400
+// - no override → 404
+// - otherwise → 204
+func (s *WhitelistServer) handleDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	pk, err := overrides.ParsePubkey(r.PathValue("pubkey"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ok, err := s.overrides.Delete(pk)
+	if err != nil {
+		s.logger.Printf("override %s: %v", r.PathValue("pubkey"), err)
+		http.Error(w, "failed to persist override", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "no override for pubkey", http.StatusNotFound)
+		return
+	}
+	s.logger.Printf("override %s: lifted", hex.EncodeToString(pk[:]))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"whitelist-plugin/pkg/overrides"
+)
+
+func adminRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestOverridesAPI_Auth(t *testing.T) {
+	s, ts := setupServer(nil, true)
+	defer ts.Close()
+	url := ts.URL + "/overrides"
+
+	// No store → 404
+	resp := adminRequest(t, http.MethodGet, url, "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without a store, got %d", resp.StatusCode)
+	}
+
+	store, err := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store but no token → 403
+	s.SetOverrides(store, "")
+	resp = adminRequest(t, http.MethodGet, url, "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 with no admin token, got %d", resp.StatusCode)
+	}
+
+	s.SetOverrides(store, "secret")
+	for _, token := range []string{"", "wrong"} {
+		resp = adminRequest(t, http.MethodGet, url, token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: expected 401 with WWW-Authenticate, got %d", token, resp.StatusCode)
+		}
+	}
+	resp = adminRequest(t, http.MethodGet, url, "secret", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 with the right token, got %d", resp.StatusCode)
+	}
+}
+
+func TestOverridesAPI_SetListDelete(t *testing.T) {
+	s, ts := setupServer(nil, true)
+	defer ts.Close()
+	store, err := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetOverrides(store, "secret")
+
+	k := makeKey(0x01)
+	hexKey := hex.EncodeToString(k[:])
+	url := ts.URL + "/overrides/" + hexKey
+
+	for name, tc := range map[string]struct{ url, body string }{
+		"bad pubkey": {ts.URL + "/overrides/abc", `{"action":"deny"}`},
+		"bad JSON":   {url, `{`},
+		"bad action": {url, `{"action":"mute"}`},
+	} {
+		resp := adminRequest(t, http.MethodPost, tc.url, "secret", tc.body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, resp.StatusCode)
+		}
+	}
+
+	resp := adminRequest(t, http.MethodPost, url, "secret", `{"action":"deny","reason":"compromised"}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var set overrides.Override
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if set.Action != overrides.Deny || set.Reason != "compromised" || set.Created.IsZero() {
+		t.Errorf("POST response = %+v", set)
+	}
+	if o, ok := store.Get(k); !ok || o.Action != overrides.Deny {
+		t.Errorf("store has %+v, %v", o, ok)
+	}
+
+	resp2 := adminRequest(t, http.MethodGet, ts.URL+"/overrides", "secret", "")
+	defer resp2.Body.Close()
+	var list map[string]overrides.Override
+	if err := json.NewDecoder(resp2.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list) != 1 || list[hexKey].Action != overrides.Deny {
+		t.Errorf("GET /overrides = %+v", list)
+	}
+
+	resp3 := adminRequest(t, http.MethodDelete, url, "secret", "")
+	resp3.Body.Close()
+	if resp3.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp3.StatusCode)
+	}
+	resp4 := adminRequest(t, http.MethodDelete, url, "secret", "")
+	resp4.Body.Close()
+	if resp4.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting a missing override, got %d", resp4.StatusCode)
+	}
+}
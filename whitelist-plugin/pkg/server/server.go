@@ -2,14 +2,18 @@ package server
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 	"whitelist-plugin/pkg/bloom"
+	"whitelist-plugin/pkg/changestream"
+	"whitelist-plugin/pkg/overrides"
 	"whitelist-plugin/pkg/version"
 	"whitelist-plugin/pkg/whitelist"
 )
@@ -19,8 +23,16 @@ import (
 type bloomEntry struct {
 	etag  string // Filter.ETag() — pre-computed quoted hex string
 	bytes []byte // Filter.MarshalBinary() output — cached once per generation
+	// patches are the most recent cuckoo patches, oldest first, the last ending
+	// at this generation. A full rebuild starts an empty history.
+	patches  []*bloom.Patch
+	patchOps int
 }
 
+// maxBloomPatchOps bounds the operations retained across bloomEntry.patches
+// (~3.3 MiB). A plugin further behind downloads the whole filter.
+const maxBloomPatchOps = 100000
+
 type WhitelistServer struct {
 	whitelist     *whitelist.Whitelist
 	addr          string
@@ -30,15 +42,23 @@ type WhitelistServer struct {
 	entries       atomic.Int64
 	lastRefresh   atomic.Pointer[time.Time]
 	bloomSnapshot atomic.Pointer[bloomEntry] // separate from whitelist.list (D-03)
+	changes       *whitelist.ChangeLog       // nil = /delta unavailable
+	overrides     *overrides.Store           // nil = admin API unavailable
+	adminToken    string
+	nip86URL      string
+	nip86Admins   map[string]struct{} // hex pubkeys; empty = NIP-86 disabled
+	metrics       *serverMetrics
 }
 
 func NewWhitelistServer(wl *whitelist.Whitelist, addr string, debug bool, logger *log.Logger) *WhitelistServer {
-	return &WhitelistServer{
+	s := &WhitelistServer{
 		whitelist: wl,
 		addr:      addr,
 		debug:     debug,
 		logger:    logger,
 	}
+	s.metrics = newServerMetrics(s)
+	return s
 }
 
 // SetReady marks the server as ready to serve traffic (whitelist loaded).
@@ -57,6 +77,13 @@ func (s *WhitelistServer) SetStats(n int, t time.Time) {
 	s.lastRefresh.Store(&t)
 }
 
+// SetChangeLog attaches the refresher's generation log, enabling /delta and
+// /changes.
+// Must be called before ListenAndServe.
+func (s *WhitelistServer) SetChangeLog(l *whitelist.ChangeLog) {
+	s.changes = l
+}
+
 // SwapFilter serializes f once into a bloomEntry and stores it atomically.
 // Pre-serializing here means the handleBloom handler is alloc-free per request (D-05).
 func (s *WhitelistServer) SwapFilter(f *bloom.Filter) error {
@@ -65,6 +92,49 @@ func (s *WhitelistServer) SwapFilter(f *bloom.Filter) error {
 		return err
 	}
 	s.bloomSnapshot.Store(&bloomEntry{etag: f.ETag(), bytes: b})
+	s.metrics.bloomSwaps.WithLabelValues("full").Inc()
+	return nil
+}
+
+// SwapFilterPatch is SwapFilter for a cuckoo filter produced from the current
+// one by Filter.Update. p is retained so plugins holding a recent generation
+// can fetch a patch instead of the whole filter. If p does not start at the
+// current generation the history restarts from f.
+func (s *WhitelistServer) SwapFilterPatch(f *bloom.Filter, p *bloom.Patch) error {
+	b, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	next := &bloomEntry{etag: f.ETag(), bytes: b}
+	if cur := s.bloomSnapshot.Load(); cur != nil && cur.etag == bloom.ETagOf(p.Base) {
+		next.patches = append(append(next.patches, cur.patches...), p)
+		next.patchOps = cur.patchOps + p.Len()
+		for next.patchOps > maxBloomPatchOps && len(next.patches) > 0 {
+			next.patchOps -= next.patches[0].Len()
+			next.patches = next.patches[1:]
+		}
+	}
+	s.bloomSnapshot.Store(next)
+	s.metrics.bloomSwaps.WithLabelValues("patch").Inc()
+	return nil
+}
+
+// patchFrom returns the patch taking the filter with ETag etag to e's filter,
+// or nil if that generation is no longer in e's history.
+func (e *bloomEntry) patchFrom(etag string) *bloom.Patch {
+	for i, p := range e.patches {
+		if bloom.ETagOf(p.Base) != etag {
+			continue
+		}
+		chain := p
+		for _, next := range e.patches[i+1:] {
+			var err error
+			if chain, err = chain.Then(next); err != nil {
+				return nil
+			}
+		}
+		return chain
+	}
 	return nil
 }
 
@@ -77,6 +147,14 @@ func (s *WhitelistServer) Handler() http.Handler {
 	mux.HandleFunc("GET /stats", s.handleStats)
 	mux.HandleFunc("GET /version", s.handleVersion)
 	mux.HandleFunc("GET /bloom", s.handleBloom)
+	mux.HandleFunc("GET /delta", s.handleDelta)
+	mux.HandleFunc("GET "+changestream.Path, s.handleChanges)
+	mux.HandleFunc("GET /overrides", s.handleListOverrides)
+	mux.HandleFunc("POST /overrides/{pubkey}", s.handleSetOverride)
+	mux.HandleFunc("DELETE /overrides/{pubkey}", s.handleDeleteOverride)
+	mux.HandleFunc("POST /{$}", s.handleNIP86)
+	mux.HandleFunc("GET /moderation", s.handleModeration)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
 	return mux
 }
 
@@ -108,6 +186,7 @@ func (s *WhitelistServer) ListenAndServe(ctx context.Context) error {
 // handleBloom serves the serialized bloom filter.
 // - nil snapshot → 503 JSON {"status":"loading","detail":"bloom filter not yet built"} (D-08)
 // - If-None-Match matches current ETag → 304 Not Modified, ETag header, empty body (D-07)
+// - A-IM: dfbf-patch and If-None-Match names a generation still in the patch history → 226 IM Used with a bloom.Patch body, if smaller than the filter (RFC 3229)
 // - otherwise → 200 application/octet-stream, ETag header, Content-Length, cached bytes (D-06)
 func (s *WhitelistServer) handleBloom(w http.ResponseWriter, r *http.Request) {
 	snap := s.bloomSnapshot.Load()
@@ -126,14 +205,30 @@ func (s *WhitelistServer) handleBloom(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && strings.Contains(r.Header.Get("A-IM"), bloom.PatchIM) {
+		if p := snap.patchFrom(inm); p != nil && p.Size() < len(snap.bytes) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", snap.etag)
+			w.Header().Set("IM", bloom.PatchIM)
+			w.Header().Set("Delta-Base", inm)
+			w.Header().Set("Content-Length", strconv.Itoa(p.Size()))
+			w.WriteHeader(http.StatusIMUsed)
+			p.WriteTo(w)
+			return
+		}
+	}
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("ETag", snap.etag)
 	w.Header().Set("Content-Length", strconv.Itoa(len(snap.bytes)))
 	w.Write(snap.bytes)
 }
 
+// checkResponse carries the binary decision plus the trust score and tier the
+// plugins key tiered policy on. Non-whitelisted pubkeys report tier 0.
 type checkResponse struct {
-	Whitelisted bool `json:"whitelisted"`
+	Whitelisted bool           `json:"whitelisted"`
+	Score       float32        `json:"score"`
+	Tier        whitelist.Tier `json:"tier"`
 }
 
 // maxBulkPubkeys caps a single bulk request to bound memory and work.
@@ -147,13 +242,30 @@ type bulkCheckRequest struct {
 	Pubkeys []string `json:"pubkeys"`
 }
 
+// scoreResponse is the per-pubkey score/tier in a bulk response.
+type scoreResponse struct {
+	Score float32        `json:"score"`
+	Tier  whitelist.Tier `json:"tier"`
+}
+
 type bulkCheckResponse struct {
-	Results map[string]bool `json:"results"`
+	Results map[string]bool          `json:"results"`
+	Scores  map[string]scoreResponse `json:"scores"`
 }
 
 type statsResponse struct {
 	Entries     int64  `json:"entries"`
 	LastRefresh string `json:"last_refresh"`
+	Generation  uint64 `json:"generation,omitempty"`
+}
+
+// deltaResponse lists the pubkeys added to and removed from the whitelist
+// between generation since and generation.
+type deltaResponse struct {
+	Since      uint64   `json:"since"`
+	Generation uint64   `json:"generation"`
+	Added      []string `json:"added"`
+	Removed    []string `json:"removed"`
 }
 
 func (s *WhitelistServer) handleCheck(w http.ResponseWriter, r *http.Request) {
@@ -163,16 +275,15 @@ func (s *WhitelistServer) handleCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// In-memory whitelist never returns a non-nil error; ignored for parity
-	// with the Checker interface used by the plugin client.
-	result, _ := s.whitelist.IsWhitelisted(pubkey)
+	entry, result := s.whitelist.Lookup(pubkey)
+	s.metrics.observeCheck("check", result)
 
 	if s.debug {
-		s.logger.Printf("CHECK %s → %v", pubkey, result)
+		s.logger.Printf("CHECK %s → %v tier=%s", pubkey, result, entry.Tier)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(checkResponse{Whitelisted: result})
+	json.NewEncoder(w).Encode(checkResponse{Whitelisted: result, Score: entry.Score, Tier: entry.Tier})
 }
 
 // handleBulkCheck checks many pubkeys in one request. Body:
@@ -181,10 +292,12 @@ func (s *WhitelistServer) handleCheck(w http.ResponseWriter, r *http.Request) {
 //
 // Response:
 //
-//	{"results": {"<hex>": true|false, ...}}
+//	{"results": {"<hex>": true|false, ...},
+//	 "scores":  {"<hex>": {"score": 0.72, "tier": 3}, ...}}
 //
 // Each pubkey maps to its own boolean, so duplicates collapse and the caller
 // can look up any pubkey it sent. Unknown/invalid pubkeys simply map to false.
+// scores only carries whitelisted pubkeys; a missing entry means tier 0.
 func (s *WhitelistServer) handleBulkCheck(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
 
@@ -200,15 +313,19 @@ func (s *WhitelistServer) handleBulkCheck(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	s.metrics.bulkSize.Observe(float64(len(req.Pubkeys)))
 	results := make(map[string]bool, len(req.Pubkeys))
+	scores := make(map[string]scoreResponse)
 	for _, pubkey := range req.Pubkeys {
 		if pubkey == "" {
 			continue
 		}
-		// In-memory whitelist never returns a non-nil error; ignored for parity
-		// with the single-key handler.
-		whitelisted, _ := s.whitelist.IsWhitelisted(pubkey)
+		entry, whitelisted := s.whitelist.Lookup(pubkey)
 		results[pubkey] = whitelisted
+		s.metrics.observeCheck("bulk", whitelisted)
+		if whitelisted {
+			scores[pubkey] = scoreResponse{Score: entry.Score, Tier: entry.Tier}
+		}
 	}
 
 	if s.debug {
@@ -216,7 +333,128 @@ func (s *WhitelistServer) handleBulkCheck(w http.ResponseWriter, r *http.Request
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(bulkCheckResponse{Results: results})
+	json.NewEncoder(w).Encode(bulkCheckResponse{Results: results, Scores: scores})
+}
+
+// handleDelta serves the membership changes since a generation
+// (GET /delta?since=<generation>).
+// - not ready or no change log → 503 JSON {"status":"loading",...}
+// - since missing or not a number → 400
+// - since outside the retained window → 410 Gone {"generation": N}; the client resyncs and resumes from N
+// - otherwise → 200 deltaResponse; an up-to-date client gets empty lists
+func (s *WhitelistServer) handleDelta(w http.ResponseWriter, r *http.Request) {
+	if s.changes == nil || !s.ready.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "loading",
+			"detail": "whitelist generation not yet available",
+		})
+		return
+	}
+
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid since: want a generation number", http.StatusBadRequest)
+		return
+	}
+
+	ch, gen, ok := s.changes.Since(since)
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]uint64{"generation": gen})
+		return
+	}
+
+	if s.debug {
+		s.logger.Printf("DELTA since=%d → %d (+%d -%d)", since, gen, len(ch.Added), len(ch.Removed))
+	}
+	json.NewEncoder(w).Encode(deltaResponse{
+		Since:      since,
+		Generation: gen,
+		Added:      hexKeys(ch.Added),
+		Removed:    hexKeys(ch.Removed),
+	})
+}
+
+// handleChanges streams generation changes as Server-Sent Events until the
+// client disconnects. See package changestream for the wire format and resume
+// semantics; the state machine is the same as handleDelta's, re-run each
+// time the ChangeLog advances.
+func (s *WhitelistServer) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if s.changes == nil || !s.ready.Load() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "loading",
+			"detail": "whitelist generation not yet available",
+		})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	since, err := changestream.ParseSince(r)
+	if err != nil {
+		http.Error(w, "invalid since: want a generation number", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(changestream.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	first := true
+	for {
+		wait := s.changes.Changed()
+		ch, gen, ok := s.changes.Since(since)
+		var ev *changestream.Event
+		switch {
+		case !ok:
+			ev = &changestream.Event{Resync: true, Generation: gen}
+		case first || gen != since:
+			ev = &changestream.Event{Since: since, Generation: gen, Added: hexKeys(ch.Added), Removed: hexKeys(ch.Removed)}
+		}
+		if ev != nil {
+			if err := changestream.Write(w, *ev); err != nil {
+				return
+			}
+			flusher.Flush()
+			if s.debug {
+				s.logger.Printf("CHANGES since=%d → %d resync=%v (+%d -%d)", since, gen, ev.Resync, len(ev.Added), len(ev.Removed))
+			}
+			since = gen
+		}
+		first = false
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wait:
+		case <-heartbeat.C:
+			if err := changestream.WriteHeartbeat(w); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// hexKeys encodes pubkeys as lowercase hex, never returning nil so the JSON
+// lists are always present.
+func hexKeys(keys [][32]byte) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = hex.EncodeToString(k[:])
+	}
+	return out
 }
 
 func (s *WhitelistServer) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -240,10 +478,16 @@ func (s *WhitelistServer) handleStats(w http.ResponseWriter, r *http.Request) {
 		refreshStr = lastRefresh.Format(time.RFC3339)
 	}
 
+	var gen uint64
+	if s.changes != nil {
+		gen = s.changes.Generation()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(statsResponse{
 		Entries:     s.entries.Load(),
 		LastRefresh: refreshStr,
+		Generation:  gen,
 	})
 }
 
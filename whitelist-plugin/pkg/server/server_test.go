@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"io"
@@ -9,9 +10,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 	"whitelist-plugin/pkg/bloom"
+	"whitelist-plugin/pkg/changestream"
+	"whitelist-plugin/pkg/repository"
 	"whitelist-plugin/pkg/version"
 	"whitelist-plugin/pkg/whitelist"
 )
@@ -145,6 +149,63 @@ func TestHandleBulkCheck(t *testing.T) {
 	}
 }
 
+func TestHandleCheck_ScoreAndTier(t *testing.T) {
+	seed := makeKey(0x01)
+	stub := makeKey(0x02)
+	wl := whitelist.NewWhiteList(nil)
+	wl.UpdateRecords([]repository.Record{
+		{Pubkey: seed, Distance: 0},
+		{Pubkey: stub, Distance: repository.NoDistance},
+	})
+	s := NewWhitelistServer(wl, ":0", false, log.New(io.Discard, "", 0))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		key  [32]byte
+		tier whitelist.Tier
+	}{
+		{seed, whitelist.TierHigh},
+		{stub, whitelist.TierLow},
+		{makeKey(0x03), whitelist.TierNone},
+	} {
+		resp, err := http.Get(ts.URL + "/check/" + hex.EncodeToString(tc.key[:]))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body checkResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if body.Tier != tc.tier {
+			t.Errorf("key %x: tier = %d, want %d", tc.key[:4], body.Tier, tc.tier)
+		}
+		if body.Whitelisted != (tc.tier != whitelist.TierNone) {
+			t.Errorf("key %x: whitelisted = %v inconsistent with tier %d", tc.key[:4], body.Whitelisted, tc.tier)
+		}
+	}
+
+	// Bulk: scores carries whitelisted keys only.
+	seedHex := hex.EncodeToString(seed[:])
+	unknown := makeKey(0x03)
+	unknownHex := hex.EncodeToString(unknown[:])
+	reqBody, _ := json.Marshal(bulkCheckRequest{Pubkeys: []string{seedHex, unknownHex}})
+	resp, err := http.Post(ts.URL+"/check", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var bulk bulkCheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bulk); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got := bulk.Scores[seedHex]; got.Tier != whitelist.TierHigh || got.Score <= 0 {
+		t.Errorf("bulk score for seed = %+v, want TierHigh with positive score", got)
+	}
+	if _, ok := bulk.Scores[unknownHex]; ok {
+		t.Error("expected no score entry for non-whitelisted key")
+	}
+}
+
 func TestHandleBulkCheck_InvalidJSON(t *testing.T) {
 	_, ts := setupServer(nil, true)
 	defer ts.Close()
@@ -380,6 +441,90 @@ func TestHandleBloom_StaleMismatchedETag(t *testing.T) {
 	}
 }
 
+func TestHandleBloom_Patch(t *testing.T) {
+	s, ts := setupServer(nil, false)
+	defer ts.Close()
+
+	b := bloom.NewCuckooBuilder(1000, 1e-6)
+	for i := 0; i < 500; i++ {
+		b.Add(makeKey(byte(i)))
+	}
+	f0, err := b.Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if err := s.SwapFilter(f0); err != nil {
+		t.Fatalf("SwapFilter failed: %v", err)
+	}
+	f1, p1, err := f0.Update([][32]byte{makeKey(0xF1)}, nil)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	s.SwapFilterPatch(f1, p1)
+	f2, p2, err := f1.Update([][32]byte{makeKey(0xF2)}, [][32]byte{makeKey(0xF1)})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	s.SwapFilterPatch(f2, p2)
+
+	get := func(etag string, patch bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", ts.URL+"/bloom", nil)
+		req.Header.Set("If-None-Match", etag)
+		if patch {
+			req.Header.Set("A-IM", bloom.PatchIM)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	// Two generations behind → one merged patch reproducing f2.
+	resp := get(f0.ETag(), true)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusIMUsed || resp.Header.Get("IM") != bloom.PatchIM {
+		t.Fatalf("expected 226 IM Used, got %d IM=%q", resp.StatusCode, resp.Header.Get("IM"))
+	}
+	if resp.Header.Get("ETag") != f2.ETag() || resp.Header.Get("Delta-Base") != f0.ETag() {
+		t.Errorf("ETag/Delta-Base = %q/%q", resp.Header.Get("ETag"), resp.Header.Get("Delta-Base"))
+	}
+	p, err := bloom.ReadPatch(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadPatch failed: %v", err)
+	}
+	got, err := f0.Apply(p)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got.ETag() != f2.ETag() {
+		t.Fatal("patched filter does not match the served generation")
+	}
+
+	// Without A-IM, or from an unknown generation, the whole filter is served.
+	for _, tc := range []struct {
+		etag  string
+		patch bool
+	}{{f0.ETag(), false}, {`"unknown"`, true}} {
+		resp := get(tc.etag, tc.patch)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("If-None-Match %s A-IM %v: expected 200, got %d", tc.etag, tc.patch, resp.StatusCode)
+		}
+	}
+
+	// A full rebuild drops the history.
+	if err := s.SwapFilter(f0); err != nil {
+		t.Fatalf("SwapFilter failed: %v", err)
+	}
+	resp2 := get(f1.ETag(), true)
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusOK {
+		t.Errorf("after rebuild: expected 200, got %d", resp2.StatusCode)
+	}
+}
+
 func TestSetStats_LiveValues(t *testing.T) {
 	s, ts := setupServer(nil, false)
 	defer ts.Close()
@@ -559,3 +704,138 @@ func TestHandleVersion(t *testing.T) {
 		t.Fatalf("mismatch: got %+v, want %+v", body, version.Info())
 	}
 }
+
+func TestHandleDelta(t *testing.T) {
+	s, ts := setupServer(nil, false)
+	defer ts.Close()
+
+	// Not ready → 503
+	resp, err := http.Get(ts.URL + "/delta?since=1")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before ready, got %d", resp.StatusCode)
+	}
+
+	changes := whitelist.NewChangeLog(100)
+	base := changes.Reset()
+	added, removed := makeKey(0x01), makeKey(0x02)
+	gen := changes.Append(whitelist.Changes{Added: [][32]byte{added}, Removed: [][32]byte{removed}})
+	s.SetChangeLog(changes)
+	s.SetReady(1)
+
+	// Bad since → 400
+	resp, err = http.Get(ts.URL + "/delta?since=abc")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", resp.StatusCode)
+	}
+
+	// In window → 200 with the changes
+	resp, err = http.Get(ts.URL + "/delta?since=" + strconv.FormatUint(base, 10))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var body deltaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Since != base || body.Generation != gen {
+		t.Errorf("since/generation = %d/%d, want %d/%d", body.Since, body.Generation, base, gen)
+	}
+	if len(body.Added) != 1 || body.Added[0] != hex.EncodeToString(added[:]) {
+		t.Errorf("added = %v", body.Added)
+	}
+	if len(body.Removed) != 1 || body.Removed[0] != hex.EncodeToString(removed[:]) {
+		t.Errorf("removed = %v", body.Removed)
+	}
+
+	// Out of window → 410 with the current generation
+	resp2, err := http.Get(ts.URL + "/delta?since=0")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusGone {
+		t.Fatalf("expected 410 for unknown generation, got %d", resp2.StatusCode)
+	}
+	var gone map[string]uint64
+	json.NewDecoder(resp2.Body).Decode(&gone)
+	if gone["generation"] != gen {
+		t.Errorf("410 generation = %d, want %d", gone["generation"], gen)
+	}
+}
+
+func TestHandleChanges(t *testing.T) {
+	s, ts := setupServer(nil, false)
+	defer ts.Close()
+
+	// Not ready → 503, which the subscriber retries rather than giving up on.
+	resp, err := http.Get(ts.URL + changestream.Path)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before ready, got %d", resp.StatusCode)
+	}
+
+	changes := whitelist.NewChangeLog(100)
+	base := changes.Reset()
+	s.SetChangeLog(changes)
+	s.SetReady(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	added := makeKey(0x01)
+	events := make(chan changestream.Event, 4)
+	go changestream.NewSubscriber(ts.URL, log.New(io.Discard, "", 0)).Run(ctx, 0, func(ev changestream.Event) {
+		events <- ev
+	})
+	next := func() changestream.Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for a change event")
+			return changestream.Event{}
+		}
+	}
+
+	// Generation 0 is outside the log → resync to the current generation.
+	if ev := next(); !ev.Resync || ev.Generation != base {
+		t.Fatalf("first event = %+v, want resync to %d", ev, base)
+	}
+
+	// An advance is pushed on the open connection.
+	gen := changes.Append(whitelist.Changes{Added: [][32]byte{added}})
+	ev := next()
+	if ev.Resync || ev.Since != base || ev.Generation != gen {
+		t.Fatalf("delta = %+v, want %d → %d", ev, base, gen)
+	}
+	if len(ev.Added) != 1 || ev.Added[0] != hex.EncodeToString(added[:]) {
+		t.Errorf("added = %v", ev.Added)
+	}
+
+	// Resuming from a held generation starts with a delta, not a resync.
+	ctx2, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+	go changestream.NewSubscriber(ts.URL, log.New(io.Discard, "", 0)).Run(ctx2, base, func(ev changestream.Event) {
+		events <- ev
+		cancel2()
+	})
+	if ev := next(); ev.Resync || ev.Since != base || ev.Generation != gen || len(ev.Added) != 1 {
+		t.Fatalf("resumed event = %+v, want delta %d → %d", ev, base, gen)
+	}
+}
@@ -0,0 +1,77 @@
+package verify
+
+import (
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// maxBatch caps the events in one VerifyBatch call made for batched Verify
+// calls.
+const maxBatch = 1024
+
+type pendingEvent struct {
+	evt *nostr.Event
+	out chan error
+}
+
+// batcher coalesces concurrent Verify calls into VerifyBatch calls.
+type batcher struct {
+	v      *Verifier
+	mu     sync.Mutex
+	queue  []pendingEvent // not yet verified
+	active bool           // a batch is being verified
+}
+
+// EnableBatching sends Verify calls through VerifyBatch: while one batch is
+// being verified, new calls queue and are verified together in the next, so
+// batches grow with the events in flight and an idle router adds no wait.
+// Worth it only when several goroutines call Verify at once, as the
+// pipelined event loop does. Must be called before the first Verify.
+func (v *Verifier) EnableBatching() {
+	v.batch = &batcher{v: v}
+}
+
+func (b *batcher) verify(evt *nostr.Event) error {
+	out := make(chan error, 1)
+	b.mu.Lock()
+	b.queue = append(b.queue, pendingEvent{evt: evt, out: out})
+	batch := b.take()
+	b.mu.Unlock()
+
+	if batch != nil {
+		go b.flush(batch)
+	}
+	return <-out
+}
+
+// take dequeues the next batch if none is being verified. Called with mu held.
+func (b *batcher) take() []pendingEvent {
+	if b.active || len(b.queue) == 0 {
+		return nil
+	}
+	n := min(len(b.queue), maxBatch)
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+	b.active = true
+	return batch
+}
+
+// flush verifies batch, answers its callers, and keeps verifying whatever
+// queued up meanwhile.
+func (b *batcher) flush(batch []pendingEvent) {
+	for batch != nil {
+		evts := make([]*nostr.Event, len(batch))
+		for i, p := range batch {
+			evts[i] = p.evt
+		}
+		for i, err := range b.v.VerifyBatch(evts) {
+			batch[i].out <- err
+		}
+
+		b.mu.Lock()
+		b.active = false
+		batch = b.take()
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,156 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func signed(t *testing.T, content string) nostr.Event {
+	t.Helper()
+	evt := nostr.Event{Kind: 1, Content: content, CreatedAt: 1700000000, Tags: nostr.Tags{}}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return evt
+}
+
+func TestEvent(t *testing.T) {
+	good := signed(t, "hello")
+	if err := Event(&good); err != nil {
+		t.Fatalf("valid event: %v", err)
+	}
+
+	tampered := good
+	tampered.Content = "goodbye"
+	if err := Event(&tampered); !errors.Is(err, ErrInvalidID) || Reason(err) != ReasonInvalidID {
+		t.Fatalf("tampered content: %v", err)
+	}
+
+	// Re-hashed after tampering, so only the signature gives it away.
+	tampered.ID = tampered.GetID()
+	if err := Event(&tampered); !errors.Is(err, ErrInvalidSignature) || Reason(err) != ReasonInvalidSignature {
+		t.Fatalf("stale signature: %v", err)
+	}
+
+	other := signed(t, "hello")
+	stolen := good
+	stolen.Sig = other.Sig
+	if err := Event(&stolen); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("someone else's signature: %v", err)
+	}
+
+	garbage := good
+	garbage.PubKey = "zz"
+	garbage.ID = garbage.GetID()
+	if err := Event(&garbage); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("malformed pubkey: %v", err)
+	}
+}
+
+func TestVerifier_CacheOnlyRemembersValidEvents(t *testing.T) {
+	v := NewVerifier(2)
+	good := signed(t, "a")
+	if err := v.Verify(&good); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, ok := v.seen[good.ID+good.Sig]; !ok {
+		t.Fatal("valid event not cached")
+	}
+
+	// Same id, forged sig: not a cache hit.
+	forged := good
+	forged.Sig = signed(t, "b").Sig
+	if err := v.Verify(&forged); err == nil {
+		t.Fatal("forged signature passed on the strength of the cache")
+	}
+
+	// The cached id and sig of a valid event, on different content: the id
+	// no longer matches, whatever the cache holds.
+	for _, tamper := range []func(*nostr.Event){
+		func(e *nostr.Event) { e.Content = "forged" },
+		func(e *nostr.Event) { e.Kind = 7 },
+		func(e *nostr.Event) { e.Tags = nostr.Tags{{"p", e.PubKey}} },
+		func(e *nostr.Event) { e.PubKey = signed(t, "x").PubKey },
+	} {
+		replayed := good
+		tamper(&replayed)
+		if err := v.Verify(&replayed); !errors.Is(err, ErrInvalidID) {
+			t.Fatalf("replayed id and sig on changed event: %v, want invalid id", err)
+		}
+	}
+
+	for _, c := range []string{"c", "d"} {
+		e := signed(t, c)
+		v.Verify(&e)
+	}
+	if _, ok := v.seen[good.ID+good.Sig]; ok || len(v.seen) != 2 {
+		t.Fatalf("cache holds %d entries, oldest not evicted", len(v.seen))
+	}
+}
+
+func TestVerifier_VerifyBatch(t *testing.T) {
+	var evts []*nostr.Event
+	for i := range 20 {
+		evt := signed(t, fmt.Sprint(i))
+		evts = append(evts, &evt)
+	}
+	evts[7].Content = "forged"
+	evts[13].Sig = evts[12].Sig
+	dup, tampered := *evts[3], *evts[3]
+	tampered.Content = "forged"
+	evts = append(evts, &dup, &tampered) // copies share evts[3]'s signature check
+
+	errs := NewVerifier(0).VerifyBatch(evts)
+	for i, err := range errs {
+		switch i {
+		case 7, 21:
+			if !errors.Is(err, ErrInvalidID) {
+				t.Errorf("event %d: %v, want invalid id", i, err)
+			}
+		case 13:
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("event 13: %v, want invalid signature", err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("event %d: %v", i, err)
+			}
+		}
+	}
+	if errs := NewVerifier(0).VerifyBatch(nil); len(errs) != 0 {
+		t.Fatalf("empty batch: %v", errs)
+	}
+}
+
+func TestVerifier_Batching(t *testing.T) {
+	v := NewVerifier(0)
+	v.EnableBatching()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		evt := signed(t, fmt.Sprint(i))
+		if i%5 == 0 {
+			evt.Content = "forged"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := v.Verify(&evt)
+			if i%5 == 0 && !errors.Is(err, ErrInvalidID) {
+				t.Errorf("event %d: %v, want invalid id", i, err)
+			} else if i%5 != 0 && err != nil {
+				t.Errorf("event %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.seen) != 40 {
+		t.Fatalf("cache holds %d events, want the 40 valid ones", len(v.seen))
+	}
+}
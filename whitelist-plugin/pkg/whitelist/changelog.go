@@ -0,0 +1,138 @@
+package whitelist
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultChangeLogKeys bounds the pubkeys a ChangeLog retains across all
+// generations (~32 MiB of keys). Clients further behind than that resync.
+const DefaultChangeLogKeys = 1 << 20
+
+// Changes is the membership difference between two whitelist generations.
+type Changes struct {
+	Added   [][32]byte
+	Removed [][32]byte
+}
+
+// Len returns the number of changed pubkeys.
+func (c Changes) Len() int {
+	return len(c.Added) + len(c.Removed)
+}
+
+// ChangeLog numbers whitelist generations and keeps the changes between
+// recent ones, so clients holding generation g can catch up with just the
+// pubkeys added or removed since g instead of a full reload.
+//
+// Generations are seeded from the wall clock at construction, so a client
+// resuming against a restarted server presents a generation older than the
+// new log's base and is told to resync rather than being served a delta from
+// an unrelated history.
+type ChangeLog struct {
+	mu      sync.RWMutex
+	base    uint64    // oldest generation Since can resume from
+	gen     uint64    // current generation
+	entries []Changes // entries[i] moves generation base+i to base+i+1
+	keys    int       // pubkeys held across entries
+	maxKeys int
+	notify  chan struct{} // closed and replaced whenever gen advances
+}
+
+// NewChangeLog returns an empty log retaining at most maxKeys pubkeys.
+func NewChangeLog(maxKeys int) *ChangeLog {
+	if maxKeys <= 0 {
+		maxKeys = DefaultChangeLogKeys
+	}
+	gen := uint64(time.Now().Unix())
+	return &ChangeLog{base: gen, gen: gen, maxKeys: maxKeys, notify: make(chan struct{})}
+}
+
+// Changed returns a channel that is closed when the generation next
+// advances. Take it before calling Since so an advance in between is not
+// missed.
+func (l *ChangeLog) Changed() <-chan struct{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.notify
+}
+
+// advance bumps the generation and wakes Changed waiters. l.mu must be held.
+func (l *ChangeLog) advance() {
+	l.gen++
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// Generation returns the current generation.
+func (l *ChangeLog) Generation() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.gen
+}
+
+// Append records ch as a new generation and returns it. An empty ch does not
+// advance the generation. A change set larger than the whole log resets it.
+func (l *ChangeLog) Append(ch Changes) uint64 {
+	if ch.Len() == 0 {
+		return l.Generation()
+	}
+	if ch.Len() > l.maxKeys {
+		return l.Reset()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, ch)
+	l.keys += ch.Len()
+	l.advance()
+	for l.keys > l.maxKeys {
+		l.keys -= l.entries[0].Len()
+		l.entries[0] = Changes{}
+		l.entries = l.entries[1:]
+		l.base++
+	}
+	return l.gen
+}
+
+// Reset starts a new generation with no history, forcing every client to
+// resync. Used for the initial load, whose "delta" is the whole whitelist.
+func (l *ChangeLog) Reset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance()
+	l.base = l.gen
+	l.entries = nil
+	l.keys = 0
+	return l.gen
+}
+
+// Since returns the changes from generation gen to the current one, which it
+// also returns. A pubkey appears once, under its latest change. It reports
+// false when gen is not in the retained window (too old, from before a
+// restart, or in the future), in which case the client must resync.
+func (l *ChangeLog) Since(gen uint64) (Changes, uint64, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if gen < l.base || gen > l.gen {
+		return Changes{}, l.gen, false
+	}
+
+	latest := make(map[[32]byte]bool) // true = added
+	for _, e := range l.entries[gen-l.base:] {
+		for _, k := range e.Added {
+			latest[k] = true
+		}
+		for _, k := range e.Removed {
+			latest[k] = false
+		}
+	}
+	var ch Changes
+	for k, added := range latest {
+		if added {
+			ch.Added = append(ch.Added, k)
+		} else {
+			ch.Removed = append(ch.Removed, k)
+		}
+	}
+	return ch, l.gen, true
+}
@@ -0,0 +1,103 @@
+package whitelist
+
+import (
+	"testing"
+)
+
+func TestChangeLog_SinceMergesLatest(t *testing.T) {
+	l := NewChangeLog(100)
+	g0 := l.Reset()
+
+	g1 := l.Append(Changes{Added: [][32]byte{{1}, {2}}})
+	l.Append(Changes{Removed: [][32]byte{{1}}, Added: [][32]byte{{3}}})
+	if g := l.Append(Changes{}); g != g1+1 {
+		t.Fatalf("empty Append advanced generation to %d, want %d", g, g1+1)
+	}
+
+	ch, gen, ok := l.Since(g0)
+	if !ok || gen != g1+1 {
+		t.Fatalf("Since(g0) = gen %d ok %v, want gen %d", gen, ok, g1+1)
+	}
+	if !sameKeys(ch.Added, [][32]byte{{2}, {3}}) || !sameKeys(ch.Removed, [][32]byte{{1}}) {
+		t.Fatalf("Since(g0) = %+v", ch)
+	}
+
+	ch, _, ok = l.Since(g1)
+	if !ok || !sameKeys(ch.Added, [][32]byte{{3}}) || !sameKeys(ch.Removed, [][32]byte{{1}}) {
+		t.Fatalf("Since(g1) = %+v, %v", ch, ok)
+	}
+
+	ch, _, ok = l.Since(gen)
+	if !ok || ch.Len() != 0 {
+		t.Fatalf("Since(current) = %+v, %v; want empty", ch, ok)
+	}
+}
+
+func TestChangeLog_OutOfWindow(t *testing.T) {
+	l := NewChangeLog(3)
+	g0 := l.Reset()
+	l.Append(Changes{Added: [][32]byte{{1}, {2}}})
+	g2 := l.Append(Changes{Added: [][32]byte{{3}, {4}}}) // evicts the first entry
+
+	if _, _, ok := l.Since(g0); ok {
+		t.Error("evicted generation should require resync")
+	}
+	if _, _, ok := l.Since(g2 - 1); !ok {
+		t.Error("retained generation should resume")
+	}
+	if _, _, ok := l.Since(g2 + 1); ok {
+		t.Error("future generation should require resync")
+	}
+
+	// A change set larger than the log resets it.
+	g3 := l.Append(Changes{Added: [][32]byte{{5}, {6}, {7}, {8}}})
+	if _, _, ok := l.Since(g2); ok {
+		t.Error("oversized Append should drop history")
+	}
+	if ch, _, ok := l.Since(g3); !ok || ch.Len() != 0 {
+		t.Errorf("Since(g3) = %+v, %v; want empty", ch, ok)
+	}
+}
+
+func sameKeys(got, want [][32]byte) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	set := make(map[[32]byte]bool, len(got))
+	for _, k := range got {
+		set[k] = true
+	}
+	for _, k := range want {
+		if !set[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestChangeLog_ChangedWakesOnAdvance(t *testing.T) {
+	l := NewChangeLog(100)
+	wait := l.Changed()
+
+	l.Append(Changes{})
+	select {
+	case <-wait:
+		t.Fatal("empty Append should not wake waiters")
+	default:
+	}
+
+	l.Append(Changes{Added: [][32]byte{{1}}})
+	select {
+	case <-wait:
+	default:
+		t.Fatal("Append did not wake waiters")
+	}
+
+	wait = l.Changed()
+	l.Reset()
+	select {
+	case <-wait:
+	default:
+		t.Fatal("Reset did not wake waiters")
+	}
+}
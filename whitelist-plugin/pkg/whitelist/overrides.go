@@ -0,0 +1,115 @@
+package whitelist
+
+import (
+	"whitelist-plugin/pkg/overrides"
+	"whitelist-plugin/pkg/repository"
+)
+
+// SetOverrides applies the operator overrides in s on top of every refresh,
+// and applies changes to s as soon as they are made. Must be called before
+// Start().
+func (r *WhitelistRefresher) SetOverrides(s *overrides.Store) {
+	r.overrides = s
+}
+
+// overlayRecords applies overrides to records fetched from the repository:
+// denied pubkeys are dropped and allowed ones pinned, and the Dgraph entry
+// of each overridden pubkey is remembered so lifting the override can
+// restore it. A full refresh picks up the store's current overrides and
+// adds allowed pubkeys missing from Dgraph; a delta reuses the ones applied.
+func (r *WhitelistRefresher) overlayRecords(records []repository.Record, full bool) []repository.Record {
+	if r.overrides == nil {
+		return records
+	}
+	if full {
+		all := r.overrides.All()
+		r.applied = make(map[[32]byte]overrides.Action, len(all))
+		r.base = make(map[[32]byte]*Entry, len(all))
+		for k, o := range all {
+			r.applied[k] = o.Action
+			r.base[k] = nil
+		}
+	}
+	if len(r.applied) == 0 {
+		return records
+	}
+
+	out := make([]repository.Record, 0, len(records))
+	for _, rec := range records {
+		action, ok := r.applied[rec.Pubkey]
+		if !ok {
+			out = append(out, rec)
+			continue
+		}
+		e := ScoreRecord(rec)
+		r.base[rec.Pubkey] = &e
+		if action == overrides.Allow {
+			rec.Pinned = true
+			out = append(out, rec)
+		}
+	}
+	if full {
+		for k, action := range r.applied {
+			if action == overrides.Allow && r.base[k] == nil {
+				out = append(out, pinnedRecord(k))
+			}
+		}
+	}
+	return out
+}
+
+// syncOverrides brings the whitelist in line with overrides changed since
+// the last refresh, publishing the result like a delta. Before the initial
+// load it does nothing; that load applies them.
+func (r *WhitelistRefresher) syncOverrides() {
+	if !r.loaded {
+		return
+	}
+	all := r.overrides.All()
+	set := make(map[[32]byte]Entry)
+	var remove [][32]byte
+	for k, o := range all {
+		if action, ok := r.applied[k]; ok && action == o.Action {
+			continue
+		}
+		if _, ok := r.applied[k]; !ok {
+			// Not overridden until now, so the whitelist holds the Dgraph entry.
+			r.base[k] = nil
+			if e, ok := r.whitelist.get(k); ok {
+				r.base[k] = &e
+			}
+		}
+		r.applied[k] = o.Action
+		if o.Action == overrides.Allow {
+			set[k] = ScoreRecord(pinnedRecord(k))
+		} else {
+			remove = append(remove, k)
+		}
+	}
+	for k := range r.applied {
+		if _, ok := all[k]; ok {
+			continue
+		}
+		if e := r.base[k]; e != nil {
+			set[k] = *e
+		} else {
+			remove = append(remove, k)
+		}
+		delete(r.applied, k)
+		delete(r.base, k)
+	}
+
+	ch := r.whitelist.applyEntries(set, remove)
+	if ch.Len() == 0 {
+		return
+	}
+	if r.onDelta != nil {
+		r.onDelta(ch)
+	}
+	gen := r.changes.Append(ch)
+	r.logger.Printf("whitelist overrides: +%d -%d (generation %d)", len(ch.Added), len(ch.Removed), gen)
+}
+
+func pinnedRecord(k [32]byte) repository.Record {
+	return repository.Record{Pubkey: k, Distance: repository.NoDistance, Pinned: true}
+}
@@ -0,0 +1,85 @@
+package whitelist
+
+import (
+	"context"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+	"whitelist-plugin/pkg/overrides"
+	"whitelist-plugin/pkg/repository"
+)
+
+func TestWhitelistRefresher_Overrides(t *testing.T) {
+	inDgraph, denied, allowed := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	repo := &mockDeltaRepo{mockKeyRepo: mockKeyRepo{records: []repository.Record{
+		{Pubkey: inDgraph, Distance: 2},
+		{Pubkey: denied, Distance: 1, FollowerCount: 50},
+	}}}
+	store, err := overrides.Open(filepath.Join(t.TempDir(), "overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set(denied, overrides.Override{Action: overrides.Deny})
+	store.Set(allowed, overrides.Override{Action: overrides.Allow})
+
+	refresher := NewWhitelistRefresher(context.Background(), repo, time.Hour, 0, log.New(io.Discard, "", 0))
+	refresher.SetDeltaInterval(time.Hour)
+	refresher.SetOverrides(store)
+	var deltas []Changes
+	refresher.SetOnDelta(func(ch Changes) { deltas = append(deltas, ch) })
+	refresher.refresh()
+
+	wl := refresher.Whitelist()
+	if _, ok := wl.get(denied); ok {
+		t.Error("denied pubkey whitelisted after refresh")
+	}
+	if e, ok := wl.get(allowed); !ok || e.Tier != TierHigh {
+		t.Errorf("allowed pubkey = %+v, %v; want TierHigh", e, ok)
+	}
+	deniedEntry := ScoreRecord(repo.records[1])
+
+	// A delta re-reading the denied pubkey must not bring it back.
+	repo.delta = []repository.Record{repo.records[1]}
+	refresher.refreshDelta()
+	if _, ok := wl.get(denied); ok {
+		t.Error("delta re-added a denied pubkey")
+	}
+
+	// Lifting the deny restores the Dgraph entry; denying a Dgraph pubkey and
+	// lifting an allow for a non-Dgraph pubkey both remove.
+	gen := refresher.Changes().Generation()
+	store.Delete(denied)
+	store.Set(inDgraph, overrides.Override{Action: overrides.Deny})
+	store.Delete(allowed)
+	refresher.syncOverrides()
+
+	if e, ok := wl.get(denied); !ok || e != deniedEntry {
+		t.Errorf("lifted deny = %+v, %v; want Dgraph entry %+v", e, ok, deniedEntry)
+	}
+	for _, k := range [][32]byte{inDgraph, allowed} {
+		if _, ok := wl.get(k); ok {
+			t.Errorf("%x still whitelisted", k[:1])
+		}
+	}
+	ch, _, ok := refresher.Changes().Since(gen)
+	if !ok || !sameKeys(ch.Added, [][32]byte{denied}) || !sameKeys(ch.Removed, [][32]byte{inDgraph, allowed}) {
+		t.Errorf("published changes = %+v, %v", ch, ok)
+	}
+	if len(deltas) != 1 {
+		t.Errorf("onDelta called %d times, want 1", len(deltas))
+	}
+
+	// Nothing pending → no new generation.
+	refresher.syncOverrides()
+	if refresher.Changes().Generation() != gen+1 {
+		t.Error("idle sync advanced the generation")
+	}
+
+	// The next full refresh keeps applying the deny.
+	refresher.refresh()
+	if _, ok := wl.get(inDgraph); ok {
+		t.Error("full refresh re-added a denied pubkey")
+	}
+}
@@ -0,0 +1,84 @@
+package whitelist
+
+import (
+	"math"
+
+	"whitelist-plugin/pkg/repository"
+)
+
+// Tier is a coarse trust bucket plugins can key policy on. TierNone means the
+// pubkey is not whitelisted; every whitelisted pubkey is at least TierLow.
+type Tier uint8
+
+const (
+	TierNone Tier = iota
+	TierLow
+	TierMid
+	TierHigh
+)
+
+// String returns the lowercase tier name used in logs and config.
+func (t Tier) String() string {
+	switch t {
+	case TierNone:
+		return "none"
+	case TierLow:
+		return "low"
+	case TierMid:
+		return "mid"
+	case TierHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// Entry is the per-pubkey value held by the whitelist. Score is in [0, 1].
+type Entry struct {
+	Score float32
+	Tier  Tier
+}
+
+// Score weights and tier cut-offs. Distance dominates: a node close to the
+// seed set is trusted on its own, while follower_count alone (which spam rings
+// can inflate among themselves) only lifts an unplaced node to TierMid.
+const (
+	distanceWeight  = 0.6
+	followerWeight  = 0.4
+	flaggedPenalty  = 0.25 // score multiplier for clusterscan-flagged members
+	followerLogSpan = 4.0  // log10 followers at which the follower term saturates (10k)
+
+	tierHighCutoff = 0.5
+	tierMidCutoff  = 0.2
+)
+
+// ScoreRecord derives a pubkey's trust score and tier from its web-of-trust
+// signals. Pinned records are always TierHigh with a full score.
+func ScoreRecord(rec repository.Record) Entry {
+	if rec.Pinned {
+		return Entry{Score: 1, Tier: TierHigh}
+	}
+
+	var dist float64
+	if rec.Distance >= 0 {
+		dist = 1 / float64(1+rec.Distance)
+	}
+	var followers float64
+	if rec.FollowerCount > 0 {
+		followers = math.Min(1, math.Log10(1+float64(rec.FollowerCount))/followerLogSpan)
+	}
+
+	score := distanceWeight*dist + followerWeight*followers
+	if rec.Flagged {
+		score *= flaggedPenalty
+	}
+
+	tier := TierLow
+	switch {
+	case score >= tierHighCutoff:
+		tier = TierHigh
+	case score >= tierMidCutoff:
+		tier = TierMid
+	}
+	return Entry{Score: float32(score), Tier: tier}
+}
@@ -0,0 +1,67 @@
+package whitelist
+
+import (
+	"encoding/hex"
+	"testing"
+	"whitelist-plugin/pkg/repository"
+)
+
+func TestScoreRecord_Tiers(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  repository.Record
+		want Tier
+	}{
+		{"pinned", repository.Record{Distance: repository.NoDistance, Pinned: true}, TierHigh},
+		{"seed", repository.Record{Distance: 0}, TierHigh},
+		{"round 1 with followers", repository.Record{Distance: 1, FollowerCount: 100}, TierHigh},
+		{"round 2 few followers", repository.Record{Distance: 2, FollowerCount: 10}, TierMid},
+		{"unplaced popular", repository.Record{Distance: repository.NoDistance, FollowerCount: 1000}, TierMid},
+		{"unplaced obscure", repository.Record{Distance: repository.NoDistance, FollowerCount: 10}, TierLow},
+		{"unplaced no signals", repository.Record{Distance: repository.NoDistance}, TierLow},
+		{"flagged near seed", repository.Record{Distance: 1, FollowerCount: 100, Flagged: true}, TierLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreRecord(tt.rec)
+			if got.Tier != tt.want {
+				t.Errorf("ScoreRecord(%+v).Tier = %s (score %.3f), want %s", tt.rec, got.Tier, got.Score, tt.want)
+			}
+			if got.Score < 0 || got.Score > 1 {
+				t.Errorf("ScoreRecord(%+v).Score = %f, want within [0, 1]", tt.rec, got.Score)
+			}
+		})
+	}
+}
+
+func TestScoreRecord_FollowerTermSaturates(t *testing.T) {
+	a := ScoreRecord(repository.Record{Distance: repository.NoDistance, FollowerCount: 10000})
+	b := ScoreRecord(repository.Record{Distance: repository.NoDistance, FollowerCount: 10000000})
+	if a.Score != b.Score {
+		t.Errorf("follower term should saturate at 10k: %f != %f", a.Score, b.Score)
+	}
+}
+
+func TestLookup_ReturnsEntry(t *testing.T) {
+	k := makeKey(0x05)
+	wl := &Whitelist{}
+	wl.UpdateRecords([]repository.Record{{Pubkey: k, Distance: 0}})
+
+	e, ok := wl.Lookup(hex.EncodeToString(k[:]))
+	if !ok || e.Tier != TierHigh {
+		t.Fatalf("Lookup = %+v, %v; want TierHigh, true", e, ok)
+	}
+
+	other := makeKey(0x06)
+	if e, ok := wl.Lookup(hex.EncodeToString(other[:])); ok || e.Tier != TierNone {
+		t.Errorf("Lookup(unknown) = %+v, %v; want TierNone, false", e, ok)
+	}
+}
+
+func TestUpdateKeys_DefaultsToTierLow(t *testing.T) {
+	k := makeKey(0x07)
+	wl := NewWhiteList([][32]byte{k})
+	if e, ok := wl.Lookup(hex.EncodeToString(k[:])); !ok || e.Tier != TierLow {
+		t.Errorf("Lookup = %+v, %v; want TierLow, true", e, ok)
+	}
+}
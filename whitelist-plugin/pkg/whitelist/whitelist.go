@@ -2,12 +2,14 @@ package whitelist
 
 import (
 	"encoding/hex"
+	"maps"
 	"strings"
 	"sync/atomic"
+	"whitelist-plugin/pkg/repository"
 )
 
 type Whitelist struct {
-	list atomic.Pointer[map[[32]byte]struct{}]
+	list atomic.Pointer[map[[32]byte]Entry]
 }
 
 func NewWhiteList(keys [][32]byte) *Whitelist {
@@ -20,19 +22,26 @@ func NewWhiteList(keys [][32]byte) *Whitelist {
 }
 
 func (wl *Whitelist) IsWhitelisted(key string) (bool, error) {
+	_, ok := wl.Lookup(key)
+	return ok, nil
+}
+
+// Lookup returns the trust entry for a hex pubkey. Invalid or unknown keys
+// report false with a zero Entry (TierNone).
+func (wl *Whitelist) Lookup(key string) (Entry, bool) {
 	if len(key) != 64 {
-		return false, nil
+		return Entry{}, false
 	}
 	var k [32]byte
 	if _, err := hex.Decode(k[:], []byte(strings.ToLower(key))); err != nil {
-		return false, nil
+		return Entry{}, false
 	}
 	mp := wl.list.Load()
 	if mp == nil {
-		return false, nil
+		return Entry{}, false
 	}
-	_, ok := (*mp)[k]
-	return ok, nil
+	e, ok := (*mp)[k]
+	return e, ok
 }
 
 func (wl *Whitelist) Len() int {
@@ -43,10 +52,107 @@ func (wl *Whitelist) Len() int {
 	return len(*mp)
 }
 
+// UpdateKeys replaces the whitelist with unscored keys, each at TierLow.
 func (wl *Whitelist) UpdateKeys(keys [][32]byte) {
-	nm := make(map[[32]byte]struct{}, len(keys))
+	nm := make(map[[32]byte]Entry, len(keys))
 	for _, k := range keys {
-		nm[k] = struct{}{}
+		nm[k] = Entry{Tier: TierLow}
+	}
+	wl.list.Store(&nm)
+}
+
+// UpdateRecords scores each record and swaps in the new map in one atomic
+// store, so readers see either the previous or the new scores, never a mix.
+// It returns the membership changes against the previous map.
+func (wl *Whitelist) UpdateRecords(records []repository.Record) Changes {
+	nm := make(map[[32]byte]Entry, len(records))
+	for _, rec := range records {
+		nm[rec.Pubkey] = ScoreRecord(rec)
+	}
+	old := wl.list.Swap(&nm)
+
+	var ch Changes
+	if old == nil {
+		return ch
+	}
+	for k := range nm {
+		if _, ok := (*old)[k]; !ok {
+			ch.Added = append(ch.Added, k)
+		}
+	}
+	for k := range *old {
+		if _, ok := nm[k]; !ok {
+			ch.Removed = append(ch.Removed, k)
+		}
+	}
+	return ch
+}
+
+// ApplyRecords upserts records into a copy of the current map and swaps it
+// in, leaving every other entry as it was. It returns the pubkeys that were
+// not whitelisted before; re-scored pubkeys are updated but not reported.
+func (wl *Whitelist) ApplyRecords(records []repository.Record) Changes {
+	var ch Changes
+	if len(records) == 0 {
+		return ch
+	}
+	nm := make(map[[32]byte]Entry, len(records))
+	if old := wl.list.Load(); old != nil {
+		nm = maps.Clone(*old)
+	}
+	for _, rec := range records {
+		if _, ok := nm[rec.Pubkey]; !ok {
+			ch.Added = append(ch.Added, rec.Pubkey)
+		}
+		nm[rec.Pubkey] = ScoreRecord(rec)
 	}
 	wl.list.Store(&nm)
+	return ch
+}
+
+// applyEntries sets and removes entries in a copy of the current map and
+// swaps it in. It returns the pubkeys whose membership changed.
+func (wl *Whitelist) applyEntries(set map[[32]byte]Entry, remove [][32]byte) Changes {
+	var ch Changes
+	nm := make(map[[32]byte]Entry, len(set))
+	if old := wl.list.Load(); old != nil {
+		nm = maps.Clone(*old)
+	}
+	for k, e := range set {
+		if _, ok := nm[k]; !ok {
+			ch.Added = append(ch.Added, k)
+		}
+		nm[k] = e
+	}
+	for _, k := range remove {
+		if _, ok := nm[k]; ok {
+			ch.Removed = append(ch.Removed, k)
+			delete(nm, k)
+		}
+	}
+	wl.list.Store(&nm)
+	return ch
+}
+
+// get returns the entry for a pubkey.
+func (wl *Whitelist) get(k [32]byte) (Entry, bool) {
+	mp := wl.list.Load()
+	if mp == nil {
+		return Entry{}, false
+	}
+	e, ok := (*mp)[k]
+	return e, ok
+}
+
+// Keys returns every whitelisted pubkey in unspecified order.
+func (wl *Whitelist) Keys() [][32]byte {
+	mp := wl.list.Load()
+	if mp == nil {
+		return nil
+	}
+	keys := make([][32]byte, 0, len(*mp))
+	for k := range *mp {
+		keys = append(keys, k)
+	}
+	return keys
 }
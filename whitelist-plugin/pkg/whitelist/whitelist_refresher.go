@@ -5,11 +5,18 @@ import (
 	"log"
 	"sync"
 	"time"
+	"whitelist-plugin/pkg/overrides"
 	"whitelist-plugin/pkg/repository"
 )
 
+// deltaOverlap is subtracted from a full refresh's start time to get the
+// first delta watermark, covering clock skew between this host and the
+// crawler that writes last_db_update.
+const deltaOverlap = time.Minute
+
 type WhitelistRefresher struct {
 	whitelist  *Whitelist
+	changes    *ChangeLog
 	keyRepo    repository.KeyRepository
 	interval   time.Duration
 	ctx        context.Context
@@ -17,13 +24,27 @@ type WhitelistRefresher struct {
 	waitGroup  sync.WaitGroup
 	retryCount int
 	logger     *log.Logger
-	onRefresh  func(keys [][32]byte) // D-01: registered before Start(), called after UpdateKeys
+	onRefresh  func(records []repository.Record, ch Changes) // D-01: registered before Start(), called after UpdateRecords
+	onDelta    func(ch Changes)                              // registered before Start(), called after a delta changes membership
+	onFetch    func(kind string, d time.Duration, err error) // registered before Start(), called after every repository read
+	// Both callbacks run before the refresh's generation is published to
+	// the ChangeLog, so derived state (the bloom filter) is never behind it.
+
+	deltaRepo     repository.DeltaRepository // nil = full refreshes only
+	deltaInterval time.Duration
+	watermark     int64 // last_db_update to read deltas from; refresh goroutine only
+	loaded        bool  // initial full refresh succeeded; refresh goroutine only
+
+	overrides *overrides.Store // nil = no operator overrides
+	applied   map[[32]byte]overrides.Action
+	base      map[[32]byte]*Entry // Dgraph entry under each applied override; nil = not in Dgraph
 }
 
 func NewWhitelistRefresher(ctx context.Context, keyRepo repository.KeyRepository, interval time.Duration, retryCount int, logger *log.Logger) *WhitelistRefresher {
 	ctx, cancel := context.WithCancel(ctx)
 	r := &WhitelistRefresher{
 		whitelist:  NewWhiteList([][32]byte{}),
+		changes:    NewChangeLog(DefaultChangeLogKeys),
 		keyRepo:    keyRepo,
 		interval:   interval,
 		ctx:        ctx,
@@ -35,28 +56,70 @@ func NewWhitelistRefresher(ctx context.Context, keyRepo repository.KeyRepository
 }
 
 // SetOnRefresh registers a callback that fires after every successful whitelist
-// refresh (after UpdateKeys). Must be called before Start(). Not concurrency-safe
-// with Start() — wiring happens in main before the goroutine launches.
-func (r *WhitelistRefresher) SetOnRefresh(fn func(keys [][32]byte)) {
+// refresh (after UpdateRecords) with the full record set and its difference from
+// the previous one; on the first load every key is in ch.Added. Must be called
+// before Start(). Not concurrency-safe with Start() — wiring happens in main before
+// the goroutine launches.
+func (r *WhitelistRefresher) SetOnRefresh(fn func(records []repository.Record, ch Changes)) {
 	r.onRefresh = fn
 }
 
+// SetOnDelta registers a callback that fires after a delta refresh adds
+// pubkeys or an override change adds or removes them. Must be called before
+// Start().
+func (r *WhitelistRefresher) SetOnDelta(fn func(ch Changes)) {
+	r.onDelta = fn
+}
+
+// SetOnFetch registers a callback that fires after every repository read,
+// failed attempts included, with the kind of read ("full" or "delta"), how
+// long it took and its error. Must be called before Start().
+func (r *WhitelistRefresher) SetOnFetch(fn func(kind string, d time.Duration, err error)) {
+	r.onFetch = fn
+}
+
+// SetDeltaInterval enables delta refreshes every interval between full
+// refreshes when the repository implements repository.DeltaRepository.
+// Zero disables them. Must be called before Start().
+func (r *WhitelistRefresher) SetDeltaInterval(interval time.Duration) {
+	r.deltaRepo = nil
+	r.deltaInterval = interval
+	if dr, ok := r.keyRepo.(repository.DeltaRepository); ok && interval > 0 {
+		r.deltaRepo = dr
+	}
+}
+
 func (r *WhitelistRefresher) Start() {
 	// Initial refresh
 	r.refresh()
 
-	// Start periodic refresh
+	// Start periodic refresh. Full and delta refreshes share this goroutine
+	// so they never interleave their updates.
 	r.waitGroup.Add(1)
 	go func() {
 		defer r.waitGroup.Done()
 		ticker := time.NewTicker(r.interval)
 		defer ticker.Stop()
+		var deltaC <-chan time.Time
+		if r.deltaRepo != nil {
+			deltaTicker := time.NewTicker(r.deltaInterval)
+			defer deltaTicker.Stop()
+			deltaC = deltaTicker.C
+		}
+		var overridesC <-chan struct{}
+		if r.overrides != nil {
+			overridesC = r.overrides.Updated()
+		}
 		for {
 			select {
 			case <-r.ctx.Done():
 				return
 			case <-ticker.C:
 				r.refresh()
+			case <-deltaC:
+				r.refreshDelta()
+			case <-overridesC:
+				r.syncOverrides()
 			}
 		}
 	}()
@@ -69,7 +132,9 @@ func (r *WhitelistRefresher) Stop() {
 
 func (r *WhitelistRefresher) refresh() {
 	for attempt := 0; attempt <= r.retryCount; attempt++ {
-		keys, err := r.keyRepo.GetAll(r.ctx)
+		started := time.Now()
+		records, err := r.keyRepo.GetAll(r.ctx)
+		r.observeFetch("full", started, err)
 		if err != nil {
 			// If context was cancelled, stop retrying immediately
 			if r.ctx.Err() != nil {
@@ -87,16 +152,67 @@ func (r *WhitelistRefresher) refresh() {
 			}
 			continue
 		}
-		r.whitelist.UpdateKeys(keys)
-		r.logger.Printf("whitelist refreshed with %d keys", len(keys))
+		records = r.overlayRecords(records, true)
+		ch := r.whitelist.UpdateRecords(records)
+		r.watermark = started.Add(-deltaOverlap).Unix()
 		if r.onRefresh != nil {
-			r.onRefresh(keys)
+			r.onRefresh(records, ch)
 		}
+		// Publish the generation last, so a client reacting to it already
+		// sees the rebuilt bloom filter.
+		var gen uint64
+		if r.loaded {
+			gen = r.changes.Append(ch)
+		} else {
+			gen = r.changes.Reset()
+			r.loaded = true
+		}
+		r.logger.Printf("whitelist refreshed with %d keys (+%d -%d, generation %d)", len(records), len(ch.Added), len(ch.Removed), gen)
 		return
 	}
 	r.logger.Printf("Refresh failed after %d attempts", r.retryCount+1)
 }
 
+// refreshDelta applies the records changed since the watermark. Failures are
+// only logged: the next tick retries from the same watermark, and the full
+// refresh is the backstop. Deltas wait for the initial full load.
+func (r *WhitelistRefresher) refreshDelta() {
+	if !r.loaded {
+		return
+	}
+	started := time.Now()
+	records, watermark, err := r.deltaRepo.GetChangedSince(r.ctx, r.watermark)
+	r.observeFetch("delta", started, err)
+	if err != nil {
+		if r.ctx.Err() == nil {
+			r.logger.Printf("Failed to fetch delta since %d: %v", r.watermark, err)
+		}
+		return
+	}
+	r.watermark = watermark
+
+	ch := r.whitelist.ApplyRecords(r.overlayRecords(records, false))
+	if ch.Len() == 0 {
+		return
+	}
+	if r.onDelta != nil {
+		r.onDelta(ch)
+	}
+	gen := r.changes.Append(ch)
+	r.logger.Printf("whitelist delta: %d changed, %d added (generation %d)", len(records), len(ch.Added), gen)
+}
+
+func (r *WhitelistRefresher) observeFetch(kind string, started time.Time, err error) {
+	if r.onFetch != nil {
+		r.onFetch(kind, time.Since(started), err)
+	}
+}
+
 func (r *WhitelistRefresher) Whitelist() *Whitelist {
 	return r.whitelist
 }
+
+// Changes returns the generation log the refresher appends to.
+func (r *WhitelistRefresher) Changes() *ChangeLog {
+	return r.changes
+}
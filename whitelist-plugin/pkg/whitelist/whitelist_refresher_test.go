@@ -3,31 +3,42 @@ package whitelist
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"slices"
 	"sync"
 	"testing"
 	"time"
+	"whitelist-plugin/pkg/repository"
 )
 
 // mockKeyRepo is a custom mock for repository.KeyRepository.
 // It allows controlling fetch results, errors, delays, and tracking calls.
 type mockKeyRepo struct {
 	keys      [][32]byte
+	records   []repository.Record // returned as-is when set; otherwise keys are wrapped
 	err       error
 	delay     time.Duration
 	callCount int
 	mu        sync.Mutex
 }
 
-func (m *mockKeyRepo) GetAll(_ context.Context) ([][32]byte, error) {
+func (m *mockKeyRepo) GetAll(_ context.Context) ([]repository.Record, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.callCount++
 	if m.delay > 0 {
 		time.Sleep(m.delay)
 	}
-	return m.keys, m.err
+	if m.records != nil {
+		return m.records, m.err
+	}
+	records := make([]repository.Record, len(m.keys))
+	for i, k := range m.keys {
+		records[i] = repository.Record{Pubkey: k, Distance: repository.NoDistance}
+	}
+	return records, m.err
 }
 
 func (m *mockKeyRepo) getCallCount() int {
@@ -94,6 +105,137 @@ func TestWhitelistRefresher_refresh_Success(t *testing.T) {
 	}
 }
 
+func TestWhitelistRefresher_refresh_SwapsScores(t *testing.T) {
+	seed := repository.Record{Pubkey: [32]byte{1}, Distance: 0}
+	mockRepo := &mockKeyRepo{records: []repository.Record{seed}}
+	logger := log.New(os.Stdout, "test", log.LstdFlags)
+	refresher := NewWhitelistRefresher(context.Background(), mockRepo, 1*time.Hour, 0, logger)
+
+	var got []repository.Record
+	var gotChanges Changes
+	refresher.SetOnRefresh(func(records []repository.Record, ch Changes) { got, gotChanges = records, ch })
+	refresher.refresh()
+
+	const seedHex = "0100000000000000000000000000000000000000000000000000000000000000"
+	if e, ok := refresher.whitelist.Lookup(seedHex); !ok || e.Tier != TierHigh {
+		t.Fatalf("Lookup(seed) = %+v, %v; want TierHigh, true", e, ok)
+	}
+	if len(got) != 1 || len(gotChanges.Added) != 1 {
+		t.Errorf("onRefresh got %d records, %d added; want 1, 1", len(got), len(gotChanges.Added))
+	}
+
+	// A later refresh that demotes the node replaces its entry wholesale.
+	mockRepo.mu.Lock()
+	mockRepo.records = []repository.Record{{Pubkey: [32]byte{1}, Distance: repository.NoDistance, Flagged: true}}
+	mockRepo.mu.Unlock()
+	refresher.refresh()
+
+	if e, ok := refresher.whitelist.Lookup(seedHex); !ok || e.Tier != TierLow {
+		t.Errorf("Lookup(seed) after demotion = %+v, %v; want TierLow, true", e, ok)
+	}
+}
+
+// mockDeltaRepo adds GetChangedSince to mockKeyRepo.
+type mockDeltaRepo struct {
+	mockKeyRepo
+	delta     []repository.Record
+	deltaErr  error
+	watermark int64
+	since     []int64
+}
+
+func (m *mockDeltaRepo) GetChangedSince(_ context.Context, since int64) ([]repository.Record, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.since = append(m.since, since)
+	if m.deltaErr != nil {
+		return nil, since, m.deltaErr
+	}
+	return m.delta, m.watermark, nil
+}
+
+func TestWhitelistRefresher_refreshDelta(t *testing.T) {
+	repo := &mockDeltaRepo{mockKeyRepo: mockKeyRepo{keys: [][32]byte{{1}}}}
+	logger := log.New(os.Stdout, "test", log.LstdFlags)
+	refresher := NewWhitelistRefresher(context.Background(), repo, 1*time.Hour, 0, logger)
+	refresher.SetDeltaInterval(time.Second)
+	if refresher.deltaRepo == nil {
+		t.Fatal("expected delta refreshes to be enabled for a DeltaRepository")
+	}
+	var deltas []Changes
+	refresher.SetOnDelta(func(ch Changes) { deltas = append(deltas, ch) })
+
+	// Deltas wait for the initial full load.
+	refresher.refreshDelta()
+	if len(repo.since) != 0 {
+		t.Fatal("delta ran before the initial load")
+	}
+
+	before := time.Now().Add(-deltaOverlap).Unix()
+	refresher.refresh()
+	base := refresher.Changes().Generation()
+	if refresher.watermark < before {
+		t.Errorf("watermark %d is before the full refresh started (%d)", refresher.watermark, before)
+	}
+
+	repo.delta = []repository.Record{
+		{Pubkey: [32]byte{1}, Distance: 0},                     // re-scored, already present
+		{Pubkey: [32]byte{2}, Distance: repository.NoDistance}, // new
+	}
+	repo.watermark = 1800000000
+	refresher.refreshDelta()
+
+	if refresher.watermark != 1800000000 {
+		t.Errorf("watermark = %d, want 1800000000", refresher.watermark)
+	}
+	if refresher.whitelist.Len() != 2 {
+		t.Errorf("whitelist has %d keys, want 2", refresher.whitelist.Len())
+	}
+	if e, _ := refresher.whitelist.Lookup("0100000000000000000000000000000000000000000000000000000000000000"); e.Tier != TierHigh {
+		t.Errorf("re-scored entry tier = %v, want high", e.Tier)
+	}
+	if len(deltas) != 1 || !sameKeys(deltas[0].Added, [][32]byte{{2}}) {
+		t.Fatalf("onDelta got %+v, want one change adding key 2", deltas)
+	}
+	ch, _, ok := refresher.Changes().Since(base)
+	if !ok || !sameKeys(ch.Added, [][32]byte{{2}}) {
+		t.Errorf("Changes().Since(base) = %+v, %v", ch, ok)
+	}
+
+	// A failed delta keeps the watermark for the next tick.
+	repo.deltaErr = errors.New("dgraph down")
+	refresher.refreshDelta()
+	if refresher.watermark != 1800000000 {
+		t.Errorf("watermark moved on error: %d", refresher.watermark)
+	}
+}
+
+func TestWhitelistRefresher_refresh_RecordsRemovals(t *testing.T) {
+	repo := &mockKeyRepo{keys: [][32]byte{{1}, {2}}}
+	logger := log.New(os.Stdout, "test", log.LstdFlags)
+	refresher := NewWhitelistRefresher(context.Background(), repo, 1*time.Hour, 0, logger)
+	refresher.refresh()
+	base := refresher.Changes().Generation()
+
+	repo.mu.Lock()
+	repo.keys = [][32]byte{{2}, {3}}
+	repo.mu.Unlock()
+	refresher.refresh()
+
+	ch, _, ok := refresher.Changes().Since(base)
+	if !ok || !sameKeys(ch.Added, [][32]byte{{3}}) || !sameKeys(ch.Removed, [][32]byte{{1}}) {
+		t.Fatalf("Changes().Since(base) = %+v, %v", ch, ok)
+	}
+}
+
+func TestWhitelistRefresher_SetDeltaInterval_PlainRepo(t *testing.T) {
+	refresher := NewWhitelistRefresher(context.Background(), &mockKeyRepo{}, 1*time.Hour, 0, log.New(os.Stdout, "test", log.LstdFlags))
+	refresher.SetDeltaInterval(time.Second)
+	if refresher.deltaRepo != nil {
+		t.Error("delta refreshes enabled for a repository without GetChangedSince")
+	}
+}
+
 func TestWhitelistRefresher_refresh_Failure_NoRetry(t *testing.T) {
 	mockRepo := &mockKeyRepo{err: errors.New("db error")}
 	logger := log.New(os.Stdout, "test", log.LstdFlags)
@@ -119,6 +261,25 @@ func TestWhitelistRefresher_refresh_Failure_WithRetry(t *testing.T) {
 	}
 }
 
+func TestWhitelistRefresher_OnFetch(t *testing.T) {
+	repo := &mockDeltaRepo{mockKeyRepo: mockKeyRepo{err: errors.New("db error")}}
+	refresher := NewWhitelistRefresher(context.Background(), repo, 1*time.Hour, 0, log.New(os.Stdout, "test", log.LstdFlags))
+	refresher.SetDeltaInterval(time.Hour)
+	var fetches []string
+	refresher.SetOnFetch(func(kind string, _ time.Duration, err error) {
+		fetches = append(fetches, fmt.Sprintf("%s:%v", kind, err != nil))
+	})
+
+	refresher.refresh()
+	repo.err = nil
+	refresher.refresh()
+	refresher.refreshDelta()
+
+	if want := []string{"full:true", "full:false", "delta:false"}; !slices.Equal(fetches, want) {
+		t.Errorf("fetches = %v, want %v", fetches, want)
+	}
+}
+
 func TestWhitelistRefresher_refresh_SuccessAfterRetry(t *testing.T) {
 	mockRepo := &mockKeyRepo{keys: [][32]byte{{2}}, err: errors.New("db error")}
 	logger := log.New(os.Stdout, "test", log.LstdFlags)